@@ -29,7 +29,15 @@ func buildImage(
 	boot, cdrom string,
 	linuxBootOptions vm.LinuxBootOptions,
 	size int,
+	saveState bool,
 ) error {
+	// Saved state can only be restored on a virtual machine without cd-roms
+	if saveState && (boot != "" || cdrom != "" || linuxBootOptions != (vm.LinuxBootOptions{})) {
+		err := errors.New("saving state is not possible with boot options or cd-roms")
+		monitor.Error(err)
+		return err
+	}
+
 	// Find absolute outputFile
 	outputFile, err := filepath.Abs(outputFile)
 	if err != nil {
@@ -69,6 +77,12 @@ func buildImage(
 		}
 	}
 
+	// Additional drives are not attached when building images
+	if len(img.Machine().Drives()) > 0 {
+		monitor.Error("Machine definitions with 'drives' are not supported by qemu-build")
+		return errors.New("machine definition with additional drives is not supported")
+	}
+
 	// Create temp folder for sockets
 	socketFolder, err := ioutil.TempDir("", "taskcluster-worker-sockets-")
 	if err != nil {
@@ -87,12 +101,17 @@ func buildImage(
 
 	// Setup logService so that logs can be posted to meta-service at:
 	// http://169.254.169.254/engine/v1/log
-	net.SetHandler(&logService{Destination: os.Stdout})
+	// If saving state, ready is closed when guest-tools is ready to run a task
+	var ready chan struct{}
+	if saveState {
+		ready = make(chan struct{})
+	}
+	net.SetHandler(&logService{Destination: os.Stdout, Ready: ready})
 
 	// Create virtual machine
 	monitor.Info("Creating virtual machine")
 	machine, err := vm.NewVirtualMachine(
-		img.Machine().DeriveLimits(), img, net, socketFolder,
+		img.Machine().DeriveLimits(), img, net, nil, socketFolder,
 		boot, cdrom, linuxBootOptions,
 		monitor.WithTag("component", "vm"),
 	)
@@ -121,6 +140,12 @@ func buildImage(
 		err = errors.New("SIGINT received, aborting virtual machine")
 	case <-machine.Done:
 		err = machine.Error
+	case <-ready:
+		monitor.Info("Guest-tools is ready, saving virtual machine state")
+		err = img.SaveState(machine)
+		if err != nil {
+			machine.Kill()
+		}
 	}
 	<-machine.Done
 	signal.Stop(interrupted)
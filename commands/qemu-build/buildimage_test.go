@@ -3,13 +3,19 @@
 package qemubuild
 
 import (
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"testing"
 
+	"github.com/stretchr/testify/require"
 	"github.com/taskcluster/slugid-go/slugid"
+	"github.com/taskcluster/taskcluster-worker/engines/enginetest"
+	_ "github.com/taskcluster/taskcluster-worker/engines/qemu"
 	"github.com/taskcluster/taskcluster-worker/engines/qemu/vm"
 	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
 )
@@ -48,9 +54,60 @@ func TestBuildImage(t *testing.T) {
 
 	err = buildImage(
 		monitor, inputImageFile, outputFile,
-		true, vncPort, isofile, cdrom, vm.LinuxBootOptions{}, 1,
+		true, vncPort, isofile, cdrom, vm.LinuxBootOptions{}, 1, false,
 	)
 	if err != nil {
 		panic(err)
 	}
 }
+
+func TestBuildImageWithSavedState(t *testing.T) {
+	monitor := mocks.NewMockMonitor(true)
+
+	inputImageFile, err := filepath.Abs("../../engines/qemu/test-image/tinycore-worker.tar.zst")
+	require.NoError(t, err)
+	outputFile := filepath.Join(os.TempDir(), slugid.Nice())
+	defer os.Remove(outputFile)
+
+	// Boot the image and save state when guest-tools is ready
+	err = buildImage(
+		monitor, inputImageFile, outputFile,
+		true, 0, "", "", vm.LinuxBootOptions{}, 1, true,
+	)
+	require.NoError(t, err)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, outputFile)
+	}))
+	defer s.Close()
+
+	// Run tasks restoring the saved state, and booting from disk
+	for _, restore := range []bool{true, false} {
+		provider := &enginetest.EngineProvider{
+			Engine: "qemu",
+			Config: fmt.Sprintf(`{
+				"network": {
+					"subnets": 1
+				},
+				"limits": {
+					"maxMemory": 256,
+					"maxCPUs": 1,
+					"defaultThreads": 1,
+					"accelerator": "auto"
+				},
+				"restoreSavedState": %v
+			}`, restore),
+		}
+		provider.SetupEngine()
+		c := enginetest.LoggingTestCase{
+			EngineProvider: provider,
+			Target:         "hello-world",
+			TargetPayload: `{
+				"image": "` + s.URL + `",
+				"command": ["sh", "-c", "echo 'hello-world' && true"]
+			}`,
+		}
+		c.TestLogTarget()
+		provider.TearDownEngine()
+	}
+}
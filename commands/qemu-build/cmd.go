@@ -31,6 +31,10 @@ options:
      --kernel <image>   Multi-boot option -kernel for QEMU.
      --append <cmdline> Multi-boot option -append for QEMU.
      --initrd <file>    Multi-boot option -initrd for QEMU.
+     --save-state       Save virtual machine state when guest-tools requests a
+                        command to execute, instead of waiting for shutdown.
+                        Tasks will resume from the saved state instead of
+                        booting. This cannot be used with cd-roms.
   -h --help             Show this screen.
 `
 }
@@ -77,6 +81,6 @@ func (cmd) Execute(arguments map[string]interface{}) bool {
 		monitor, inputFile, outputFile,
 		fromImage, int(vncPort),
 		boot, cdrom, linuxBootOptions,
-		int(size),
+		int(size), arguments["--save-state"].(bool),
 	) == nil
 }
@@ -3,12 +3,19 @@ package qemubuild
 import (
 	"io"
 	"net/http"
+	"sync"
 )
 
 // logService is a minimalistic implementation of metadata service that allows
 // for streaming out logs. This is useful for when we do automatic image builds.
+//
+// If Ready is non-nil, it is closed when guest-tools requests
+// GET /engine/v1/execute, and the request is left hanging. This is used to
+// save the virtual machine state when guest-tools is ready to run a task.
 type logService struct {
 	Destination io.Writer
+	Ready       chan<- struct{}
+	once        sync.Once
 }
 
 func (l *logService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -23,6 +30,12 @@ func (l *logService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.Method == http.MethodGet && r.URL.Path == "/engine/v1/execute" && l.Ready != nil {
+		l.once.Do(func() { close(l.Ready) })
+		<-r.Context().Done()
+		return
+	}
+
 	if r.Method == http.MethodGet && r.URL.Path == "/engine/v1/ping" {
 		w.WriteHeader(http.StatusOK)
 		return
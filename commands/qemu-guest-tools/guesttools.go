@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
@@ -111,6 +112,7 @@ func (g *guestTools) Run() {
 	}
 
 	result := "failed"
+	var report []byte // ExitReport, if the command was executed
 	var proc *system.Process
 
 	// Find user, if any
@@ -126,6 +128,13 @@ func (g *guestTools) Run() {
 		}
 	}
 
+	// Mount volumes, if any
+	if err = mountVolumes(task.Mounts); err != nil {
+		g.monitor.Error("Failed to mount volumes, error: ", err)
+		fmt.Fprintf(taskLog, "[taskcluster:error] %s\n", err)
+		goto resolved
+	}
+
 	// Execute the task
 	proc, err = system.StartProcess(system.ProcessOptions{
 		Arguments:     append(g.config.Entrypoint, task.Command...),
@@ -152,6 +161,17 @@ func (g *guestTools) Run() {
 			result = "success"
 		}
 		close(done)
+
+		code, signal := proc.ExitStatus()
+		usage := proc.ResourceUsage()
+		report, _ = json.Marshal(metaservice.ExitReport{
+			ExitCode:   code,
+			Signal:     signal,
+			WallTime:   int64(usage.WallTime / time.Millisecond),
+			UserTime:   int64(usage.UserTime / time.Millisecond),
+			SystemTime: int64(usage.SystemTime / time.Millisecond),
+			MaxMemory:  usage.MaxMemory,
+		})
 	}
 
 resolved:
@@ -166,7 +186,7 @@ resolved:
 	<-logSent
 
 	// Report result
-	res, err := g.got.Put(g.url("engine/v1/"+result), nil).Send()
+	res, err := g.got.Put(g.url("engine/v1/"+result), report).Send()
 	if err != nil {
 		g.monitor.Println("Failed to report result ", result, ", error: ", err)
 	} else if res.StatusCode != http.StatusOK {
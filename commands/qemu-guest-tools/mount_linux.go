@@ -0,0 +1,33 @@
+package qemuguesttools
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/engines/qemu/metaservice"
+)
+
+// mountVolumes mounts the virtio-9p devices given in mounts
+func mountVolumes(mounts []metaservice.Mount) error {
+	for _, m := range mounts {
+		if err := os.MkdirAll(m.Mountpoint, 0777); err != nil {
+			return errors.Wrapf(err, "failed to create mountpoint: %s", m.Mountpoint)
+		}
+		options := []string{"trans=virtio", "version=9p2000.L"}
+		if m.ReadOnly {
+			options = append(options, "ro")
+		}
+		out, err := exec.Command(
+			"mount", "-t", "9p", "-o", strings.Join(options, ","), m.Tag, m.Mountpoint,
+		).CombinedOutput()
+		if err != nil {
+			return errors.Errorf(
+				"failed to mount volume at %s, error: %s, output: %s",
+				m.Mountpoint, err, strings.TrimSpace(string(out)),
+			)
+		}
+	}
+	return nil
+}
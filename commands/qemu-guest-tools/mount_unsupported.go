@@ -0,0 +1,18 @@
+// +build !linux
+
+package qemuguesttools
+
+import (
+	"errors"
+
+	"github.com/taskcluster/taskcluster-worker/engines/qemu/metaservice"
+)
+
+// mountVolumes returns an error if there is any mounts, as virtio-9p is only
+// supported on linux guests.
+func mountVolumes(mounts []metaservice.Mount) error {
+	if len(mounts) > 0 {
+		return errors.New("volumes are not supported on this guest platform")
+	}
+	return nil
+}
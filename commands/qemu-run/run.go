@@ -98,7 +98,7 @@ func (cmd) Execute(arguments map[string]interface{}) bool {
 
 	// Get an instance of the image
 	monitor.Info("Creating instance of image")
-	image, err := manager.Instance("image", func(target *os.File) error {
+	inst, err := manager.Instance("image", func(target *os.File) error {
 		f, ferr := os.Open(imageFile)
 		if ferr != nil {
 			return ferr
@@ -118,10 +118,34 @@ func (cmd) Execute(arguments map[string]interface{}) bool {
 		monitor.Panic("Failed to create user-space network, error: ", err)
 	}
 
+	// Create files for additional drives, ISO files for cdrom drives aren't
+	// fetched by qemu-run, so these are not supported.
+	var img vm.Image = inst
+	if drives := inst.Machine().Drives(); len(drives) > 0 {
+		monitor.Info("Creating additional drives")
+		maxSize := int64(inst.Machine().DeriveLimits().MaxDriveSize) * 1024 * 1024
+		files := make([]string, len(drives))
+		for i, d := range drives {
+			files[i] = filepath.Join(tempFolder, fmt.Sprintf("drive-%d", i))
+			switch d.Type {
+			case vm.DriveScratch:
+				err = image.CreateScratchDisk(files[i], d.Size)
+			case vm.DriveData:
+				err = inst.CreateDataDisk(d.File, files[i], maxSize)
+			default:
+				err = fmt.Errorf("drives of type '%s' are not supported by qemu-run", d.Type)
+			}
+			if err != nil {
+				monitor.Panic("Failed to create drive, error: ", err)
+			}
+		}
+		img = vm.AttachDrives(inst, files, func() {})
+	}
+
 	// Create virtual machine
 	monitor.Info("Creating virtual machine")
 	vm, err := vm.NewVirtualMachine(
-		image.Machine().DeriveLimits(), image, net, tempFolder,
+		img.Machine().DeriveLimits(), img, net, nil, tempFolder,
 		"", "", vm.LinuxBootOptions{},
 		monitor.WithTag("component", "vm"),
 	)
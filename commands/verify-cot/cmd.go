@@ -0,0 +1,114 @@
+package verifycot
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/openpgp"
+
+	"github.com/taskcluster/taskcluster-worker/commands"
+)
+
+func init() {
+	commands.Register("verify-cot", cmd{})
+}
+
+type cmd struct{}
+
+func (cmd) Summary() string {
+	return "Verify chain-of-trust certificate and artifact hashes"
+}
+
+func (cmd) Usage() string {
+	return `
+taskcluster-worker verify-cot verifies the signature of a chain-of-trust
+certificate downloaded from a task, and optionally the hashes of artifacts
+downloaded from the same task. This is done offline, given the public key
+matching the key the worker signs certificates with.
+
+Certificates with 'chainOfTrustVersion: 2' are verified using a detached
+ed25519 signature, while certificates with 'chainOfTrustVersion: 1' are
+clear-signed with OpenPGP.
+
+usage:
+  taskcluster-worker verify-cot [options] <certificate>
+
+options:
+  --public-key <key>    Base64 encoded ed25519 public key (version 2).
+  --signature <file>    Detached ed25519 signature (version 2), defaults to
+                        <certificate> with '.sig' appended.
+  --gpg-key <file>      File with armored OpenPGP public key (version 1).
+  --artifacts <folder>  Folder with downloaded artifacts, if given artifact
+                        hashes are verified against the files in <folder>
+                        with path given by artifact name.
+  --allow-missing       Ignore artifacts missing from <folder>.
+  -h --help             Show this screen.
+`
+}
+
+func (cmd) Execute(arguments map[string]interface{}) bool {
+	certFile := arguments["<certificate>"].(string)
+	publicKey, _ := arguments["--public-key"].(string)
+	signatureFile, _ := arguments["--signature"].(string)
+	gpgKeyFile, _ := arguments["--gpg-key"].(string)
+	artifactFolder, _ := arguments["--artifacts"].(string)
+	allowMissing := arguments["--allow-missing"].(bool)
+
+	if (publicKey == "") == (gpgKeyFile == "") {
+		fmt.Fprintln(os.Stderr, "exactly one of --public-key and --gpg-key must be given")
+		return false
+	}
+
+	data, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to read certificate, error: %s\n", err)
+		return false
+	}
+
+	// Verify signature
+	var cert *certificate
+	if publicKey != "" {
+		key, kerr := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+		if kerr != nil || len(key) != ed25519.PublicKeySize {
+			fmt.Fprintln(os.Stderr, "--public-key must be a base64 encoded ed25519 public key")
+			return false
+		}
+		if signatureFile == "" {
+			signatureFile = certFile + ".sig"
+		}
+		signature, serr := ioutil.ReadFile(signatureFile)
+		if serr != nil {
+			fmt.Fprintf(os.Stderr, "failed to read signature, error: %s\n", serr)
+			return false
+		}
+		cert, err = verifyEd25519(data, signature, ed25519.PublicKey(key))
+	} else {
+		f, ferr := os.Open(gpgKeyFile)
+		if ferr != nil {
+			fmt.Fprintf(os.Stderr, "failed to open --gpg-key, error: %s\n", ferr)
+			return false
+		}
+		keyring, kerr := openpgp.ReadArmoredKeyRing(f)
+		f.Close()
+		if kerr != nil {
+			fmt.Fprintf(os.Stderr, "failed to read --gpg-key, error: %s\n", kerr)
+			return false
+		}
+		cert, err = verifyClearsigned(data, keyring)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid certificate: %s\n", err)
+		return false
+	}
+	fmt.Printf("verified certificate for taskId: %s, runId: %d\n", cert.TaskID, cert.RunID)
+
+	// Verify artifacts, if a folder was given
+	if artifactFolder != "" {
+		return verifyArtifacts(cert, artifactFolder, allowMissing, os.Stdout)
+	}
+	return true
+}
@@ -0,0 +1,7 @@
+// Package verifycot provides a CommandProvider that verifies chain-of-trust
+// certificates and the hashes of downloaded artifacts offline.
+package verifycot
+
+import "github.com/taskcluster/taskcluster-worker/runtime/util"
+
+var debug = util.Debug("verifycot")
@@ -0,0 +1,139 @@
+package verifycot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+
+	"github.com/pkg/errors"
+)
+
+// certificate is the subset of a chain-of-trust certificate we need
+type certificate struct {
+	Version   int    `json:"chainOfTrustVersion"`
+	TaskID    string `json:"taskId"`
+	RunID     int    `json:"runId"`
+	Artifacts map[string]struct {
+		Sha256           string `json:"sha256"`
+		ContentEncoding  string `json:"contentEncoding"`
+		CompressedSha256 string `json:"compressedSha256"`
+	} `json:"artifacts"`
+}
+
+func parseCertificate(data []byte, version int) (*certificate, error) {
+	var cert certificate
+	if err := json.Unmarshal(data, &cert); err != nil {
+		return nil, errors.Wrap(err, "certificate is not valid JSON")
+	}
+	if cert.Version != version {
+		return nil, fmt.Errorf(
+			"expected chainOfTrustVersion: %d, found: %d", version, cert.Version,
+		)
+	}
+	return &cert, nil
+}
+
+// verifyEd25519 verifies a version 2 certificate with detached signature
+func verifyEd25519(data, signature []byte, publicKey ed25519.PublicKey) (*certificate, error) {
+	if !ed25519.Verify(publicKey, data, signature) {
+		return nil, errors.New("ed25519 signature doesn't match certificate and public key")
+	}
+	return parseCertificate(data, 2)
+}
+
+// verifyClearsigned verifies a version 1 certificate clear-signed with OpenPGP
+func verifyClearsigned(data []byte, keyring openpgp.KeyRing) (*certificate, error) {
+	block, _ := clearsign.Decode(data)
+	if block == nil {
+		return nil, errors.New("certificate isn't clear-signed")
+	}
+	_, err := openpgp.CheckDetachedSignature(
+		keyring, bytes.NewReader(block.Bytes), block.ArmoredSignature.Body,
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "OpenPGP signature doesn't match certificate")
+	}
+	return parseCertificate(block.Plaintext, 1)
+}
+
+// verifyArtifacts verifies the hashes of artifacts from cert found in folder,
+// writing the result for each artifact to w. Returns true, if all artifacts
+// are valid.
+//
+// Artifacts uploaded with 'Content-Encoding: gzip' are accepted both as they
+// were stored and decompressed, as clients may or may not decompress them.
+func verifyArtifacts(cert *certificate, folder string, allowMissing bool, w io.Writer) bool {
+	names := make([]string, 0, len(cert.Artifacts))
+	for name := range cert.Artifacts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	valid := true
+	for _, name := range names {
+		a := cert.Artifacts[name]
+		hash, decompressedHash, err := hashFile(filepath.Join(folder, filepath.FromSlash(name)))
+		switch {
+		case os.IsNotExist(err) && allowMissing:
+			fmt.Fprintf(w, "missing:  %s\n", name)
+		case os.IsNotExist(err):
+			fmt.Fprintf(w, "missing:  %s\n", name)
+			valid = false
+		case err != nil:
+			fmt.Fprintf(w, "error:    %s (%s)\n", name, err)
+			valid = false
+		case hash == a.Sha256:
+			fmt.Fprintf(w, "valid:    %s\n", name)
+		case a.CompressedSha256 != "" && hash == a.CompressedSha256:
+			fmt.Fprintf(w, "valid:    %s (%s encoded)\n", name, a.ContentEncoding)
+		case decompressedHash != "" && decompressedHash == a.Sha256:
+			fmt.Fprintf(w, "valid:    %s (decompressed)\n", name)
+		default:
+			fmt.Fprintf(w, "invalid:  %s\n", name)
+			valid = false
+		}
+	}
+	return valid
+}
+
+// hashFile returns the sha256 of the file, and if the file is gzip compressed
+// the sha256 of the decompressed content.
+func hashFile(file string) (hash, decompressedHash string, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", "", err
+	}
+	hash = hex.EncodeToString(h.Sum(nil))
+
+	// Attempt to decompress, ignoring errors as the file may not be gzip'ed
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+	zr, zerr := gzip.NewReader(f)
+	if zerr != nil {
+		return hash, "", nil
+	}
+	h = sha256.New()
+	if _, zerr = io.Copy(h, zr); zerr != nil {
+		debug("failed to decompress '%s', error: %s", file, zerr)
+		return hash, "", nil
+	}
+	return hash, hex.EncodeToString(h.Sum(nil)), nil
+}
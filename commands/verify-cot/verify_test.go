@@ -0,0 +1,133 @@
+package verifycot
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+)
+
+func sha256hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// makeCertificate returns a certificate covering plain.txt and gzip'ed.txt,
+// along with a folder containing the artifacts.
+func makeCertificate(t *testing.T, version int) ([]byte, string) {
+	folder, err := ioutil.TempDir("", "verify-cot-test-")
+	require.NoError(t, err)
+
+	plain := []byte("hello world")
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write(plain)
+	require.NoError(t, zw.Close())
+
+	require.NoError(t, os.MkdirAll(filepath.Join(folder, "public"), 0777))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(folder, "public", "plain.txt"), plain, 0666))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(folder, "public", "gzip.txt"), compressed.Bytes(), 0666))
+
+	data, err := json.Marshal(map[string]interface{}{
+		"chainOfTrustVersion": version,
+		"taskId":              "my-task-id",
+		"runId":               0,
+		"artifacts": map[string]interface{}{
+			"public/plain.txt": map[string]string{
+				"sha256": sha256hex(plain),
+			},
+			"public/gzip.txt": map[string]string{
+				"sha256":           sha256hex(plain),
+				"contentEncoding":  "gzip",
+				"compressedSha256": sha256hex(compressed.Bytes()),
+			},
+		},
+	})
+	require.NoError(t, err)
+	return data, folder
+}
+
+func TestVerifyEd25519(t *testing.T) {
+	data, folder := makeCertificate(t, 2)
+	defer os.RemoveAll(folder)
+
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	signature := ed25519.Sign(private, data)
+
+	cert, err := verifyEd25519(data, signature, public)
+	require.NoError(t, err)
+	require.Equal(t, "my-task-id", cert.TaskID)
+	require.True(t, verifyArtifacts(cert, folder, false, ioutil.Discard))
+
+	// Tampered certificate
+	tampered := bytes.Replace(data, []byte("my-task-id"), []byte("other-task"), 1)
+	_, err = verifyEd25519(tampered, signature, public)
+	require.Error(t, err)
+
+	// Wrong key
+	other, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	_, err = verifyEd25519(data, signature, other)
+	require.Error(t, err)
+
+	// Version 1 certificate with ed25519 signature isn't allowed
+	data1, folder1 := makeCertificate(t, 1)
+	defer os.RemoveAll(folder1)
+	_, err = verifyEd25519(data1, ed25519.Sign(private, data1), public)
+	require.Error(t, err)
+}
+
+func TestVerifyArtifacts(t *testing.T) {
+	data, folder := makeCertificate(t, 2)
+	defer os.RemoveAll(folder)
+	cert, err := parseCertificate(data, 2)
+	require.NoError(t, err)
+
+	// Decompressed download of a gzip encoded artifact is valid
+	require.NoError(t, ioutil.WriteFile(filepath.Join(folder, "public", "gzip.txt"), []byte("hello world"), 0666))
+	require.True(t, verifyArtifacts(cert, folder, false, ioutil.Discard))
+
+	// Modified artifact is invalid
+	require.NoError(t, ioutil.WriteFile(filepath.Join(folder, "public", "plain.txt"), []byte("bad"), 0666))
+	require.False(t, verifyArtifacts(cert, folder, false, ioutil.Discard))
+
+	// Missing artifact is only invalid if not allowed
+	require.NoError(t, os.Remove(filepath.Join(folder, "public", "plain.txt")))
+	require.False(t, verifyArtifacts(cert, folder, false, ioutil.Discard))
+	require.True(t, verifyArtifacts(cert, folder, true, ioutil.Discard))
+}
+
+func TestVerifyClearsigned(t *testing.T) {
+	data, folder := makeCertificate(t, 1)
+	defer os.RemoveAll(folder)
+
+	entity, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	require.NoError(t, err)
+	var signed bytes.Buffer
+	w, err := clearsign.Encode(&signed, entity.PrivateKey, nil)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	cert, err := verifyClearsigned(signed.Bytes(), openpgp.EntityList{entity})
+	require.NoError(t, err)
+	require.Equal(t, 1, cert.Version)
+	require.True(t, verifyArtifacts(cert, folder, false, ioutil.Discard))
+
+	other, err := openpgp.NewEntity("other", "", "other@example.com", nil)
+	require.NoError(t, err)
+	_, err = verifyClearsigned(signed.Bytes(), openpgp.EntityList{other})
+	require.Error(t, err)
+}
@@ -82,6 +82,18 @@ type Engine interface {
 	// Non-fatal errors: MalformedPayloadError, ErrMaxConcurrencyExceeded.
 	NewSandboxBuilder(options SandboxOptions) (SandboxBuilder, error)
 
+	// ResourceReservation returns the resources a sandbox for the given payload
+	// is expected to use, allowing the worker to avoid claiming more tasks than
+	// it has capacity to run. Fields that are zero are unknown, and the worker
+	// will assume a configured default.
+	//
+	// The payload is the subset of keys from the payload that was declared in
+	// PayloadSchema(), and implementors can assume that it validates against
+	// this schema.
+	//
+	// Non-fatal errors: ErrFeatureNotSupported
+	ResourceReservation(payload map[string]interface{}) (Resources, error)
+
 	// VolumeSchema returns a JSON schema description of the volume options,
 	// accepted by this engine.
 	VolumeSchema() schematypes.Schema
@@ -133,6 +145,12 @@ type Capabilities struct {
 	// defaults, typically that a feature isn't supported.
 }
 
+// Resources is a set of resources reserved for a sandbox.
+type Resources struct {
+	Memory    int64 // Memory in bytes, zero if unknown
+	DiskSpace int64 // Disk space in bytes, zero if unknown
+}
+
 // EngineBase is a base implemenation of Engine. It will implement all optional
 // methods such that they return ErrFeatureNotSupported.
 //
@@ -159,6 +177,12 @@ func (EngineBase) Capabilities() Capabilities {
 	return Capabilities{}
 }
 
+// ResourceReservation returns ErrFeatureNotSupported indicating that the
+// engine doesn't know the resources used by sandboxes.
+func (EngineBase) ResourceReservation(payload map[string]interface{}) (Resources, error) {
+	return Resources{}, ErrFeatureNotSupported
+}
+
 // VolumeSchema returns an empty schematypes.Object indicating no options for
 // volume creation
 func (EngineBase) VolumeSchema() schematypes.Schema {
@@ -0,0 +1,126 @@
+package enginetest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+// A CheckpointTestCase tests if Sandbox.Checkpoint() works by invoking it
+// after Ready has been printed to log by Payload, and then resuming from the
+// checkpoint with the payload returned by ResumePayload, which must print
+// Target to log.
+type CheckpointTestCase struct {
+	*EngineProvider
+	// Artifact name the checkpoint is uploaded as
+	Artifact string
+	// String printed by Payload, when it is ready to be checkpointed
+	Ready string
+	// String printed after the task has been resumed
+	Target  string
+	Payload string
+	// Returns a payload resuming from the checkpoint available at url
+	ResumePayload func(url string) string
+	// Scopes required to resume from a checkpoint available at a url
+	ResumeScopes []string
+}
+
+// fileArtifactBackend is a runtime.ArtifactBackend that saves artifacts with
+// a given name to a file.
+type fileArtifactBackend struct {
+	name string
+	file string
+}
+
+func (b *fileArtifactBackend) UploadArtifact(context *runtime.TaskContext, artifact runtime.S3Artifact) error {
+	assert(artifact.Name == b.name, "Unexpected artifact uploaded: ", artifact.Name)
+	f, err := os.Create(b.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(f, artifact.Stream)
+	return err
+}
+
+// TestCheckpoint checks that the sandbox can be checkpointed
+func (c *CheckpointTestCase) TestCheckpoint() {
+	file := c.checkpoint()
+	os.Remove(file)
+}
+
+// TestResume checks that the task can be resumed from the checkpoint
+func (c *CheckpointTestCase) TestResume() {
+	file := c.checkpoint()
+	defer os.Remove(file)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, file)
+	}))
+	defer s.Close()
+
+	debug(" - New run")
+	r := c.newRun()
+	defer r.Dispose()
+	r.context.Scopes = c.ResumeScopes
+	debug(" - New sandbox builder resuming from checkpoint")
+	r.NewSandboxBuilder(c.ResumePayload(s.URL))
+	debug(" - Start sandbox and wait for result")
+	assert(r.buildRunSandbox(), "Expected resumed task to be successful")
+	assert(r.GrepLog(c.Target), "Expected Target in log after resuming, log: ", r.ReadLog())
+}
+
+// checkpoint runs Payload, creates a checkpoint and returns the file it was
+// saved to.
+func (c *CheckpointTestCase) checkpoint() string {
+	debug(" - New run")
+	r := c.newRun()
+	defer r.Dispose()
+
+	f, err := r.provider.environment.TemporaryStorage.NewFile()
+	nilOrPanic(err, "Failed to create temporary file")
+	f.Close()
+	r.control.SetArtifactBackend(&fileArtifactBackend{
+		name: c.Artifact,
+		file: f.Path(),
+	})
+
+	debug(" - New sandbox builder")
+	r.NewSandboxBuilder(c.Payload)
+	debug(" - Start sandbox")
+	r.StartSandbox()
+
+	debug(" - Wait for Ready to be printed")
+	r.OpenLogReader()
+	buf := bytes.Buffer{}
+	for !strings.Contains(buf.String(), c.Ready) {
+		b := []byte{0}
+		n, err := r.logReader.Read(b)
+		assert(n == 1, "Expected one byte to be read!")
+		buf.WriteByte(b[0])
+		nilOrPanic(err, "Failed while reading from livelog...")
+	}
+
+	debug(" - Checkpoint sandbox")
+	nilOrPanic(r.sandbox.Checkpoint(), "Sandbox.Checkpoint() returned an error")
+	_, err = r.sandbox.WaitForResult()
+	assert(err == engines.ErrSandboxAborted, "Expected ErrSandboxAborted after checkpoint, got: ", err)
+	r.sandbox = nil // resources are released by Checkpoint()
+
+	info, err := os.Stat(f.Path())
+	nilOrPanic(err, "Failed to stat checkpoint file")
+	assert(info.Size() > 0, "Expected checkpoint artifact to be uploaded")
+	return f.Path()
+}
+
+// Test runs all tests on the test case.
+func (c *CheckpointTestCase) Test() {
+	c.TestCheckpoint()
+	c.TestResume()
+}
@@ -0,0 +1,47 @@
+package enginetest
+
+// An ExitStatusTestCase tests that ResultSet.ExitStatus() returns the exit code
+// of the task command, and that ResultSet.ResourceUsage() reports the wall time
+// of the task command.
+type ExitStatusTestCase struct {
+	*EngineProvider
+	// Payload that exits zero
+	SuccessPayload string
+	// Payload that exits with ExitCode
+	FailingPayload string
+	// Exit code of FailingPayload, must be non-zero
+	ExitCode int
+}
+
+func (c ExitStatusTestCase) runAndCheck(payload string, code int) {
+	r := c.newRun()
+	defer r.Dispose()
+	r.NewSandboxBuilder(payload)
+	r.StartSandbox()
+	success := r.WaitForResult()
+	assert(success == (code == 0), "Expected success: ", code == 0)
+
+	status, err := r.resultSet.ExitStatus()
+	nilOrPanic(err, "ResultSet.ExitStatus() failed")
+	assert(status.Code == code, "Expected exit code ", code, " got ", status.Code)
+
+	usage, err := r.resultSet.ResourceUsage()
+	nilOrPanic(err, "ResultSet.ResourceUsage() failed")
+	assert(usage.WallTime > 0, "Expected ResourceUsage().WallTime > 0")
+}
+
+// TestExitZero checks that SuccessPayload has exit code zero
+func (c ExitStatusTestCase) TestExitZero() {
+	c.runAndCheck(c.SuccessPayload, 0)
+}
+
+// TestExitNonZero checks that FailingPayload has exit code ExitCode
+func (c ExitStatusTestCase) TestExitNonZero() {
+	c.runAndCheck(c.FailingPayload, c.ExitCode)
+}
+
+// Test runs all tests on the test case.
+func (c ExitStatusTestCase) Test() {
+	c.TestExitZero()
+	c.TestExitNonZero()
+}
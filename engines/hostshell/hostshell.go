@@ -0,0 +1,133 @@
+// Package hostshell implements engines.Shell for a process started on the
+// host, for engines that run interactive shells as host processes, possibly
+// entering the sandbox using a helper such as nsenter.
+package hostshell
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/engines/native/system"
+	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+var debug = util.Debug("hostshell")
+
+// Shell is an engines.Shell wrapping a system.Process
+type Shell struct {
+	process    *system.Process
+	isTTY      bool
+	stdin      io.WriteCloser
+	stdout     io.ReadCloser
+	stderr     io.ReadCloser
+	resolve    atomics.Once // Guarding result, resultErr and abortErr
+	result     bool
+	resultErr  error
+	abortErr   error
+	aborted    atomics.Bool
+	terminated atomics.Bool
+}
+
+// New starts a process with the given options and returns a Shell for it,
+// options.Stdin, options.Stdout and options.Stderr are replaced by pipes
+// exposed by the Shell.
+func New(options system.ProcessOptions) (*Shell, error) {
+	// Setup some pipes
+	pipein, stdin := io.Pipe()
+	stdout, pipeout := io.Pipe()
+	var stderr io.ReadCloser
+	var pipeerr io.WriteCloser
+	if !options.TTY {
+		stderr, pipeerr = io.Pipe()
+	} else {
+		// If doing a TTY we merge stderr and stdout, so stderr just becomes an
+		// empty stream as far as client is aware
+		stderr = ioutil.NopCloser(bytes.NewBuffer(nil))
+	}
+	options.Stdin = pipein
+	options.Stdout = pipeout
+	options.Stderr = pipeerr
+
+	process, err := system.StartProcess(options)
+	if err != nil {
+		return nil, err
+	}
+
+	shell := &Shell{
+		process: process,
+		isTTY:   options.TTY,
+		stdin:   stdin,
+		stdout:  stdout,
+		stderr:  stderr,
+	}
+
+	go shell.waitForResult()
+
+	return shell, nil
+}
+
+func (s *Shell) waitForResult() {
+	// wait for process to terminate
+	success := s.process.Wait()
+	debug("shell done")
+
+	s.resolve.Do(func() {
+		s.terminated.Set(true)
+		s.result = success
+		s.abortErr = engines.ErrShellTerminated
+	})
+}
+
+// StdinPipe returns the stdin of the shell
+func (s *Shell) StdinPipe() io.WriteCloser {
+	return s.stdin
+}
+
+// StdoutPipe returns the stdout of the shell
+func (s *Shell) StdoutPipe() io.ReadCloser {
+	return s.stdout
+}
+
+// StderrPipe returns the stderr of the shell, this is empty if running as TTY
+func (s *Shell) StderrPipe() io.ReadCloser {
+	return s.stderr
+}
+
+// SetSize of the TTY, returns ErrFeatureNotSupported if not running as TTY
+func (s *Shell) SetSize(columns, rows uint16) error {
+	// Best effort check if we've terminated
+	if s.aborted.Get() {
+		return engines.ErrSandboxAborted
+	}
+	if s.terminated.Get() {
+		return engines.ErrShellTerminated
+	}
+	// Feature not supported if not tty
+	if s.isTTY {
+		//TODO: Write a test case in system/ package to check that SetSize()
+		//      doesn't cause issues if called after Kill()
+		s.process.SetSize(columns, rows)
+		return nil
+	}
+	return engines.ErrFeatureNotSupported
+}
+
+// Abort kills the process tree of the shell
+func (s *Shell) Abort() error {
+	s.resolve.Do(func() {
+		s.terminated.Set(true)
+		system.KillProcessTree(s.process)
+		s.resultErr = engines.ErrShellAborted
+	})
+	s.resolve.Wait()
+	return s.abortErr
+}
+
+// Wait for the shell to terminate, returns true if it exited zero
+func (s *Shell) Wait() (bool, error) {
+	s.resolve.Wait()
+	return s.result, s.resultErr
+}
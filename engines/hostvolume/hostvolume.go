@@ -0,0 +1,124 @@
+// Package hostvolume implements engines.Volume and engines.VolumeBuilder as a
+// folder on the host, for engines that share folders with their sandboxes,
+// such as bind mounts or virtio-9p shared folders.
+package hostvolume
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
+)
+
+// Volume is a folder on the host, engines mount Path() in their sandboxes.
+type Volume struct {
+	engines.VolumeBase
+	folder   runtime.TemporaryFolder
+	disposed atomics.Once
+}
+
+// Builder writes files into a Volume before it is built.
+type Builder struct {
+	engines.VolumeBuilderBase
+	volume *Volume
+	built  atomics.Once
+}
+
+// New creates a new empty Volume in storage. If allowAllUsers is true, the
+// folder is made writable to all users, this is necessary when users in the
+// sandbox aren't mapped to the user owning the folder on the host.
+func New(storage runtime.TemporaryStorage, allowAllUsers bool) (*Volume, error) {
+	folder, err := storage.NewFolder()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create temporary folder for volume")
+	}
+	if allowAllUsers {
+		if err = os.Chmod(folder.Path(), 0777); err != nil {
+			folder.Remove()
+			return nil, errors.Wrap(err, "failed to set permissions on volume folder")
+		}
+	}
+	return &Volume{folder: folder}, nil
+}
+
+// NewBuilder creates a Builder for a new empty Volume, see New().
+func NewBuilder(storage runtime.TemporaryStorage, allowAllUsers bool) (*Builder, error) {
+	v, err := New(storage, allowAllUsers)
+	if err != nil {
+		return nil, err
+	}
+	return &Builder{volume: v}, nil
+}
+
+// Path returns the path to the folder on the host
+func (v *Volume) Path() string {
+	return v.folder.Path()
+}
+
+// Dispose removes the folder
+func (v *Volume) Dispose() error {
+	var err error
+	v.disposed.Do(func() {
+		err = v.folder.Remove()
+	})
+	return err
+}
+
+// filePath returns the path on the host for slash separated name in the
+// volume, cleaning name as an absolute path ensures it can't escape the volume.
+func (v *Volume) filePath(name string) string {
+	return filepath.Join(v.folder.Path(), filepath.FromSlash(path.Clean("/"+name)))
+}
+
+// WriteFolder creates the folder name and any parent folders
+func (b *Builder) WriteFolder(name string) error {
+	return os.MkdirAll(b.volume.filePath(name), 0777)
+}
+
+// errorWriter is an io.WriteCloser that always returns the given error.
+type errorWriter struct {
+	err error
+}
+
+func (w errorWriter) Write([]byte) (int, error) { return 0, w.err }
+func (w errorWriter) Close() error              { return w.err }
+
+// WriteFile creates the file name and any parent folders, errors are returned
+// from Write() and Close() on the io.WriteCloser returned.
+func (b *Builder) WriteFile(name string) io.WriteCloser {
+	p := b.volume.filePath(name)
+	if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+		return errorWriter{errors.Wrap(err, "failed to create parent folder")}
+	}
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return errorWriter{errors.Wrap(err, "failed to create file")}
+	}
+	return f
+}
+
+// BuildVolume returns the Volume, this may only be called once.
+func (b *Builder) BuildVolume() (engines.Volume, error) {
+	var v *Volume
+	b.built.Do(func() {
+		v = b.volume
+	})
+	if v == nil {
+		panic("VolumeBuilder.BuildVolume() called after BuildVolume() or Discard()")
+	}
+	return v, nil
+}
+
+// Discard removes the Volume, unless BuildVolume() has been called.
+func (b *Builder) Discard() error {
+	var err error
+	b.built.Do(func() {
+		err = b.volume.Dispose()
+	})
+	return err
+}
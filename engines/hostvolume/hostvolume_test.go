@@ -0,0 +1,68 @@
+package hostvolume
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+func TestBuildVolume(t *testing.T) {
+	storage := runtime.NewTemporaryTestFolderOrPanic()
+	defer storage.Remove()
+
+	b, err := NewBuilder(storage, true)
+	require.NoError(t, err)
+	require.NoError(t, b.WriteFolder("/a/b"))
+	w := b.WriteFile("a/c/hello.txt")
+	_, err = w.Write([]byte("hello world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	// Paths can't escape the volume
+	require.NoError(t, b.WriteFolder("../outside"))
+	w = b.WriteFile("/../../outside.txt")
+	_, err = w.Write([]byte("data"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	result, err := b.BuildVolume()
+	require.NoError(t, err)
+	v := result.(*Volume)
+	info, err := os.Stat(v.Path())
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0777), info.Mode().Perm())
+	data, err := ioutil.ReadFile(filepath.Join(v.Path(), "a", "c", "hello.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+	_, err = os.Stat(filepath.Join(v.Path(), "outside"))
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(v.Path(), "outside.txt"))
+	require.NoError(t, err)
+	assert.Panics(t, func() { b.BuildVolume() })
+
+	// Discard is a no-op after BuildVolume()
+	require.NoError(t, b.Discard())
+	_, err = os.Stat(v.Path())
+	require.NoError(t, err)
+
+	require.NoError(t, v.Dispose())
+	_, err = os.Stat(v.Path())
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDiscardVolume(t *testing.T) {
+	storage := runtime.NewTemporaryTestFolderOrPanic()
+	defer storage.Remove()
+
+	b, err := NewBuilder(storage, false)
+	require.NoError(t, err)
+	path := b.volume.Path()
+	require.NoError(t, b.Discard())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
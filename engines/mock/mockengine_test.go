@@ -166,3 +166,22 @@ var killTestCase = enginetest.KillTestCase{
 }
 
 func TestKill(t *t.T) { killTestCase.Test() }
+
+var exitStatusTestCase = enginetest.ExitStatusTestCase{
+	EngineProvider: provider,
+	SuccessPayload: `{
+    "delay": 0,
+    "function": "exit",
+    "argument": "0"
+  }`,
+	FailingPayload: `{
+    "delay": 0,
+    "function": "exit",
+    "argument": "3"
+  }`,
+	ExitCode: 3,
+}
+
+func TestExitZero(t *t.T)           { exitStatusTestCase.TestExitZero() }
+func TestExitNonZero(t *t.T)        { exitStatusTestCase.TestExitNonZero() }
+func TestExitStatusTestCase(t *t.T) { exitStatusTestCase.Test() }
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -41,8 +42,13 @@ type sandbox struct {
 	sessions    atomics.WaitGroup
 	shells      []engines.Shell
 	displays    []io.ReadWriteCloser
+	watchers    []io.ReadWriteCloser // displays from WatchDisplay()
+	terminated  bool                 // true, when watchers have been closed
 	resolve     atomics.Once
 	result      bool
+	exitCode    int
+	exited      bool // true, if function returned, false if killed
+	wallTime    time.Duration
 	resultErr   error
 	abortErr    error
 }
@@ -60,12 +66,22 @@ func (s *sandbox) abortSessions() {
 	for _, display := range s.displays {
 		display.Close()
 	}
+	s.closeWatchers()
+}
+
+// closeWatchers closes displays from WatchDisplay(), s must be locked.
+func (s *sandbox) closeWatchers() {
+	s.terminated = true
+	for _, display := range s.watchers {
+		display.Close()
+	}
 }
 
 func (s *sandbox) StartSandbox() (engines.Sandbox, error) {
 	s.Lock()
 	defer s.Unlock()
 
+	started := time.Now()
 	go func() {
 		// No need to lock access to payload, as it can't be mutated at this point
 		time.Sleep(time.Duration(s.payload.Delay) * time.Millisecond)
@@ -78,9 +94,18 @@ func (s *sandbox) StartSandbox() (engines.Sandbox, error) {
 		} else {
 			result, err = f(s, s.payload.Argument)
 		}
+		wallTime := time.Since(started)
 		s.sessions.WaitAndDrain()
+		s.Lock()
+		s.closeWatchers()
+		s.Unlock()
 		s.resolve.Do(func() {
 			s.result = result
+			if !result && s.exitCode == 0 {
+				s.exitCode = 1
+			}
+			s.exited = true
+			s.wallTime = wallTime
 			s.resultErr = err
 			s.abortErr = engines.ErrSandboxTerminated
 		})
@@ -152,6 +177,17 @@ func (s *sandbox) SetEnvironmentVariable(name string, value string) error {
 var functions = map[string]func(*sandbox, string) (bool, error){
 	"true":  func(s *sandbox, arg string) (bool, error) { return true, nil },
 	"false": func(s *sandbox, arg string) (bool, error) { return false, nil },
+	"exit": func(s *sandbox, arg string) (bool, error) {
+		// Parse arg as: <exitCode>
+		code, err := strconv.Atoi(arg)
+		if err != nil || code < 0 || code > 255 {
+			return false, runtime.NewMalformedPayloadError(
+				"MockEngine function 'exit' requires an exit code as argument, got: '", arg, "'",
+			)
+		}
+		s.exitCode = code
+		return code == 0, nil
+	},
 	"write-volume": func(s *sandbox, arg string) (bool, error) {
 		// Parse arg as: <mountPoint>/<file_name>:<fileData>
 		args := strings.SplitN(arg, "/", 2)
@@ -332,6 +368,21 @@ func (s *sandbox) OpenDisplay(name string) (io.ReadWriteCloser, error) {
 	return d, nil
 }
 
+func (s *sandbox) WatchDisplay(name string) (io.ReadWriteCloser, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if name != "MockDisplay" {
+		return nil, engines.ErrNoSuchDisplay
+	}
+	if s.terminated {
+		return nil, engines.ErrSandboxTerminated
+	}
+	d := newMockDisplay()
+	s.watchers = append(s.watchers, d)
+	return d, nil
+}
+
 ///////////////////////////// Implementation of ResultSet interface
 
 func (s *sandbox) ExtractFile(path string) (ioext.ReadSeekCloser, error) {
@@ -380,3 +431,19 @@ func (s *sandbox) Success() bool {
 	// No need to lock access as result is immutable
 	return s.result
 }
+
+func (s *sandbox) ExitStatus() (engines.ExitStatus, error) {
+	// No need to lock access as exitCode is immutable
+	if !s.exited {
+		return engines.ExitStatus{}, engines.ErrResourceNotFound
+	}
+	return engines.ExitStatus{Code: s.exitCode}, nil
+}
+
+func (s *sandbox) ResourceUsage() (engines.ResourceUsage, error) {
+	// No need to lock access as wallTime is immutable
+	if !s.exited {
+		return engines.ResourceUsage{}, engines.ErrResourceNotFound
+	}
+	return engines.ResourceUsage{WallTime: s.wallTime}, nil
+}
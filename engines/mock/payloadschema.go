@@ -29,6 +29,7 @@ var payloadSchema = schematypes.Object{
 			Options: []string{
 				"true",
 				"false",
+				"exit",
 				"write-volume",
 				"read-volume",
 				"get-url",
@@ -0,0 +1,71 @@
+// +build linux
+
+package namespaceengine
+
+import (
+	"math"
+
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+type configType struct {
+	MaxConcurrency int               `json:"maxConcurrency"`
+	UserNamespace  userNamespaceType `json:"userNamespace"`
+}
+
+type userNamespaceType struct {
+	HostID int `json:"hostId"`
+	Size   int `json:"size"`
+}
+
+// Default range of host uids/gids that users in containers are mapped to
+const (
+	defaultUserNamespaceHostID = 100000
+	defaultUserNamespaceSize   = 65536
+)
+
+var configSchema = schematypes.Object{
+	Title: "Namespace Engine Config",
+	Description: util.Markdown(`
+		Configuration for the namespace engine, this engine runs each task in
+		fresh Linux namespaces with a root file system given in the task payload.
+	`),
+	Properties: schematypes.Properties{
+		"maxConcurrency": schematypes.Integer{
+			Title: "Max Concurrency",
+			Description: util.Markdown(`
+				Maximum number of containers to run in parallel. Each container is
+				given a virtual ethernet pair with a '/30' subnet from
+				'100.99.0.0/16', hence, this cannot exceed 16384.
+			`),
+			Minimum: 1,
+			Maximum: maxNetworks,
+		},
+		"userNamespace": schematypes.Object{
+			Title: "User Namespace",
+			Description: util.Markdown(`
+				Range of uids and gids on the host that users in containers are
+				mapped to, uid 0 in the container is mapped to 'hostId'. Files
+				in the rootfs are owned by the mapped ids on the host, so this range
+				should not overlap with users on the host.
+
+				Defaults to 65536 ids starting from 100000, if not specified.
+			`),
+			Properties: schematypes.Properties{
+				"hostId": schematypes.Integer{
+					Title:   "First Host ID",
+					Minimum: 1,
+					Maximum: math.MaxInt32,
+				},
+				"size": schematypes.Integer{
+					Title:   "Number of IDs",
+					Minimum: 1,
+					Maximum: math.MaxInt32,
+				},
+			},
+			Required: []string{"hostId", "size"},
+		},
+	},
+	Required: []string{"maxConcurrency"},
+}
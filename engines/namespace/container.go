@@ -0,0 +1,185 @@
+// +build linux
+
+package namespaceengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
+)
+
+// initProcessName is given as os.Args[0], when the worker re-executes itself
+// as init process for a container.
+const initProcessName = "taskcluster-worker-namespace-init"
+
+// Namespaces created for each container, the user namespace ensures that root
+// in the container is an unprivileged user on the host.
+const cloneFlags = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+	syscall.CLONE_NEWNET | syscall.CLONE_NEWUTS | syscall.CLONE_NEWIPC
+
+// File descriptors for pipes given to the init process
+const (
+	initConfigFd = 3 // JSON encoded initConfig is read from here
+	initErrorFd  = 4 // JSON encoded initError is written here, if exec fails
+)
+
+// initConfig is the configuration sent to the container init process.
+type initConfig struct {
+	Rootfs     string      `json:"rootfs"`     // Host path to rootfs
+	Hostname   string      `json:"hostname"`   // Hostname inside the container
+	Command    []string    `json:"command"`    // Command to exec
+	Env        []string    `json:"env"`        // Environment for the command
+	WorkingDir string      `json:"workingDir"` // Working directory inside rootfs
+	Mounts     []initMount `json:"mounts"`     // Volumes to bind mount
+	IPCommand  string      `json:"ipCommand"`  // Host path to 'ip' from iproute2
+	Interface  string      `json:"interface"`  // Container end of veth pair
+	Address    string      `json:"address"`    // CIDR address for interface
+}
+
+type initMount struct {
+	Source   string `json:"source"`   // Host path to bind mount
+	Target   string `json:"target"`   // Mountpoint inside rootfs
+	ReadOnly bool   `json:"readOnly"` // True, if mount should be read-only
+}
+
+// initError is written to the error pipe, if the init process fails.
+type initError struct {
+	Stage   string `json:"stage"` // 'setup' or 'exec'
+	Message string `json:"message"`
+}
+
+// container is the init process of a container, after configuration this
+// process will exec the task command, and become PID 1 in the container.
+type container struct {
+	cmd          *exec.Cmd
+	configWriter *os.File
+	errorReader  *os.File
+	resolve      atomics.Once
+	success      bool
+}
+
+// startContainer starts an init process in new namespaces, this process will
+// wait for Configure() to be called. Users in the container are mapped to host
+// ids given by userNamespace.
+func startContainer(stdout io.Writer, userNamespace userNamespaceType) (*container, error) {
+	configReader, configWriter, err := os.Pipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create config pipe")
+	}
+	errorReader, errorWriter, err := os.Pipe()
+	if err != nil {
+		configReader.Close()
+		configWriter.Close()
+		return nil, errors.Wrap(err, "failed to create error pipe")
+	}
+
+	cmd := &exec.Cmd{
+		Path:       "/proc/self/exe",
+		Args:       []string{initProcessName},
+		Env:        []string{},
+		Stdout:     stdout,
+		Stderr:     stdout,
+		ExtraFiles: []*os.File{configReader, errorWriter},
+		SysProcAttr: &syscall.SysProcAttr{
+			Cloneflags: cloneFlags,
+			Pdeathsig:  syscall.SIGKILL,
+			UidMappings: []syscall.SysProcIDMap{{
+				ContainerID: 0,
+				HostID:      userNamespace.HostID,
+				Size:        userNamespace.Size,
+			}},
+			GidMappings: []syscall.SysProcIDMap{{
+				ContainerID: 0,
+				HostID:      userNamespace.HostID,
+				Size:        userNamespace.Size,
+			}},
+			GidMappingsEnableSetgroups: true,
+			// Become root in the user namespace, as the host root isn't mapped
+			Credential: &syscall.Credential{Uid: 0, Gid: 0},
+		},
+	}
+	err = cmd.Start()
+
+	// Close the ends of the pipes held by the init process
+	configReader.Close()
+	errorWriter.Close()
+
+	if err != nil {
+		configWriter.Close()
+		errorReader.Close()
+		return nil, errors.Wrap(err, "failed to start container init process")
+	}
+
+	c := &container{
+		cmd:          cmd,
+		configWriter: configWriter,
+		errorReader:  errorReader,
+	}
+	go c.waitForResult()
+
+	return c, nil
+}
+
+func (c *container) waitForResult() {
+	err := c.cmd.Wait()
+	debug("container init process exited, error: %v", err)
+	c.resolve.Do(func() {
+		c.success = err == nil
+	})
+}
+
+// Pid returns the host pid of the init process
+func (c *container) Pid() int {
+	return c.cmd.Process.Pid
+}
+
+// Configure sends configuration to the init process and waits for the command
+// to be executed. If the init process fails, an initError is returned.
+func (c *container) Configure(config initConfig) *initError {
+	err := json.NewEncoder(c.configWriter).Encode(config)
+	c.configWriter.Close()
+	if err != nil {
+		return &initError{Stage: "setup", Message: fmt.Sprintf(
+			"failed to send configuration to init process, error: %s", err,
+		)}
+	}
+
+	// The error pipe is closed on exec, so reading it will return EOF when the
+	// command has been executed.
+	data, err := ioutil.ReadAll(c.errorReader)
+	c.errorReader.Close()
+	if err != nil {
+		return &initError{Stage: "setup", Message: fmt.Sprintf(
+			"failed to read error pipe from init process, error: %s", err,
+		)}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	var e initError
+	if err = json.Unmarshal(data, &e); err != nil {
+		return &initError{Stage: "setup", Message: fmt.Sprintf(
+			"invalid message from init process: %s", string(data),
+		)}
+	}
+	return &e
+}
+
+// Kill the container, killing PID 1 in a pid namespace kills all processes in
+// the namespace.
+func (c *container) Kill() {
+	c.cmd.Process.Signal(syscall.SIGKILL)
+}
+
+// Wait for the container to terminate, returns true, if exited zero.
+func (c *container) Wait() bool {
+	c.resolve.Wait()
+	return c.success
+}
@@ -0,0 +1,22 @@
+// Package namespaceengine implements a container engine for taskcluster-worker
+// based on Linux namespaces.
+//
+// Each task runs in a fresh user, mount, pid, net, uts and ipc namespace with a
+// root file system unpacked from a tar-ball given in the task payload. Root in
+// the container is mapped to an unprivileged user on the host, and the task
+// command runs with a reduced set of capabilities and no_new_privs. This offers
+// more isolation than the native engine, but is much cheaper than the QEMU
+// engine, as no virtual machine is booted.
+//
+// This package requires the worker to run as root on Linux with user namespaces
+// enabled, the worker binary and the temporary folder must be accessible to
+// the unprivileged users containers are mapped to. The following debian
+// packages are also required:
+//  - iproute2
+//  - util-linux (for nsenter)
+//  - tar
+package namespaceengine
+
+import "github.com/taskcluster/taskcluster-worker/runtime/util"
+
+var debug = util.Debug("namespace")
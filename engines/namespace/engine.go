@@ -0,0 +1,104 @@
+// +build linux
+
+package namespaceengine
+
+import (
+	"os/exec"
+
+	"github.com/pkg/errors"
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/engines/hostvolume"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+type engineProvider struct {
+	engines.EngineProviderBase
+}
+
+type engine struct {
+	engines.EngineBase
+	config      configType
+	environment *runtime.Environment
+	monitor     runtime.Monitor
+	networks    *networkPool
+	ipCommand   string // Absolute path to 'ip' from iproute2
+}
+
+// requiredUtilities is the list of utilities that must be in PATH
+var requiredUtilities = []string{"ip", "nsenter", "tar"}
+
+// checkRequirements checks that required utilities are present in PATH
+func checkRequirements() error {
+	for _, name := range requiredUtilities {
+		if _, err := exec.LookPath(name); err != nil {
+			return errors.Errorf("unable to find '%s' in PATH, error: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func (engineProvider) ConfigSchema() schematypes.Schema {
+	return configSchema
+}
+
+func (engineProvider) NewEngine(options engines.EngineOptions) (engines.Engine, error) {
+	var c configType
+	schematypes.MustValidateAndMap(configSchema, options.Config, &c)
+	if c.UserNamespace.Size == 0 {
+		c.UserNamespace = userNamespaceType{
+			HostID: defaultUserNamespaceHostID,
+			Size:   defaultUserNamespaceSize,
+		}
+	}
+
+	// Check that we have the utilities required
+	if err := checkRequirements(); err != nil {
+		return nil, errors.Wrap(err, "namespace engine requirements not satisfied")
+	}
+	ipCommand, _ := exec.LookPath("ip")
+
+	return &engine{
+		config:      c,
+		environment: options.Environment,
+		monitor:     options.Monitor,
+		networks:    newNetworkPool(c.MaxConcurrency),
+		ipCommand:   ipCommand,
+	}, nil
+}
+
+func (e *engine) Capabilities() engines.Capabilities {
+	return engines.Capabilities{
+		MaxConcurrency: e.config.MaxConcurrency,
+	}
+}
+
+func (e *engine) PayloadSchema() schematypes.Object {
+	return payloadSchema
+}
+
+func (e *engine) NewSandboxBuilder(options engines.SandboxOptions) (engines.SandboxBuilder, error) {
+	var p payloadType
+	schematypes.MustValidateAndMap(payloadSchema, options.Payload, &p)
+
+	// Get an idle network
+	net, err := e.networks.Network()
+	if err != nil {
+		return nil, err
+	}
+
+	// Create sandboxBuilder, it'll handle rootfs downloading
+	return newSandboxBuilder(&p, net, options.TaskContext, e, options.Monitor), nil
+}
+
+func (e *engine) VolumeSchema() schematypes.Schema {
+	return schematypes.Object{}
+}
+
+func (e *engine) NewVolumeBuilder(options interface{}) (engines.VolumeBuilder, error) {
+	return hostvolume.NewBuilder(e.environment.TemporaryStorage, true)
+}
+
+func (e *engine) NewVolume(options interface{}) (engines.Volume, error) {
+	return hostvolume.New(e.environment.TemporaryStorage, true)
+}
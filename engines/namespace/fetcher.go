@@ -0,0 +1,30 @@
+// +build linux
+
+package namespaceengine
+
+import (
+	"fmt"
+
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/fetcher"
+)
+
+// A fetcher for downloading root file systems.
+var rootfsFetcher = fetcher.Combine(
+	// Allow fetching rootfs from URL
+	fetcher.URL,
+	// Allow fetching rootfs from queue artifacts
+	fetcher.Artifact,
+	// Allow fetching rootfs from queue referenced by index namespace
+	fetcher.Index,
+	// Allow fetching rootfs from URL + hash
+	fetcher.URLHash,
+)
+
+type fetchRootfsContext struct {
+	*runtime.TaskContext
+}
+
+func (c fetchRootfsContext) Progress(description string, percent float64) {
+	c.Log(fmt.Sprintf("Fetching rootfs: %s - %.0f %%", description, percent*100))
+}
@@ -0,0 +1,23 @@
+package namespaceengine
+
+import (
+	"os"
+
+	"github.com/taskcluster/taskcluster-worker/engines"
+)
+
+func init() {
+	// When the worker re-executes itself as container init process, we set up
+	// the container and exec the task command. This never returns.
+	if len(os.Args) > 0 && os.Args[0] == initProcessName {
+		containerInit()
+	}
+
+	// When the worker is executed inside a container by nsenter, we start a
+	// shell. This never returns.
+	if len(os.Args) > 3 && os.Args[1] == shellProcessName {
+		shellInit(os.Args[2], os.Args[3:])
+	}
+
+	engines.Register("namespace", engineProvider{})
+}
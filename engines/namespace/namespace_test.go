@@ -0,0 +1,233 @@
+// +build linux,namespace
+
+package namespaceengine
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/taskcluster/taskcluster-worker/engines/enginetest"
+)
+
+// makeTestRootfs creates a rootfs tar-ball with a statically linked busybox
+// from the host, this requires 'busybox' in PATH.
+func makeTestRootfs(target string) {
+	busybox, err := exec.LookPath("busybox")
+	if err != nil {
+		log.Panic("These tests requires a statically linked busybox in PATH, error: ", err)
+	}
+	folder, err := ioutil.TempDir("", "namespace-rootfs-")
+	if err != nil {
+		log.Panic("Failed to create temporary folder, error: ", err)
+	}
+	defer os.RemoveAll(folder)
+
+	bin := filepath.Join(folder, "bin")
+	for _, name := range []string{"bin", "tmp", "etc", "root"} {
+		if err = os.MkdirAll(filepath.Join(folder, name), 0755); err != nil {
+			log.Panic("Failed to create folder, error: ", err)
+		}
+	}
+	if err = exec.Command("cp", busybox, filepath.Join(bin, "busybox")).Run(); err != nil {
+		log.Panic("Failed to copy busybox, error: ", err)
+	}
+	out, err := exec.Command(busybox, "--list").Output()
+	if err != nil {
+		log.Panic("Failed to list busybox applets, error: ", err)
+	}
+	for _, applet := range strings.Fields(string(out)) {
+		if applet != "busybox" {
+			os.Symlink("busybox", filepath.Join(bin, applet))
+		}
+	}
+
+	err = exec.Command("tar", "-czf", target, "-C", folder, ".").Run()
+	if err != nil {
+		log.Panic("Failed to create rootfs tar-ball, error: ", err)
+	}
+}
+
+var s *httptest.Server
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	rootfs, err := ioutil.TempFile("", "namespace-rootfs-")
+	if err != nil {
+		log.Panic("Failed to create temporary file, error: ", err)
+	}
+	rootfs.Close()
+	makeTestRootfs(rootfs.Name())
+
+	s = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, rootfs.Name())
+	}))
+
+	provider.SetupEngine()
+	result := 1
+	func() {
+		defer func() {
+			provider.TearDownEngine()
+			s.Close()
+			os.Remove(rootfs.Name())
+		}()
+		result = m.Run()
+	}()
+	os.Exit(result)
+}
+
+var provider = &enginetest.EngineProvider{
+	Engine: "namespace",
+	Config: `{
+		"maxConcurrency": 5
+	}`,
+}
+
+func TestLogging(t *testing.T) {
+	c := enginetest.LoggingTestCase{
+		EngineProvider: provider,
+		Target:         "hello-world",
+		TargetPayload: `{
+			"rootfs": "` + s.URL + `",
+			"command": ["sh", "-c", "echo 'hello-world' && true"]
+		}`,
+		FailingPayload: `{
+			"rootfs": "` + s.URL + `",
+			"command": ["sh", "-c", "echo 'hello-world' && false"]
+		}`,
+		SilentPayload: `{
+			"rootfs": "` + s.URL + `",
+			"command": ["sh", "-c", "echo 'no hello' && true"]
+		}`,
+	}
+
+	c.TestLogTarget()
+	c.TestLogTargetWhenFailing()
+	c.TestSilentTask()
+	c.Test()
+}
+
+func TestEnvironmentVariables(t *testing.T) {
+	c := enginetest.EnvVarTestCase{
+		EngineProvider: provider,
+		VariableName:   "TEST_ENV_VAR",
+		InvalidVariableNames: []string{
+			"#=#",
+		},
+		Payload: `{
+			"rootfs": "` + s.URL + `",
+			"command": ["sh", "-c", "echo $TEST_ENV_VAR && true"]
+		}`,
+	}
+
+	c.TestPrintVariable()
+	c.TestVariableNameConflict()
+	c.TestInvalidVariableNames()
+	c.Test()
+}
+
+func TestAttachProxy(t *testing.T) {
+	c := enginetest.ProxyTestCase{
+		EngineProvider: provider,
+		ProxyName:      "test-proxy",
+		PingProxyPayload: `{
+			"rootfs": "` + s.URL + `",
+			"command": ["sh", "-ec", "echo 'Pinging'; wget -q -O - http://taskcluster/test-proxy/v1/ping"]
+		}`,
+	}
+
+	c.TestPingProxyPayload()
+	c.TestPing404IsUnsuccessful()
+	c.TestLiveLogging()
+	c.TestParallelPings()
+	c.Test()
+}
+
+func TestArtifacts(t *testing.T) {
+	c := enginetest.ArtifactTestCase{
+		EngineProvider:     provider,
+		Text:               "[hello-world]",
+		TextFilePath:       "/folder/hello.txt",
+		FileNotFoundPath:   "/no-such-file.txt",
+		FolderNotFoundPath: "/no-such-folder/",
+		NestedFolderFiles: []string{
+			"hello.txt",
+			"sub-folder/hello2.txt",
+		},
+		NestedFolderPath: "/folder/",
+		Payload: `{
+			"rootfs": "` + s.URL + `",
+			"command": ["sh", "-ec", "mkdir -p /folder/sub-folder; echo '[hello-world]' > /folder/hello.txt; echo '[hello-world]' > /folder/sub-folder/hello2.txt"]
+		}`,
+	}
+
+	c.TestExtractTextFile()
+	c.TestExtractFileNotFound()
+	c.TestExtractFolderNotFound()
+	c.TestExtractNestedFolderPath()
+	c.TestExtractFolderHandlerInterrupt()
+	c.Test()
+}
+
+func TestShell(t *testing.T) {
+	c := enginetest.ShellTestCase{
+		EngineProvider: provider,
+		Command:        "echo '[hello-world]'; (>&2 echo '[hello-error]');",
+		Stdout:         "[hello-world]\n",
+		Stderr:         "[hello-error]\n",
+		BadCommand:     "exit 1;\n",
+		SleepCommand:   "sleep 30;\n",
+		Payload: `{
+			"rootfs": "` + s.URL + `",
+			"command": ["sh", "-c", "sleep 1 && true"]
+		}`, // sleep in payload, sandbox doesn't terminate before shell is started
+	}
+
+	c.TestCommand()
+	c.TestBadCommand()
+	c.TestAbortSleepCommand()
+	c.TestKillSleepCommand()
+	c.Test()
+}
+
+func TestKill(t *testing.T) {
+	c := enginetest.KillTestCase{
+		EngineProvider: provider,
+		Target:         `hello-world`,
+		Payload: `{
+			"rootfs": "` + s.URL + `",
+			"command": ["sh", "-c", "echo 'hello-world' && sleep 30 && true"]
+		}`,
+	}
+
+	c.Test()
+}
+
+func TestVolumes(t *testing.T) {
+	c := enginetest.VolumeTestCase{
+		EngineProvider: provider,
+		Mountpoint:     "/mnt/my-volume",
+		WriteVolumePayload: `{
+			"rootfs": "` + s.URL + `",
+			"command": ["sh", "-ec", "echo 'hello-world' > /mnt/my-volume/hello.txt"]
+		}`,
+		CheckVolumePayload: `{
+			"rootfs": "` + s.URL + `",
+			"command": ["sh", "-ec", "grep 'hello-world' /mnt/my-volume/hello.txt"]
+		}`,
+	}
+
+	c.TestWriteReadVolume()
+	c.TestReadEmptyVolume()
+	c.TestWriteToReadOnlyVolume()
+	c.TestReadToReadOnlyVolume()
+	c.Test()
+}
@@ -0,0 +1,179 @@
+// +build linux
+
+package namespaceengine
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/engines"
+)
+
+// Each network is a '/30' subnet in 100.99.0.0/16, so we can have 16384
+// networks at most.
+const maxNetworks = 64 * 256
+
+// Name of the host that proxies are exposed on inside the container.
+const proxyHostname = "taskcluster"
+
+// networkPool keeps track of which networks are in use.
+type networkPool struct {
+	m     sync.Mutex
+	inUse []bool
+}
+
+func newNetworkPool(size int) *networkPool {
+	return &networkPool{inUse: make([]bool, size)}
+}
+
+// Network returns an idle network, or ErrMaxConcurrencyExceeded if all
+// networks are in use.
+func (p *networkPool) Network() (*network, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	for i, used := range p.inUse {
+		if !used {
+			p.inUse[i] = true
+			return &network{pool: p, index: i}, nil
+		}
+	}
+	return nil, engines.ErrMaxConcurrencyExceeded
+}
+
+// network is a virtual ethernet pair, where one end is moved into the network
+// namespace of the container. An HTTP server listening on the host end of the
+// pair forwards requests to the handler given with SetHandler().
+type network struct {
+	pool     *networkPool
+	index    int
+	m        sync.Mutex
+	handler  http.Handler
+	server   *http.Server
+	released bool
+}
+
+// HostInterface returns the name of the host end of the veth pair
+func (n *network) HostInterface() string {
+	return fmt.Sprintf("tcns%dh", n.index)
+}
+
+// ContainerInterface returns the name of the container end of the veth pair
+func (n *network) ContainerInterface() string {
+	return fmt.Sprintf("tcns%dc", n.index)
+}
+
+func (n *network) address(offset int) string {
+	return fmt.Sprintf("100.99.%d.%d", n.index/64, (n.index%64)*4+offset)
+}
+
+// HostIP returns the IP address of the host end of the veth pair
+func (n *network) HostIP() string {
+	return n.address(1)
+}
+
+// ContainerIP returns the IP address of the container end of the veth pair
+func (n *network) ContainerIP() string {
+	return n.address(2)
+}
+
+// SetHandler sets the http.Handler for requests from the container
+func (n *network) SetHandler(handler http.Handler) {
+	n.m.Lock()
+	defer n.m.Unlock()
+	n.handler = handler
+}
+
+func (n *network) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.m.Lock()
+	handler := n.handler
+	n.m.Unlock()
+
+	if handler == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
+
+// ip runs the 'ip' utility from iproute2 with given arguments
+func ip(args ...string) error {
+	out, err := exec.Command("ip", args...).CombinedOutput()
+	if err != nil {
+		return errors.Errorf("'ip %s' failed, error: %s, output: %s",
+			strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Setup creates the veth pair, moves the container end into the network
+// namespace of the process with given pid, and starts the HTTP server.
+func (n *network) Setup(pid int) error {
+	// Remove interface left behind by a previous crash, ignore errors
+	_ = ip("link", "del", n.HostInterface())
+
+	err := ip("link", "add", n.HostInterface(), "type", "veth", "peer", "name", n.ContainerInterface())
+	if err != nil {
+		return err
+	}
+	if err = ip("addr", "add", n.HostIP()+"/30", "dev", n.HostInterface()); err != nil {
+		return err
+	}
+	if err = ip("link", "set", n.HostInterface(), "up"); err != nil {
+		return err
+	}
+	if err = ip("link", "set", n.ContainerInterface(), "netns", fmt.Sprintf("%d", pid)); err != nil {
+		return err
+	}
+
+	// Start HTTP server listening on the host end
+	listener, err := net.Listen("tcp", n.HostIP()+":80")
+	if err != nil {
+		return errors.Wrap(err, "failed to listen on host end of veth pair")
+	}
+	n.m.Lock()
+	n.server = &http.Server{Handler: n}
+	server := n.server
+	n.m.Unlock()
+	go server.Serve(listener)
+
+	return nil
+}
+
+// Release stops the HTTP server, deletes the veth pair and returns the network
+// to the pool.
+func (n *network) Release() {
+	n.m.Lock()
+	if n.released {
+		n.m.Unlock()
+		panic("Can't release a network twice")
+	}
+	n.released = true
+	server := n.server
+	n.server = nil
+	n.handler = nil
+	n.m.Unlock()
+
+	if server != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}
+
+	// Deleting the host end deletes the pair, this fails if the network
+	// namespace is gone, as that also deletes the pair.
+	if err := ip("link", "del", n.HostInterface()); err != nil {
+		debug("failed to delete veth pair (probably already gone), error: %s", err)
+	}
+
+	n.pool.m.Lock()
+	n.pool.inUse[n.index] = false
+	n.pool.m.Unlock()
+}
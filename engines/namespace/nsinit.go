@@ -0,0 +1,391 @@
+// +build linux
+
+package namespaceengine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	rt "runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+// Default PATH, if not specified by the task
+const defaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// Name of the folder the old root is moved to by pivot_root
+const oldRootFolder = ".pivot_root"
+
+// Devices bind mounted from the host into /dev of the container
+var bindMountedDevices = []string{"null", "zero", "full", "random", "urandom", "tty"}
+
+// Capabilities kept in the bounding set of the task command, this is the
+// default set given to docker containers except CAP_MKNOD, all other
+// capabilities are dropped. See capability.h for numbers.
+var keptCapabilities = map[uintptr]bool{
+	0:  true, // CAP_CHOWN
+	1:  true, // CAP_DAC_OVERRIDE
+	3:  true, // CAP_FOWNER
+	4:  true, // CAP_FSETID
+	5:  true, // CAP_KILL
+	6:  true, // CAP_SETGID
+	7:  true, // CAP_SETUID
+	8:  true, // CAP_SETPCAP
+	10: true, // CAP_NET_BIND_SERVICE
+	13: true, // CAP_NET_RAW
+	18: true, // CAP_SYS_CHROOT
+	29: true, // CAP_AUDIT_WRITE
+	31: true, // CAP_SETFCAP
+}
+
+// Constants not exported by the syscall package
+const (
+	prSetNoNewPrivs         = 38         // PR_SET_NO_NEW_PRIVS from prctl.h
+	linuxCapabilityVersion3 = 0x20080522 // _LINUX_CAPABILITY_VERSION_3
+)
+
+// Flags that may be locked on a mount in a user namespace, these must be given
+// when remounting. The ST_* flags from statfs() have the same values.
+const lockedMountFlags = syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC |
+	syscall.MS_NOATIME | syscall.MS_NODIRATIME | syscall.MS_RELATIME
+
+// containerInit is called when the worker is executed as init process inside
+// the new namespaces. It reads configuration from initConfigFd, sets up the
+// container and executes the task command. This function never returns.
+func containerInit() {
+	// Capabilities and no_new_privs are per thread, so we must exec the task
+	// command from the thread we drop privileges on.
+	rt.LockOSThread()
+
+	// Write errors to error pipe and exit
+	errorPipe := os.NewFile(initErrorFd, "error-pipe")
+	fail := func(stage string, err error) {
+		json.NewEncoder(errorPipe).Encode(initError{
+			Stage:   stage,
+			Message: err.Error(),
+		})
+		os.Exit(1)
+	}
+	// Close the error pipe when the task command is executed
+	syscall.CloseOnExec(initErrorFd)
+
+	// Read configuration, this is sent when the network has been setup
+	var c initConfig
+	configPipe := os.NewFile(initConfigFd, "config-pipe")
+	data, err := ioutil.ReadAll(configPipe)
+	configPipe.Close()
+	if err != nil {
+		fail("setup", errors.Wrap(err, "failed to read configuration"))
+	}
+	if err = json.Unmarshal(data, &c); err != nil {
+		fail("setup", errors.Wrap(err, "failed to parse configuration"))
+	}
+
+	if err = setupContainer(c); err != nil {
+		fail("setup", err)
+	}
+
+	// Lookup the command using PATH from the task environment
+	path := defaultPath
+	for _, kv := range c.Env {
+		if strings.HasPrefix(kv, "PATH=") {
+			path = strings.TrimPrefix(kv, "PATH=")
+		}
+	}
+	os.Setenv("PATH", path)
+	if len(c.Command) == 0 {
+		fail("exec", errors.New("no command given"))
+	}
+	binary, err := exec.LookPath(c.Command[0])
+	if err != nil {
+		fail("exec", errors.Errorf("unable to find '%s' in rootfs", c.Command[0]))
+	}
+
+	if err = dropPrivileges(); err != nil {
+		fail("setup", err)
+	}
+
+	err = syscall.Exec(binary, c.Command, c.Env)
+	fail("exec", errors.Errorf("failed to execute '%s', error: %s", c.Command[0], err))
+}
+
+// shellInit is called when the worker is executed by nsenter inside the
+// namespaces of the container with init process pid, keeping the host root. It
+// changes root to the root of the container, drops privileges like the task
+// command and executes command. This function never returns.
+func shellInit(pid string, command []string) {
+	// Capabilities and no_new_privs are per thread, so we must exec the command
+	// from the thread we drop privileges on.
+	rt.LockOSThread()
+
+	fail := func(err error) {
+		fmt.Fprintf(os.Stderr, "failed to start shell, error: %s\n", err)
+		os.Exit(1)
+	}
+
+	// Change root and working directory to those of the container init process
+	cwd, err := os.Open(filepath.Join("/proc", pid, "cwd"))
+	if err != nil {
+		fail(errors.Wrap(err, "failed to open working directory of container"))
+	}
+	if err = syscall.Chroot(filepath.Join("/proc", pid, "root")); err != nil {
+		fail(errors.Wrap(err, "failed to change root to container"))
+	}
+	err = syscall.Fchdir(int(cwd.Fd()))
+	cwd.Close()
+	if err != nil {
+		fail(errors.Wrap(err, "failed to change working directory"))
+	}
+
+	// Lookup the command using PATH from the shell environment
+	if os.Getenv("PATH") == "" {
+		os.Setenv("PATH", defaultPath)
+	}
+	binary, err := exec.LookPath(command[0])
+	if err != nil {
+		fail(errors.Errorf("unable to find '%s' in rootfs", command[0]))
+	}
+
+	if err = dropPrivileges(); err != nil {
+		fail(err)
+	}
+
+	err = syscall.Exec(binary, command, os.Environ())
+	fail(errors.Errorf("failed to execute '%s', error: %s", command[0], err))
+}
+
+// mount is a wrapper for syscall.Mount with a sane error message
+func mount(source, target, fstype string, flags uintptr, data string) error {
+	if err := syscall.Mount(source, target, fstype, flags, data); err != nil {
+		return errors.Errorf("failed to mount '%s' on '%s' (type: '%s'), error: %s",
+			source, target, fstype, err)
+	}
+	return nil
+}
+
+// remount changes the flags of the bind mount at target, flags locked by the
+// user namespace are preserved, as the remount fails otherwise.
+func remount(target string, flags uintptr) error {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(target, &st); err != nil {
+		return errors.Wrapf(err, "failed to stat mount '%s'", target)
+	}
+	flags |= syscall.MS_BIND | syscall.MS_REC | syscall.MS_REMOUNT
+	flags |= uintptr(st.Flags) & lockedMountFlags
+	return mount("", target, "", flags, "")
+}
+
+// setupContainer sets up mounts, network, hostname and root file system for
+// the container, this must be called from the container init process.
+func setupContainer(c initConfig) error {
+	// Ensure that mounts aren't propagated to the host
+	if err := mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return err
+	}
+
+	// Bind mount rootfs to itself, as pivot_root requires a mount point, the
+	// rootfs is extracted by the host root, so it must be nodev and nosuid
+	if err := mount(c.Rootfs, c.Rootfs, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return err
+	}
+	if err := remount(c.Rootfs, syscall.MS_NODEV|syscall.MS_NOSUID); err != nil {
+		return err
+	}
+
+	if err := setupDevices(c.Rootfs); err != nil {
+		return err
+	}
+
+	// Bind mount volumes
+	for _, m := range c.Mounts {
+		target, err := resolvePath(c.Rootfs, m.Target)
+		if err != nil {
+			return err
+		}
+		if err = os.MkdirAll(target, 0755); err != nil {
+			return errors.Wrapf(err, "failed to create mountpoint '%s'", m.Target)
+		}
+		if err = mount(m.Source, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return err
+		}
+		if m.ReadOnly {
+			// Read-only bind mounts requires a remount
+			if err = remount(target, syscall.MS_RDONLY); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Configure network interfaces, using 'ip' from the host
+	for _, args := range [][]string{
+		{"link", "set", "lo", "up"},
+		{"addr", "add", c.Address, "dev", c.Interface},
+		{"link", "set", c.Interface, "up"},
+	} {
+		out, err := exec.Command(c.IPCommand, args...).CombinedOutput()
+		if err != nil {
+			return errors.Errorf("'ip %s' failed, error: %s, output: %s",
+				strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+		}
+	}
+
+	if err := syscall.Sethostname([]byte(c.Hostname)); err != nil {
+		return errors.Wrap(err, "failed to set hostname")
+	}
+
+	// Make rootfs the new root
+	oldRoot := filepath.Join(c.Rootfs, oldRootFolder)
+	if err := os.MkdirAll(oldRoot, 0700); err != nil {
+		return errors.Wrap(err, "failed to create folder for old root")
+	}
+	if err := syscall.PivotRoot(c.Rootfs, oldRoot); err != nil {
+		return errors.Wrap(err, "pivot_root failed")
+	}
+	if err := os.Chdir("/"); err != nil {
+		return errors.Wrap(err, "failed to chdir to new root")
+	}
+
+	// Mount proc for the new pid namespace, and sysfs as read-only if present
+	if err := os.MkdirAll("/proc", 0555); err != nil {
+		return errors.Wrap(err, "failed to create /proc")
+	}
+	flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC)
+	if err := mount("proc", "/proc", "proc", flags, ""); err != nil {
+		return err
+	}
+	if info, err := os.Stat("/sys"); err == nil && info.IsDir() {
+		if err = mount("sysfs", "/sys", "sysfs", flags|syscall.MS_RDONLY, ""); err != nil {
+			return err
+		}
+	}
+
+	// Unmount the old root
+	if err := syscall.Unmount("/"+oldRootFolder, syscall.MNT_DETACH); err != nil {
+		return errors.Wrap(err, "failed to unmount old root")
+	}
+	if err := os.Remove("/" + oldRootFolder); err != nil {
+		return errors.Wrap(err, "failed to remove old root folder")
+	}
+
+	workingDir := c.WorkingDir
+	if workingDir == "" {
+		workingDir = "/"
+	}
+	if err := os.Chdir(workingDir); err != nil {
+		return errors.Wrapf(err, "failed to chdir to '%s'", workingDir)
+	}
+	return nil
+}
+
+// setupDevices mounts a tmpfs on /dev in rootfs and populates it with a
+// minimal set of devices. The tmpfs is mounted nodev, so device nodes created
+// by the task can't be used, devices are bind mounted from the host instead.
+func setupDevices(rootfs string) error {
+	dev := filepath.Join(rootfs, "dev")
+	if err := os.MkdirAll(dev, 0755); err != nil {
+		return errors.Wrap(err, "failed to create /dev")
+	}
+	flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_STRICTATIME)
+	if err := mount("tmpfs", dev, "tmpfs", flags, "mode=755,size=65536k"); err != nil {
+		return err
+	}
+
+	for _, name := range bindMountedDevices {
+		target := filepath.Join(dev, name)
+		if err := ioutil.WriteFile(target, nil, 0666); err != nil {
+			return errors.Wrapf(err, "failed to create mountpoint for /dev/%s", name)
+		}
+		if err := mount("/dev/"+name, target, "", syscall.MS_BIND, ""); err != nil {
+			return err
+		}
+	}
+
+	pts := filepath.Join(dev, "pts")
+	if err := os.Mkdir(pts, 0755); err != nil {
+		return errors.Wrap(err, "failed to create /dev/pts")
+	}
+	flags = uintptr(syscall.MS_NOSUID | syscall.MS_NOEXEC)
+	if err := mount("devpts", pts, "devpts", flags, "newinstance,ptmxmode=0666,mode=620"); err != nil {
+		return err
+	}
+
+	shm := filepath.Join(dev, "shm")
+	if err := os.Mkdir(shm, 0755); err != nil {
+		return errors.Wrap(err, "failed to create /dev/shm")
+	}
+	flags = uintptr(syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC)
+	if err := mount("shm", shm, "tmpfs", flags, "mode=1777,size=65536k"); err != nil {
+		return err
+	}
+
+	for name, target := range map[string]string{
+		"ptmx":   "pts/ptmx",
+		"fd":     "/proc/self/fd",
+		"stdin":  "/proc/self/fd/0",
+		"stdout": "/proc/self/fd/1",
+		"stderr": "/proc/self/fd/2",
+	} {
+		if err := os.Symlink(target, filepath.Join(dev, name)); err != nil {
+			return errors.Wrapf(err, "failed to create /dev/%s", name)
+		}
+	}
+	return nil
+}
+
+// dropPrivileges drops capabilities not in keptCapabilities from the bounding
+// set, clears the inheritable set and sets no_new_privs, so the task command
+// and its sub-processes can't regain capabilities.
+func dropPrivileges() error {
+	data, err := ioutil.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return errors.Wrap(err, "failed to read cap_last_cap")
+	}
+	lastCap, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return errors.Wrap(err, "failed to parse cap_last_cap")
+	}
+	for c := uintptr(0); c <= uintptr(lastCap); c++ {
+		if keptCapabilities[c] {
+			continue
+		}
+		_, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, syscall.PR_CAPBSET_DROP, c, 0, 0, 0, 0)
+		if errno != 0 {
+			return errors.Wrapf(errno, "failed to drop capability %d", c)
+		}
+	}
+
+	// Clear the inheritable set, as this is preserved across exec
+	header := struct {
+		version uint32
+		pid     int32
+	}{version: linuxCapabilityVersion3}
+	var caps [2]struct {
+		effective   uint32
+		permitted   uint32
+		inheritable uint32
+	}
+	_, _, errno := syscall.RawSyscall(syscall.SYS_CAPGET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&caps[0])), 0)
+	if errno != 0 {
+		return errors.Wrap(errno, "capget failed")
+	}
+	caps[0].inheritable = 0
+	caps[1].inheritable = 0
+	_, _, errno = syscall.RawSyscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&caps[0])), 0)
+	if errno != 0 {
+		return errors.Wrap(errno, "capset failed")
+	}
+
+	_, _, errno = syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0)
+	if errno != 0 {
+		return errors.Wrap(errno, "failed to set no_new_privs")
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+// +build linux
+
+package namespaceengine
+
+import (
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+type payloadType struct {
+	Rootfs  interface{} `json:"rootfs"`
+	Command []string    `json:"command"`
+}
+
+var payloadSchema = schematypes.Object{
+	Properties: schematypes.Properties{
+		"rootfs": rootfsFetcher.Schema(),
+		"command": schematypes.Array{
+			Title: "Command",
+			Description: util.Markdown(`
+				Command and arguments to execute inside the container. The command
+				is resolved using 'PATH' from the root file system.
+			`),
+			Items: schematypes.String{},
+		},
+	},
+	Required: []string{"rootfs", "command"},
+}
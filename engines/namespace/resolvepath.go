@@ -0,0 +1,66 @@
+// +build linux
+
+package namespaceengine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Maximum number of symlinks resolvePath will follow
+const maxSymlinks = 255
+
+// resolvePath returns the host path for an absolute path p inside the root
+// file system at root. Symlinks are resolved relative to root, hence, the
+// result is always inside root, even if the rootfs contains malicious links.
+//
+// Path components that doesn't exist are appended without resolution.
+func resolvePath(root, p string) (string, error) {
+	links := 0
+	result := "/"
+	rest := strings.Split(p, "/")
+	for len(rest) > 0 {
+		c := rest[0]
+		rest = rest[1:]
+		if c == "" || c == "." {
+			continue
+		}
+		if c == ".." {
+			result = filepath.Dir(result)
+			continue
+		}
+
+		next := filepath.Join(result, c)
+		info, err := os.Lstat(filepath.Join(root, next))
+		if os.IsNotExist(err) {
+			result = next
+			continue
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to resolve '%s'", p)
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			result = next
+			continue
+		}
+
+		links++
+		if links > maxSymlinks {
+			return "", errors.Errorf("too many levels of symbolic links in '%s'", p)
+		}
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to read symlink in '%s'", p)
+		}
+		// Absolute links are relative to root, relative links are relative to
+		// the folder containing the link.
+		if filepath.IsAbs(target) {
+			result = "/"
+		}
+		rest = append(strings.Split(target, "/"), rest...)
+	}
+	return filepath.Join(root, result), nil
+}
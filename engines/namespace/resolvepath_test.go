@@ -0,0 +1,44 @@
+// +build linux
+
+package namespaceengine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolvePath(t *testing.T) {
+	root, err := ioutil.TempDir("", "namespace-resolvepath-")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "etc", "sub"), 0755))
+	require.NoError(t, os.Symlink("/etc", filepath.Join(root, "abs")))
+	require.NoError(t, os.Symlink("../../..", filepath.Join(root, "etc", "sub", "up")))
+	require.NoError(t, os.Symlink("/etc/sub/up/../etc", filepath.Join(root, "mixed")))
+	require.NoError(t, os.Symlink("loop", filepath.Join(root, "loop")))
+
+	for path, result := range map[string]string{
+		"/":                  "/",
+		"/etc/hosts":         "/etc/hosts",
+		"etc/./sub":          "/etc/sub",
+		"/../../etc":         "/etc",
+		"/abs/hosts":         "/etc/hosts",
+		"/etc/sub/up":        "/",
+		"/etc/sub/up/passwd": "/passwd",
+		"/mixed/sub":         "/etc/sub",
+		"/missing/../etc":    "/etc",
+		"/missing/file":      "/missing/file",
+	} {
+		p, err := resolvePath(root, path)
+		require.NoError(t, err, "resolvePath failed for '%s'", path)
+		require.Equal(t, filepath.Join(root, result), p, "wrong result for '%s'", path)
+	}
+
+	_, err = resolvePath(root, "/loop")
+	require.Error(t, err, "expected symlink loop to fail")
+}
@@ -0,0 +1,118 @@
+// +build linux
+
+package namespaceengine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+)
+
+// resultSet gives access to the rootfs after the container has terminated.
+//
+// Note: volumes are mounted inside the container, so files written to volumes
+// are not present in the rootfs after termination.
+type resultSet struct {
+	engines.ResultSetBase
+	monitor  runtime.Monitor
+	rootfs   runtime.TemporaryFolder
+	success  bool
+	disposed atomics.Once
+}
+
+func (r *resultSet) Success() bool {
+	return r.success
+}
+
+func (r *resultSet) ExtractFile(path string) (ioext.ReadSeekCloser, error) {
+	p, err := resolvePath(r.rootfs.Path(), filepath.ToSlash(path))
+	if err != nil {
+		return nil, engines.ErrResourceNotFound
+	}
+
+	// Stat the file to make sure it's a file
+	info, err := os.Lstat(p)
+	if err != nil {
+		return nil, engines.ErrResourceNotFound
+	}
+	// Don't allow anything that isn't a plain file
+	if !ioext.IsPlainFileInfo(info) {
+		return nil, engines.ErrResourceNotFound
+	}
+
+	// Open file
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, engines.ErrResourceNotFound
+	}
+
+	return f, nil
+}
+
+func (r *resultSet) ExtractFolder(path string, handler engines.FileHandler) error {
+	p, err := resolvePath(r.rootfs.Path(), filepath.ToSlash(path))
+	if err != nil {
+		return engines.ErrResourceNotFound
+	}
+
+	first := true
+	return filepath.Walk(p, func(abspath string, info os.FileInfo, err error) error {
+		// If there is a path error, on the first call then the folder is missing
+		if _, ok := err.(*os.PathError); ok && first {
+			return engines.ErrResourceNotFound
+		}
+		// If first path is what we're walking and it's not a directory, then we
+		// didn't find folder at the given path.
+		if first && p == abspath && !info.IsDir() {
+			return engines.ErrResourceNotFound
+		}
+		first = false
+
+		// Ignore folder we can't walk (probably a permission issues)
+		if err != nil {
+			return nil
+		}
+
+		// Skip anything that isn't a plain file
+		if !ioext.IsPlainFileInfo(info) {
+			return nil
+		}
+
+		// If we can't construct relative file path this internal error, we'll skip
+		relpath, err := filepath.Rel(p, abspath)
+		if err != nil {
+			r.monitor.ReportError(err, fmt.Sprintf(
+				"ExtractFolder from %s, filepath.Rel('%s', '%s') returns error: %s",
+				path, p, abspath, err,
+			))
+			return nil
+		}
+
+		f, err := os.Open(abspath)
+		if err != nil {
+			// file must have been deleted as we tried to open it
+			return nil
+		}
+
+		// If handler returns an error we return ErrHandlerInterrupt
+		if handler(filepath.ToSlash(relpath), f) != nil {
+			return engines.ErrHandlerInterrupt
+		}
+		return nil
+	})
+}
+
+func (r *resultSet) Dispose() error {
+	var err error
+	r.disposed.Do(func() {
+		if err = r.rootfs.Remove(); err != nil {
+			r.monitor.Error("Failed to remove rootfs, error: ", err)
+		}
+	})
+	return err
+}
@@ -0,0 +1,346 @@
+// +build linux
+
+package namespaceengine
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/engines/hostshell"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
+)
+
+// Hostname of the container
+const containerHostname = "sandbox"
+
+type sandbox struct {
+	engines.SandboxBase
+	engine    *engine
+	context   *runtime.TaskContext
+	monitor   runtime.Monitor
+	rootfs    runtime.TemporaryFolder
+	network   *network
+	container *container
+	proxies   map[string]http.Handler
+	env       map[string]string
+	resolve   atomics.Once // Guarding resultSet, resultErr and abortErr
+	resultSet *resultSet
+	resultErr error
+	abortErr  error
+	sessions  atomics.WaitGroup
+	mShells   sync.Mutex
+	shells    []*hostshell.Shell
+}
+
+func newSandbox(b *sandboxBuilder) (*sandbox, error) {
+	// Construct environment variables, with defaults
+	env := map[string]string{
+		"PATH": defaultPath,
+		"HOME": "/root",
+	}
+	for k, v := range b.env {
+		env[k] = v
+	}
+	envList := make([]string, 0, len(env))
+	for k, v := range env {
+		envList = append(envList, k+"="+v)
+	}
+	sort.Strings(envList)
+
+	// Bind mount volumes, sorted so parent folders are mounted first
+	mountpoints := make([]string, 0, len(b.mounts))
+	for mountpoint := range b.mounts {
+		mountpoints = append(mountpoints, mountpoint)
+	}
+	sort.Strings(mountpoints)
+	mounts := make([]initMount, len(mountpoints))
+	for i, mountpoint := range mountpoints {
+		mounts[i] = initMount{
+			Source:   b.mounts[mountpoint].volume.Path(),
+			Target:   mountpoint,
+			ReadOnly: b.mounts[mountpoint].readOnly,
+		}
+	}
+
+	if err := writeHostFiles(b.rootfs.Path(), b.network); err != nil {
+		return nil, err
+	}
+
+	// Start the init process, it'll wait for configuration
+	debug("starting container init process")
+	c, err := startContainer(b.context.LogDrain(), b.engine.config.UserNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	// Setup network while the init process is waiting
+	if err = b.network.Setup(c.Pid()); err != nil {
+		c.Kill()
+		c.Wait()
+		return nil, err
+	}
+
+	s := &sandbox{
+		engine:    b.engine,
+		context:   b.context,
+		monitor:   b.monitor,
+		rootfs:    b.rootfs,
+		network:   b.network,
+		container: c,
+		proxies:   b.proxies,
+		env:       env,
+	}
+	b.network.SetHandler(http.HandlerFunc(s.handleRequest))
+
+	// Send configuration and wait for the command to be executed
+	debug("configuring container, command: %v", b.command)
+	ierr := c.Configure(initConfig{
+		Rootfs:     b.rootfs.Path(),
+		Hostname:   containerHostname,
+		Command:    b.command,
+		Env:        envList,
+		WorkingDir: "/",
+		Mounts:     mounts,
+		IPCommand:  b.engine.ipCommand,
+		Interface:  b.network.ContainerInterface(),
+		Address:    b.network.ContainerIP() + "/30",
+	})
+	if ierr != nil {
+		c.Kill()
+		c.Wait()
+		if ierr.Stage == "exec" {
+			return nil, runtime.NewMalformedPayloadError(
+				"Unable to start specified command: ", b.command, " error: ", ierr.Message,
+			)
+		}
+		return nil, errors.Errorf("failed to setup container, error: %s", ierr.Message)
+	}
+
+	go s.waitForTermination()
+
+	return s, nil
+}
+
+// writeHostFiles writes /etc/hosts and /etc/hostname in rootfs
+func writeHostFiles(rootfs string, n *network) error {
+	etc, err := resolvePath(rootfs, "/etc")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(etc, 0755); err != nil {
+		return errors.Wrap(err, "failed to create /etc in rootfs")
+	}
+
+	files := map[string]string{
+		"/etc/hosts": fmt.Sprintf(
+			"127.0.0.1\tlocalhost %s\n%s\t%s\n",
+			containerHostname, n.HostIP(), proxyHostname,
+		),
+		"/etc/hostname": containerHostname + "\n",
+	}
+	for name, data := range files {
+		p, err := resolvePath(rootfs, name)
+		if err != nil {
+			return err
+		}
+		// Remove first, in case it's a symlink pointing somewhere else
+		os.Remove(p)
+		if err = ioutil.WriteFile(p, []byte(data), 0644); err != nil {
+			return errors.Wrapf(err, "failed to write %s in rootfs", name)
+		}
+	}
+	return nil
+}
+
+// handleRequest forwards requests for http://taskcluster/<name>/<path> to
+// the proxy attached with the given name.
+func (s *sandbox) handleRequest(w http.ResponseWriter, r *http.Request) {
+	var origPath string
+	isRawPath := r.URL.RawPath != ""
+	if isRawPath {
+		origPath = r.URL.RawPath
+	} else {
+		origPath = r.URL.Path
+	}
+	debug("handling request: %s", origPath)
+
+	if len(origPath) == 0 || origPath[0] != '/' {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	p := strings.SplitN(origPath[1:], "/", 2)
+	if len(p) != 2 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	name, path := p[0], "/"+p[1]
+
+	h := s.proxies[name]
+	if h == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// Rewrite the path
+	if isRawPath {
+		r.URL.Path, _ = url.PathUnescape(path)
+		r.URL.RawPath = path
+	} else {
+		r.URL.Path = path
+		r.URL.RawPath = ""
+	}
+
+	h.ServeHTTP(w, r)
+}
+
+func (s *sandbox) NewShell(command []string, tty bool) (engines.Shell, error) {
+	s.mShells.Lock()
+	defer s.mShells.Unlock()
+
+	// Increment shell counter, if draining we don't allow new shells
+	if s.sessions.Add(1) != nil {
+		return nil, engines.ErrSandboxTerminated
+	}
+
+	debug("NewShell with: %v", command)
+	S, err := newShell(s, command, tty)
+	if err != nil {
+		debug("Failed to start shell, error: %s", err)
+		s.sessions.Done()
+		return nil, runtime.NewMalformedPayloadError(
+			"Unable to spawn command: ", command, " error: ", err,
+		)
+	}
+
+	// Add shells to list
+	s.shells = append(s.shells, S)
+
+	// Wait for the S to be done and decrement WaitGroup
+	go func() {
+		result, _ := S.Wait()
+		debug("Shell finished with: %v", result)
+
+		s.mShells.Lock()
+		defer s.mShells.Unlock()
+
+		// remove S from s.shells
+		shells := make([]*hostshell.Shell, 0, len(s.shells))
+		for _, s2 := range s.shells {
+			if s2 != S {
+				shells = append(shells, s2)
+			}
+		}
+		s.shells = shells
+
+		// Mark as done
+		s.sessions.Done()
+	}()
+
+	return S, nil
+}
+
+// abortShells prevents new shells and aborts all existing shells
+func (s *sandbox) abortShells() {
+	s.mShells.Lock()
+
+	// Prevent new shells
+	s.sessions.Drain()
+
+	// Abort all shells
+	for _, S := range s.shells {
+		go S.Abort()
+	}
+	s.shells = nil
+
+	// can't hold lock while waiting for session to finish
+	s.mShells.Unlock()
+
+	// Wait for all shells to be done
+	s.sessions.Wait()
+}
+
+func (s *sandbox) waitForTermination() {
+	// Wait for the container to terminate, when PID 1 exits the kernel kills
+	// all other processes in the pid namespace, including shells.
+	success := s.container.Wait()
+	debug("Container finished with: %v", success)
+
+	// Wait for all shell to finish and prevent new shells from being created
+	s.sessions.WaitAndDrain()
+	debug("All shells terminated")
+
+	// The network namespace is gone, so we can release the network
+	s.network.Release()
+
+	s.resolve.Do(func() {
+		s.resultSet = &resultSet{
+			monitor: s.monitor,
+			rootfs:  s.rootfs,
+			success: success,
+		}
+		s.abortErr = engines.ErrSandboxTerminated
+	})
+}
+
+func (s *sandbox) WaitForResult() (engines.ResultSet, error) {
+	// Wait for result and terminate
+	s.resolve.Wait()
+	return s.resultSet, s.resultErr
+}
+
+func (s *sandbox) Kill() error {
+	s.resolve.Do(func() {
+		debug("Sandbox.Kill()")
+
+		// Kill all processes in the container
+		s.container.Kill()
+
+		// Abort all shells
+		s.abortShells()
+
+		// Wait for the container to be gone
+		s.container.Wait()
+
+		// Create resultSet
+		s.resultSet = &resultSet{
+			monitor: s.monitor,
+			rootfs:  s.rootfs,
+			success: false,
+		}
+		s.abortErr = engines.ErrSandboxTerminated
+	})
+	s.resolve.Wait()
+	return s.resultErr
+}
+
+func (s *sandbox) Abort() error {
+	s.resolve.Do(func() {
+		debug("Sandbox.Abort()")
+
+		// Kill all processes in the container
+		s.container.Kill()
+
+		// Abort all shells
+		s.abortShells()
+
+		// Wait for the container to be gone, before removing the rootfs
+		s.container.Wait()
+		if err := s.rootfs.Remove(); err != nil {
+			s.monitor.Error("Failed to remove rootfs, error: ", err)
+		}
+
+		// Set result
+		s.resultErr = engines.ErrSandboxAborted
+	})
+	s.resolve.Wait()
+	return s.abortErr
+}
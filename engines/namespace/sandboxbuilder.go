@@ -0,0 +1,336 @@
+// +build linux
+
+package namespaceengine
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/engines/hostvolume"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/fetcher"
+)
+
+type sandboxBuilder struct {
+	engines.SandboxBuilderBase
+	m           sync.Mutex
+	discarded   bool
+	network     *network
+	command     []string
+	rootfs      runtime.TemporaryFolder
+	rootfsError error
+	rootfsDone  <-chan struct{}
+	proxies     map[string]http.Handler
+	env         map[string]string
+	mounts      map[string]volumeMount
+	context     *runtime.TaskContext
+	engine      *engine
+	monitor     runtime.Monitor
+}
+
+// newSandboxBuilder creates a new sandboxBuilder and starts fetching the
+// rootfs in the background.
+func newSandboxBuilder(
+	payload *payloadType, network *network,
+	c *runtime.TaskContext, e *engine, monitor runtime.Monitor,
+) *sandboxBuilder {
+	rootfsDone := make(chan struct{})
+	sb := &sandboxBuilder{
+		network:    network,
+		command:    payload.Command,
+		rootfsDone: rootfsDone,
+		proxies:    make(map[string]http.Handler),
+		env:        make(map[string]string),
+		mounts:     make(map[string]volumeMount),
+		context:    c,
+		engine:     e,
+		monitor:    monitor,
+	}
+
+	// Start downloading and extracting the rootfs
+	go func() {
+		rootfs, err := fetchRootfs(payload.Rootfs, c, e)
+
+		sb.m.Lock()
+		// if already discarded then we remove the rootfs immediately, as we
+		// don't want to leak disk space.
+		if sb.discarded {
+			if rootfs != nil {
+				if rerr := rootfs.Remove(); rerr != nil {
+					monitor.ReportError(rerr, "failed to remove rootfs")
+				}
+			}
+		} else {
+			sb.rootfs = rootfs
+			sb.rootfsError = err
+		}
+		sb.m.Unlock()
+		close(rootfsDone)
+	}()
+	return sb
+}
+
+// fetchRootfs downloads the tar-ball referenced by rootfs and extracts it to
+// a temporary folder.
+func fetchRootfs(rootfs interface{}, c *runtime.TaskContext, e *engine) (runtime.TemporaryFolder, error) {
+	ctx := fetchRootfsContext{c}
+	ref, err := rootfsFetcher.NewReference(ctx, rootfs)
+	if err != nil {
+		if fetcher.IsBrokenReferenceError(err) {
+			err = runtime.NewMalformedPayloadError("unable to fetch rootfs, error:", err)
+		}
+		return nil, err
+	}
+
+	// Check that task.scopes satisfies one of required scope-sets
+	scopeSets := ref.Scopes()
+	if !c.HasScopes(scopeSets...) {
+		var options []string
+		for _, scopes := range scopeSets {
+			options = append(options, strings.Join(scopes, ", "))
+		}
+		return nil, runtime.NewMalformedPayloadError(
+			`task.scopes must satisfy at-least one of the scope-sets: ` + strings.Join(options, " or "),
+		)
+	}
+
+	// Download to a temporary file
+	filePath := e.environment.TemporaryStorage.NewFilePath()
+	file, err := os.Create(filePath)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create temporary file for rootfs")
+	}
+	defer os.Remove(filePath)
+	debug("fetching rootfs: %#v", rootfs)
+	err = ref.Fetch(ctx, &fetcher.FileReseter{File: file})
+	file.Close()
+	if err != nil {
+		if fetcher.IsBrokenReferenceError(err) {
+			err = runtime.NewMalformedPayloadError("unable to fetch rootfs, error:", err)
+		}
+		return nil, err
+	}
+
+	// Extract the tar-ball, GNU tar detects compression automatically
+	folder, err := e.environment.TemporaryStorage.NewFolder()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create temporary folder for rootfs")
+	}
+	out, err := exec.Command(
+		"tar", "-xpf", filePath, "-C", folder.Path(), "--numeric-owner",
+	).CombinedOutput()
+	if err != nil {
+		folder.Remove()
+		return nil, runtime.NewMalformedPayloadError(
+			"unable to extract rootfs, error: ", err, " output: ", strings.TrimSpace(string(out)),
+		)
+	}
+
+	// Ensure the rootfs is accessible inside the container
+	if err = os.Chmod(folder.Path(), 0755); err != nil {
+		folder.Remove()
+		return nil, errors.Wrap(err, "failed to set permissions on rootfs")
+	}
+	if err = shiftOwnership(folder.Path(), e.config.UserNamespace); err != nil {
+		folder.Remove()
+		return nil, err
+	}
+	debug("extracted rootfs: %#v", rootfs)
+	return folder, nil
+}
+
+// shiftOwnership changes the owner of all files in rootfs from ids in the
+// container to the host ids they are mapped to by the user namespace.
+func shiftOwnership(rootfs string, userNamespace userNamespaceType) error {
+	return filepath.Walk(rootfs, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errors.Wrap(err, "failed to read rootfs")
+		}
+		// Remove device nodes, as the rootfs was extracted by the host root they
+		// would give access to host devices, /dev is populated by the container
+		if info.Mode()&os.ModeType&^(os.ModeDir|os.ModeSymlink|os.ModeNamedPipe|os.ModeSocket) != 0 {
+			debug("removing '%s' from rootfs, mode: %s", strings.TrimPrefix(p, rootfs), info.Mode())
+			if err = os.Remove(p); err != nil {
+				return errors.Wrapf(err, "failed to remove '%s' from rootfs", p)
+			}
+			return nil
+		}
+		st := info.Sys().(*syscall.Stat_t)
+		if int(st.Uid) >= userNamespace.Size || int(st.Gid) >= userNamespace.Size {
+			return runtime.NewMalformedPayloadError(fmt.Sprintf(
+				"rootfs contains '%s' owned by %d:%d, only ids less than %d are supported",
+				strings.TrimPrefix(p, rootfs), st.Uid, st.Gid, userNamespace.Size,
+			))
+		}
+		uid := userNamespace.HostID + int(st.Uid)
+		gid := userNamespace.HostID + int(st.Gid)
+		if err = os.Lchown(p, uid, gid); err != nil {
+			return errors.Wrapf(err, "failed to change owner of '%s' in rootfs", p)
+		}
+		// chown clears setuid and setgid bits, so we restore the mode
+		if info.Mode()&(os.ModeSetuid|os.ModeSetgid) != 0 && info.Mode()&os.ModeSymlink == 0 {
+			if err = os.Chmod(p, info.Mode()); err != nil {
+				return errors.Wrapf(err, "failed to restore mode of '%s' in rootfs", p)
+			}
+		}
+		return nil
+	})
+}
+
+// volumeMount is a volume attached to the sandboxBuilder
+type volumeMount struct {
+	volume   *hostvolume.Volume
+	readOnly bool
+}
+
+// mountPointPattern defines allowed volume mountpoints
+var mountPointPattern = regexp.MustCompile(`^(/[a-zA-Z0-9_.-]+)+$`)
+
+func (sb *sandboxBuilder) AttachVolume(mountpoint string, v engines.Volume, readOnly bool) error {
+	// We can type cast Volume to our internal type as we know the volume was
+	// created by NewVolume() or NewVolumeBuilder()
+	vol, valid := v.(*hostvolume.Volume)
+	if !valid {
+		return fmt.Errorf("invalid volume type")
+	}
+
+	// Validate mountpoint against allowed patterns
+	if !mountPointPattern.MatchString(mountpoint) || strings.Contains(mountpoint, "/..") {
+		return runtime.NewMalformedPayloadError("Volume mountpoint: '", mountpoint, "'",
+			" is not allowed for namespace engine. The mountpoint must be an",
+			" absolute path matching: ", mountPointPattern.String())
+	}
+
+	// Acquire the lock
+	sb.m.Lock()
+	defer sb.m.Unlock()
+
+	// Check that the mountpoint isn't already in use
+	if _, ok := sb.mounts[mountpoint]; ok {
+		return engines.ErrNamingConflict
+	}
+
+	// Attach the volume
+	sb.mounts[mountpoint] = volumeMount{
+		volume:   vol,
+		readOnly: readOnly,
+	}
+	return nil
+}
+
+var proxyNamePattern = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+func (sb *sandboxBuilder) AttachProxy(hostname string, handler http.Handler) error {
+	// Validate hostname against allowed patterns
+	if !proxyNamePattern.MatchString(hostname) {
+		return runtime.NewMalformedPayloadError("Proxy hostname: '", hostname, "'",
+			" is not allowed for namespace engine. The hostname must match: ",
+			proxyNamePattern.String())
+	}
+
+	// Acquire the lock
+	sb.m.Lock()
+	defer sb.m.Unlock()
+
+	// Check that the hostname isn't already in use
+	if _, ok := sb.proxies[hostname]; ok {
+		return engines.ErrNamingConflict
+	}
+
+	// Otherwise set the handler
+	sb.proxies[hostname] = handler
+	return nil
+}
+
+// envVarPattern defines allowed environment variable names
+var envVarPattern = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+func (sb *sandboxBuilder) SetEnvironmentVariable(name, value string) error {
+	// Simple sanity check of environment variable names
+	if !envVarPattern.MatchString(name) {
+		return runtime.NewMalformedPayloadError("Environment variable name: '",
+			name, "' is not allowed for namespace engine. Environment variable",
+			" names must be on the form: ", envVarPattern.String())
+	}
+
+	// Acquire the lock
+	sb.m.Lock()
+	defer sb.m.Unlock()
+
+	// Check if the name is already used
+	if _, ok := sb.env[name]; ok {
+		return engines.ErrNamingConflict
+	}
+
+	// Set the env var
+	sb.env[name] = value
+	return nil
+}
+
+func (sb *sandboxBuilder) StartSandbox() (engines.Sandbox, error) {
+	// Wait for the rootfs to be fetched
+	<-sb.rootfsDone
+
+	// If we were discarded while waiting for the rootfs we're done
+	sb.m.Lock()
+	if sb.discarded {
+		sb.m.Unlock()
+		return nil, engines.ErrSandboxBuilderDiscarded
+	}
+	// Otherwise, set as discarded... Whatever happens here we free the resources
+	sb.discarded = true
+
+	// If we couldn't fetch the rootfs, then we're done
+	if sb.rootfsError != nil {
+		err := sb.rootfsError
+		sb.m.Unlock()
+		// Free all resources
+		sb.Discard()
+		return nil, err
+	}
+
+	// Create a sandbox
+	s, err := newSandbox(sb)
+	if err != nil {
+		sb.m.Unlock()
+		// Free all resources
+		sb.Discard()
+		return nil, err
+	}
+
+	// Resources are now owned by the sandbox
+	sb.network = nil
+	sb.rootfs = nil
+	sb.m.Unlock()
+
+	return s, nil
+}
+
+func (sb *sandboxBuilder) Discard() error {
+	sb.m.Lock()
+	defer sb.m.Unlock()
+	// Mark the SandboxBuilder as discarded, so things can't be started
+	sb.discarded = true
+
+	// Let's be defensive about release it... Here we don't complain about
+	// releasing a resource twice. We'll set it nil, so that shouldn't happen
+	var err error
+	if sb.rootfs != nil {
+		err = sb.rootfs.Remove()
+		sb.rootfs = nil
+	}
+	if sb.network != nil {
+		sb.network.Release()
+		sb.network = nil
+	}
+	return err
+}
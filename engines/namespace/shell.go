@@ -0,0 +1,47 @@
+// +build linux
+
+package namespaceengine
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/engines/hostshell"
+	"github.com/taskcluster/taskcluster-worker/engines/native/system"
+)
+
+// shellProcessName is given as os.Args[1], when the worker is executed inside
+// the namespaces of a container to start a shell.
+const shellProcessName = "taskcluster-worker-namespace-shell"
+
+// newShell starts command inside the namespaces of the container
+func newShell(s *sandbox, command []string, tty bool) (*hostshell.Shell, error) {
+	// Default to a shell from the rootfs
+	if len(command) == 0 {
+		command = []string{"sh"}
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find worker executable")
+	}
+
+	// Use nsenter to execute the worker inside the namespaces of the container,
+	// keeping the host root, so the worker can be loaded. The worker changes root
+	// to the container and drops privileges like the task command, before it
+	// executes command as root in the container, which is an unprivileged user
+	// on the host.
+	pid := strconv.Itoa(s.container.Pid())
+	args := []string{
+		"nsenter", "--target", pid,
+		"--user", "--mount", "--uts", "--ipc", "--net", "--pid", "--root=/", "--wd=/", "--",
+		exe, shellProcessName, pid,
+	}
+	return hostshell.New(system.ProcessOptions{
+		Arguments:     append(args, command...),
+		Environment:   s.env,
+		WorkingFolder: "/",
+		TTY:           tty,
+	})
+}
@@ -8,6 +8,7 @@ import (
 type config struct {
 	Groups     []string `json:"groups,omitempty"`
 	CreateUser bool     `json:"createUser"`
+	Limits     *limits  `json:"limits,omitempty"`
 }
 
 var configSchema = schematypes.Object{
@@ -41,6 +42,13 @@ var configSchema = schematypes.Object{
 				will run with the same user as the worker does.
 			`),
 		},
+		"limits": limitsSchema("Task Resource Limits", util.Markdown(`
+			Resource limits for each task, if given the process tree of each task
+			is placed in a cgroup (v2 if available, otherwise v1) enforcing these
+			limits. Tasks may specify lower limits in 'task.payload.limits'.
+
+			This is only supported on Linux, and requires the worker to run as root.
+		`)),
 	},
 	Required: []string{
 		"createUser",
@@ -46,6 +46,15 @@ func (engineProvider) NewEngine(options engines.EngineOptions) (engines.Engine,
 		groups = append(groups, group)
 	}
 
+	// Check that cgroups are supported, if resource limits are configured
+	if c.Limits != nil {
+		if err := system.CgroupsSupported(); err != nil {
+			return nil, fmt.Errorf(
+				"resource limits are configured, but cgroups cannot be used, error: %s", err,
+			)
+		}
+	}
+
 	return &engine{
 		environment: *options.Environment,
 		monitor:     options.Monitor,
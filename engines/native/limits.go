@@ -0,0 +1,110 @@
+package nativeengine
+
+import (
+	"math"
+
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/engines/native/system"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// limits specifies resource limits for a task, zero values means unlimited.
+type limits struct {
+	Memory   int64   `json:"memory,omitempty"`   // MiB
+	CPUs     float64 `json:"cpus,omitempty"`     // Number of CPUs
+	Pids     int64   `json:"pids,omitempty"`     // Number of processes
+	IOWeight int64   `json:"ioWeight,omitempty"` // Relative disk-IO weight
+}
+
+func limitsSchema(title, description string) schematypes.Object {
+	return schematypes.Object{
+		Title:       title,
+		Description: description,
+		Properties: schematypes.Properties{
+			"memory": schematypes.Integer{
+				Title: "Memory Limit",
+				Description: util.Markdown(`
+					Maximum memory in MiB, if exceeded the task is killed by the OOM
+					killer and resolved as failed.
+				`),
+				Minimum: 1,
+				Maximum: math.MaxInt64 / (1024 * 1024),
+			},
+			"cpus": schematypes.Number{
+				Title: "CPU Limit",
+				Description: util.Markdown(`
+					Maximum number of CPUs worth of CPU time the task may use,
+					fractional values are allowed.
+				`),
+				Minimum: 0.01,
+				Maximum: 4096,
+			},
+			"pids": schematypes.Integer{
+				Title:       "Process Limit",
+				Description: "Maximum number of processes and threads the task may have.",
+				Minimum:     1,
+				Maximum:     math.MaxInt32,
+			},
+			"ioWeight": schematypes.Integer{
+				Title: "Disk-IO Weight",
+				Description: util.Markdown(`
+					Relative weight of disk-IO from 1 to 10000, the default weight
+					for processes is 100.
+				`),
+				Minimum: 1,
+				Maximum: 10000,
+			},
+		},
+	}
+}
+
+// WithMaximums returns limits with values from l, using values from maximums
+// where l doesn't specify a limit. If l exceeds a limit in maximums this
+// returns a MalformedPayloadError.
+func (l limits) WithMaximums(maximums limits) (limits, error) {
+	result := maximums
+	if l.Memory != 0 {
+		if maximums.Memory != 0 && l.Memory > maximums.Memory {
+			return result, runtime.NewMalformedPayloadError(
+				"task.payload.limits.memory exceeds the maximum of ", maximums.Memory, " MiB",
+			)
+		}
+		result.Memory = l.Memory
+	}
+	if l.CPUs != 0 {
+		if maximums.CPUs != 0 && l.CPUs > maximums.CPUs {
+			return result, runtime.NewMalformedPayloadError(
+				"task.payload.limits.cpus exceeds the maximum of ", maximums.CPUs,
+			)
+		}
+		result.CPUs = l.CPUs
+	}
+	if l.Pids != 0 {
+		if maximums.Pids != 0 && l.Pids > maximums.Pids {
+			return result, runtime.NewMalformedPayloadError(
+				"task.payload.limits.pids exceeds the maximum of ", maximums.Pids,
+			)
+		}
+		result.Pids = l.Pids
+	}
+	if l.IOWeight != 0 {
+		if maximums.IOWeight != 0 && l.IOWeight > maximums.IOWeight {
+			return result, runtime.NewMalformedPayloadError(
+				"task.payload.limits.ioWeight exceeds the maximum of ", maximums.IOWeight,
+			)
+		}
+		result.IOWeight = l.IOWeight
+	}
+	return result, nil
+}
+
+// CgroupLimits returns the limits as system.CgroupLimits
+func (l limits) CgroupLimits() system.CgroupLimits {
+	return system.CgroupLimits{
+		Memory:   l.Memory * 1024 * 1024,
+		CPUs:     l.CPUs,
+		Pids:     l.Pids,
+		IOWeight: l.IOWeight,
+	}
+}
@@ -0,0 +1,28 @@
+package nativeengine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+func TestLimitsWithMaximums(t *testing.T) {
+	maximums := limits{Memory: 1024, CPUs: 2, Pids: 100}
+
+	result, err := limits{}.WithMaximums(maximums)
+	require.NoError(t, err)
+	require.Equal(t, maximums, result, "expected maximums as default")
+
+	result, err = limits{Memory: 512, IOWeight: 50}.WithMaximums(maximums)
+	require.NoError(t, err)
+	require.Equal(t, limits{Memory: 512, CPUs: 2, Pids: 100, IOWeight: 50}, result)
+
+	_, err = limits{CPUs: 2.5}.WithMaximums(maximums)
+	_, ok := runtime.IsMalformedPayloadError(err)
+	require.True(t, ok, "expected MalformedPayloadError, got: %v", err)
+
+	_, err = limits{Memory: 2048}.WithMaximums(maximums)
+	_, ok = runtime.IsMalformedPayloadError(err)
+	require.True(t, ok, "expected MalformedPayloadError, got: %v", err)
+}
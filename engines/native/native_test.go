@@ -164,6 +164,21 @@ func TestKill(t *testing.T) {
 	c.Test()
 }
 
+func TestExitStatus(t *testing.T) {
+	c := enginetest.ExitStatusTestCase{
+		EngineProvider: provider,
+		SuccessPayload: `{
+			"command": ["sh", "-c", "echo 'hello-world' && exit 0"]
+		}`,
+		FailingPayload: `{
+			"command": ["sh", "-c", "echo 'hello-world' && exit 3"]
+		}`,
+		ExitCode: 3,
+	}
+
+	c.Test()
+}
+
 func TestContext(t *testing.T) {
 	s := httptest.NewServer(http.FileServer(http.Dir("testdata/")))
 	defer s.Close()
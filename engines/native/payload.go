@@ -8,6 +8,7 @@ import (
 type payload struct {
 	Command []string `json:"command"`
 	Context string   `json:"context"`
+	Limits  *limits  `json:"limits,omitempty"`
 }
 
 var payloadSchema = schematypes.Object{
@@ -24,6 +25,11 @@ var payloadSchema = schematypes.Object{
 				and extracted in the 'HOME' directory for running the command.
 			`),
 		},
+		"limits": limitsSchema("Resource Limits", util.Markdown(`
+			Optional resource limits for the task, these cannot exceed the limits
+			configured for the worker. Limits not given here default to the limits
+			configured for the worker.
+		`)),
 	},
 	Required: []string{"command"},
 }
@@ -20,12 +20,28 @@ type resultSet struct {
 	workingFolder runtime.TemporaryFolder
 	user          *system.User
 	success       bool
+	exitStatus    *engines.ExitStatus    // nil, if killed before exiting
+	resourceUsage *engines.ResourceUsage // nil, if killed before exiting
 }
 
 func (r *resultSet) Success() bool {
 	return r.success
 }
 
+func (r *resultSet) ExitStatus() (engines.ExitStatus, error) {
+	if r.exitStatus == nil {
+		return engines.ExitStatus{}, engines.ErrResourceNotFound
+	}
+	return *r.exitStatus, nil
+}
+
+func (r *resultSet) ResourceUsage() (engines.ResourceUsage, error) {
+	if r.resourceUsage == nil {
+		return engines.ResourceUsage{}, engines.ErrResourceNotFound
+	}
+	return *r.resourceUsage, nil
+}
+
 func (r *resultSet) ExtractFile(path string) (ioext.ReadSeekCloser, error) {
 	// Evaluate symlinks
 	p, err := filepath.EvalSymlinks(filepath.Join(r.user.Home(), path))
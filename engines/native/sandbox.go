@@ -7,6 +7,7 @@ import (
 	"sync"
 
 	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/engines/hostshell"
 	"github.com/taskcluster/taskcluster-worker/engines/native/system"
 	"github.com/taskcluster/taskcluster-worker/runtime"
 	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
@@ -23,22 +24,31 @@ type sandbox struct {
 	user          *system.User
 	process       *system.Process
 	env           map[string]string
+	cgroup        *system.Cgroup // nil, if no resource limits are configured
+	limits        limits
 	resolve       atomics.Once // Guarding resultSet, resultErr and abortErr
 	resultSet     *resultSet
 	resultErr     error
 	abortErr      error
 	sessions      atomics.WaitGroup
 	mShells       sync.Mutex
-	shells        []*shell
+	shells        []*hostshell.Shell
 }
 
 func newSandbox(b *sandboxBuilder) (engines.Sandbox, error) {
 	var user *system.User
 	var workingFolder runtime.TemporaryFolder
+	var cgroup *system.Cgroup
+	var taskLimits limits
 
 	var err error
 	defer func() {
 		if err != nil {
+			if cgroup != nil {
+				cgroup.Kill()
+				cgroup.Remove()
+			}
+
 			if b.engine.config.CreateUser && user != nil {
 				user.Remove()
 			}
@@ -49,6 +59,22 @@ func newSandbox(b *sandboxBuilder) (engines.Sandbox, error) {
 		}
 	}()
 
+	// Resolve resource limits, payload limits can't exceed configured limits
+	if b.payload.Limits != nil && b.engine.config.Limits == nil {
+		return nil, runtime.NewMalformedPayloadError(
+			"task.payload.limits is not supported, as this worker isn't configured with resource limits",
+		)
+	}
+	if b.engine.config.Limits != nil {
+		taskLimits = *b.engine.config.Limits
+		if b.payload.Limits != nil {
+			taskLimits, err = b.payload.Limits.WithMaximums(taskLimits)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	if b.engine.config.CreateUser {
 		// Create temporary home folder for the task
 		workingFolder, err = b.engine.environment.TemporaryStorage.NewFolder()
@@ -88,6 +114,16 @@ func newSandbox(b *sandboxBuilder) (engines.Sandbox, error) {
 	env["USER"] = user.Name()
 	env["LOGNAME"] = user.Name()
 
+	// Create cgroup enforcing resource limits
+	if b.engine.config.Limits != nil {
+		name := fmt.Sprintf("%s-%d", b.context.TaskID, b.context.RunID)
+		cgroup, err = system.NewCgroup(name, taskLimits.CgroupLimits())
+		if err != nil {
+			err = fmt.Errorf("Failed to create cgroup, error: %s", err)
+			return nil, err
+		}
+	}
+
 	// Start process
 	debug("StartProcess: %v", b.payload.Command)
 	process, err := system.StartProcess(system.ProcessOptions{
@@ -97,6 +133,7 @@ func newSandbox(b *sandboxBuilder) (engines.Sandbox, error) {
 		Owner:         user,
 		Stdout:        ioext.WriteNopCloser(b.context.LogDrain()),
 		// Stderr defaults to Stdout when not specified
+		Cgroup: cgroup,
 	})
 	if err != nil {
 		// StartProcess provides human-readable error messages (see docs)
@@ -114,6 +151,8 @@ func newSandbox(b *sandboxBuilder) (engines.Sandbox, error) {
 		user:          user,
 		process:       process,
 		env:           b.env,
+		cgroup:        cgroup,
+		limits:        taskLimits,
 	}
 
 	go s.waitForTermination()
@@ -192,7 +231,7 @@ func (s *sandbox) NewShell(command []string, tty bool) (engines.Shell, error) {
 		defer s.mShells.Unlock()
 
 		// remove S from s.shells
-		shells := make([]*shell, 0, len(s.shells))
+		shells := make([]*hostshell.Shell, 0, len(s.shells))
 		for _, s2 := range s.shells {
 			if s2 != S {
 				shells = append(shells, s2)
@@ -227,15 +266,48 @@ func (s *sandbox) abortShells() {
 	s.sessions.Wait()
 }
 
+// killProcesses kills all processes in the cgroup, or the process tree of the
+// task, if not running in a cgroup.
+func (s *sandbox) killProcesses() {
+	if s.cgroup != nil {
+		if err := s.cgroup.Kill(); err != nil {
+			s.monitor.Error("Failed to kill processes in cgroup, error: ", err)
+		}
+		return
+	}
+	system.KillProcessTree(s.process)
+}
+
 func (s *sandbox) waitForTermination() {
 	// Wait for process to terminate
 	success := s.process.Wait()
-	debug("Process finished with: %v", success)
+	code, signal := s.process.ExitStatus()
+	usage := engines.ResourceUsage(s.process.ResourceUsage())
+	debug("Process finished with: %v, exit code: %d", success, code)
+
+	// Report if the task was killed for exceeding the memory limit
+	if s.cgroup != nil && s.cgroup.OOMKilled() {
+		s.context.LogError(fmt.Sprintf(
+			"Task was killed by the OOM killer for exceeding the memory limit of %d MiB",
+			s.limits.Memory,
+		))
+		success = false
+	}
 
 	// Wait for all shell to finish and prevent new shells from being created
 	s.sessions.WaitAndDrain()
 	debug("All shells terminated")
 
+	// Kill all remaining processes in the cgroup and remove it
+	if s.cgroup != nil {
+		if err := s.cgroup.Kill(); err != nil {
+			s.monitor.Error("Failed to kill processes in cgroup, error: ", err)
+		}
+		if err := s.cgroup.Remove(); err != nil {
+			s.monitor.Error("Failed to remove cgroup, error: ", err)
+		}
+	}
+
 	s.resolve.Do(func() {
 		// Halt all other sub-processes
 		if s.engine.config.CreateUser {
@@ -250,6 +322,8 @@ func (s *sandbox) waitForTermination() {
 			workingFolder: s.workingFolder,
 			user:          s.user,
 			success:       success,
+			exitStatus:    &engines.ExitStatus{Code: code, Signal: signal},
+			resourceUsage: &usage,
 		}
 		s.abortErr = engines.ErrSandboxTerminated
 	})
@@ -266,7 +340,7 @@ func (s *sandbox) Kill() error {
 		debug("Sandbox.Kill()")
 
 		// Kill process tree
-		system.KillProcessTree(s.process)
+		s.killProcesses()
 
 		// Abort all shells
 		s.abortShells()
@@ -298,7 +372,7 @@ func (s *sandbox) Abort() error {
 		// In case we didn't create a new user, killing
 		// the children processes is the only safe way
 		// to kill processes created by the task.
-		system.KillProcessTree(s.process)
+		s.killProcesses()
 
 		// Abort all shells
 		s.abortShells()
@@ -1,122 +1,19 @@
 package nativeengine
 
 import (
-	"bytes"
-	"io"
-	"io/ioutil"
-
-	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/engines/hostshell"
 	"github.com/taskcluster/taskcluster-worker/engines/native/system"
-	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
 )
 
-type shell struct {
-	process    *system.Process
-	isTTY      bool
-	stdin      io.WriteCloser
-	stdout     io.ReadCloser
-	stderr     io.ReadCloser
-	resolve    atomics.Once // Guarding result, resultErr and abortErr
-	result     bool
-	resultErr  error
-	abortErr   error
-	aborted    atomics.Bool
-	terminated atomics.Bool
-}
-
-func newShell(s *sandbox, command []string, tty bool) (*shell, error) {
-	// Setup some pipes
-	pipein, stdin := io.Pipe()
-	stdout, pipeout := io.Pipe()
-	var stderr io.ReadCloser
-	var pipeerr io.WriteCloser
-	if !tty {
-		stderr, pipeerr = io.Pipe()
-	} else {
-		// If doing a TTY we merge stderr and stdout, so stderr just becomes an
-		// empty stream as far as client is aware
-		stderr = ioutil.NopCloser(bytes.NewBuffer(nil))
-	}
-
-	process, err := system.StartProcess(system.ProcessOptions{
+// newShell starts command as the task user, shells are subject to the
+// resource limits of the task, so they're started in the cgroup of the task.
+func newShell(s *sandbox, command []string, tty bool) (*hostshell.Shell, error) {
+	return hostshell.New(system.ProcessOptions{
 		Arguments:     command,
 		Environment:   s.env,
 		WorkingFolder: s.user.Home(),
 		Owner:         s.user,
-		Stdin:         pipein,
-		Stdout:        pipeout,
-		Stderr:        pipeerr,
 		TTY:           tty,
+		Cgroup:        s.cgroup,
 	})
-	if err != nil {
-		return nil, err
-	}
-
-	shell := &shell{
-		process: process,
-		stdin:   stdin,
-		stdout:  stdout,
-		stderr:  stderr,
-	}
-
-	go shell.waitForResult()
-
-	return shell, nil
-}
-
-func (s *shell) waitForResult() {
-	// wait for process to terminate
-	success := s.process.Wait()
-	debug("shell done")
-
-	s.resolve.Do(func() {
-		s.terminated.Set(true)
-		s.result = success
-		s.abortErr = engines.ErrShellTerminated
-	})
-}
-
-func (s *shell) StdinPipe() io.WriteCloser {
-	return s.stdin
-}
-
-func (s *shell) StdoutPipe() io.ReadCloser {
-	return s.stdout
-}
-
-func (s *shell) StderrPipe() io.ReadCloser {
-	return s.stderr
-}
-
-func (s *shell) SetSize(columns, rows uint16) error {
-	// Best effort check if we've terminated
-	if s.aborted.Get() {
-		return engines.ErrSandboxAborted
-	}
-	if s.terminated.Get() {
-		return engines.ErrShellTerminated
-	}
-	// Feature not supported if not tty
-	if s.isTTY {
-		//TODO: Write a test case in system/ package to check that SetSize()
-		//      doesn't cause issues if called after Kill()
-		s.process.SetSize(columns, rows)
-		return nil
-	}
-	return engines.ErrFeatureNotSupported
-}
-
-func (s *shell) Abort() error {
-	s.resolve.Do(func() {
-		s.terminated.Set(true)
-		system.KillProcessTree(s.process)
-		s.resultErr = engines.ErrShellAborted
-	})
-	s.resolve.Wait()
-	return s.abortErr
-}
-
-func (s *shell) Wait() (bool, error) {
-	s.resolve.Wait()
-	return s.result, s.resultErr
 }
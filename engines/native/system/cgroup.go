@@ -0,0 +1,10 @@
+package system
+
+// CgroupLimits specifies resource limits for a Cgroup, zero values means
+// unlimited.
+type CgroupLimits struct {
+	Memory   int64   // Maximum memory in bytes
+	CPUs     float64 // Maximum number of CPUs (CPU time per wall-clock time)
+	Pids     int64   // Maximum number of processes
+	IOWeight int64   // Relative disk-IO weight from 1 to 10000
+}
@@ -0,0 +1,363 @@
+package system
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Mountpoint for the cgroup file systems
+const cgroupMount = "/sys/fs/cgroup"
+
+// Name of the parent cgroup in which cgroups for tasks are created
+const cgroupParent = "taskcluster-worker"
+
+// Controllers used with cgroups v2
+var cgroupV2Controllers = []string{"memory", "cpu", "pids", "io"}
+
+// Hierarchies used with cgroups v1, the first must always be present
+var cgroupV1Hierarchies = []string{"pids", "memory", "cpu", "blkio"}
+
+// A Cgroup is a control group that resource limits are enforced on. Cgroups v2
+// is used if available, otherwise cgroups v1 hierarchies are used.
+type Cgroup struct {
+	v2    bool
+	paths map[string]string // controller/hierarchy -> folder, v2 uses ""
+}
+
+// CgroupsSupported returns nil if cgroups can be used, otherwise an error
+// explaining why not.
+func CgroupsSupported() error {
+	if _, err := os.Stat(filepath.Join(cgroupMount, "cgroup.controllers")); err == nil {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(cgroupMount, cgroupV1Hierarchies[0])); err != nil {
+		return errors.Errorf("neither cgroups v2 nor cgroups v1 is mounted at %s", cgroupMount)
+	}
+	return nil
+}
+
+// writeCgroupFile writes value to file in a cgroup folder
+func writeCgroupFile(folder, file, value string) error {
+	err := ioutil.WriteFile(filepath.Join(folder, file), []byte(value), 0644)
+	if err != nil {
+		return errors.Wrapf(err, "failed to write '%s' to %s", value, filepath.Join(folder, file))
+	}
+	return nil
+}
+
+// NewCgroup creates a new cgroup with given name and limits. If a cgroup with
+// the given name already exists, any processes in it are killed and it is
+// replaced.
+func NewCgroup(name string, limits CgroupLimits) (*Cgroup, error) {
+	if err := CgroupsSupported(); err != nil {
+		return nil, err
+	}
+	c := &Cgroup{paths: make(map[string]string)}
+	if _, err := os.Stat(filepath.Join(cgroupMount, "cgroup.controllers")); err == nil {
+		c.v2 = true
+		c.paths[""] = filepath.Join(cgroupMount, cgroupParent, name)
+	} else {
+		for _, hierarchy := range cgroupV1Hierarchies {
+			if _, err := os.Stat(filepath.Join(cgroupMount, hierarchy)); err == nil {
+				c.paths[hierarchy] = filepath.Join(cgroupMount, hierarchy, cgroupParent, name)
+			}
+		}
+	}
+
+	// Remove left-overs from previous runs
+	c.Kill()
+	c.Remove()
+
+	if c.v2 {
+		// Enable controllers for the parent and children of the parent, the root
+		// cgroup is exempt from the no-internal-process constraint.
+		parent := filepath.Join(cgroupMount, cgroupParent)
+		if err := os.MkdirAll(parent, 0755); err != nil {
+			return nil, errors.Wrap(err, "failed to create parent cgroup")
+		}
+		for _, folder := range []string{cgroupMount, parent} {
+			data, err := ioutil.ReadFile(filepath.Join(folder, "cgroup.controllers"))
+			if err != nil {
+				return nil, errors.Wrap(err, "failed to read available cgroup controllers")
+			}
+			available := strings.Fields(string(data))
+			for _, controller := range cgroupV2Controllers {
+				if !stringContains(available, controller) {
+					continue // setLimits fails, if limits for this controller is given
+				}
+				if err = writeCgroupFile(folder, "cgroup.subtree_control", "+"+controller); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	for _, folder := range c.paths {
+		if err := os.MkdirAll(folder, 0755); err != nil {
+			c.Remove()
+			return nil, errors.Wrap(err, "failed to create cgroup")
+		}
+	}
+
+	if err := c.setLimits(limits); err != nil {
+		c.Remove()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Cgroup) setLimits(limits CgroupLimits) error {
+	// Collect files and values to write for each controller/hierarchy
+	type entry struct {
+		controller, file, value string
+		optional                bool // Ignore if file doesn't exist
+	}
+	var entries []entry
+	if c.v2 {
+		if limits.Memory > 0 {
+			entries = append(entries,
+				entry{"", "memory.max", strconv.FormatInt(limits.Memory, 10), false},
+				entry{"", "memory.swap.max", "0", true},
+			)
+		}
+		if limits.CPUs > 0 {
+			quota := int64(limits.CPUs * 100000)
+			entries = append(entries, entry{"", "cpu.max", fmt.Sprintf("%d 100000", quota), false})
+		}
+		if limits.Pids > 0 {
+			entries = append(entries, entry{"", "pids.max", strconv.FormatInt(limits.Pids, 10), false})
+		}
+		if limits.IOWeight > 0 {
+			entries = append(entries, entry{"", "io.weight", fmt.Sprintf("default %d", limits.IOWeight), false})
+		}
+	} else {
+		if limits.Memory > 0 {
+			value := strconv.FormatInt(limits.Memory, 10)
+			entries = append(entries,
+				entry{"memory", "memory.limit_in_bytes", value, false},
+				entry{"memory", "memory.memsw.limit_in_bytes", value, true},
+			)
+		}
+		if limits.CPUs > 0 {
+			quota := int64(limits.CPUs * 100000)
+			entries = append(entries,
+				entry{"cpu", "cpu.cfs_period_us", "100000", false},
+				entry{"cpu", "cpu.cfs_quota_us", strconv.FormatInt(quota, 10), false},
+			)
+		}
+		if limits.Pids > 0 {
+			entries = append(entries, entry{"pids", "pids.max", strconv.FormatInt(limits.Pids, 10), false})
+		}
+		if limits.IOWeight > 0 {
+			// blkio.weight ranges from 10 to 1000
+			weight := limits.IOWeight / 10
+			if weight < 10 {
+				weight = 10
+			}
+			entries = append(entries, entry{"blkio", "blkio.weight", strconv.FormatInt(weight, 10), false})
+		}
+	}
+
+	for _, e := range entries {
+		folder, ok := c.paths[e.controller]
+		if !ok {
+			return errors.Errorf("cgroup hierarchy '%s' is not mounted", e.controller)
+		}
+		if _, err := os.Stat(filepath.Join(folder, e.file)); err != nil && e.optional {
+			continue
+		}
+		if err := writeCgroupFile(folder, e.file, e.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cgroupExecName is given as os.Args[0], when the worker re-executes itself to
+// start a process in a cgroup.
+const cgroupExecName = "taskcluster-worker-cgroup-exec"
+
+// File descriptor from which cgroupExec reads, when it has been added to the
+// cgroup.
+const cgroupExecReadyFd = 3
+
+func init() {
+	// When the worker re-executes itself to start a process in a cgroup, we wait
+	// for the parent to add us to the cgroup and exec the command. This never
+	// returns.
+	if len(os.Args) > 2 && os.Args[0] == cgroupExecName {
+		cgroupExec(os.Args[1], os.Args[2:])
+	}
+}
+
+// cgroupExec waits for the parent to write a byte to cgroupExecReadyFd, and
+// executes binary with args. If the pipe is closed without a byte written, the
+// parent failed to add us to the cgroup, and we exit without executing binary.
+func cgroupExec(binary string, args []string) {
+	ready := os.NewFile(cgroupExecReadyFd, "ready-pipe")
+	n, _ := ready.Read(make([]byte, 1))
+	ready.Close()
+	if n != 1 {
+		os.Exit(1)
+	}
+	err := syscall.Exec(binary, args, os.Environ())
+	fmt.Fprintf(os.Stderr, "Failed to execute '%s', error: %s\n", binary, err)
+	os.Exit(1)
+}
+
+// wrapCommand modifies cmd to re-execute the worker as cgroupExecName, which
+// waits for addProcess to be called before it executes the command. Otherwise,
+// the command could fork processes outside the cgroup, before being added.
+func (c *Cgroup) wrapCommand(cmd *exec.Cmd) (*os.File, error) {
+	// Lookup the binary here, as we don't want to replace errors from exec.Cmd
+	binary := cmd.Path
+	if filepath.Base(binary) == binary {
+		var err error
+		if binary, err = exec.LookPath(binary); err != nil {
+			return nil, err
+		}
+	}
+
+	ready, release, err := os.Pipe()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create pipe")
+	}
+	cmd.Path = "/proc/self/exe"
+	cmd.Args = append([]string{cgroupExecName, binary}, cmd.Args...)
+	cmd.ExtraFiles = []*os.File{ready}
+	return release, nil
+}
+
+// addProcess adds the process started from a command modified by wrapCommand
+// to the cgroup, and releases it to execute the command by writing to release.
+func (c *Cgroup) addProcess(cmd *exec.Cmd, release *os.File) error {
+	defer release.Close()
+	cmd.ExtraFiles[0].Close()
+
+	for _, folder := range c.paths {
+		err := writeCgroupFile(folder, "cgroup.procs", strconv.Itoa(cmd.Process.Pid))
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := release.Write([]byte{1}); err != nil {
+		return errors.Wrap(err, "failed to release process added to cgroup")
+	}
+	return nil
+}
+
+func stringContains(list []string, value string) bool {
+	for _, s := range list {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
+
+// trackingPath returns the folder in which cgroup.procs lists all processes
+func (c *Cgroup) trackingPath() string {
+	if c.v2 {
+		return c.paths[""]
+	}
+	return c.paths[cgroupV1Hierarchies[0]]
+}
+
+// pids returns the processes in the cgroup
+func (c *Cgroup) pids() []int {
+	data, err := ioutil.ReadFile(filepath.Join(c.trackingPath(), "cgroup.procs"))
+	if err != nil {
+		return nil
+	}
+	var pids []int
+	for _, line := range strings.Fields(string(data)) {
+		if pid, err := strconv.Atoi(line); err == nil {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// Kill all processes in the cgroup, and wait for them to be gone.
+func (c *Cgroup) Kill() error {
+	// Use cgroup.kill if available (Linux 5.14 and later)
+	if c.v2 {
+		if _, err := os.Stat(filepath.Join(c.paths[""], "cgroup.kill")); err == nil {
+			if err = writeCgroupFile(c.paths[""], "cgroup.kill", "1"); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Keep sending SIGKILL until the cgroup is empty, this handles processes
+	// forking while we're killing them.
+	for i := 0; i < 500; i++ {
+		pids := c.pids()
+		if len(pids) == 0 {
+			return nil
+		}
+		for _, pid := range pids {
+			syscall.Kill(pid, syscall.SIGKILL)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return errors.New("failed to kill all processes in cgroup")
+}
+
+// OOMKilled returns true, if a process in the cgroup was killed by the OOM
+// killer, because the cgroup exceeded its memory limit.
+func (c *Cgroup) OOMKilled() bool {
+	var file string
+	if c.v2 {
+		file = filepath.Join(c.paths[""], "memory.events")
+	} else if folder, ok := c.paths["memory"]; ok {
+		file = filepath.Join(folder, "memory.oom_control")
+	} else {
+		return false
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	// Both files contains lines on the form 'key value'
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" && fields[1] != "0" {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove the cgroup, this requires that all processes have been killed.
+func (c *Cgroup) Remove() error {
+	var result error
+	for _, folder := range c.paths {
+		// Removal fails with EBUSY while processes are exiting, so we retry
+		var err error
+		for i := 0; i < 50; i++ {
+			err = syscall.Rmdir(folder)
+			if err == nil || err == syscall.ENOENT {
+				err = nil
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		if err != nil && result == nil {
+			result = errors.Wrapf(err, "failed to remove cgroup %s", folder)
+		}
+	}
+	return result
+}
@@ -0,0 +1,54 @@
+// +build linux,system
+
+package system
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/slugid-go/slugid"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+)
+
+func TestStartProcessInCgroup(t *testing.T) {
+	if err := CgroupsSupported(); err != nil {
+		t.Skip("cgroups not supported, error: ", err)
+	}
+	c, err := NewCgroup("test-start-process", CgroupLimits{Pids: 100})
+	require.NoError(t, err)
+	defer c.Remove()
+	defer c.Kill()
+
+	homeDir := filepath.Join(os.TempDir(), slugid.Nice())
+	require.NoError(t, os.MkdirAll(homeDir, 0777))
+	defer os.RemoveAll(homeDir)
+	u, err := CreateUser(homeDir, nil)
+	require.NoError(t, err)
+	defer u.Remove()
+
+	// The process and its sub-processes are in the cgroup from the start
+	var out bytes.Buffer
+	p, err := StartProcess(ProcessOptions{
+		Arguments: []string{"sh", "-c", "cat /proc/self/cgroup; id -u"},
+		Owner:     u,
+		Stdout:    ioext.WriteNopCloser(&out),
+		Cgroup:    c,
+	})
+	require.NoError(t, err)
+	require.True(t, p.Wait(), "output: %s", out.String())
+	assert.Contains(t, out.String(), "/"+cgroupParent+"/test-start-process")
+	assert.NotContains(t, out.String(), "\n0\n", "expected process to run as the user")
+
+	// Commands that can't be found are reported before the process is started
+	_, err = StartProcess(ProcessOptions{
+		Arguments: []string{"no-such-command-in-path"},
+		Stdout:    ioext.WriteNopCloser(ioutil.Discard),
+		Cgroup:    c,
+	})
+	assert.Error(t, err)
+}
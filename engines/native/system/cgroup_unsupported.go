@@ -0,0 +1,45 @@
+// +build !linux
+
+package system
+
+import (
+	"os"
+	"os/exec"
+)
+
+// A Cgroup is a control group that resource limits are enforced on, this is
+// only supported on Linux.
+type Cgroup struct{}
+
+// CgroupsSupported returns ErrCgroupsNotSupported on this platform.
+func CgroupsSupported() error {
+	return ErrCgroupsNotSupported
+}
+
+// NewCgroup returns ErrCgroupsNotSupported on this platform.
+func NewCgroup(name string, limits CgroupLimits) (*Cgroup, error) {
+	return nil, ErrCgroupsNotSupported
+}
+
+func (c *Cgroup) wrapCommand(cmd *exec.Cmd) (*os.File, error) {
+	return nil, ErrCgroupsNotSupported
+}
+
+func (c *Cgroup) addProcess(cmd *exec.Cmd, release *os.File) error {
+	return ErrCgroupsNotSupported
+}
+
+// Kill is not supported on this platform.
+func (c *Cgroup) Kill() error {
+	return ErrCgroupsNotSupported
+}
+
+// OOMKilled always returns false on this platform.
+func (c *Cgroup) OOMKilled() bool {
+	return false
+}
+
+// Remove is not supported on this platform.
+func (c *Cgroup) Remove() error {
+	return ErrCgroupsNotSupported
+}
@@ -15,6 +15,8 @@
 //      system.FindGroup(name string) (*Group, error)
 //     	system.StartProcess(options ProcessOptions) (*Process, error)
 //     	system.KillByOwner(user *User) error
+//      system.Cgroup (only supported on Linux)
+//      system.NewCgroup(name string, limits CgroupLimits) (*Cgroup, error)
 package system
 
 import "github.com/taskcluster/taskcluster-worker/runtime/util"
@@ -4,3 +4,7 @@ import "errors"
 
 // ErrUserGroupNotFound indicates that a given user-group doesn't exist.
 var ErrUserGroupNotFound = errors.New("user group doesn't exist")
+
+// ErrCgroupsNotSupported indicates that cgroups aren't supported on the
+// current platform.
+var ErrCgroupsNotSupported = errors.New("cgroups are not supported on this platform")
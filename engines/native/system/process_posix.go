@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"os/exec"
 	"os/user"
 	"strconv"
@@ -18,20 +19,24 @@ import (
 	"github.com/taskcluster/taskcluster-worker/plugins/interactive/pty"
 	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
 	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+	"github.com/taskcluster/taskcluster-worker/runtime/processstate"
 )
 
 const systemPKill = "/usr/bin/pkill"
 
 // Process is a representation of a system process.
 type Process struct {
-	cmd     *exec.Cmd
-	pty     *pty.PTY
-	resolve atomics.Once
-	sockets sync.WaitGroup
-	result  bool
-	stdin   io.ReadCloser
-	stdout  io.WriteCloser
-	stderr  io.WriteCloser
+	cmd      *exec.Cmd
+	pty      *pty.PTY
+	resolve  atomics.Once
+	sockets  sync.WaitGroup
+	result   bool
+	started  time.Time
+	state    *os.ProcessState // nil, if waiting for the process failed
+	wallTime time.Duration    // time from start until the process exited
+	stdin    io.ReadCloser
+	stdout   io.WriteCloser
+	stderr   io.WriteCloser
 }
 
 func pkill(args ...string) error {
@@ -182,8 +187,18 @@ func StartProcess(options ProcessOptions) (*Process, error) {
 		}
 	}
 
-	// Start the process
+	// Start the process through a helper that waits to be added to the cgroup,
+	// so the command can't fork processes outside the cgroup
 	var err error
+	var release *os.File
+	if options.Cgroup != nil {
+		release, err = options.Cgroup.wrapCommand(p.cmd)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to execute binary, error: %s", err)
+		}
+	}
+
+	// Start the process
 	if !options.TTY {
 		p.cmd.Stdin = options.Stdin
 		p.cmd.Stdout = options.Stdout
@@ -209,19 +224,33 @@ func StartProcess(options ProcessOptions) (*Process, error) {
 	}
 
 	if err != nil {
+		if release != nil {
+			release.Close()
+			p.cmd.ExtraFiles[0].Close()
+		}
 		debug("Failed to start process, error: %s", err)
 		return nil, fmt.Errorf("Unable to execute binary, error: %s", err)
 	}
+	p.started = time.Now()
 	debug("Started process with %v", options.Arguments)
 
 	// Go wait for result
 	go p.waitForResult()
 
+	// Add the process to the cgroup, the helper exits if this fails
+	if release != nil {
+		if err = options.Cgroup.addProcess(p.cmd, release); err != nil {
+			p.Kill()
+			return nil, fmt.Errorf("Failed to add process to cgroup, error: %s", err)
+		}
+	}
+
 	return p, nil
 }
 
 func (p *Process) waitForResult() {
 	err := p.cmd.Wait()
+	exited := time.Now()
 	debug("Process, cmd.Wait() return: %v", err)
 
 	p.sockets.Wait()
@@ -243,6 +272,8 @@ func (p *Process) waitForResult() {
 	// Resolve with result
 	p.resolve.Do(func() {
 		p.result = err == nil
+		p.state = p.cmd.ProcessState
+		p.wallTime = exited.Sub(p.started)
 	})
 }
 
@@ -252,6 +283,20 @@ func (p *Process) Wait() bool {
 	return p.result
 }
 
+// ExitStatus waits for the process to terminate and returns the exit code,
+// or -1 and a description of the signal, if terminated by a signal.
+func (p *Process) ExitStatus() (code int, signal string) {
+	p.resolve.Wait()
+	return processstate.ExitStatusOf(p.state)
+}
+
+// ResourceUsage waits for the process to terminate and returns the resources
+// used by the process.
+func (p *Process) ResourceUsage() processstate.ResourceUsage {
+	p.resolve.Wait()
+	return processstate.ResourceUsageOf(p.state, p.wallTime)
+}
+
 // Kill the process
 func (p *Process) Kill() {
 	p.cmd.Process.Kill()
@@ -4,27 +4,33 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"os/exec"
 	"os/user"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
 	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+	"github.com/taskcluster/taskcluster-worker/runtime/processstate"
 )
 
 const defaultShell = "cmd.exe"
 
 // Process is a representation of a system process.
 type Process struct {
-	cmd     *exec.Cmd
-	resolve atomics.Once
-	sockets sync.WaitGroup
-	result  bool
-	stdin   io.ReadCloser
-	stdout  io.WriteCloser
-	stderr  io.WriteCloser
+	cmd      *exec.Cmd
+	resolve  atomics.Once
+	sockets  sync.WaitGroup
+	result   bool
+	started  time.Time
+	state    *os.ProcessState // nil, if waiting for the process failed
+	wallTime time.Duration    // time from start until the process exited
+	stdin    io.ReadCloser
+	stdout   io.WriteCloser
+	stderr   io.WriteCloser
 }
 
 // StartProcess starts a new process with given arguments, environment variables,
@@ -33,6 +39,10 @@ type Process struct {
 // Returns an human readable error explaining why the sub-process couldn't start
 // if not successful.
 func StartProcess(options ProcessOptions) (*Process, error) {
+	if options.Cgroup != nil {
+		return nil, ErrCgroupsNotSupported
+	}
+
 	// Default arguments to system shell
 	if len(options.Arguments) == 0 {
 		options.Arguments = []string{defaultShell}
@@ -99,6 +109,7 @@ func StartProcess(options ProcessOptions) (*Process, error) {
 		debug("Failed to start process, error: %s", err)
 		return nil, fmt.Errorf("Unable to execute binary, error: %s", err)
 	}
+	p.started = time.Now()
 	debug("Started process with %v", options.Arguments)
 
 	// Go wait for result
@@ -109,6 +120,7 @@ func StartProcess(options ProcessOptions) (*Process, error) {
 
 func (p *Process) waitForResult() {
 	err := p.cmd.Wait()
+	exited := time.Now()
 	debug("Process, cmd.Wait() return: %v", err)
 
 	p.sockets.Wait()
@@ -127,6 +139,8 @@ func (p *Process) waitForResult() {
 	// Resolve with result
 	p.resolve.Do(func() {
 		p.result = err == nil
+		p.state = p.cmd.ProcessState
+		p.wallTime = exited.Sub(p.started)
 	})
 }
 
@@ -136,6 +150,20 @@ func (p *Process) Wait() bool {
 	return p.result
 }
 
+// ExitStatus waits for the process to terminate and returns the exit code,
+// or -1 and a description of the signal, if terminated by a signal.
+func (p *Process) ExitStatus() (code int, signal string) {
+	p.resolve.Wait()
+	return processstate.ExitStatusOf(p.state)
+}
+
+// ResourceUsage waits for the process to terminate and returns the resources
+// used by the process.
+func (p *Process) ResourceUsage() processstate.ResourceUsage {
+	p.resolve.Wait()
+	return processstate.ResourceUsageOf(p.state, p.wallTime)
+}
+
 // Kill the process
 func (p *Process) Kill() {
 	p.cmd.Process.Kill()
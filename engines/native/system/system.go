@@ -13,4 +13,5 @@ type ProcessOptions struct {
 	Stdout        io.WriteCloser    // Stream for stdout
 	Stderr        io.WriteCloser    // Stream for stderr, or nil if using stdout
 	TTY           bool              // Start as TTY, if supported, ignores stderr
+	Cgroup        *Cgroup           // Cgroup to start process in, nil if none
 }
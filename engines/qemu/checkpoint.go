@@ -0,0 +1,116 @@
+package qemuengine
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/engines/qemu/image"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/fetcher"
+)
+
+// Name of the artifact checkpoints are uploaded as
+const checkpointArtifactName = "private/qemu/checkpoint.tar.zst"
+
+// Scope required to resume from checkpoints, other than the checkpoints
+// uploaded by previous runs of the task itself.
+const resumeFromScope = "worker:qemu:resume-from"
+
+// checkpoint saves the virtual machine state and disk, and uploads it as an
+// artifact. This terminates the virtual machine, if successful.
+func (s *sandbox) checkpoint() error {
+	folder, err := s.engine.Environment.TemporaryStorage.NewFolder()
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary folder for checkpoint")
+	}
+	defer folder.Remove()
+
+	// Save state, disk and NVRAM, then package it with the machine definition
+	machine := s.vm.Machine()
+	err = s.vm.Checkpoint(
+		filepath.Join(folder.Path(), "state.bin"),
+		filepath.Join(folder.Path(), "layer.qcow2"),
+		filepath.Join(folder.Path(), "nvram.bin"),
+	)
+	if err != nil {
+		return err
+	}
+	checkpointFile := filepath.Join(folder.Path(), "checkpoint.tar.zst")
+	err = image.PackageCheckpoint(folder.Path(), machine, s.imageHash, checkpointFile)
+	if err != nil {
+		return err
+	}
+
+	// Upload checkpoint as artifact
+	f, err := os.Open(checkpointFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to open checkpoint file")
+	}
+	defer f.Close()
+	err = s.context.UploadS3Artifact(runtime.S3Artifact{
+		Name:     checkpointArtifactName,
+		Mimetype: "application/octet-stream",
+		Expires:  s.context.TaskInfo.Expires,
+		Stream:   f,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to upload checkpoint artifact")
+	}
+	s.context.Log("Checkpoint of the virtual machine uploaded as: ", checkpointArtifactName)
+	return nil
+}
+
+// isOwnCheckpoint returns true, if resumeFrom references the checkpoint
+// artifact from a previous run of the task given by info.
+func isOwnCheckpoint(resumeFrom interface{}, info runtime.TaskInfo) bool {
+	schema := fetcher.Artifact.Schema()
+	if schema.Validate(resumeFrom) != nil {
+		return false
+	}
+	var r struct {
+		TaskID   string `json:"taskId"`
+		RunID    int    `json:"runId"`
+		Artifact string `json:"artifact"`
+	}
+	r.RunID = -1 // latest runId isn't necessarily a previous run
+	schematypes.MustValidateAndMap(schema, resumeFrom, &r)
+	return r.TaskID == info.TaskID && r.RunID >= 0 && r.RunID < info.RunID &&
+		r.Artifact == checkpointArtifactName
+}
+
+// loadCheckpoint fetches the checkpoint referenced by resumeFrom and loads
+// it into the image instance.
+//
+// Checkpoints are loaded by QEMU as a migration stream, hence, unless
+// resumeFrom references a checkpoint uploaded by a previous run of this task,
+// the resumeFromScope is required.
+func loadCheckpoint(ctx *fetchImageContext, resumeFrom interface{}, inst *image.Instance, e *engine) error {
+	if !isOwnCheckpoint(resumeFrom, ctx.TaskInfo) && !ctx.HasScopes([]string{resumeFromScope}) {
+		return runtime.NewMalformedPayloadError(
+			"task.payload.resumeFrom must reference the artifact '", checkpointArtifactName,
+			"' from a previous run of this task, unless task.scopes has '", resumeFromScope, "'",
+		)
+	}
+
+	ref, err := imageFetcher.NewReference(ctx, resumeFrom)
+	if err != nil {
+		return err
+	}
+	if err = checkReferenceScopes(ctx.TaskContext, ref); err != nil {
+		return err
+	}
+
+	file, err := e.Environment.TemporaryStorage.NewFile()
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary file for checkpoint")
+	}
+	defer file.Close()
+
+	debug("fetching checkpoint: %#v", resumeFrom)
+	if err = ref.Fetch(ctx, &fetcher.FileReseter{File: file}); err != nil {
+		return err
+	}
+	return inst.LoadCheckpoint(file.Path())
+}
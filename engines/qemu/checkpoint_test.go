@@ -0,0 +1,30 @@
+package qemuengine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+func TestIsOwnCheckpoint(t *testing.T) {
+	info := runtime.TaskInfo{TaskID: "Pe0hb7TYR3uSkWtZVYQGsg", RunID: 2}
+	ref := func(taskID string, runID int, artifact string) interface{} {
+		r := map[string]interface{}{
+			"taskId":   taskID,
+			"artifact": artifact,
+		}
+		if runID >= 0 {
+			r["runId"] = runID
+		}
+		return r
+	}
+
+	require.True(t, isOwnCheckpoint(ref(info.TaskID, 0, checkpointArtifactName), info))
+	require.True(t, isOwnCheckpoint(ref(info.TaskID, 1, checkpointArtifactName), info))
+	require.False(t, isOwnCheckpoint(ref(info.TaskID, 2, checkpointArtifactName), info), "current run")
+	require.False(t, isOwnCheckpoint(ref(info.TaskID, -1, checkpointArtifactName), info), "latest run")
+	require.False(t, isOwnCheckpoint(ref(info.TaskID, 1, "private/qemu/other.tar.zst"), info), "other artifact")
+	require.False(t, isOwnCheckpoint(ref("Q_7rQ0gHR8y8yj6hHkH6QA", 1, checkpointArtifactName), info), "other task")
+	require.False(t, isOwnCheckpoint("https://example.com/checkpoint.tar.zst", info), "url")
+}
@@ -4,6 +4,8 @@
 //  - qemu
 //  - iproute2
 //  - dnsmasq-base
+//  - ovmf (for machines with UEFI firmware)
+//  - swtpm (for machines with a TPM)
 // This is tested against Debian Jessie 64bit, should probably work with most
 // other systems.
 package qemuengine
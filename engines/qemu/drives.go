@@ -0,0 +1,132 @@
+package qemuengine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/taskcluster/taskcluster-worker/engines/qemu/image"
+	"github.com/taskcluster/taskcluster-worker/engines/qemu/vm"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/fetcher"
+)
+
+// attachDrives creates files for the additional drives of the machine given
+// by img, and returns an image with the files attached. The files are deleted
+// when the image is released, or when remove is called, if the image is never
+// used.
+//
+// Scratch disks are created empty, data disks are backed by data files from
+// inst, and ISO files for cdrom drives are fetched using imageFetcher.
+func attachDrives(
+	img vm.Image, inst *image.Instance, c *runtime.TaskContext, e *engine,
+) (result vm.Image, remove func(), err error) {
+	drives := img.Machine().Drives()
+	if len(drives) == 0 {
+		return img, func() {}, nil
+	}
+
+	// Validate drives before we start creating files
+	limits := e.engineConfig.MachineLimits
+	if _, err = img.Machine().ApplyLimits(limits); err != nil {
+		return nil, nil, err
+	}
+	maxSize := int64(limits.MaxDriveSize) * 1024 * 1024
+
+	folder, err := e.Environment.TemporaryStorage.NewFolder()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create temporary folder for drives, error: %s", err)
+	}
+	remove = func() {
+		if rerr := folder.Remove(); rerr != nil {
+			e.monitor.ReportWarning(rerr, "failed to remove folder with drive files")
+		}
+	}
+
+	files := make([]string, len(drives))
+	for i, d := range drives {
+		files[i] = filepath.Join(folder.Path(), fmt.Sprintf("drive-%d", i))
+		switch d.Type {
+		case vm.DriveScratch:
+			err = image.CreateScratchDisk(files[i], d.Size)
+		case vm.DriveData:
+			err = inst.CreateDataDisk(d.File, files[i], maxSize)
+		case vm.DriveCDROM:
+			err = fetchISO(&fetchImageContext{c}, d.Source, files[i], maxSize)
+		}
+		if err != nil {
+			remove()
+			return nil, nil, err
+		}
+	}
+
+	return vm.AttachDrives(img, files, remove), remove, nil
+}
+
+// errISOTooLarge is returned from boundedWriteReseter when exceeding max
+var errISOTooLarge = errors.New("ISO file is larger than the maximum drive size")
+
+// boundedWriteReseter is a fetcher.WriteReseter that fails, if more than max
+// bytes are written.
+type boundedWriteReseter struct {
+	fetcher.WriteReseter
+	max      int64
+	written  int64
+	exceeded bool
+}
+
+func (w *boundedWriteReseter) Write(p []byte) (int, error) {
+	if w.written+int64(len(p)) > w.max {
+		w.exceeded = true
+		return 0, errISOTooLarge
+	}
+	n, err := w.WriteReseter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *boundedWriteReseter) Reset() error {
+	w.written = 0
+	return w.WriteReseter.Reset()
+}
+
+// fetchISO fetches the ISO file referenced by source to target, and returns
+// a MalformedPayloadError, if the ISO file is larger than maxSize bytes.
+func fetchISO(ctx *fetchImageContext, source interface{}, target string, maxSize int64) error {
+	// The machine schema doesn't know the fetchers, so we validate here
+	if imageFetcher.Schema().Validate(source) != nil {
+		return runtime.NewMalformedPayloadError(
+			"source for cdrom drive: ", source, " isn't a valid reference to a file",
+		)
+	}
+	ref, err := imageFetcher.NewReference(ctx, source)
+	if err == nil {
+		err = checkReferenceScopes(ctx.TaskContext, ref)
+	}
+
+	var w *boundedWriteReseter
+	if err == nil {
+		var file *os.File
+		file, err = os.Create(target)
+		if err != nil {
+			return fmt.Errorf("failed to create file for ISO, error: %s", err)
+		}
+		defer file.Close()
+
+		debug("fetching ISO: %#v", source)
+		w = &boundedWriteReseter{WriteReseter: &fetcher.FileReseter{File: file}, max: maxSize}
+		err = ref.Fetch(ctx, w)
+	}
+
+	if w != nil && w.exceeded {
+		return runtime.NewMalformedPayloadError(
+			"ISO file for cdrom drive is larger than ", maxSize,
+			" bytes, which is the maximum allowed drive size",
+		)
+	}
+	if fetcher.IsBrokenReferenceError(err) {
+		return runtime.NewMalformedPayloadError("unable to fetch ISO for cdrom drive, error: ", err)
+	}
+	return err
+}
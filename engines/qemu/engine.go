@@ -1,13 +1,17 @@
 package qemuengine
 
 import (
+	"strings"
+
 	"github.com/pkg/errors"
 	schematypes "github.com/taskcluster/go-schematypes"
 	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/engines/hostvolume"
 	"github.com/taskcluster/taskcluster-worker/engines/qemu/image"
 	"github.com/taskcluster/taskcluster-worker/engines/qemu/network"
 	"github.com/taskcluster/taskcluster-worker/engines/qemu/vm"
 	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
 )
 
 type engine struct {
@@ -27,9 +31,13 @@ type engineProvider struct {
 }
 
 type configType struct {
-	Network       interface{}      `json:"network"`
-	MachineLimits vm.MachineLimits `json:"limits"`
-	Machine       interface{}      `json:"machine"`
+	Network              interface{}      `json:"network"`
+	MachineLimits        vm.MachineLimits `json:"limits"`
+	Machine              interface{}      `json:"machine"`
+	CheckpointOnShutdown bool             `json:"checkpointOnShutdown"`
+	RestoreSavedState    bool             `json:"restoreSavedState"`
+	EgressPolicyScopes   []string         `json:"egressPolicyScopes"`
+	Metrics              *metricsConfig   `json:"metrics,omitempty"`
 }
 
 var configSchema = schematypes.Object{
@@ -37,6 +45,43 @@ var configSchema = schematypes.Object{
 		"network": network.PoolConfigSchema,
 		"limits":  vm.MachineLimitsSchema,
 		"machine": vm.MachineSchema,
+		"checkpointOnShutdown": schematypes.Boolean{
+			Title: "Checkpoint on Shutdown",
+			Description: util.Markdown(`
+				If true, running virtual machines are checkpointed when the worker is
+				shutting down, for example, when a spot instance is terminated. The
+				state and disk of the virtual machine is uploaded as the private
+				artifact '` + checkpointArtifactName + `', which a rerun of the task
+				can resume from using 'task.payload.resumeFrom'. Resuming from other
+				checkpoints requires the scope '` + resumeFromScope + `'.
+
+				Virtual machines with volumes mounted or additional drives can't be
+				checkpointed, such tasks are aborted as usual. Defaults to false.
+			`),
+		},
+		"restoreSavedState": schematypes.Boolean{
+			Title: "Restore Saved State",
+			Description: util.Markdown(`
+				If true, virtual machines are restored from the saved state in images
+				built with 'qemu-build --save-state', instead of booting from disk.
+				Saved state is loaded by QEMU as a migration stream, hence, this should
+				only be enabled if all images tasks can use are trusted.
+
+				If false, saved state in images is ignored. Defaults to false.
+			`),
+		},
+		"egressPolicyScopes": schematypes.Array{
+			Title: "Egress Policy Scopes",
+			Description: util.Markdown(`
+				Scopes required to set 'task.payload.egressPolicy', unless the mode is
+				'deny-all'. Egress policies from tasks can only narrow the default
+				'egressPolicy' from the network configuration, so this may be empty.
+
+				Defaults to '["` + defaultEgressPolicyScope + `"]', if not specified.
+			`),
+			Items: schematypes.String{},
+		},
+		"metrics": metricsConfigSchema,
 	},
 	Required: []string{
 		"network",
@@ -52,6 +97,19 @@ func (p engineProvider) NewEngine(options engines.EngineOptions) (engines.Engine
 	var c configType
 	schematypes.MustValidateAndMap(configSchema, options.Config, &c)
 
+	// Detect KVM availability, so we don't have to do it for each VM
+	accel, err := vm.ResolveAccelerator(c.MachineLimits.Accelerator)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to select accelerator")
+	}
+	if accel != vm.AcceleratorKVM {
+		options.Monitor.Warnf("KVM isn't used, virtual machines will use '%s' software emulation", accel)
+	}
+	c.MachineLimits.Accelerator = accel
+	if c.EgressPolicyScopes == nil {
+		c.EgressPolicyScopes = []string{defaultEgressPolicyScope}
+	}
+
 	// Create socket folder
 	socketFolder, err := options.Environment.TemporaryStorage.NewFolder()
 	if err != nil {
@@ -104,11 +162,18 @@ func (e *engine) Capabilities() engines.Capabilities {
 }
 
 type payloadType struct {
-	Image   interface{} `json:"image"`
-	Command []string    `json:"command"`
-	Machine interface{} `json:"machine,omitempty"`
+	Image        interface{}           `json:"image"`
+	Command      []string              `json:"command"`
+	Machine      interface{}           `json:"machine,omitempty"`
+	EgressPolicy *network.EgressPolicy `json:"egressPolicy,omitempty"`
+	ResumeFrom   interface{}           `json:"resumeFrom,omitempty"`
+	Screenshots  *screenshotsOptions   `json:"screenshots,omitempty"`
 }
 
+// Default scope required to set task.payload.egressPolicy, unless mode is
+// deny-all, see egressPolicyScopes in the engine config.
+const defaultEgressPolicyScope = "worker:qemu:egress-policy"
+
 var payloadSchema = schematypes.Object{
 	Properties: schematypes.Properties{
 		"image": imageFetcher.Schema(),
@@ -117,7 +182,13 @@ var payloadSchema = schematypes.Object{
 			Description: `Command and arguments to execute on the guest.`,
 			Items:       schematypes.String{},
 		},
-		"machine": vm.MachineSchema,
+		"machine":      vm.MachineSchema,
+		"egressPolicy": network.EgressPolicySchema,
+		// Checkpoint to resume from, this is referenced like an image, typically
+		// as the artifact uploaded by a previous run of the task, other references
+		// require the resumeFromScope.
+		"resumeFrom":  imageFetcher.Schema(),
+		"screenshots": screenshotsSchema,
 	},
 	Required: []string{"command", "image"},
 }
@@ -129,6 +200,11 @@ func (e *engine) PayloadSchema() schematypes.Object {
 func (e *engine) NewSandboxBuilder(options engines.SandboxOptions) (engines.SandboxBuilder, error) {
 	var p payloadType
 	schematypes.MustValidateAndMap(payloadSchema, options.Payload, &p)
+	if p.Screenshots != nil && p.Screenshots.Timeline && p.Screenshots.Interval == 0 {
+		return nil, runtime.NewMalformedPayloadError(
+			"task.payload.screenshots.timeline requires 'interval' to be given",
+		)
+	}
 
 	// Get an idle network
 	net, err := e.networkPool.Network()
@@ -139,10 +215,60 @@ func (e *engine) NewSandboxBuilder(options engines.SandboxOptions) (engines.Sand
 		return nil, err
 	}
 
+	// Apply egress policy from task.payload, this can only narrow the default
+	// policy. Denying all egress is always allowed, other modes require scopes.
+	if p.EgressPolicy != nil {
+		scopes := e.engineConfig.EgressPolicyScopes
+		if p.EgressPolicy.Mode != network.EgressDenyAll && !options.TaskContext.HasScopes(scopes) {
+			net.Release()
+			return nil, runtime.NewMalformedPayloadError(
+				"task.payload.egressPolicy requires the scopes: '", strings.Join(scopes, "', '"),
+				"', unless mode is '", network.EgressDenyAll, "'",
+			)
+		}
+		if err = net.SetEgressPolicy(*p.EgressPolicy); err != nil {
+			net.Release()
+			return nil, err
+		}
+	}
+
 	// Create sandboxBuilder, it'll handle image downloading
 	return newSandboxBuilder(&p, net, options.TaskContext, e, options.Monitor), nil
 }
 
+func (e *engine) ResourceReservation(payload map[string]interface{}) (engines.Resources, error) {
+	var p payloadType
+	schematypes.MustValidateAndMap(payloadSchema, payload, &p)
+
+	// The machine definition from the image isn't known until the image has
+	// been fetched, so memory defaults to the limit if not given in the payload
+	var memory int
+	if p.Machine != nil {
+		memory = vm.NewMachine(p.Machine).Memory()
+	}
+	if memory == 0 {
+		memory = e.defaultMachine.Memory()
+	}
+	if memory == 0 {
+		memory = e.engineConfig.MachineLimits.MaxMemory
+	}
+	return engines.Resources{
+		Memory: int64(memory) * 1024 * 1024,
+	}, nil
+}
+
+func (e *engine) VolumeSchema() schematypes.Schema {
+	return schematypes.Object{}
+}
+
+func (e *engine) NewVolumeBuilder(options interface{}) (engines.VolumeBuilder, error) {
+	return hostvolume.NewBuilder(e.Environment.TemporaryStorage, true)
+}
+
+func (e *engine) NewVolume(options interface{}) (engines.Volume, error) {
+	return hostvolume.New(e.Environment.TemporaryStorage, true)
+}
+
 func (e *engine) Dispose() error {
 	err := e.networkPool.Dispose()
 	e.networkPool = nil
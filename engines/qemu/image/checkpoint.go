@@ -0,0 +1,214 @@
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/slugid-go/slugid"
+	"github.com/taskcluster/taskcluster-worker/engines/qemu/vm"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+)
+
+// checkpointInfo is written to checkpoint.json in checkpoint archives
+type checkpointInfo struct {
+	ImageHash string `json:"imageHash"` // hash of the image the disk is based on
+}
+
+// PackageCheckpoint creates a zstd compressed tar archive in targetFile with
+// layer.qcow2, state.bin and optionally nvram.bin from folder, as created by
+// VirtualMachine.Checkpoint(), along with the machine definition and the hash
+// of the image the instance was created from.
+//
+// The checkpoint can be loaded into a new instance of the same image using
+// Instance.LoadCheckpoint().
+func PackageCheckpoint(folder string, machine vm.Machine, imageHash, targetFile string) error {
+	if strings.Contains(targetFile, "'") {
+		return fmt.Errorf("target file path: '%s' must not contain single quotes", targetFile)
+	}
+
+	// Create machine.json and checkpoint.json
+	files := map[string]interface{}{
+		"machine.json":    machine,
+		"checkpoint.json": checkpointInfo{ImageHash: imageHash},
+	}
+	for name, value := range files {
+		data, err := json.Marshal(value)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to json.Marshal %s, err: %s", name, err))
+		}
+		if err = ioutil.WriteFile(filepath.Join(folder, name), data, 0600); err != nil {
+			return fmt.Errorf("Failed to write %s, err: %s", name, err)
+		}
+	}
+
+	// Create tarball of everything, and zstd compress it
+	names := "layer.qcow2 state.bin machine.json checkpoint.json"
+	if ioext.IsPlainFile(filepath.Join(folder, "nvram.bin")) {
+		names += " nvram.bin"
+	}
+	tar := exec.Command("sh", "-fec", "tar -Sc "+names+" | "+
+		"zstd -1qfo '"+targetFile+"'",
+	)
+	tar.Dir = folder
+	if _, err := tar.Output(); err != nil {
+		msg := err.Error()
+		if ee, ok := err.(*exec.ExitError); ok {
+			msg = string(ee.Stderr)
+		}
+		return fmt.Errorf("Failed to create checkpoint file, error: %s", msg)
+	}
+	return nil
+}
+
+// LoadCheckpoint replaces the disk of this instance with the disk from a
+// checkpoint created with PackageCheckpoint(), and makes the instance restore
+// the saved state and machine definition from the checkpoint.
+//
+// Returns a MalformedPayloadError if the checkpoint is invalid or was created
+// from a different image.
+func (i *Instance) LoadCheckpoint(checkpointFile string) error {
+	i.m.Lock()
+	defer i.m.Unlock()
+	if i.image == nil {
+		panic("Instance of image is already disposed")
+	}
+	if i.checkpointFolder != "" {
+		panic("Instance already has a checkpoint loaded")
+	}
+	if strings.Contains(checkpointFile+i.image.folder, "'") {
+		return fmt.Errorf("checkpoint file path: '%s' must not contain single quotes", checkpointFile)
+	}
+
+	// Restrict file to some maximum size
+	if !ioext.IsPlainFile(checkpointFile) {
+		return fmt.Errorf("LoadCheckpoint: checkpointFile is not a file")
+	}
+	if !ioext.IsFileLessThan(checkpointFile, maxImageSize) {
+		return runtime.NewMalformedPayloadError("Checkpoint file is larger than ", maxImageSize, " bytes")
+	}
+
+	// Extract to a sub-folder of the image folder, so it's deleted with the image
+	folder := filepath.Join(i.image.folder, "checkpoint-"+slugid.Nice())
+	if err := os.Mkdir(folder, 0700); err != nil {
+		return errors.Wrap(err, "failed to create checkpoint folder")
+	}
+	machine, err := extractCheckpoint(checkpointFile, folder, i.image.hash)
+	if err != nil {
+		if e := os.RemoveAll(folder); e != nil {
+			i.image.manager.monitor.ReportWarning(e, "Failed to delete checkpoint folder")
+		}
+		return err
+	}
+
+	// Replace the disk of this instance, the layer.qcow2 from the checkpoint has
+	// backing file 'disk.img' relative to the image folder
+	if err = os.Rename(filepath.Join(folder, "layer.qcow2"), i.diskFile); err != nil {
+		if e := os.RemoveAll(folder); e != nil {
+			i.image.manager.monitor.ReportWarning(e, "Failed to delete checkpoint folder")
+		}
+		return errors.Wrap(err, "failed to move disk from checkpoint")
+	}
+
+	// Replace the UEFI variables of this instance, if the checkpoint has any
+	if nvram := filepath.Join(folder, "nvram.bin"); ioext.IsPlainFile(nvram) {
+		if i.nvramFile == "" {
+			i.nvramFile = filepath.Join(i.image.folder, slugid.Nice()+".nvram")
+		}
+		if err = os.Rename(nvram, i.nvramFile); err != nil {
+			if e := os.RemoveAll(folder); e != nil {
+				i.image.manager.monitor.ReportWarning(e, "Failed to delete checkpoint folder")
+			}
+			return errors.Wrap(err, "failed to move nvram.bin from checkpoint")
+		}
+	}
+
+	i.checkpointFolder = folder
+	i.stateFile = filepath.Join(folder, "state.bin")
+	i.machine = machine
+	return nil
+}
+
+// extractCheckpoint extracts a checkpoint archive into folder and validates
+// the files, returning the machine definition from the checkpoint.
+func extractCheckpoint(checkpointFile, folder, imageHash string) (*vm.Machine, error) {
+	tar := exec.Command("sh", "-fec", "zstd -dqc '"+checkpointFile+"' | "+
+		"tar -xoC '"+folder+"' --no-same-permissions",
+	)
+	if _, err := tar.Output(); err != nil {
+		if ee, ok := err.(*exec.ExitError); ok {
+			return nil, runtime.NewMalformedPayloadError(
+				"Failed to extract checkpoint archive, error: ", string(ee.Stderr),
+			)
+		}
+		return nil, fmt.Errorf("Failed to extract checkpoint archive, error: %s", err)
+	}
+
+	// Check that the expected files, and only those, were extracted
+	names := []string{"layer.qcow2", "state.bin", "machine.json", "checkpoint.json"}
+	if _, err := os.Lstat(filepath.Join(folder, "nvram.bin")); err == nil {
+		names = append(names, "nvram.bin")
+	}
+	entries, err := ioutil.ReadDir(folder)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list extracted checkpoint files")
+	}
+	if len(entries) != len(names) {
+		return nil, runtime.NewMalformedPayloadError("Checkpoint file must contain ",
+			"exactly the files: ", names)
+	}
+	for _, name := range names {
+		f := filepath.Join(folder, name)
+		if !ioext.IsPlainFile(f) {
+			return nil, runtime.NewMalformedPayloadError("Checkpoint file is missing '", name, "'")
+		}
+		if !ioext.IsFileLessThan(f, maxImageSize) {
+			return nil, runtime.NewMalformedPayloadError("Checkpoint file contains '",
+				name, "' larger than ", maxImageSize, " bytes")
+		}
+	}
+
+	// Check that checkpoint was created from this image
+	data, err := ioext.BoundedReadFile(filepath.Join(folder, "checkpoint.json"), 1024*1024)
+	if err != nil {
+		return nil, runtime.NewMalformedPayloadError("Failed to read 'checkpoint.json', error: ", err)
+	}
+	var info checkpointInfo
+	if err = json.Unmarshal(data, &info); err != nil {
+		return nil, runtime.NewMalformedPayloadError("Invalid JSON in 'checkpoint.json', error: ", err)
+	}
+	if info.ImageHash != imageHash {
+		return nil, runtime.NewMalformedPayloadError("Checkpoint was created from an image ",
+			"with sha256: '", info.ImageHash, "', but the image given has sha256: '", imageHash, "'")
+	}
+
+	// Load the machine configuration
+	machine, err := newMachineFromFile(filepath.Join(folder, "machine.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Inspect the QCOW2 layer file, the dirty-flag may be set as the disk was
+	// copied while the virtual machine was paused.
+	layerInfo := inspectImageFile(filepath.Join(folder, "layer.qcow2"), imageQCOW2Format)
+	if layerInfo == nil || layerInfo.Format != formatQCOW2 {
+		return nil, runtime.NewMalformedPayloadError("Checkpoint file contains ",
+			"'layer.qcow2' which is not a QCOW2 file")
+	}
+	if layerInfo.VirtualSize > maxImageSize {
+		return nil, runtime.NewMalformedPayloadError("Checkpoint file contains ",
+			"'layer.qcow2' has virtual size larger than ", maxImageSize, " bytes")
+	}
+	if layerInfo.BackingFile != "disk.img" || layerInfo.BackingFormat != formatRaw {
+		return nil, runtime.NewMalformedPayloadError("Checkpoint file contains ",
+			"'layer.qcow2' which doesn't have raw backing file 'disk.img'")
+	}
+
+	return machine, nil
+}
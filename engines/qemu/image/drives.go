@@ -0,0 +1,72 @@
+package image
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+)
+
+// dataFilePattern matches the names of data files permitted in images, these
+// can be attached to virtual machines as data drives.
+var dataFilePattern = regexp.MustCompile(`^data-[a-z0-9_-]{1,64}\.img$`)
+
+// CreateScratchDisk creates an empty qcow2 disk file of size MiB.
+func CreateScratchDisk(file string, size int) error {
+	return createQCOW2(file, fmt.Sprintf("%dM", size))
+}
+
+// CreateDataDisk creates a qcow2 disk file backed by the data file name from
+// the image, so writes to the disk doesn't modify the data file shared between
+// instances.
+//
+// Returns a MalformedPayloadError, if the image doesn't contain the data file,
+// or if the data file is larger than maxSize bytes.
+func (i *Instance) CreateDataDisk(name, file string, maxSize int64) error {
+	i.m.Lock()
+	defer i.m.Unlock()
+	if i.image == nil {
+		panic("Instance of image is already disposed")
+	}
+
+	dataFile := filepath.Join(i.image.folder, name)
+	if !dataFilePattern.MatchString(name) || !ioext.IsPlainFile(dataFile) {
+		return runtime.NewMalformedPayloadError(
+			"Image doesn't contain the data file '", name, "'",
+		)
+	}
+	if !ioext.IsFileLessThan(dataFile, maxSize+1) {
+		return runtime.NewMalformedPayloadError(
+			"Image contains data file '", name, "' larger than ", maxSize,
+			" bytes, which is the maximum allowed drive size",
+		)
+	}
+	return createQCOW2(file, "", "-F", formatRaw, "-b", dataFile)
+}
+
+// createQCOW2 creates a qcow2 file with additional arguments for qemu-img
+func createQCOW2(file, size string, args ...string) error {
+	args = append([]string{"create", "-q", "-f", formatQCOW2}, args...)
+	args = append(args, "--", file)
+	if size != "" {
+		args = append(args, size)
+	}
+	_, err := exec.Command("qemu-img", args...).Output()
+	if err != nil {
+		msg := err.Error()
+		if ee, ok := err.(*exec.ExitError); ok {
+			msg = string(ee.Stderr)
+		}
+		return fmt.Errorf("Failed to create qcow2 file, error: %s", msg)
+	}
+	return nil
+}
+
+// Drives returns nil, as files for additional drives must be created by the
+// caller and attached with vm.AttachDrives().
+func (i *Instance) Drives() []string {
+	return nil
+}
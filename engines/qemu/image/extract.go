@@ -4,6 +4,8 @@ import (
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"os/exec"
 	"path/filepath"
 
@@ -22,6 +24,9 @@ const (
 
 const maxImageSize = int64(50 * 1024 * 1024 * 1024) // Use int64 for i386 builds
 
+// OVMF uses a few MiB for UEFI variables, more is certainly not sane
+const maxNVRAMSize = 64 * 1024 * 1024
+
 // RandomMAC generates a new random MAC with the local bit set.
 func RandomMAC() string {
 	// Credits: http://stackoverflow.com/a/21027407/68333
@@ -35,9 +40,10 @@ func RandomMAC() string {
 	return fmt.Sprintf("%02x:%02x:%02x:%02x:%02x:%02x", m[0], m[1], m[2], m[3], m[4], m[5])
 }
 
-// extractImage will extract the "disk.img", "layer.qcow2" and "machine.json"
-// files from a tar archive using GNU tar ensuring that sparse entries will be
-// extracted as sparse files.
+// extractImage will extract the "disk.img", "layer.qcow2", "machine.json" and
+// optionally "state.bin", "nvram.bin" and "data-<name>.img" files from a tar
+// archive using GNU tar ensuring that sparse entries will be extracted as
+// sparse files.
 //
 // This also validates that files aren't symlinks and are in correct format,
 // with legal backing_file parameters.
@@ -53,10 +59,11 @@ func extractImage(imageFile, imageFolder string) (*vm.Machine, error) {
 		return nil, runtime.NewMalformedPayloadError("Image file is larger than ", maxImageSize, " bytes")
 	}
 
-	// Using zstd | tar so we get sparse files (sh to get OS pipes)
+	// Using zstd | tar so we get sparse files (sh to get OS pipes), we can't
+	// list the files to extract as some files are optional, instead we check
+	// that no other files were extracted.
 	tar := exec.Command("sh", "-fec", "zstd -dqc '"+imageFile+"' | "+
-		"tar -xoC '"+imageFolder+"' --no-same-permissions -- "+
-		"disk.img layer.qcow2 machine.json",
+		"tar -xoC '"+imageFolder+"' --no-same-permissions",
 	)
 	_, err := tar.Output()
 	if err != nil {
@@ -70,6 +77,50 @@ func extractImage(imageFile, imageFolder string) (*vm.Machine, error) {
 		return nil, fmt.Errorf("Failed to extract image archive, error: %s", err)
 	}
 
+	// Check that no unexpected files were extracted
+	entries, err := ioutil.ReadDir(imageFolder)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list extracted image files")
+	}
+	var dataFiles []string
+	for _, entry := range entries {
+		switch entry.Name() {
+		case "disk.img", "layer.qcow2", "machine.json", "state.bin", "nvram.bin":
+		default:
+			if !dataFilePattern.MatchString(entry.Name()) {
+				return nil, runtime.NewMalformedPayloadError("Image file contains ",
+					"unexpected file '", entry.Name(), "'")
+			}
+			dataFiles = append(dataFiles, entry.Name())
+		}
+	}
+
+	// Check saved state, if present, is a plain file
+	stateFile := filepath.Join(imageFolder, "state.bin")
+	if _, err = os.Lstat(stateFile); err == nil {
+		if !ioext.IsPlainFile(stateFile) {
+			return nil, runtime.NewMalformedPayloadError("Image file contains ",
+				"'state.bin' which is not a plain file")
+		}
+		if !ioext.IsFileLessThan(stateFile, maxImageSize) {
+			return nil, runtime.NewMalformedPayloadError("Image file contains ",
+				"'state.bin' larger than ", maxImageSize, " bytes")
+		}
+	}
+
+	// Check UEFI variables, if present, is a plain file
+	nvramFile := filepath.Join(imageFolder, "nvram.bin")
+	if _, err = os.Lstat(nvramFile); err == nil {
+		if !ioext.IsPlainFile(nvramFile) {
+			return nil, runtime.NewMalformedPayloadError("Image file contains ",
+				"'nvram.bin' which is not a plain file")
+		}
+		if !ioext.IsFileLessThan(nvramFile, maxNVRAMSize) {
+			return nil, runtime.NewMalformedPayloadError("Image file contains ",
+				"'nvram.bin' larger than ", maxNVRAMSize, " bytes")
+		}
+	}
+
 	// Check files exist, are plain files and not larger than maxImageSize
 	for _, name := range []string{"disk.img", "layer.qcow2", "machine.json"} {
 		f := filepath.Join(imageFolder, name)
@@ -133,6 +184,28 @@ func extractImage(imageFile, imageFolder string) (*vm.Machine, error) {
 			"'layer.qcow2' which has a backing file format that isn't 'raw'")
 	}
 
+	// Inspect raw data files
+	for _, name := range dataFiles {
+		f := filepath.Join(imageFolder, name)
+		if !ioext.IsPlainFile(f) {
+			return nil, runtime.NewMalformedPayloadError("Image file contains ",
+				"'", name, "' which is not a plain file")
+		}
+		if !ioext.IsFileLessThan(f, maxImageSize) {
+			return nil, runtime.NewMalformedPayloadError("Image file contains '",
+				name, "' larger than ", maxImageSize, " bytes")
+		}
+		info := inspectImageFile(f, imageRawFormat)
+		if info == nil || info.Format != formatRaw {
+			return nil, runtime.NewMalformedPayloadError("Image file contains ",
+				"'", name, "' which is not a RAW image file")
+		}
+		if info.BackingFile != "" {
+			return nil, runtime.NewMalformedPayloadError("Image file contains ",
+				"'", name, "' which has a backing file, this is not permitted")
+		}
+	}
+
 	return machine, nil
 }
 
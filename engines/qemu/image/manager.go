@@ -11,6 +11,7 @@ import (
 	"github.com/taskcluster/taskcluster-worker/engines/qemu/vm"
 	"github.com/taskcluster/taskcluster-worker/runtime"
 	"github.com/taskcluster/taskcluster-worker/runtime/gc"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
 )
 
 // Manager loads and tracks images.
@@ -30,19 +31,26 @@ type Downloader func(imageFile *os.File) error
 // image represents an image of which multiple instances can be created
 type image struct {
 	gc.DisposableResource
-	imageID string
-	folder  string
-	machine *vm.Machine
-	done    <-chan struct{}
-	manager *Manager
-	err     error
+	imageID   string
+	folder    string
+	hash      string // sha256 of the image file, as downloaded
+	stateFile string // saved virtual machine state, empty-string if none
+	nvramFile string // UEFI variables, empty-string if none
+	machine   *vm.Machine
+	done      <-chan struct{}
+	manager   *Manager
+	err       error
 }
 
 // Instance represents an instance of an image.
 type Instance struct {
-	m        sync.Mutex
-	image    *image
-	diskFile string
+	m                sync.Mutex
+	image            *image
+	diskFile         string
+	nvramFile        string      // copy of nvram.bin, if the image has one
+	checkpointFolder string      // folder with checkpoint, if loaded
+	stateFile        string      // state.bin from checkpoint, if loaded
+	machine          *vm.Machine // machine from checkpoint, if loaded
 }
 
 // NewManager creates a new image manager using the imageFolder for storing
@@ -138,11 +146,24 @@ func (img *image) loadImage(download Downloader, done chan<- struct{}) {
 		goto cleanup
 	}
 
+	// Hash image file, so tasks can report which image they used
+	img.hash, err = hashFile(imageFilePath)
+	if err != nil {
+		err = errors.Wrap(err, "failed to hash image file")
+		goto cleanup
+	}
+
 	// Extract image and validate image
 	img.machine, err = extractImage(imageFilePath, img.folder)
 	if err != nil {
 		goto cleanup
 	}
+	if ioext.IsPlainFile(filepath.Join(img.folder, "state.bin")) {
+		img.stateFile = filepath.Join(img.folder, "state.bin")
+	}
+	if ioext.IsPlainFile(filepath.Join(img.folder, "nvram.bin")) {
+		img.nvramFile = filepath.Join(img.folder, "nvram.bin")
+	}
 
 	// Clean up if there is any error
 cleanup:
@@ -211,9 +232,20 @@ func (img *image) instance() (*Instance, error) {
 		return nil, fmt.Errorf("Failed to make copy of layer.qcow2, error: %s", err)
 	}
 
+	// Create a copy of nvram.bin, as UEFI variables are writable
+	nvramFile := ""
+	if img.nvramFile != "" {
+		nvramFile = filepath.Join(img.folder, slugid.Nice()+".nvram")
+		if err = copyFile(img.nvramFile, nvramFile); err != nil {
+			os.Remove(diskFile)
+			return nil, fmt.Errorf("Failed to make copy of nvram.bin, error: %s", err)
+		}
+	}
+
 	return &Instance{
-		image:    img,
-		diskFile: diskFile,
+		image:     img,
+		diskFile:  diskFile,
+		nvramFile: nvramFile,
 	}, nil
 }
 
@@ -224,6 +256,9 @@ func (i *Instance) Machine() vm.Machine {
 	if i.image == nil {
 		panic("Instance of image is already disposed")
 	}
+	if i.machine != nil {
+		return *i.machine
+	}
 	return *i.image.machine
 }
 
@@ -237,6 +272,45 @@ func (i *Instance) DiskFile() string {
 	return i.diskFile
 }
 
+// Hash returns the hex encoded sha256 hash of the compressed image file this
+// instance was created from.
+func (i *Instance) Hash() string {
+	i.m.Lock()
+	defer i.m.Unlock()
+	if i.image == nil {
+		panic("Instance of image is already disposed")
+	}
+	return i.image.hash
+}
+
+// StateFile returns the saved virtual machine state for this instance, or
+// empty-string if the image doesn't have saved state. The state file is shared
+// between instances and must not be modified.
+//
+// If a checkpoint has been loaded, this returns the state from the checkpoint.
+func (i *Instance) StateFile() string {
+	i.m.Lock()
+	defer i.m.Unlock()
+	if i.image == nil {
+		panic("Instance of image is already disposed")
+	}
+	if i.checkpointFolder != "" {
+		return i.stateFile
+	}
+	return i.image.stateFile
+}
+
+// NVRAMFile returns the UEFI variables for this instance, or empty-string if
+// the image doesn't have an nvram.bin. Changes only affect this instance.
+func (i *Instance) NVRAMFile() string {
+	i.m.Lock()
+	defer i.m.Unlock()
+	if i.image == nil {
+		panic("Instance of image is already disposed")
+	}
+	return i.nvramFile
+}
+
 // Format returns the image format: 'qcow2'
 func (i *Instance) Format() string {
 	return formatQCOW2
@@ -255,6 +329,20 @@ func (i *Instance) Release() {
 		i.image.manager.monitor.ReportError(err, "Failed to delete layer.qcow2 copy")
 	}
 
+	// Delete the nvram.bin copy, if the image has one
+	if i.nvramFile != "" {
+		if err := os.Remove(i.nvramFile); err != nil {
+			i.image.manager.monitor.ReportError(err, "Failed to delete nvram.bin copy")
+		}
+	}
+
+	// Delete the checkpoint, if one was loaded
+	if i.checkpointFolder != "" {
+		if err := os.RemoveAll(i.checkpointFolder); err != nil {
+			i.image.manager.monitor.ReportError(err, "Failed to delete checkpoint folder")
+		}
+	}
+
 	// Release the image
 	i.image.Release()
 	i.image = nil // ensure that we never do this twice
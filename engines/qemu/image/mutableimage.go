@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -11,16 +12,18 @@ import (
 	"sync"
 
 	"github.com/taskcluster/taskcluster-worker/engines/qemu/vm"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
 )
 
 // MutableImage is an vm.MutableImage implementation that keeps the image
 // in a single folder. This can be used for testing images and building new
 // images.
 type MutableImage struct {
-	m       sync.Mutex
-	inUse   bool
-	folder  string
-	machine *vm.Machine
+	m        sync.Mutex
+	inUse    bool
+	hasState bool // true, if state.bin should be included when packaging
+	folder   string
+	machine  *vm.Machine
 }
 
 // NewMutableImage creates a new blank MutableImage of given size in GiB, and
@@ -46,6 +49,10 @@ func NewMutableImage(folder string, size int, machine *vm.Machine) (*MutableImag
 		return nil, fmt.Errorf("Failed to create sparse file, error: %s", msg)
 	}
 
+	if err = createNVRAM(folder, machine); err != nil {
+		return nil, err
+	}
+
 	return &MutableImage{
 		folder:  folder,
 		machine: machine,
@@ -70,12 +77,41 @@ func NewMutableImageFromFile(imageFile, imageFolder string) (*MutableImage, erro
 		return nil, fmt.Errorf("Failed to delete layer.qcow2 after extract, err: %s", err)
 	}
 
+	// Remove state.bin, as saved state is invalid once the disk is modified
+	if err := os.Remove(filepath.Join(imageFolder, "state.bin")); err != nil && !os.IsNotExist(err) {
+		// Delete image folder, ignoring errors
+		os.RemoveAll(imageFolder)
+
+		// Return the original error
+		return nil, fmt.Errorf("Failed to delete state.bin after extract, err: %s", err)
+	}
+
+	if err := createNVRAM(imageFolder, machine); err != nil {
+		// Delete image folder, ignoring errors
+		os.RemoveAll(imageFolder)
+
+		return nil, err
+	}
+
 	return &MutableImage{
 		folder:  imageFolder,
 		machine: machine,
 	}, nil
 }
 
+// createNVRAM creates nvram.bin in folder from the OVMF template, if machine
+// uses UEFI and the folder doesn't have an nvram.bin already.
+func createNVRAM(folder string, machine *vm.Machine) error {
+	nvram := filepath.Join(folder, "nvram.bin")
+	if machine.Firmware() != vm.FirmwareUEFI || ioext.IsPlainFile(nvram) {
+		return nil
+	}
+	if err := copyFile(vm.OVMFVarsFile, nvram); err != nil {
+		return fmt.Errorf("Failed to create nvram.bin from %s, error: %s", vm.OVMFVarsFile, err)
+	}
+	return nil
+}
+
 // DiskFile returns path to disk file to use in QEMU.
 // This also marks the image as being in-use.
 func (img *MutableImage) DiskFile() string {
@@ -105,6 +141,58 @@ func (img *MutableImage) Machine() vm.Machine {
 	return *img.machine
 }
 
+// StateFile returns empty-string, as a MutableImage is always booted from disk.
+// Saved state can be added with SaveState().
+func (img *MutableImage) StateFile() string {
+	return ""
+}
+
+// NVRAMFile returns the writable UEFI variables, which is included when the
+// image is packaged, or empty-string if the image doesn't use UEFI.
+func (img *MutableImage) NVRAMFile() string {
+	img.m.Lock()
+	defer img.m.Unlock()
+	if img.folder == "" {
+		panic("MutableImage have been disposed")
+	}
+
+	nvram := filepath.Join(img.folder, "nvram.bin")
+	if !ioext.IsPlainFile(nvram) {
+		return ""
+	}
+	return nvram
+}
+
+// Drives returns nil, as additional drives aren't attached when building
+// images. Data files from the image are preserved by Package().
+func (img *MutableImage) Drives() []string {
+	return nil
+}
+
+// SaveState saves the state of virtual machine using this image, terminating
+// the virtual machine. The saved state is included when the image is packaged,
+// together with the machine definition used by the virtual machine.
+func (img *MutableImage) SaveState(machine *vm.VirtualMachine) error {
+	img.m.Lock()
+	if img.folder == "" {
+		panic("MutableImage have been disposed")
+	}
+	stateFile := filepath.Join(img.folder, "state.bin")
+	img.m.Unlock()
+
+	// Don't hold the lock, as the virtual machine calls Release() when done
+	if err := machine.SaveState(stateFile); err != nil {
+		return fmt.Errorf("Failed to save virtual machine state, error: %s", err)
+	}
+
+	img.m.Lock()
+	defer img.m.Unlock()
+	m := machine.Machine()
+	img.machine = &m
+	img.hasState = true
+	return nil
+}
+
 // Package will write an zstd compressed tar archive of the image to targetFile.
 // This method cannot be called the image is in-use.
 func (img *MutableImage) Package(targetFile string) error {
@@ -150,9 +238,23 @@ func (img *MutableImage) Package(targetFile string) error {
 	file.Close()
 
 	// Create tarball of everything
-	tar := exec.Command(
-		"tar", "-Scf", "image.tar", "disk.img", "layer.qcow2", "machine.json",
-	)
+	files := []string{"disk.img", "layer.qcow2", "machine.json"}
+	if img.hasState {
+		files = append(files, "state.bin")
+	}
+	if ioext.IsPlainFile(filepath.Join(img.folder, "nvram.bin")) {
+		files = append(files, "nvram.bin")
+	}
+	entries, err := ioutil.ReadDir(img.folder)
+	if err != nil {
+		return fmt.Errorf("Failed to list image files, error: %s", err)
+	}
+	for _, entry := range entries {
+		if dataFilePattern.MatchString(entry.Name()) {
+			files = append(files, entry.Name())
+		}
+	}
+	tar := exec.Command("tar", append([]string{"-Scf", "image.tar"}, files...)...)
 	tar.Dir = img.folder
 	if _, err := tar.Output(); err != nil {
 		msg := err.Error()
@@ -1,6 +1,8 @@
 package image
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
@@ -42,6 +44,21 @@ func copyFile(source, target string) (err error) {
 	return
 }
 
+// hashFile returns the hex encoded sha256 hash of the file at given path
+func hashFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
 const maxRetries = 7
 
 // DownloadImage returns a Downloader that will download the image from the
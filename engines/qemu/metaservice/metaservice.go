@@ -1,6 +1,7 @@
 package metaservice
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -22,6 +23,9 @@ import (
 // hanging before getting a response (even if the response is none).
 const PollTimeout = 30 * time.Second
 
+// Maximum size of the ExitReport request payload
+const maxExitReportSize = 64 * 1024
+
 type asyncCallback func(http.ResponseWriter, *http.Request)
 type asyncRecord struct {
 	Callback asyncCallback
@@ -35,11 +39,13 @@ type MetaService struct {
 	m               sync.Mutex
 	command         []string
 	env             map[string]string
+	mounts          []Mount
 	logDrain        io.Writer
 	resultCallback  func(bool)
 	environment     *runtime.Environment
 	resolved        bool
-	result          bool // saved to support idempotency
+	result          bool        // saved to support idempotency
+	exitReport      *ExitReport // nil, if not reported by guest-tools
 	mux             *http.ServeMux
 	actionOut       chan Action
 	pendingRecords  map[string]*asyncRecord
@@ -81,6 +87,14 @@ func New(
 	return s
 }
 
+// SetMounts sets the list of mounts guest-tools must create before executing
+// the command. This must be called before the virtual machine is started.
+func (s *MetaService) SetMounts(mounts []Mount) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.mounts = mounts
+}
+
 // ServeHTTP handles request to the meta-data service.
 func (s *MetaService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.mux.ServeHTTP(w, r)
@@ -121,9 +135,13 @@ func (s *MetaService) handleExecute(w http.ResponseWriter, r *http.Request) {
 	}
 
 	debug("GET /engine/v1/execute")
+	s.m.Lock()
+	mounts := s.mounts
+	s.m.Unlock()
 	reply(w, http.StatusOK, Execute{
 		Command: s.command,
 		Env:     s.env,
+		Mounts:  mounts,
 	})
 }
 
@@ -151,12 +169,17 @@ func (s *MetaService) handleSuccess(w http.ResponseWriter, r *http.Request) {
 	if !forceMethod(w, r, http.MethodPut) {
 		return
 	}
+	report, ok := readExitReport(w, r)
+	if !ok {
+		return
+	}
 
 	// Only resolve once
 	s.m.Lock()
 	resolved := s.resolved
 	if !s.resolved {
 		s.result = true
+		s.exitReport = report
 	}
 	s.resolved = true
 	s.m.Unlock()
@@ -180,12 +203,17 @@ func (s *MetaService) handleFailed(w http.ResponseWriter, r *http.Request) {
 	if !forceMethod(w, r, http.MethodPut) {
 		return
 	}
+	report, ok := readExitReport(w, r)
+	if !ok {
+		return
+	}
 
 	// Only resolve once
 	s.m.Lock()
 	resolved := s.resolved
 	if !s.resolved {
 		s.result = false
+		s.exitReport = report
 	}
 	s.resolved = true
 	s.m.Unlock()
@@ -204,6 +232,42 @@ func (s *MetaService) handleFailed(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// readExitReport reads the optional ExitReport from the request body, replying
+// with an error and returning false, if the body isn't a valid ExitReport.
+func readExitReport(w http.ResponseWriter, r *http.Request) (*ExitReport, bool) {
+	if r.Body == nil {
+		return nil, true
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, maxExitReportSize))
+	if err != nil {
+		reply(w, http.StatusBadRequest, Error{
+			Code:    ErrorCodeInvalidPayload,
+			Message: "Error while reading request body",
+		})
+		return nil, false
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, true
+	}
+	var report ExitReport
+	if err = json.Unmarshal(data, &report); err != nil {
+		reply(w, http.StatusBadRequest, Error{
+			Code:    ErrorCodeInvalidPayload,
+			Message: fmt.Sprintf("Invalid exit report, error: %s", err),
+		})
+		return nil, false
+	}
+	return &report, true
+}
+
+// ExitReport returns the exit status and resource usage reported by
+// guest-tools when the task was resolved, nil if this wasn't reported.
+func (s *MetaService) ExitReport() *ExitReport {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.exitReport
+}
+
 // handlePing handles ping requests
 func (s *MetaService) handlePing(w http.ResponseWriter, r *http.Request) {
 	if !forceMethod(w, r, http.MethodGet) {
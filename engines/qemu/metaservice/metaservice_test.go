@@ -229,6 +229,45 @@ func TestMetaService(t *testing.T) {
 	assert(t, len(files) == 0, "Expected zero files")
 }
 
+func TestMetaServiceExitReport(t *testing.T) {
+	storage, err := runtime.NewTemporaryStorage(os.TempDir())
+	nilOrFatal(t, err, "Failed to create TemporaryStorage")
+
+	var resolved atomics.Once
+	s := New([]string{"bash", "-c", "false"}, make(map[string]string), ioutil.Discard, func(r bool) {
+		resolved.Do(func() {})
+	}, &runtime.Environment{
+		TemporaryStorage: storage,
+	})
+	assert(t, s.ExitReport() == nil, "Expected no exit report before resolution")
+
+	// Check that an invalid exit report is rejected
+	req, err := http.NewRequest("PUT", "http://169.254.169.254/engine/v1/failed", bytes.NewBufferString("{"))
+	nilOrFatal(t, err)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	assert(t, w.Code == http.StatusBadRequest, "Unexpected status: ", w.Code)
+
+	// Report failed with an exit report
+	payload, _ := json.Marshal(ExitReport{
+		ExitCode:  3,
+		WallTime:  1500,
+		MaxMemory: 4096,
+	})
+	req, err = http.NewRequest("PUT", "http://169.254.169.254/engine/v1/failed", bytes.NewBuffer(payload))
+	nilOrFatal(t, err)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	assert(t, w.Code == http.StatusOK, "Unexpected status: ", w.Code)
+	resolved.Wait()
+
+	report := s.ExitReport()
+	assert(t, report != nil, "Expected an exit report")
+	assert(t, report.ExitCode == 3, "Expected exit code 3")
+	assert(t, report.WallTime == 1500, "Expected wall time 1500 ms")
+	assert(t, report.MaxMemory == 4096, "Expected max memory 4096 bytes")
+}
+
 func TestMetaServiceShell(t *testing.T) {
 	// Create temporary storage
 	storage, err := runtime.NewTemporaryStorage(os.TempDir())
@@ -4,6 +4,27 @@ package metaservice
 type Execute struct {
 	Env     map[string]string `json:"env"`
 	Command []string          `json:"command"`
+	Mounts  []Mount           `json:"mounts,omitempty"`
+}
+
+// Mount is an entry in the Execute payload specifying a virtio-9p device that
+// guest-tools must mount before executing the command.
+type Mount struct {
+	Tag        string `json:"tag"`        // mount_tag of the virtio-9p device
+	Mountpoint string `json:"mountpoint"` // Absolute path to mount at
+	ReadOnly   bool   `json:"readOnly"`   // true, if mount should be read-only
+}
+
+// ExitReport is the optional request payload for the /engine/v1/success and
+// /engine/v1/failed end-points, reporting how the command exited and the
+// resources it used. Older versions of guest-tools send an empty body.
+type ExitReport struct {
+	ExitCode   int    `json:"exitCode"`         // -1, if terminated by a signal
+	Signal     string `json:"signal,omitempty"` // Signal that terminated the command
+	WallTime   int64  `json:"wallTime"`         // Wall time in milliseconds
+	UserTime   int64  `json:"userTime"`         // User-mode CPU time in milliseconds
+	SystemTime int64  `json:"systemTime"`       // Kernel-mode CPU time in milliseconds
+	MaxMemory  uint64 `json:"maxMemory"`        // Peak memory in bytes, zero if unknown
 }
 
 // List of API error codes for using the Error struct.
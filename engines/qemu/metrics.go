@@ -0,0 +1,204 @@
+package qemuengine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/engines/qemu/vm"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// Name of the artifact with metrics summary and samples
+const metricsArtifactName = "public/metrics.json"
+
+type metricsConfig struct {
+	Interval int  `json:"interval"`
+	Summary  bool `json:"summary"`
+}
+
+var metricsConfigSchema = schematypes.Object{
+	Title: "Metrics",
+	Description: util.Markdown(`
+		Periodic sampling of resource usage for virtual machines, samples are
+		reported as metrics tagged with 'taskId'. If not given, resource usage
+		isn't sampled.
+	`),
+	Properties: schematypes.Properties{
+		"interval": schematypes.Integer{
+			Title:       "Sampling Interval",
+			Description: `Number of seconds between samples of resource usage.`,
+			Minimum:     1,
+			Maximum:     60 * 60,
+		},
+		"summary": schematypes.Boolean{
+			Title: "Summary",
+			Description: util.Markdown(`
+				If true, a summary of the resource usage is written to the task log
+				and uploaded along with all samples as '` + metricsArtifactName + `'.
+			`),
+		},
+	},
+	Required: []string{"interval"},
+}
+
+// metricsSample holds cumulative resource usage at a point in time
+type metricsSample struct {
+	Time       time.Time `json:"time"`
+	CPUTime    float64   `json:"cpuTime"`    // seconds
+	MemoryUsed int64     `json:"memoryUsed"` // bytes, zero if unknown
+	DiskRead   int64     `json:"diskRead"`   // bytes
+	DiskWrite  int64     `json:"diskWrite"`  // bytes
+	NetworkRx  int64     `json:"networkRx"`  // bytes
+	NetworkTx  int64     `json:"networkTx"`  // bytes
+}
+
+// metricsSummary summarizes the samples collected
+type metricsSummary struct {
+	CPUTime        float64 `json:"cpuTime"`
+	PeakMemoryUsed int64   `json:"peakMemoryUsed"`
+	DiskRead       int64   `json:"diskRead"`
+	DiskWrite      int64   `json:"diskWrite"`
+	NetworkRx      int64   `json:"networkRx"`
+	NetworkTx      int64   `json:"networkTx"`
+}
+
+// metricsCollector periodically samples resource usage of a virtual machine
+// and reports it with monitor.Measure().
+type metricsCollector struct {
+	stats    func() (*vm.Stats, error)
+	vmDone   <-chan struct{}
+	interval time.Duration
+	monitor  runtime.Monitor
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	samples  []metricsSample // must not be accessed before done is closed
+}
+
+// newMetricsCollector starts sampling resource usage using the stats function
+// until vmDone is closed or Stop() is called.
+func newMetricsCollector(
+	stats func() (*vm.Stats, error), vmDone <-chan struct{},
+	interval time.Duration, monitor runtime.Monitor,
+) *metricsCollector {
+	m := &metricsCollector{
+		stats:    stats,
+		vmDone:   vmDone,
+		interval: interval,
+		monitor:  monitor,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		samples:  []metricsSample{},
+	}
+	go m.run()
+	return m
+}
+
+func (m *metricsCollector) run() {
+	defer close(m.done)
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	var last metricsSample
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-m.vmDone:
+			return
+		case <-ticker.C:
+		}
+
+		stats, err := m.stats()
+		if err != nil {
+			m.monitor.Warn("failed to sample resource usage, error: ", err)
+			continue
+		}
+		s := metricsSample{
+			Time:      time.Now(),
+			CPUTime:   stats.CPUTime.Seconds(),
+			DiskRead:  stats.DiskRead,
+			DiskWrite: stats.DiskWrite,
+			NetworkRx: stats.NetworkRx,
+			NetworkTx: stats.NetworkTx,
+		}
+		if stats.MemoryTotal > 0 {
+			s.MemoryUsed = stats.MemoryTotal - stats.MemoryFree
+			m.monitor.Measure("memory-used", float64(s.MemoryUsed))
+		}
+		// Report usage since last sample, counters are cumulative
+		m.monitor.Measure("cpu-usage", (s.CPUTime-last.CPUTime)/m.interval.Seconds())
+		m.monitor.Measure("disk-read", float64(s.DiskRead-last.DiskRead))
+		m.monitor.Measure("disk-write", float64(s.DiskWrite-last.DiskWrite))
+		m.monitor.Measure("network-rx", float64(s.NetworkRx-last.NetworkRx))
+		m.monitor.Measure("network-tx", float64(s.NetworkTx-last.NetworkTx))
+		m.samples = append(m.samples, s)
+		last = s
+	}
+}
+
+// Stop sampling and wait for sampling to be stopped
+func (m *metricsCollector) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+	})
+	<-m.done
+}
+
+// Summary returns a summary of the samples, Stop() must have been called.
+func (m *metricsCollector) Summary() metricsSummary {
+	<-m.done
+
+	var s metricsSummary
+	if len(m.samples) == 0 {
+		return s
+	}
+	last := m.samples[len(m.samples)-1]
+	s.CPUTime = last.CPUTime
+	s.DiskRead = last.DiskRead
+	s.DiskWrite = last.DiskWrite
+	s.NetworkRx = last.NetworkRx
+	s.NetworkTx = last.NetworkTx
+	for _, sample := range m.samples {
+		if sample.MemoryUsed > s.PeakMemoryUsed {
+			s.PeakMemoryUsed = sample.MemoryUsed
+		}
+	}
+	return s
+}
+
+// Report writes a summary to the task log and uploads the summary and samples
+// as an artifact. Stop() must have been called.
+func (m *metricsCollector) Report(context *runtime.TaskContext) error {
+	summary := m.Summary()
+
+	const MiB = 1024 * 1024
+	context.Log(fmt.Sprintf(
+		"Resource usage: CPU time %.1f s, peak memory %d MiB, disk read %d MiB, "+
+			"disk write %d MiB, network received %d MiB, network sent %d MiB",
+		summary.CPUTime, summary.PeakMemoryUsed/MiB, summary.DiskRead/MiB,
+		summary.DiskWrite/MiB, summary.NetworkRx/MiB, summary.NetworkTx/MiB,
+	))
+
+	data, err := json.MarshalIndent(map[string]interface{}{
+		"interval": m.interval.Seconds(),
+		"summary":  summary,
+		"samples":  m.samples,
+	}, "", "  ")
+	if err != nil {
+		panic(fmt.Sprintf("Failed to json.Marshal metrics, error: %s", err))
+	}
+	return context.UploadS3Artifact(runtime.S3Artifact{
+		Name:     metricsArtifactName,
+		Mimetype: "application/json",
+		Expires:  context.TaskInfo.Expires,
+		Stream:   ioext.NopCloser(bytes.NewReader(data)),
+	})
+}
@@ -0,0 +1,51 @@
+package qemuengine
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/engines/qemu/vm"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+func TestMetricsCollector(t *testing.T) {
+	var m sync.Mutex
+	samples := 0
+	stats := func() (*vm.Stats, error) {
+		m.Lock()
+		defer m.Unlock()
+		samples++
+		return &vm.Stats{
+			CPUTime:     time.Duration(samples) * time.Second,
+			MemoryTotal: 1000,
+			MemoryFree:  1000 - int64(samples)*100,
+			DiskRead:    int64(samples) * 10,
+			DiskWrite:   int64(samples) * 20,
+			NetworkRx:   int64(samples) * 30,
+			NetworkTx:   int64(samples) * 40,
+		}, nil
+	}
+
+	monitor := mocks.NewMockMonitor(true)
+	vmDone := make(chan struct{})
+	c := newMetricsCollector(stats, vmDone, 5*time.Millisecond, monitor)
+	time.Sleep(50 * time.Millisecond)
+	close(vmDone)
+	c.Stop()
+
+	m.Lock()
+	n := samples
+	m.Unlock()
+	require.True(t, n > 0, "expected samples")
+	require.Len(t, c.samples, n)
+	require.True(t, monitor.HasMeasure("cpu-usage"))
+	require.True(t, monitor.HasMeasure("memory-used"))
+
+	summary := c.Summary()
+	require.Equal(t, float64(n), summary.CPUTime)
+	require.Equal(t, int64(n)*100, summary.PeakMemoryUsed)
+	require.Equal(t, int64(n)*10, summary.DiskRead)
+	require.Equal(t, int64(n)*40, summary.NetworkTx)
+}
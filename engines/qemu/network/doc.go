@@ -10,6 +10,10 @@
 // This package uses iptables to lock down network and ensure that the virtual
 // machine attached to a TAP device can't contact the meta-data handler of
 // another virtual machine.
+//
+// If an IPv6 prefix is configured each TAP device also gets an IPv6 subnet,
+// with addresses assigned using router advertisements and DHCPv6, and rules
+// in ip6tables mirroring the iptables rules.
 package network
 
 import "github.com/taskcluster/taskcluster-worker/runtime/util"
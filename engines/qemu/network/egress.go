@@ -0,0 +1,327 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// Egress policy modes
+const (
+	EgressAllowAll  = "allow-all"  // allow all out-going connections
+	EgressAllowList = "allow-list" // allow out-going connections matching a rule
+	EgressDenyAll   = "deny-all"   // deny all out-going connections
+)
+
+// EgressPolicy restricts out-going connections from a virtual machine to the
+// internet and VPN connections. The meta-data service, DNS and DHCP are never
+// restricted, hence, proxies exposed through the meta-data service, such as
+// tcproxy, remains available when all egress is denied.
+type EgressPolicy struct {
+	Mode  string       `json:"mode"`
+	Allow []EgressRule `json:"allow,omitempty"`
+}
+
+// EgressRule specifies a destination to allow when the EgressPolicy has mode
+// allow-list.
+type EgressRule struct {
+	Destination string `json:"destination"`        // hostname, IPv4 or CIDR
+	Protocol    string `json:"protocol,omitempty"` // tcp, udp or empty for any
+	Ports       []int  `json:"ports,omitempty"`    // empty for any
+}
+
+// EgressPolicySchema is the schema for an EgressPolicy
+var EgressPolicySchema schematypes.Schema = schematypes.Object{
+	Title: "Egress Policy",
+	Description: util.Markdown(`
+		Policy restricting out-going connections from the virtual machine to
+		the internet and VPN connections. The meta-data service, DNS and DHCP
+		is always available, hence, proxies exposed through the meta-data
+		service can be used, even if all egress is denied.
+	`),
+	Properties: schematypes.Properties{
+		"mode": schematypes.StringEnum{
+			Title: "Mode",
+			Description: util.Markdown(`
+				Use 'allow-all' to permit all out-going connections,
+				'allow-list' to permit connections matching a rule in 'allow',
+				and 'deny-all' to deny all out-going connections.
+			`),
+			Options: []string{EgressAllowAll, EgressAllowList, EgressDenyAll},
+		},
+		"allow": schematypes.Array{
+			Title:       "Allowed Destinations",
+			Description: `Rules for out-going connections to allow in 'allow-list' mode.`,
+			Items: schematypes.Object{
+				Properties: schematypes.Properties{
+					"destination": schematypes.String{
+						Title: "Destination",
+						Description: util.Markdown(`
+							Hostname, IPv4 address or CIDR to allow connections to.
+							Hostnames are resolved when the policy is applied.
+						`),
+						MinimumLength: 1,
+						MaximumLength: 255,
+					},
+					"protocol": schematypes.StringEnum{
+						Title:       "Protocol",
+						Description: `Protocol to allow, defaults to any protocol.`,
+						Options:     []string{"tcp", "udp"},
+					},
+					"ports": schematypes.Array{
+						Title:       "Ports",
+						Description: `Destination ports to allow, requires 'protocol' to be given.`,
+						Items:       schematypes.Integer{Minimum: 1, Maximum: 65535},
+						Unique:      true,
+					},
+				},
+				Required: []string{"destination"},
+			},
+		},
+	},
+	Required: []string{"mode"},
+}
+
+// egressChain returns the name of the iptables chain holding egress rules for
+// tapDevice.
+func egressChain(tapDevice string) string {
+	return "egress_" + tapDevice
+}
+
+// Validate returns a MalformedPayloadError if the policy is invalid.
+func (p EgressPolicy) Validate() error {
+	if p.Mode != EgressAllowList && len(p.Allow) > 0 {
+		return runtime.NewMalformedPayloadError(
+			"egress policy can only have 'allow' rules in mode '", EgressAllowList, "'",
+		)
+	}
+	for _, rule := range p.Allow {
+		if len(rule.Ports) > 0 && rule.Protocol == "" {
+			return runtime.NewMalformedPayloadError(
+				"egress rule for '", rule.Destination, "' must specify 'protocol' when 'ports' is given",
+			)
+		}
+	}
+	return nil
+}
+
+// resolve validates the policy and returns a policy where hostnames in
+// destinations have been replaced by rules for each IPv4 address.
+func (p EgressPolicy) resolve() (EgressPolicy, error) {
+	if err := p.Validate(); err != nil {
+		return p, err
+	}
+	result := EgressPolicy{Mode: p.Mode}
+	for _, r := range p.Allow {
+		destinations, err := resolveDestination(r.Destination)
+		if err != nil {
+			return p, err
+		}
+		for _, d := range destinations {
+			result.Allow = append(result.Allow, EgressRule{
+				Destination: d,
+				Protocol:    r.Protocol,
+				Ports:       r.Ports,
+			})
+		}
+	}
+	return result, nil
+}
+
+// narrow returns the policy p restricted to the defaults policy, both policies
+// must have been resolved. If p allows a destination the defaults policy
+// doesn't allow, a MalformedPayloadError is returned, as policies from tasks
+// may only narrow the default policy.
+func (p EgressPolicy) narrow(defaults EgressPolicy) (EgressPolicy, error) {
+	switch {
+	case defaults.Mode == EgressAllowAll || defaults.Mode == "":
+		return p, nil
+	case p.Mode == EgressDenyAll || defaults.Mode == EgressDenyAll:
+		return EgressPolicy{Mode: EgressDenyAll}, nil
+	case p.Mode == EgressAllowAll || p.Mode == "":
+		return defaults, nil
+	}
+
+	// Both policies are allow-lists, so each rule in p must be covered by rules
+	// in the default policy.
+	for _, r := range p.Allow {
+		if !defaults.covers(r) {
+			return p, runtime.NewMalformedPayloadError(
+				"egress rule for '", r.Destination, "' allows connections not allowed ",
+				"by the default egress policy of the worker",
+			)
+		}
+	}
+	return p, nil
+}
+
+// covers returns true, if all connections allowed by rule r are allowed by the
+// rules in policy p. Both must have been resolved.
+func (p EgressPolicy) covers(r EgressRule) bool {
+	// Rules without ports must be covered by a single rule without ports
+	if len(r.Ports) == 0 {
+		for _, d := range p.Allow {
+			if len(d.Ports) == 0 && coversDestination(d, r) && (d.Protocol == "" || d.Protocol == r.Protocol) {
+				return true
+			}
+		}
+		return false
+	}
+	// Rules with ports must have each port covered by a rule
+	for _, port := range r.Ports {
+		covered := false
+		for _, d := range p.Allow {
+			if coversDestination(d, r) && (d.Protocol == "" || d.Protocol == r.Protocol) &&
+				(len(d.Ports) == 0 || containsPort(d.Ports, port)) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// coversDestination returns true, if the destination of d contains the
+// destination of r, destinations must be resolved IPv4 addresses or CIDRs.
+func coversDestination(d, r EgressRule) bool {
+	dNet, dErr := parseDestination(d.Destination)
+	rNet, rErr := parseDestination(r.Destination)
+	if dErr != nil || rErr != nil {
+		return false
+	}
+	dOnes, _ := dNet.Mask.Size()
+	rOnes, _ := rNet.Mask.Size()
+	return dOnes <= rOnes && dNet.Contains(rNet.IP)
+}
+
+// parseDestination parses a resolved destination as an IPv4 network
+func parseDestination(destination string) (*net.IPNet, error) {
+	if ip := net.ParseIP(destination); ip != nil {
+		destination += "/32"
+	}
+	_, ipnet, err := net.ParseCIDR(destination)
+	return ipnet, err
+}
+
+func containsPort(ports []int, port int) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+// egressRules returns the commands to replace the rules in the egress chain
+// for tapDevice with rules implementing the policy, destinations must have
+// been resolved.
+//
+// Allowed destinations RETURN to the fwd_input_ chain, where private subnets
+// are rejected, hence, the policy can't grant access to private subnets.
+func (p EgressPolicy) egressRules(tapDevice string) [][]string {
+	chain := egressChain(tapDevice)
+	cmds := [][]string{
+		{"iptables", "-w", xtableLockWait, "-F", chain},
+	}
+	rule := func(args ...string) {
+		cmds = append(cmds, append([]string{"iptables", "-w", xtableLockWait, "-A", chain}, args...))
+	}
+
+	switch p.Mode {
+	case EgressAllowAll, "":
+		return cmds
+	case EgressDenyAll:
+		rule("-j", "REJECT", "--reject-with", "icmp-net-prohibited")
+		return cmds
+	}
+
+	for _, r := range p.Allow {
+		switch {
+		case r.Protocol == "":
+			rule("-d", r.Destination, "-j", "RETURN")
+		case len(r.Ports) == 0:
+			rule("-d", r.Destination, "-p", r.Protocol, "-j", "RETURN")
+		default:
+			for _, port := range r.Ports {
+				rule("-d", r.Destination, "-p", r.Protocol, "-m", r.Protocol,
+					"--dport", strconv.Itoa(port), "-j", "RETURN")
+			}
+		}
+	}
+	rule("-j", "REJECT", "--reject-with", "icmp-net-prohibited")
+	return cmds
+}
+
+// egressRules6 returns the commands to replace the rules in the ip6tables
+// egress chain for tapDevice. Destinations are IPv4 only, so all IPv6 egress
+// is rejected unless the policy allows all egress.
+func (p EgressPolicy) egressRules6(tapDevice string) [][]string {
+	chain := egressChain(tapDevice)
+	cmds := [][]string{
+		{"ip6tables", "-w", xtableLockWait, "-F", chain},
+	}
+	if p.Mode != EgressAllowAll && p.Mode != "" {
+		cmds = append(cmds, []string{
+			"ip6tables", "-w", xtableLockWait, "-A", chain, "-j", "REJECT", "--reject-with", "icmp6-adm-prohibited",
+		})
+	}
+	return cmds
+}
+
+// resolveDestination returns a list of IPv4 addresses or CIDRs for an egress
+// rule destination.
+func resolveDestination(destination string) ([]string, error) {
+	if _, ipnet, err := net.ParseCIDR(destination); err == nil {
+		if ipnet.IP.To4() == nil {
+			return nil, runtime.NewMalformedPayloadError(
+				"egress destination '", destination, "' is not an IPv4 CIDR",
+			)
+		}
+		return []string{ipnet.String()}, nil
+	}
+	if ip := net.ParseIP(destination); ip != nil {
+		if ip.To4() == nil {
+			return nil, runtime.NewMalformedPayloadError(
+				"egress destination '", destination, "' is not an IPv4 address",
+			)
+		}
+		return []string{ip.To4().String()}, nil
+	}
+
+	ips, err := net.LookupIP(destination)
+	if err != nil {
+		return nil, runtime.NewMalformedPayloadError(
+			"unable to resolve egress destination '", destination, "', error: ", err,
+		)
+	}
+	var result []string
+	for _, ip := range ips {
+		if ipv4 := ip.To4(); ipv4 != nil {
+			result = append(result, ipv4.String())
+		}
+	}
+	if len(result) == 0 {
+		return nil, runtime.NewMalformedPayloadError(
+			"egress destination '", destination, "' has no IPv4 addresses",
+		)
+	}
+	return result, nil
+}
+
+// String returns a human readable summary of the policy for logging
+func (p EgressPolicy) String() string {
+	if p.Mode == "" {
+		return EgressAllowAll
+	}
+	if p.Mode != EgressAllowList {
+		return p.Mode
+	}
+	return fmt.Sprintf("%s (%d rules)", p.Mode, len(p.Allow))
+}
@@ -0,0 +1,119 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEgressPolicyRules(t *testing.T) {
+	prefix := []string{"iptables", "-w", xtableLockWait, "-A", "egress_tctap0"}
+	flush := []string{"iptables", "-w", xtableLockWait, "-F", "egress_tctap0"}
+	reject := append(prefix, "-j", "REJECT", "--reject-with", "icmp-net-prohibited")
+
+	t.Run("allow-all", func(t *testing.T) {
+		p, err := EgressPolicy{Mode: EgressAllowAll}.resolve()
+		require.NoError(t, err)
+		require.Equal(t, [][]string{flush}, p.egressRules("tctap0"))
+	})
+
+	t.Run("deny-all", func(t *testing.T) {
+		p, err := EgressPolicy{Mode: EgressDenyAll}.resolve()
+		require.NoError(t, err)
+		require.Equal(t, [][]string{flush, reject}, p.egressRules("tctap0"))
+	})
+
+	t.Run("allow-list", func(t *testing.T) {
+		p, err := EgressPolicy{
+			Mode: EgressAllowList,
+			Allow: []EgressRule{
+				{Destination: "1.2.3.4"},
+				{Destination: "8.8.0.0/16", Protocol: "udp"},
+				{Destination: "5.6.7.8", Protocol: "tcp", Ports: []int{80, 443}},
+			},
+		}.resolve()
+		require.NoError(t, err)
+		require.Equal(t, [][]string{
+			flush,
+			append(prefix, "-d", "1.2.3.4", "-j", "RETURN"),
+			append(prefix, "-d", "8.8.0.0/16", "-p", "udp", "-j", "RETURN"),
+			append(prefix, "-d", "5.6.7.8", "-p", "tcp", "-m", "tcp", "--dport", "80", "-j", "RETURN"),
+			append(prefix, "-d", "5.6.7.8", "-p", "tcp", "-m", "tcp", "--dport", "443", "-j", "RETURN"),
+			reject,
+		}, p.egressRules("tctap0"))
+	})
+}
+
+func TestEgressPolicyValidate(t *testing.T) {
+	require.NoError(t, EgressPolicy{Mode: EgressDenyAll}.Validate())
+	require.Error(t, EgressPolicy{
+		Mode:  EgressDenyAll,
+		Allow: []EgressRule{{Destination: "1.2.3.4"}},
+	}.Validate())
+	require.Error(t, EgressPolicy{
+		Mode:  EgressAllowList,
+		Allow: []EgressRule{{Destination: "1.2.3.4", Ports: []int{80}}},
+	}.Validate())
+
+	_, err := EgressPolicy{
+		Mode:  EgressAllowList,
+		Allow: []EgressRule{{Destination: "2001:db8::/32"}},
+	}.resolve()
+	require.Error(t, err)
+}
+
+func TestEgressPolicyNarrow(t *testing.T) {
+	allowAll := EgressPolicy{Mode: EgressAllowAll}
+	denyAll := EgressPolicy{Mode: EgressDenyAll}
+	defaults := EgressPolicy{
+		Mode: EgressAllowList,
+		Allow: []EgressRule{
+			{Destination: "10.0.0.0/8"},
+			{Destination: "1.2.3.4", Protocol: "tcp", Ports: []int{80}},
+			{Destination: "1.2.3.0/24", Protocol: "tcp", Ports: []int{443}},
+		},
+	}
+
+	// Any policy narrows allow-all
+	p, err := defaults.narrow(allowAll)
+	require.NoError(t, err)
+	require.Equal(t, defaults, p)
+
+	// Nothing can widen deny-all, and deny-all always narrows
+	p, err = allowAll.narrow(denyAll)
+	require.NoError(t, err)
+	require.Equal(t, denyAll, p)
+	p, err = denyAll.narrow(defaults)
+	require.NoError(t, err)
+	require.Equal(t, denyAll, p)
+
+	// allow-all from a task doesn't widen the default policy
+	p, err = allowAll.narrow(defaults)
+	require.NoError(t, err)
+	require.Equal(t, defaults, p)
+
+	// Rules covered by the default policy are allowed
+	narrower := EgressPolicy{
+		Mode: EgressAllowList,
+		Allow: []EgressRule{
+			{Destination: "10.1.0.0/16", Protocol: "udp"},
+			{Destination: "1.2.3.4", Protocol: "tcp", Ports: []int{80, 443}},
+		},
+	}
+	p, err = narrower.narrow(defaults)
+	require.NoError(t, err)
+	require.Equal(t, narrower, p)
+
+	// Rules not covered by the default policy are rejected
+	for _, r := range []EgressRule{
+		{Destination: "8.8.8.8"},
+		{Destination: "10.0.0.0/7"},
+		{Destination: "1.2.3.4"},
+		{Destination: "1.2.3.4", Protocol: "tcp"},
+		{Destination: "1.2.3.4", Protocol: "tcp", Ports: []int{22}},
+		{Destination: "1.2.3.5", Protocol: "tcp", Ports: []int{80}},
+	} {
+		_, err = EgressPolicy{Mode: EgressAllowList, Allow: []EgressRule{r}}.narrow(defaults)
+		require.Error(t, err, "expected %v to be rejected", r)
+	}
+}
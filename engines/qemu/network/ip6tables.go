@@ -0,0 +1,128 @@
+package network
+
+import "net"
+
+// ip6TableRules returns a list of commands to append ip6tables rules for
+// tapDevice. If delete=true, this returns the commands to delete the rules.
+//
+// These rules mirror the rules from ipTableRules for IPv6, such that a VM
+// exposed on tapDevice is restricted to IPs from the /64 subnet and can access:
+// * DNS server (dnsmasq)
+// * DHCPv6 and router advertisements (dnsmasq)
+// * The public IPv6 internet through uplink, subject to the egress policy
+// VPN connections and the meta-data service are only available over IPv4.
+func ip6TableRules(tapDevice string, subnet *net.IPNet, uplink string, delete bool) [][]string {
+	prefixCommands := func(prefix []string, rules [][]string) [][]string {
+		cmds := [][]string{}
+		for _, rule := range rules {
+			cmds = append(cmds, append(prefix, rule...))
+		}
+		return cmds
+	}
+	network := subnet.String()
+	gateway := ipv6Host(subnet, 1)
+
+	ruleAction := "-A"
+	chainAction := "-N"
+	if delete {
+		ruleAction = "-D"
+		chainAction = "-X"
+	}
+
+	// Create/delete custom chains for this tap device
+	chains := prefixCommands([]string{"ip6tables", "-w", xtableLockWait, chainAction}, [][]string{
+		{"input_" + tapDevice},
+		{"output_" + tapDevice},
+		{"fwd_input_" + tapDevice},
+		{"fwd_output_" + tapDevice},
+		{egressChain(tapDevice)},
+	})
+
+	// Rules for jumping to custom chains for this tap device
+	rules := prefixCommands([]string{"ip6tables", "-w", xtableLockWait, ruleAction}, [][]string{
+		{"INPUT", "-i", tapDevice, "-j", "input_" + tapDevice},
+		{"OUTPUT", "-o", tapDevice, "-j", "output_" + tapDevice},
+		{"FORWARD", "-i", tapDevice, "-j", "fwd_input_" + tapDevice},
+		{"FORWARD", "-o", tapDevice, "-j", "fwd_output_" + tapDevice},
+	})
+
+	// Rules for nat from this subnet, as the subnet is usually not routable
+	nat := prefixCommands([]string{"ip6tables", "-w", xtableLockWait, "-t", "nat", ruleAction}, [][]string{
+		{"POSTROUTING", "-o", uplink, "-s", network, "-j", "MASQUERADE"},
+	})
+
+	// Rules for filtering INPUT from this tap device
+	inputRules := prefixCommands([]string{"ip6tables", "-w", xtableLockWait, ruleAction, "input_" + tapDevice}, [][]string{
+		// Allow ICMPv6, required for neighbor discovery and router solicitation
+		{"-p", "icmpv6", "-j", "ACCEPT"},
+		// Allow DNS requests
+		{"-p", "tcp", "-s", network, "-d", gateway, "-m", "tcp", "--dport", "53", "-m", "state", "--state", "NEW,ESTABLISHED", "-j", "ACCEPT"},
+		{"-p", "udp", "-s", network, "-d", gateway, "-m", "udp", "--dport", "53", "-m", "state", "--state", "NEW,ESTABLISHED", "-j", "ACCEPT"},
+		// Allow DHCPv6 requests, these are sent from link-local addresses
+		{"-s", "fe80::/10", "-p", "udp", "-m", "udp", "--sport", "546", "--dport", "547", "-j", "ACCEPT"},
+		// Reject all other input
+		{"-j", "REJECT", "--reject-with", "icmp6-adm-prohibited"},
+	})
+
+	// Rules for filtering OUTPUT to this tap device
+	outputRules := prefixCommands([]string{"ip6tables", "-w", xtableLockWait, ruleAction, "output_" + tapDevice}, [][]string{
+		// Allow ICMPv6, required for neighbor discovery and router advertisements
+		{"-p", "icmpv6", "-j", "ACCEPT"},
+		// Allow DNS replies from dnsmasq (to subnet only)
+		{"-p", "udp", "-s", gateway, "-d", network, "-m", "udp", "--sport", "53", "-m", "state", "--state", "ESTABLISHED", "-j", "ACCEPT"},
+		{"-p", "tcp", "-s", gateway, "-d", network, "-m", "tcp", "--sport", "53", "-m", "state", "--state", "ESTABLISHED", "-j", "ACCEPT"},
+		// Allow DHCPv6 replies
+		{"-p", "udp", "-m", "udp", "--sport", "547", "--dport", "546", "-j", "ACCEPT"},
+		// Reject all other output
+		{"-j", "REJECT", "--reject-with", "icmp6-adm-prohibited"},
+	})
+
+	// Rules for filtering FORWARD from this tap device
+	forwardInputRules := prefixCommands([]string{"ip6tables", "-w", xtableLockWait, ruleAction, "fwd_input_" + tapDevice}, [][]string{
+		// Apply egress policy, rejecting out-going connections not allowed
+		{"-j", egressChain(tapDevice)},
+		// Reject out-going from this tap device to unique local and link-local
+		{"-d", "fc00::/7", "-j", "REJECT", "--reject-with", "icmp6-addr-unreachable"},
+		{"-d", "fe80::/10", "-j", "REJECT", "--reject-with", "icmp6-addr-unreachable"},
+		// Allow out-going from this tap device with correct source subnet
+		{"-o", uplink, "-s", network, "-j", "ACCEPT"},
+		// Reject all other input for forwarding from tap-device
+		{"-j", "REJECT", "--reject-with", "icmp6-adm-prohibited"},
+	})
+
+	// Rules for filtering FORWARD to this tap device
+	forwardOutputRules := prefixCommands([]string{"ip6tables", "-w", xtableLockWait, ruleAction, "fwd_output_" + tapDevice}, [][]string{
+		// Drop incoming from unique local and link-local addresses
+		{"-s", "fc00::/7", "-j", "DROP"},
+		{"-s", "fe80::/10", "-j", "DROP"},
+		// Allow incoming with correct destination (if already established)
+		{"-i", uplink, "-d", network, "-m", "state", "--state", "RELATED,ESTABLISHED", "-j", "ACCEPT"},
+		// Drop all other output from forwarding to tap-device
+		{"-j", "DROP"},
+	})
+
+	cmds := [][]string{}
+	if !delete {
+		cmds = append(cmds, nat...)
+		cmds = append(cmds, chains...)
+		cmds = append(cmds, rules...)
+		cmds = append(cmds, inputRules...)
+		cmds = append(cmds, outputRules...)
+		cmds = append(cmds, forwardOutputRules...)
+		cmds = append(cmds, forwardInputRules...)
+	} else {
+		// Reverse order when deleting, because we can't delete chains that are
+		// referenced by a rule
+		cmds = append(cmds, forwardInputRules...)
+		cmds = append(cmds, forwardOutputRules...)
+		cmds = append(cmds, outputRules...)
+		cmds = append(cmds, inputRules...)
+		cmds = append(cmds, rules...)
+		// Flush the egress chain, as rules in it are not given here
+		cmds = append(cmds, []string{"ip6tables", "-w", xtableLockWait, "-F", egressChain(tapDevice)})
+		cmds = append(cmds, chains...)
+		cmds = append(cmds, nat...)
+	}
+
+	return cmds
+}
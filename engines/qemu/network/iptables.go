@@ -6,7 +6,7 @@ import "github.com/taskcluster/taskcluster-worker/engines/qemu/network/openvpn"
 const xtableLockWait = "3"
 
 // ipTableRules returns a list of commands to append rules for tapDevice.
-// If delete=false, this returns the commands to delete the rules.
+// If delete=true, this returns the commands to delete the rules.
 //
 // The goal is to create iptable rules such that a VM exposed on tapDevice is
 // restricted to IPs from the subnet <ipPrefix>.0/24 and can access:
@@ -14,11 +14,11 @@ const xtableLockWait = "3"
 // * DNS server (dnsmasq)
 // * DHCP server (dnsmasq)
 // * Routes connected through VPN
-// * The public IPv4 internet address
+// * The public IPv4 internet through uplink, subject to the egress policy
 // In particular we wish to forbid access to other VMs, IP spoofing, and
 // connections other resources within the private network the worker is
 // deployed in.
-func ipTableRules(tapDevice string, ipPrefix string, vpns []*openvpn.VPN, delete bool) [][]string {
+func ipTableRules(tapDevice string, ipPrefix string, uplink string, vpns []*openvpn.VPN, delete bool) [][]string {
 	subnet := ipPrefix + ".0/24"
 	gateway := ipPrefix + ".1"
 	prefixCommands := func(prefix []string, rules [][]string) [][]string {
@@ -42,6 +42,7 @@ func ipTableRules(tapDevice string, ipPrefix string, vpns []*openvpn.VPN, delete
 		{"output_" + tapDevice},
 		{"fwd_input_" + tapDevice},
 		{"fwd_output_" + tapDevice},
+		{egressChain(tapDevice)},
 	})
 
 	// Rules for jumping to custom chains for this tap device
@@ -54,7 +55,7 @@ func ipTableRules(tapDevice string, ipPrefix string, vpns []*openvpn.VPN, delete
 
 	// Rules for nat from this subnet
 	nat := prefixCommands([]string{"iptables", "-w", xtableLockWait, "-t", "nat", ruleAction}, [][]string{
-		{"POSTROUTING", "-o", "eth0", "-s", subnet, "-j", "MASQUERADE"},
+		{"POSTROUTING", "-o", uplink, "-s", subnet, "-j", "MASQUERADE"},
 	})
 
 	// Rules for filtering INPUT from this tap device
@@ -109,9 +110,13 @@ func ipTableRules(tapDevice string, ipPrefix string, vpns []*openvpn.VPN, delete
 	}
 
 	// Rules for filtering FORWARD from this tap device
+	forwardInput := [][]string{
+		// Apply egress policy, rejecting out-going connections not allowed
+		{"-j", egressChain(tapDevice)},
+	}
 	forwardInputRules := prefixCommands([]string{"iptables", "-w", xtableLockWait, ruleAction, "fwd_input_" + tapDevice}, append(
 		// Allow tap device -> VPN
-		forwardVPNInputRules,
+		append(forwardInput, forwardVPNInputRules...),
 		[][]string{
 			// Reject out-going from this tap device to private subnets
 			{"-d", "10.0.0.0/8", "-j", "REJECT", "--reject-with", "icmp-net-unreachable"},
@@ -119,7 +124,7 @@ func ipTableRules(tapDevice string, ipPrefix string, vpns []*openvpn.VPN, delete
 			{"-d", "169.254.0.0/16", "-j", "REJECT", "--reject-with", "icmp-net-unreachable"},
 			{"-d", "192.168.0.0/16", "-j", "REJECT", "--reject-with", "icmp-net-unreachable"},
 			// Allow out-going from this tap device with correct source subnet
-			{"-o", "eth0", "-s", subnet, "-j", "ACCEPT"},
+			{"-o", uplink, "-s", subnet, "-j", "ACCEPT"},
 			// Allow tap device -> tap device within allowed subnet
 			{"-o", tapDevice, "-s", subnet, "-j", "ACCEPT"},
 			// Reject all other input for forwarding from tap-device
@@ -138,7 +143,7 @@ func ipTableRules(tapDevice string, ipPrefix string, vpns []*openvpn.VPN, delete
 			{"-s", "169.254.0.0/16", "-j", "DROP"},
 			{"-s", "192.168.0.0/16", "-j", "DROP"},
 			// Allow incoming from this tap device with correct destination (if already established)
-			{"-i", "eth0", "-d", subnet, "-m", "state", "--state", "RELATED,ESTABLISHED", "-j", "ACCEPT"},
+			{"-i", uplink, "-d", subnet, "-m", "state", "--state", "RELATED,ESTABLISHED", "-j", "ACCEPT"},
 			// Allow tap device -> tap device within allowed subnet
 			{"-i", tapDevice, "-s", subnet, "-j", "ACCEPT"},
 			// Reject all other output from forwarding to tap-device
@@ -163,6 +168,8 @@ func ipTableRules(tapDevice string, ipPrefix string, vpns []*openvpn.VPN, delete
 		cmds = append(cmds, outputRules...)
 		cmds = append(cmds, inputRules...)
 		cmds = append(cmds, rules...)
+		// Flush the egress chain, as rules in it are not given here
+		cmds = append(cmds, []string{"iptables", "-w", xtableLockWait, "-F", egressChain(tapDevice)})
 		cmds = append(cmds, chains...)
 		cmds = append(cmds, nat...)
 	}
@@ -35,16 +35,22 @@ type Pool struct {
 	dnsmasq    *exec.Cmd
 	disposing  atomics.Bool   // Set when we're disposing, before killing dnsmasq
 	disposed   sync.WaitGroup // Counts subprocesses, dnsmasq and vpns
+	egress     EgressPolicy   // Default egress policy, with hostnames resolved
+	uplink     string         // Network interface used for internet access
+	ipv6Prefix string         // IPv6 prefix for subnets, empty if IPv6 is disabled
+	monitor    runtime.Monitor
 }
 
 // entry is a strictly internal presentation of a TAP device network.
 type entry struct {
 	tapDevice string
-	ipPrefix  string // 192.168.xxx (subnet without the last ".0")
+	ipPrefix  string     // 192.168.xxx (subnet without the last ".0")
+	ipv6      *net.IPNet // IPv6 /64 subnet, nil if IPv6 is disabled
 	m         sync.RWMutex
 	handler   http.Handler
 	pool      *Pool
 	inUse     bool
+	egress    bool // true, if egress policy differs from the default policy
 }
 
 // PoolOptions specifies options required by NewPool
@@ -63,7 +69,36 @@ func NewPool(options PoolOptions) (*Pool, error) {
 	schematypes.MustValidateAndMap(PoolConfigSchema, options.Config, &C)
 
 	p := &Pool{
-		networks: make(map[string]*entry),
+		networks:   make(map[string]*entry),
+		uplink:     C.Uplink,
+		ipv6Prefix: C.IPv6Prefix,
+		monitor:    options.Monitor,
+	}
+
+	// Validate IPv6 prefix, before we start creating networks
+	if p.ipv6Prefix != "" {
+		if _, err := ipv6Subnet(p.ipv6Prefix, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	// Find the uplink interface from the default route, if not configured
+	if p.uplink == "" {
+		uplink, err := detectUplink()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to detect uplink interface, consider configuring 'uplink'")
+		}
+		p.uplink = uplink
+	}
+	debug("using uplink interface: %s", p.uplink)
+
+	// Resolve the default egress policy, so it's the same for all networks
+	if C.Egress != nil {
+		egress, err := C.Egress.resolve()
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid egressPolicy in network configuration")
+		}
+		p.egress = egress
 	}
 
 	// Start VPN connections
@@ -110,6 +145,18 @@ func NewPool(options PoolOptions) (*Pool, error) {
 		return nil, fmt.Errorf("Failed to enable ipv4 forwarding: %s", err)
 	}
 
+	// Enable IPv6 forwarding, while still accepting router advertisements on
+	// the uplink interface, as enabling forwarding disables this by default.
+	if p.ipv6Prefix != "" {
+		err = script([][]string{
+			{"sysctl", "-w", "net.ipv6.conf." + p.uplink + ".accept_ra=2"},
+			{"sysctl", "-w", "net.ipv6.conf.all.forwarding=1"},
+		}, true)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to enable ipv6 forwarding: %s", err)
+		}
+	}
+
 	// Create dnsmasq configuration
 	dnsmasqConfig := []string{
 		"strict-order",
@@ -139,7 +186,21 @@ func NewPool(options PoolOptions) (*Pool, error) {
 			}, ","),
 		)
 	}
+	if p.ipv6Prefix != "" {
+		dnsmasqConfig = append(dnsmasqConfig, "enable-ra")
+	}
 	for _, n := range p.networks {
+		if n.ipv6 != nil {
+			dnsmasqConfig = append(dnsmasqConfig,
+				"dhcp-range="+strings.Join([]string{
+					"tag:" + n.tapDevice,
+					ipv6Host(n.ipv6, 2),
+					ipv6Host(n.ipv6, 0xffff),
+					"64",
+					"20m",
+				}, ","),
+			)
+		}
 		dnsmasqConfig = append(dnsmasqConfig,
 			"interface="+n.tapDevice,
 			"dhcp-range="+strings.Join([]string{
@@ -293,6 +354,54 @@ func (n *Network) NetDev(ID string) string {
 	return "tap,id=" + ID + ",ifname=" + n.entry.tapDevice + ",script=no,downscript=no"
 }
 
+// TapDevice returns the name of the tap device for this network.
+func (n *Network) TapDevice() string {
+	n.m.Lock()
+	defer n.m.Unlock()
+	if n.entry == nil {
+		panic("Network.TapDevice() called after Network.Release()")
+	}
+
+	return n.entry.tapDevice
+}
+
+// SetEgressPolicy restricts out-going connections from this network further
+// than the default policy from the network configuration. Returns a
+// MalformedPayloadError, if policy allows connections the default policy
+// doesn't allow. The default policy is restored on Release().
+func (n *Network) SetEgressPolicy(policy EgressPolicy) error {
+	n.m.Lock()
+	defer n.m.Unlock()
+	if n.entry == nil {
+		panic("Network.SetEgressPolicy() called after Network.Release()")
+	}
+
+	policy, err := policy.resolve()
+	if err != nil {
+		return err
+	}
+	policy, err = policy.narrow(n.entry.pool.egress)
+	if err != nil {
+		return err
+	}
+	debug("setting egress policy: %s for %s", policy, n.entry.tapDevice)
+	n.entry.egress = true
+	return n.entry.setEgressPolicy(policy)
+}
+
+// setEgressPolicy replaces the rules in the egress chain for this network
+func (e *entry) setEgressPolicy(policy EgressPolicy) error {
+	cmds := policy.egressRules(e.tapDevice)
+	if e.ipv6 != nil {
+		cmds = append(cmds, policy.egressRules6(e.tapDevice)...)
+	}
+	err := script(cmds, false)
+	if err != nil {
+		return fmt.Errorf("Failed to apply egress policy for tap device: %s, error: %s", e.tapDevice, err)
+	}
+	return nil
+}
+
 // Release returns this network to the Pool
 func (n *Network) Release() {
 	// Lock the wrapper
@@ -309,6 +418,18 @@ func (n *Network) Release() {
 	n.entry.handler = nil
 	n.entry.m.Unlock()
 
+	// Reset egress policy to the default policy, if it was changed. If this
+	// fails we leave the network as in-use, to avoid reusing it.
+	if n.entry.egress {
+		err := n.entry.setEgressPolicy(n.entry.pool.egress)
+		if err != nil {
+			n.entry.pool.monitor.ReportError(err, "failed to reset egress policy for ", n.entry.tapDevice)
+			n.entry = nil
+			return
+		}
+		n.entry.egress = false
+	}
+
 	// Set entry as idle
 	n.entry.pool.m.Lock()
 	n.entry.inUse = false
@@ -416,18 +537,43 @@ func createNetwork(index int, parent *Pool) (*entry, error) {
 	}
 
 	// Create iptables rules and chains
-	err = script(ipTableRules(tapDevice, ipPrefix, parent.vpns, false), false)
+	err = script(ipTableRules(tapDevice, ipPrefix, parent.uplink, parent.vpns, false), false)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to setup ip-tables for tap device: %s error: %s", tapDevice, err)
 	}
 
 	// Construct the network object
-	return &entry{
+	e := &entry{
 		tapDevice: tapDevice,
 		ipPrefix:  ipPrefix,
 		handler:   nil,
 		pool:      parent,
-	}, nil
+	}
+
+	// Assign IPv6 subnet and create ip6tables rules and chains
+	if parent.ipv6Prefix != "" {
+		e.ipv6, err = ipv6Subnet(parent.ipv6Prefix, index+150)
+		if err != nil {
+			return nil, err
+		}
+		err = script([][]string{
+			// Skip duplicate address detection, as the subnet is ours
+			{"ip", "-6", "addr", "add", ipv6Host(e.ipv6, 1) + "/64", "dev", tapDevice, "nodad"},
+		}, true)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to assign IPv6 address to tap device: %s, error: %s", tapDevice, err)
+		}
+		err = script(ip6TableRules(tapDevice, e.ipv6, parent.uplink, false), false)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to setup ip6-tables for tap device: %s error: %s", tapDevice, err)
+		}
+	}
+
+	// Apply the default egress policy
+	if err = e.setEgressPolicy(parent.egress); err != nil {
+		return nil, err
+	}
+	return e, nil
 }
 
 // destroy deletes the networks tap device and related ip-tables configuration.
@@ -439,10 +585,16 @@ func destroyNetwork(n *entry) error {
 	}
 
 	// Delete iptables rules and chains
-	err := script(ipTableRules(n.tapDevice, n.ipPrefix, n.pool.vpns, true), false)
+	err := script(ipTableRules(n.tapDevice, n.ipPrefix, n.pool.uplink, n.pool.vpns, true), false)
 	if err != nil {
 		return fmt.Errorf("Failed to remove ip-tables for tap device: %s, error: %s", n.tapDevice, err)
 	}
+	if n.ipv6 != nil {
+		err = script(ip6TableRules(n.tapDevice, n.ipv6, n.pool.uplink, true), false)
+		if err != nil {
+			return fmt.Errorf("Failed to remove ip6-tables for tap device: %s, error: %s", n.tapDevice, err)
+		}
+	}
 
 	err = script([][]string{
 		// Remove route for the network subnet
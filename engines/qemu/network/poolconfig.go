@@ -11,6 +11,9 @@ type poolConfig struct {
 	VPNs        []interface{} `json:"vpnConnections,omitempty"`
 	SRVRecords  []srvRecord   `json:"srvRecords,omitempty"`
 	HostRecords []hostRecord  `json:"hostRecords,omitempty"`
+	Egress      *EgressPolicy `json:"egressPolicy,omitempty"`
+	Uplink      string        `json:"uplink,omitempty"`
+	IPv6Prefix  string        `json:"ipv6Prefix,omitempty"`
 }
 
 type srvRecord struct {
@@ -99,6 +102,28 @@ var PoolConfigSchema schematypes.Schema = schematypes.Object{
 				Required: []string{"names"},
 			},
 		},
+		"egressPolicy": EgressPolicySchema,
+		"uplink": schematypes.String{
+			Title: "Uplink Interface",
+			Description: util.Markdown(`
+				Network interface through which virtual machines access the internet.
+				Defaults to the interface of the default IPv4 route.
+			`),
+			MaximumLength: 15,
+			Pattern:       `^[a-zA-Z0-9_.:@-]+$`,
+		},
+		"ipv6Prefix": schematypes.String{
+			Title: "IPv6 Prefix",
+			Description: util.Markdown(`
+				IPv6 prefix from which '/64' subnets are allocated for virtual
+				machines, such as a unique local address prefix 'fd00:aaaa:bbbb::/48'.
+				The prefix length must be at most 56 bits.
+
+				If given, virtual machines get IPv6 addresses using router
+				advertisements and DHCPv6, with IPv6 traffic masqueraded through the
+				uplink interface. If not given, virtual machines only have IPv4.
+			`),
+		},
 	},
 	Required: []string{"subnets"},
 }
@@ -0,0 +1,58 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+var defaultRouteDevPattern = regexp.MustCompile(`(?m)^default\b.*?\sdev\s+(\S+)`)
+
+// detectUplink returns the network interface used by the default IPv4 route.
+func detectUplink() (string, error) {
+	output, err := exec.Command("ip", "-4", "route", "show", "default").Output()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to list default route")
+	}
+	return parseDefaultRoute(string(output))
+}
+
+// parseDefaultRoute returns the interface from output of 'ip route show default'
+func parseDefaultRoute(output string) (string, error) {
+	match := defaultRouteDevPattern.FindStringSubmatch(output)
+	if len(match) != 2 {
+		return "", fmt.Errorf("unable to find default route in: '%s'", output)
+	}
+	return match[1], nil
+}
+
+// ipv6Subnet returns the /64 subnet with given index under prefix, which must
+// be an IPv6 CIDR with a prefix length of at most 56 bits.
+func ipv6Subnet(prefix string, index int) (*net.IPNet, error) {
+	ip, ipnet, err := net.ParseCIDR(prefix)
+	if err != nil || ip.To4() != nil {
+		return nil, fmt.Errorf("ipv6Prefix: '%s' is not an IPv6 CIDR", prefix)
+	}
+	if ones, _ := ipnet.Mask.Size(); ones > 56 {
+		return nil, fmt.Errorf("ipv6Prefix: '%s' must have a prefix length of at most 56 bits", prefix)
+	}
+	if index < 0 || index > 255 {
+		return nil, fmt.Errorf("subnet index %d is out of range", index)
+	}
+	subnet := make(net.IP, net.IPv6len)
+	copy(subnet, ipnet.IP.To16())
+	subnet[7] = byte(index)
+	return &net.IPNet{IP: subnet, Mask: net.CIDRMask(64, 128)}, nil
+}
+
+// ipv6Host returns the address of host within an IPv6 subnet
+func ipv6Host(subnet *net.IPNet, host uint16) string {
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, subnet.IP.To16())
+	ip[14] = byte(host >> 8)
+	ip[15] = byte(host)
+	return ip.String()
+}
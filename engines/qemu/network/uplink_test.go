@@ -0,0 +1,39 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDefaultRoute(t *testing.T) {
+	uplink, err := parseDefaultRoute(
+		"default via 172.31.0.1 dev ens5 proto dhcp src 172.31.10.2 metric 100\n",
+	)
+	require.NoError(t, err)
+	require.Equal(t, "ens5", uplink)
+
+	uplink, err = parseDefaultRoute("default dev bond0 scope link\n")
+	require.NoError(t, err)
+	require.Equal(t, "bond0", uplink)
+
+	_, err = parseDefaultRoute("10.0.0.0/8 dev eth1 scope link\n")
+	require.Error(t, err)
+}
+
+func TestIPv6Subnet(t *testing.T) {
+	subnet, err := ipv6Subnet("fd00:aaaa:bbbb::/48", 150)
+	require.NoError(t, err)
+	require.Equal(t, "fd00:aaaa:bbbb:96::/64", subnet.String())
+	require.Equal(t, "fd00:aaaa:bbbb:96::1", ipv6Host(subnet, 1))
+	require.Equal(t, "fd00:aaaa:bbbb:96::ffff", ipv6Host(subnet, 0xffff))
+
+	subnet, err = ipv6Subnet("2001:db8:0:ab00::/56", 1)
+	require.NoError(t, err)
+	require.Equal(t, "2001:db8:0:ab01::/64", subnet.String())
+
+	_, err = ipv6Subnet("fd00:aaaa:bbbb:cc00::/60", 1)
+	require.Error(t, err, "prefix is too long")
+	_, err = ipv6Subnet("192.168.0.0/16", 1)
+	require.Error(t, err, "not an IPv6 prefix")
+}
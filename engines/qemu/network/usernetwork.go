@@ -79,6 +79,12 @@ func (n *UserNetwork) NetDev(ID string) string {
 	return "user,id=" + ID + ",net=169.254.0.0/16,guestfwd=tcp:" + metaDataIP + ":80-cmd:netcat -U " + n.socketFile
 }
 
+// TapDevice returns empty-string as user-mode networking doesn't use a tap
+// device.
+func (n *UserNetwork) TapDevice() string {
+	return ""
+}
+
 // SetHandler takes an http.Handler to be used for meta-data requests.
 func (n *UserNetwork) SetHandler(handler http.Handler) {
 	n.m.Lock()
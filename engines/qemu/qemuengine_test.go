@@ -60,10 +60,12 @@ var provider = &enginetest.EngineProvider{
 		"network": {
 			"subnets": 5
 		},
+		"checkpointOnShutdown": true,
 		"limits": {
 			"maxMemory": 256,
 			"maxCPUs": 1,
-			"defaultThreads": 1
+			"defaultThreads": 1,
+			"accelerator": "auto"
 		}
 	}`,
 }
@@ -214,3 +216,49 @@ func TestKill(t *testing.T) {
 
 	c.Test()
 }
+
+func TestVolumes(t *testing.T) {
+	c := enginetest.VolumeTestCase{
+		EngineProvider: provider,
+		Mountpoint:     "/mnt/my-volume",
+		WriteVolumePayload: `{
+			"image": "` + s.URL + `",
+			"command": ["sh", "-ec", "echo 'hello-world' > /mnt/my-volume/hello.txt"]
+		}`,
+		CheckVolumePayload: `{
+			"image": "` + s.URL + `",
+			"command": ["sh", "-ec", "grep 'hello-world' /mnt/my-volume/hello.txt"]
+		}`,
+	}
+
+	c.TestWriteReadVolume()
+	c.TestReadEmptyVolume()
+	c.TestWriteToReadOnlyVolume()
+	c.TestReadToReadOnlyVolume()
+	c.Test()
+}
+
+func TestCheckpoint(t *testing.T) {
+	c := enginetest.CheckpointTestCase{
+		EngineProvider: provider,
+		Artifact:       checkpointArtifactName,
+		Ready:          "[ready-for-checkpoint]",
+		Target:         "[resumed-from-checkpoint]",
+		Payload: `{
+			"image": "` + s.URL + `",
+			"command": ["sh", "-c", "echo '[ready-for-checkpoint]' && sleep 10 && echo '[resumed-from-checkpoint]'"]
+		}`,
+		ResumePayload: func(url string) string {
+			return `{
+				"image": "` + s.URL + `",
+				"command": ["sh", "-c", "echo '[ready-for-checkpoint]' && sleep 10 && echo '[resumed-from-checkpoint]'"],
+				"resumeFrom": "` + url + `"
+			}`
+		},
+		ResumeScopes: []string{resumeFromScope},
+	}
+
+	c.TestCheckpoint()
+	c.TestResume()
+	c.Test()
+}
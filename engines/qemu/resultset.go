@@ -2,6 +2,7 @@ package qemuengine
 
 import (
 	"strings"
+	"time"
 
 	"github.com/taskcluster/taskcluster-worker/engines"
 	"github.com/taskcluster/taskcluster-worker/engines/qemu/metaservice"
@@ -14,15 +15,22 @@ type resultSet struct {
 	success     bool
 	vm          *vm.VirtualMachine
 	metaService *metaservice.MetaService
+	imageHash   string
+	screenshots *screenshotRecorder
 }
 
-func newResultSet(success bool, vm *vm.VirtualMachine, m *metaservice.MetaService) *resultSet {
+func newResultSet(
+	success bool, vm *vm.VirtualMachine, m *metaservice.MetaService,
+	imageHash string, screenshots *screenshotRecorder,
+) *resultSet {
 	// Set metaService as handler (this will make proxies unreachable)
 	vm.SetHTTPHandler(m)
 	return &resultSet{
 		success:     success,
 		vm:          vm,
 		metaService: m,
+		imageHash:   imageHash,
+		screenshots: screenshots,
 	}
 }
 
@@ -30,11 +38,48 @@ func (r *resultSet) Success() bool {
 	return r.success
 }
 
+func (r *resultSet) ExitStatus() (engines.ExitStatus, error) {
+	report := r.metaService.ExitReport()
+	if report == nil {
+		return engines.ExitStatus{}, engines.ErrResourceNotFound
+	}
+	return engines.ExitStatus{
+		Code:   report.ExitCode,
+		Signal: report.Signal,
+	}, nil
+}
+
+func (r *resultSet) ResourceUsage() (engines.ResourceUsage, error) {
+	report := r.metaService.ExitReport()
+	if report == nil {
+		return engines.ResourceUsage{}, engines.ErrResourceNotFound
+	}
+	return engines.ResourceUsage{
+		WallTime:   time.Duration(report.WallTime) * time.Millisecond,
+		UserTime:   time.Duration(report.UserTime) * time.Millisecond,
+		SystemTime: time.Duration(report.SystemTime) * time.Millisecond,
+		MaxMemory:  report.MaxMemory,
+	}, nil
+}
+
+func (r *resultSet) Environment() (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"imageHash": "sha256:" + r.imageHash,
+	}, nil
+}
+
 func (r *resultSet) ExtractFile(path string) (ioext.ReadSeekCloser, error) {
+	if strings.HasPrefix(path, screenshotsPath+"/") {
+		return r.screenshots.ExtractFile(path)
+	}
 	return r.metaService.GetArtifact(path)
 }
 
 func (r *resultSet) ExtractFolder(path string, handler engines.FileHandler) error {
+	if path == screenshotsPath || path == screenshotsPath+"/" {
+		return r.screenshots.ExtractFolder(handler)
+	}
+
 	files, err := r.metaService.ListFolder(path)
 	if err != nil {
 		return err
@@ -62,5 +107,5 @@ func (r *resultSet) ExtractFolder(path string, handler engines.FileHandler) erro
 
 func (r *resultSet) Dispose() error {
 	r.vm.Kill()
-	return nil
+	return r.screenshots.Dispose()
 }
@@ -1,13 +1,17 @@
 package qemuengine
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/engines/qemu/image"
 	"github.com/taskcluster/taskcluster-worker/engines/qemu/metaservice"
 	"github.com/taskcluster/taskcluster-worker/engines/qemu/vm"
 	"github.com/taskcluster/taskcluster-worker/runtime"
@@ -27,6 +31,12 @@ type sandbox struct {
 	resultAbort error             // Error for Abort
 	monitor     runtime.Monitor   // System log / metrics / error reporting
 	sessions    *sessionManager
+	imageHash   string              // sha256 of the image, for ResultSet.Environment()
+	metrics     *metricsCollector   // nil, if resource usage isn't sampled
+	screenshots *screenshotRecorder // nil, if screenshots aren't captured
+	// False, if volumes are mounted or drives attached, QEMU can't migrate with
+	// shared folders mounted and additional drives aren't saved in checkpoints
+	checkpointable bool
 }
 
 // newSandbox will create a new sandbox and start it.
@@ -34,39 +44,108 @@ func newSandbox(
 	command []string,
 	env map[string]string,
 	proxies map[string]http.Handler,
+	mounts map[string]volumeMount,
 	machine vm.Machine,
-	image vm.Image,
+	inst *image.Instance,
+	resume bool,
+	screenshots *screenshotsOptions,
 	network vm.Network,
 	c *runtime.TaskContext,
 	e *engine,
 	monitor runtime.Monitor,
 ) (*sandbox, error) {
+	// Create a shared folder for each volume mount, sorted for consistency
+	mountpoints := make([]string, 0, len(mounts))
+	for mountpoint := range mounts {
+		mountpoints = append(mountpoints, mountpoint)
+	}
+	sort.Strings(mountpoints)
+	sharedFolders := make([]vm.SharedFolder, len(mountpoints))
+	guestMounts := make([]metaservice.Mount, len(mountpoints))
+	for i, mountpoint := range mountpoints {
+		tag := fmt.Sprintf("volume-%d", i)
+		sharedFolders[i] = vm.SharedFolder{
+			Tag:      tag,
+			Path:     mounts[mountpoint].volume.Path(),
+			ReadOnly: mounts[mountpoint].readOnly,
+		}
+		guestMounts[i] = metaservice.Mount{
+			Tag:        tag,
+			Mountpoint: mountpoint,
+			ReadOnly:   mounts[mountpoint].readOnly,
+		}
+	}
+
+	// Merge machine definitions in order of preference:
+	//  - task.payload.machine
+	//  - machine.json from iamge (or checkpoint, if resuming)
+	//  - machine from engine config
+	//  - default machine (hardcoded into vm.NewVirtualMachine)
+	img := vm.OverwriteMachine(inst, machine.WithDefaults(inst.Machine()).WithDefaults(e.defaultMachine))
+
+	// When resuming from a checkpoint, the saved state must be restored
+	if resume && len(mounts) > 0 {
+		return nil, runtime.NewMalformedPayloadError(
+			"task.payload.resumeFrom cannot be used with volumes mounted in the virtual machine",
+		)
+	}
+	if resume && img.StateFile() == "" {
+		return nil, runtime.NewMalformedPayloadError(
+			"task.payload.resumeFrom can only be used if task.payload.machine ",
+			"matches the machine definition the checkpoint was created with",
+		)
+	}
+
+	// Saved state in images is only restored, if enabled in the engine config
+	if !resume && !e.engineConfig.RestoreSavedState {
+		img = vm.WithoutState(img)
+	}
+
+	// Create files for additional drives, if any
+	img, removeDrives, err := attachDrives(img, inst, c, e)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create screenshot recorder, if screenshots are requested
+	var recorder *screenshotRecorder
+	if screenshots != nil {
+		recorder, err = newScreenshotRecorder(
+			*screenshots, e.Environment.TemporaryStorage, monitor.WithPrefix("screenshots"),
+		)
+		if err != nil {
+			removeDrives()
+			return nil, err
+		}
+	}
+
 	instance, err := vm.NewVirtualMachine(
 		e.engineConfig.MachineLimits,
-		// Merge machine definitions in order of preference:
-		//  - task.payload.machine
-		//  - machine.json from iamge
-		//  - machine from engine config
-		//  - default machine (hardcoded into vm.NewVirtualMachine)
-		vm.OverwriteMachine(image, machine.WithDefaults(image.Machine()).WithDefaults(e.defaultMachine)),
-		network, e.socketFolder.Path(), "", "", vm.LinuxBootOptions{},
+		img,
+		network, sharedFolders, e.socketFolder.Path(), "", "", vm.LinuxBootOptions{},
 		monitor.WithTag("component", "vm"),
 	)
 	if err != nil {
+		recorder.Dispose()
+		removeDrives()
 		return nil, err
 	}
 
 	// Create sandbox
 	s := &sandbox{
-		vm:      instance,
-		context: c,
-		engine:  e,
-		proxies: proxies,
-		monitor: monitor,
+		vm:             instance,
+		context:        c,
+		engine:         e,
+		proxies:        proxies,
+		monitor:        monitor,
+		imageHash:      inst.Hash(),
+		screenshots:    recorder,
+		checkpointable: len(mounts) == 0 && len(img.Machine().Drives()) == 0,
 	}
 
 	// Setup meta-data service
 	s.metaService = metaservice.New(command, env, c.LogDrain(), s.result, e.Environment)
+	s.metaService.SetMounts(guestMounts)
 
 	// Create session manager
 	s.sessions = newSessionManager(s.metaService, s.vm)
@@ -77,6 +156,15 @@ func newSandbox(
 	// Start the VM
 	debug("Starting virtual machine")
 	s.vm.Start()
+	s.screenshots.Start(s.vm.Screenshot)
+
+	// Sample resource usage, if enabled
+	if config := e.engineConfig.Metrics; config != nil {
+		s.metrics = newMetricsCollector(
+			s.vm.Stats, s.vm.Done, time.Duration(config.Interval)*time.Second,
+			monitor.WithPrefix("metrics"),
+		)
+	}
 
 	// Resolve when VM is closed
 	go s.waitForCrash()
@@ -135,16 +223,39 @@ func (s *sandbox) result(success bool) {
 	s.sessions.WaitAndTerminate()
 
 	s.resolve.Do(func() {
-		s.resultSet = newResultSet(success, s.vm, s.metaService)
+		s.reportMetrics()
+		if !success {
+			s.screenshots.Final()
+		}
+		s.screenshots.Stop()
+		s.resultSet = newResultSet(success, s.vm, s.metaService, s.imageHash, s.screenshots)
 		s.resultAbort = engines.ErrSandboxTerminated
 	})
 }
 
+// reportMetrics stops sampling of resource usage, and reports the summary if
+// enabled.
+func (s *sandbox) reportMetrics() {
+	if s.metrics == nil {
+		return
+	}
+	s.metrics.Stop()
+	if !s.engine.engineConfig.Metrics.Summary {
+		return
+	}
+	if err := s.metrics.Report(s.context); err != nil {
+		s.monitor.ReportWarning(err, "failed to report resource usage")
+	}
+}
+
 func (s *sandbox) Kill() error {
 	s.resolve.Do(func() {
+		s.screenshots.Final()
+		s.screenshots.Stop()
 		s.sessions.KillSessions()
 		s.metaService.KillProcess()
-		s.resultSet = newResultSet(false, s.vm, s.metaService)
+		s.reportMetrics()
+		s.resultSet = newResultSet(false, s.vm, s.metaService, s.imageHash, s.screenshots)
 		s.resultAbort = engines.ErrSandboxTerminated
 	})
 	s.resolve.Wait()
@@ -160,6 +271,9 @@ func (s *sandbox) waitForCrash() {
 		// Kill all sessions
 		s.sessions.AbortSessions()
 
+		// Delete screenshots, as there is no ResultSet
+		s.screenshots.Dispose()
+
 		// TODO: Read s.vm.Error and handle the error
 		s.resultError = errors.New("QEMU crashed unexpected")
 		s.resultAbort = engines.ErrSandboxTerminated
@@ -178,6 +292,7 @@ func (s *sandbox) Abort() error {
 
 		// Abort the VM
 		s.vm.Kill()
+		s.screenshots.Dispose()
 		s.resultError = engines.ErrSandboxAborted
 	})
 
@@ -185,6 +300,32 @@ func (s *sandbox) Abort() error {
 	return s.resultAbort
 }
 
+func (s *sandbox) Checkpoint() error {
+	if !s.engine.engineConfig.CheckpointOnShutdown || !s.checkpointable {
+		return engines.ErrFeatureNotSupported
+	}
+
+	var err error
+	resolved := s.resolve.Do(func() {
+		// Abort all shells, these can't be restored
+		s.sessions.AbortSessions()
+
+		// Save and upload checkpoint, kill the VM if this failed
+		err = s.checkpoint()
+		s.vm.Kill()
+		s.screenshots.Dispose()
+		s.resultError = engines.ErrSandboxAborted
+	})
+	if !resolved {
+		s.resolve.Wait()
+		if s.resultError == engines.ErrSandboxAborted {
+			return engines.ErrSandboxAborted
+		}
+		return engines.ErrSandboxTerminated
+	}
+	return err
+}
+
 func (s *sandbox) NewShell(command []string, tty bool) (engines.Shell, error) {
 	return s.sessions.NewShell(command, tty)
 }
@@ -220,3 +361,10 @@ func (s *sandbox) OpenDisplay(name string) (io.ReadWriteCloser, error) {
 	}
 	return s.sessions.OpenDisplay()
 }
+
+func (s *sandbox) WatchDisplay(name string) (io.ReadWriteCloser, error) {
+	if name != qemuDisplayName {
+		return nil, engines.ErrNoSuchDisplay
+	}
+	return s.sessions.WatchDisplay()
+}
@@ -1,6 +1,7 @@
 package qemuengine
 
 import (
+	"fmt"
 	"net/http"
 	"os"
 	"regexp"
@@ -8,6 +9,7 @@ import (
 	"sync"
 
 	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/engines/hostvolume"
 	"github.com/taskcluster/taskcluster-worker/engines/qemu/image"
 	"github.com/taskcluster/taskcluster-worker/engines/qemu/network"
 	"github.com/taskcluster/taskcluster-worker/engines/qemu/vm"
@@ -22,11 +24,14 @@ type sandboxBuilder struct {
 	network    *network.Network
 	command    []string
 	machine    vm.Machine
+	resume     bool                // true, if resuming from a checkpoint
+	capture    *screenshotsOptions // screenshots to capture, if any
 	image      *image.Instance
 	imageError error
 	imageDone  <-chan struct{}
 	proxies    map[string]http.Handler
 	env        map[string]string
+	mounts     map[string]volumeMount
 	context    *runtime.TaskContext
 	engine     *engine
 	monitor    runtime.Monitor
@@ -42,9 +47,12 @@ func newSandboxBuilder(
 	sb := &sandboxBuilder{
 		network:   network,
 		command:   payload.Command,
+		resume:    payload.ResumeFrom != nil,
+		capture:   payload.Screenshots,
 		imageDone: imageDone,
 		proxies:   make(map[string]http.Handler),
 		env:       make(map[string]string),
+		mounts:    make(map[string]volumeMount),
 		context:   c,
 		engine:    e,
 		monitor:   monitor,
@@ -55,7 +63,6 @@ func newSandboxBuilder(
 
 	// Start downloading and extracting the image
 	go func() {
-		var scopeSets [][]string
 		var inst *image.Instance
 
 		ctx := &fetchImageContext{c}
@@ -65,15 +72,7 @@ func newSandboxBuilder(
 		}
 
 		// Check that task.scopes satisfies one of required scope-sets
-		scopeSets = ref.Scopes()
-		if !c.HasScopes(scopeSets...) {
-			var options []string
-			for _, scopes := range scopeSets {
-				options = append(options, strings.Join(scopes, ", "))
-			}
-			err = runtime.NewMalformedPayloadError(
-				`task.scopes must satisfy at-least one of the scope-sets: ` + strings.Join(options, " or "),
-			)
+		if err = checkReferenceScopes(c, ref); err != nil {
 			goto handleErr
 		}
 
@@ -83,6 +82,14 @@ func newSandboxBuilder(
 		})
 		debug("fetched image: %#v", payload.Image)
 
+		// Load checkpoint into the image instance, if resuming from a checkpoint
+		if err == nil && payload.ResumeFrom != nil {
+			if err = loadCheckpoint(ctx, payload.ResumeFrom, inst, e); err != nil {
+				inst.Release()
+				inst = nil
+			}
+		}
+
 	handleErr:
 		// Transform broken reference to malformed payload
 		if fetcher.IsBrokenReferenceError(err) {
@@ -107,6 +114,70 @@ func newSandboxBuilder(
 	return sb
 }
 
+// checkReferenceScopes returns a MalformedPayloadError, if task.scopes doesn't
+// satisfy one of the scope-sets required to fetch ref.
+func checkReferenceScopes(c *runtime.TaskContext, ref fetcher.Reference) error {
+	scopeSets := ref.Scopes()
+	if c.HasScopes(scopeSets...) {
+		return nil
+	}
+	var options []string
+	for _, scopes := range scopeSets {
+		options = append(options, strings.Join(scopes, ", "))
+	}
+	return runtime.NewMalformedPayloadError(
+		`task.scopes must satisfy at-least one of the scope-sets: ` + strings.Join(options, " or "),
+	)
+}
+
+// volumeMount is a volume attached to the sandboxBuilder
+type volumeMount struct {
+	volume   *hostvolume.Volume
+	readOnly bool
+}
+
+// mountPointPattern defines allowed volume mountpoints
+var mountPointPattern = regexp.MustCompile(`^(/[a-zA-Z0-9_.-]+)+$`)
+
+func (sb *sandboxBuilder) AttachVolume(mountpoint string, v engines.Volume, readOnly bool) error {
+	// We can type cast Volume to our internal type as we know the volume was
+	// created by NewVolume() or NewVolumeBuilder()
+	vol, valid := v.(*hostvolume.Volume)
+	if !valid {
+		return fmt.Errorf("invalid volume type")
+	}
+
+	// Validate mountpoint against allowed patterns
+	if !mountPointPattern.MatchString(mountpoint) || strings.Contains(mountpoint, "/..") {
+		return runtime.NewMalformedPayloadError("Volume mountpoint: '", mountpoint, "'",
+			" is not allowed for QEMU engine. The mountpoint must be an absolute path",
+			" matching: ", mountPointPattern.String())
+	}
+
+	// Acquire the lock
+	sb.m.Lock()
+	defer sb.m.Unlock()
+
+	// Check that the mountpoint isn't already in use
+	if _, ok := sb.mounts[mountpoint]; ok {
+		return engines.ErrNamingConflict
+	}
+
+	// Check that we don't exceed the number of shared folders QEMU can attach
+	if len(sb.mounts) >= vm.MaxSharedFolders {
+		return runtime.NewMalformedPayloadError(
+			"QEMU engine only supports attaching ", vm.MaxSharedFolders, " volumes",
+		)
+	}
+
+	// Attach the volume
+	sb.mounts[mountpoint] = volumeMount{
+		volume:   vol,
+		readOnly: readOnly,
+	}
+	return nil
+}
+
 var proxyNamePattern = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
 
 func (sb *sandboxBuilder) AttachProxy(hostname string, handler http.Handler) error {
@@ -185,8 +256,8 @@ func (sb *sandboxBuilder) StartSandbox() (engines.Sandbox, error) {
 
 	// Create a sandbox
 	s, err := newSandbox(
-		sb.command, sb.env, sb.proxies, sb.machine, sb.image, sb.network,
-		sb.context, sb.engine, sb.monitor,
+		sb.command, sb.env, sb.proxies, sb.mounts, sb.machine, sb.image, sb.resume,
+		sb.capture, sb.network, sb.context, sb.engine, sb.monitor,
 	)
 	if err != nil {
 		sb.m.Unlock()
@@ -0,0 +1,331 @@
+package qemuengine
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// Path in the ResultSet where screenshots can be extracted from, this can't
+// conflict with guest paths as these are absolute.
+const screenshotsPath = "qemu:screenshots"
+
+// Maximum number of periodic screenshots captured for a task
+const maxScreenshots = 250
+
+// Names of the final screenshot and the animated timeline
+const (
+	finalScreenshotName = "final.png"
+	timelineName        = "timeline.gif"
+)
+
+// Delay between frames in the timeline in 100ths of a second
+const timelineFrameDelay = 50
+
+type screenshotsOptions struct {
+	Interval int  `json:"interval,omitempty"`
+	Final    bool `json:"final,omitempty"`
+	Timeline bool `json:"timeline,omitempty"`
+}
+
+var screenshotsSchema = schematypes.Object{
+	Title: "Screenshots",
+	Description: util.Markdown(`
+		Capture screenshots of the virtual machine screen as PNG files. The
+		screenshots can be extracted from the path '` + screenshotsPath + `',
+		for example, using the 'artifacts' plugin with a 'directory' artifact.
+	`),
+	Properties: schematypes.Properties{
+		"interval": schematypes.Integer{
+			Title: "Interval",
+			Description: util.Markdown(`
+				Number of seconds between periodic screenshots, if not given no
+				periodic screenshots are captured. At most ` + fmt.Sprint(maxScreenshots) + `
+				periodic screenshots are captured.
+			`),
+			Minimum: 1,
+			Maximum: 60 * 60,
+		},
+		"final": schematypes.Boolean{
+			Title: "Final Screenshot",
+			Description: util.Markdown(`
+				Capture a screenshot as '` + finalScreenshotName + `' when the task
+				fails or is killed, for example, because it exceeded its run-time.
+			`),
+		},
+		"timeline": schematypes.Boolean{
+			Title: "Timeline",
+			Description: util.Markdown(`
+				Encode the periodic screenshots as an animated GIF named
+				'` + timelineName + `', requires 'interval' to be given.
+			`),
+		},
+	},
+}
+
+// screenshotRecorder captures screenshots to a temporary folder, methods may
+// be called on a nil screenshotRecorder, if screenshots aren't enabled.
+type screenshotRecorder struct {
+	m          sync.Mutex
+	folder     runtime.TemporaryFolder
+	screenshot func() (image.Image, error)
+	options    screenshotsOptions
+	monitor    runtime.Monitor
+	files      []string // names of screenshots in folder
+	periodic   []string // names of periodic screenshots in order of capture
+	stop       chan struct{}
+	stopOnce   sync.Once
+	done       chan struct{}
+	timeline   sync.Once // encoding of the timeline, when first extracted
+}
+
+// newScreenshotRecorder creates a screenshotRecorder, Start() must be called
+// to start capturing screenshots.
+func newScreenshotRecorder(
+	options screenshotsOptions, storage runtime.TemporaryStorage, monitor runtime.Monitor,
+) (*screenshotRecorder, error) {
+	folder, err := storage.NewFolder()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create folder for screenshots")
+	}
+	return &screenshotRecorder{
+		folder:  folder,
+		options: options,
+		monitor: monitor,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}, nil
+}
+
+// Start capturing periodic screenshots using the screenshot function, if
+// options has an interval.
+func (r *screenshotRecorder) Start(screenshot func() (image.Image, error)) {
+	if r == nil {
+		return
+	}
+	r.screenshot = screenshot
+	if r.options.Interval > 0 {
+		go r.run(time.Duration(r.options.Interval) * time.Second)
+	} else {
+		close(r.done)
+	}
+}
+
+func (r *screenshotRecorder) run(interval time.Duration) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for i := 1; i <= maxScreenshots; i++ {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+		name := fmt.Sprintf("screenshot-%04d.png", i)
+		if err := r.capture(name); err != nil {
+			r.monitor.Warn("failed to capture screenshot, error: ", err)
+			continue
+		}
+		r.m.Lock()
+		r.periodic = append(r.periodic, name)
+		r.m.Unlock()
+	}
+}
+
+// capture a screenshot and save it as PNG with given name
+func (r *screenshotRecorder) capture(name string) error {
+	img, err := r.screenshot()
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(filepath.Join(r.folder.Path(), name))
+	if err != nil {
+		return errors.Wrap(err, "failed to create screenshot file")
+	}
+	if err = png.Encode(f, img); err != nil {
+		f.Close()
+		return errors.Wrap(err, "failed to encode screenshot")
+	}
+	if err = f.Close(); err != nil {
+		return errors.Wrap(err, "failed to write screenshot file")
+	}
+	r.m.Lock()
+	r.files = append(r.files, name)
+	r.m.Unlock()
+	return nil
+}
+
+// Final captures the final screenshot, if enabled, this must be called
+// before the virtual machine is stopped.
+func (r *screenshotRecorder) Final() {
+	if r == nil || r.screenshot == nil || !r.options.Final {
+		return
+	}
+	if err := r.capture(finalScreenshotName); err != nil {
+		r.monitor.Warn("failed to capture final screenshot, error: ", err)
+	}
+}
+
+// Stop capturing periodic screenshots. The timeline is encoded when
+// screenshots are first extracted, as encoding may take a while.
+func (r *screenshotRecorder) Stop() {
+	if r == nil {
+		return
+	}
+	r.stopOnce.Do(func() {
+		close(r.stop)
+		if r.screenshot != nil {
+			<-r.done
+		}
+	})
+}
+
+// ensureTimeline encodes the timeline, if enabled and not already encoded,
+// this must not be called before Stop().
+func (r *screenshotRecorder) ensureTimeline() {
+	r.timeline.Do(func() {
+		r.m.Lock()
+		periodic := r.periodic
+		r.m.Unlock()
+		if !r.options.Timeline || len(periodic) == 0 {
+			return
+		}
+		if err := r.encodeTimeline(periodic); err != nil {
+			r.monitor.Warn("failed to encode screenshot timeline, error: ", err)
+		}
+	})
+}
+
+// encodeTimeline encodes periodic screenshots as an animated GIF, decoding
+// and encoding one frame at a time.
+func (r *screenshotRecorder) encodeTimeline(periodic []string) error {
+	// Find the size of the largest frame
+	var width, height int
+	for _, name := range periodic {
+		f, err := os.Open(filepath.Join(r.folder.Path(), name))
+		if err != nil {
+			return errors.Wrap(err, "failed to open screenshot")
+		}
+		c, err := png.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			return errors.Wrap(err, "failed to decode screenshot")
+		}
+		if c.Width > width {
+			width = c.Width
+		}
+		if c.Height > height {
+			height = c.Height
+		}
+	}
+
+	f, err := os.Create(filepath.Join(r.folder.Path(), timelineName))
+	if err != nil {
+		return errors.Wrap(err, "failed to create timeline file")
+	}
+	defer f.Close()
+	w := newTimelineWriter(f, width, height)
+	for _, name := range periodic {
+		img, err := decodeScreenshot(filepath.Join(r.folder.Path(), name))
+		if err != nil {
+			return err
+		}
+		if err = w.WriteFrame(img, timelineFrameDelay); err != nil {
+			return errors.Wrap(err, "failed to encode timeline")
+		}
+	}
+	if err = w.Close(); err != nil {
+		return errors.Wrap(err, "failed to encode timeline")
+	}
+	if err = f.Close(); err != nil {
+		return errors.Wrap(err, "failed to write timeline file")
+	}
+	r.m.Lock()
+	r.files = append(r.files, timelineName)
+	r.m.Unlock()
+	return nil
+}
+
+// decodeScreenshot decodes the PNG file
+func decodeScreenshot(file string) (image.Image, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open screenshot")
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode screenshot")
+	}
+	return img, nil
+}
+
+// ExtractFile returns a screenshot from path under screenshotsPath
+func (r *screenshotRecorder) ExtractFile(path string) (ioext.ReadSeekCloser, error) {
+	if r == nil {
+		return nil, engines.ErrResourceNotFound
+	}
+	r.ensureTimeline()
+	name := strings.TrimPrefix(path, screenshotsPath+"/")
+	r.m.Lock()
+	defer r.m.Unlock()
+	for _, f := range r.files {
+		if f == name {
+			return os.Open(filepath.Join(r.folder.Path(), name))
+		}
+	}
+	return nil, engines.ErrResourceNotFound
+}
+
+// ExtractFolder calls handler for each screenshot
+func (r *screenshotRecorder) ExtractFolder(handler engines.FileHandler) error {
+	if r == nil {
+		return engines.ErrResourceNotFound
+	}
+	r.ensureTimeline()
+	r.m.Lock()
+	files := append([]string{}, r.files...)
+	r.m.Unlock()
+	if len(files) == 0 {
+		return engines.ErrResourceNotFound
+	}
+	for _, name := range files {
+		f, err := os.Open(filepath.Join(r.folder.Path(), name))
+		if err != nil {
+			r.monitor.ReportError(err, "failed to open screenshot")
+			return runtime.ErrNonFatalInternalError
+		}
+		if handler(name, f) != nil {
+			return engines.ErrHandlerInterrupt
+		}
+	}
+	return nil
+}
+
+// Dispose stops capturing and deletes all screenshots
+func (r *screenshotRecorder) Dispose() error {
+	if r == nil {
+		return nil
+	}
+	r.stopOnce.Do(func() {
+		close(r.stop)
+		if r.screenshot != nil {
+			<-r.done
+		}
+	})
+	return r.folder.Remove()
+}
@@ -0,0 +1,68 @@
+package qemuengine
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+func TestScreenshotRecorder(t *testing.T) {
+	storage := runtime.NewTemporaryTestFolderOrPanic()
+	defer storage.Remove()
+
+	size := 10
+	screenshot := func() (image.Image, error) {
+		size += 10
+		img := image.NewRGBA(image.Rect(0, 0, size, size))
+		img.Set(1, 1, color.White)
+		return img, nil
+	}
+
+	r, err := newScreenshotRecorder(screenshotsOptions{
+		Final:    true,
+		Timeline: true,
+	}, storage, mocks.NewMockMonitor(true))
+	require.NoError(t, err)
+	defer r.Dispose()
+	r.Start(screenshot)
+
+	// Capture periodic screenshots, as if the interval had passed
+	for _, name := range []string{"screenshot-0001.png", "screenshot-0002.png"} {
+		require.NoError(t, r.capture(name))
+		r.periodic = append(r.periodic, name)
+	}
+	r.Final()
+	r.Stop()
+
+	var files []string
+	err = r.ExtractFolder(func(p string, f ioext.ReadSeekCloser) error {
+		files = append(files, p)
+		return f.Close()
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"screenshot-0001.png", "screenshot-0002.png", finalScreenshotName, timelineName,
+	}, files)
+
+	f, err := r.ExtractFile(screenshotsPath + "/" + timelineName)
+	require.NoError(t, err)
+	anim, err := gif.DecodeAll(f)
+	f.Close()
+	require.NoError(t, err)
+	require.Len(t, anim.Image, 2)
+	require.Equal(t, 30, anim.Config.Width, "expected size of largest frame")
+
+	_, err = r.ExtractFile(screenshotsPath + "/missing.png")
+	require.Equal(t, engines.ErrResourceNotFound, err)
+
+	var nilRecorder *screenshotRecorder
+	_, err = nilRecorder.ExtractFile(screenshotsPath + "/" + finalScreenshotName)
+	require.Equal(t, engines.ErrResourceNotFound, err)
+}
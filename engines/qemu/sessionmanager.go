@@ -27,6 +27,7 @@ type sessionManager struct {
 	newError error                // Error, if we don't allow new shells/displays
 	shells   []engines.Shell      // Active shells
 	displays []io.ReadWriteCloser // Active displays
+	watchers []io.ReadWriteCloser // Passive displays, closed when terminated
 }
 
 func newSessionManager(meta *metaservice.MetaService, vm *vm.VirtualMachine) *sessionManager {
@@ -55,6 +56,9 @@ func (s *sessionManager) AbortSessions() {
 	for _, c := range s.displays {
 		c.Close()
 	}
+	for _, c := range s.watchers {
+		c.Close()
+	}
 }
 
 func (s *sessionManager) KillSessions() {
@@ -84,6 +88,10 @@ func (s *sessionManager) WaitAndTerminate() {
 	}
 	// Do now allow new shells
 	s.newError = engines.ErrSandboxTerminated
+	// Close passive displays, as they don't keep the sandbox alive
+	for _, c := range s.watchers {
+		c.Close()
+	}
 	s.m.Unlock()
 }
 
@@ -140,13 +148,16 @@ func (s *sessionManager) waitForShell(shell engines.Shell) {
 	s.c.Broadcast()
 }
 
-func (s *sessionManager) OpenDisplay() (io.ReadWriteCloser, error) {
+// dialDisplay connects to the VNC socket, if we're still allowing creation
+// of interactive sessions.
+func (s *sessionManager) dialDisplay() (net.Conn, error) {
 	// Check if we're still allowing creation of interactive sessions
 	s.m.Lock()
-	if s.newError != nil {
-		return nil, s.newError
-	}
+	err := s.newError
 	s.m.Unlock()
+	if err != nil {
+		return nil, err
+	}
 
 	// Get socket
 	socket := s.vm.VNCSocket()
@@ -162,11 +173,25 @@ func (s *sessionManager) OpenDisplay() (io.ReadWriteCloser, error) {
 		// TODO: Check if vm is still running, if so report an error
 		return nil, engines.ErrSandboxTerminated
 	}
+	return conn, nil
+}
+
+func (s *sessionManager) OpenDisplay() (io.ReadWriteCloser, error) {
+	conn, err := s.dialDisplay()
+	if err != nil {
+		return nil, err
+	}
 
 	// Lock we so we can insert in the list of displays
 	s.m.Lock()
 	defer s.m.Unlock()
 
+	// Check that we didn't stop allowing new displays while dialing
+	if s.newError != nil {
+		conn.Close()
+		return nil, s.newError
+	}
+
 	// Create a WatchPipe around conn, so that we can remove it from displays
 	// when it is closed
 	var display io.ReadWriteCloser
@@ -192,3 +217,24 @@ func (s *sessionManager) OpenDisplay() (io.ReadWriteCloser, error) {
 
 	return display, nil
 }
+
+// WatchDisplay opens a passive display connection, which doesn't prevent
+// WaitAndTerminate() from returning, instead it is closed when terminated.
+func (s *sessionManager) WatchDisplay() (io.ReadWriteCloser, error) {
+	conn, err := s.dialDisplay()
+	if err != nil {
+		return nil, err
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	// Check that we didn't terminate while dialing
+	if s.newError != nil {
+		conn.Close()
+		return nil, s.newError
+	}
+	s.watchers = append(s.watchers, conn)
+
+	return conn, nil
+}
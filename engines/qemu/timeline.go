@@ -0,0 +1,144 @@
+package qemuengine
+
+import (
+	"bufio"
+	"compress/lzw"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"io"
+)
+
+// timelineWriter writes an animated GIF one frame at a time, such that only
+// a single frame is held in memory while encoding the timeline. All frames are
+// quantized to the palette.Plan9 global color table.
+type timelineWriter struct {
+	w      *bufio.Writer
+	bounds image.Rectangle
+	frame  *image.Paletted
+	err    error
+}
+
+// newTimelineWriter writes the GIF header for frames of given size to w
+func newTimelineWriter(w io.Writer, width, height int) *timelineWriter {
+	t := &timelineWriter{
+		w:      bufio.NewWriter(w),
+		bounds: image.Rect(0, 0, width, height),
+	}
+	t.write([]byte("GIF89a"))
+	// Logical screen descriptor with a global color table of 256 entries
+	t.write([]byte{
+		byte(width), byte(width >> 8), byte(height), byte(height >> 8),
+		0xF7, 0x00, 0x00,
+	})
+	for _, c := range palette.Plan9 {
+		r, g, b, _ := c.RGBA()
+		t.write([]byte{byte(r >> 8), byte(g >> 8), byte(b >> 8)})
+	}
+	// Application extension making the animation loop forever
+	t.write([]byte{0x21, 0xFF, 0x0B})
+	t.write([]byte("NETSCAPE2.0"))
+	t.write([]byte{0x03, 0x01, 0x00, 0x00, 0x00})
+	return t
+}
+
+func (t *timelineWriter) write(b []byte) {
+	if t.err == nil {
+		_, t.err = t.w.Write(b)
+	}
+}
+
+// WriteFrame quantizes img and writes it as a frame shown for delay 100ths
+// of a second, img is drawn in the top-left corner of the frame.
+func (t *timelineWriter) WriteFrame(img image.Image, delay int) error {
+	if t.frame == nil {
+		t.frame = image.NewPaletted(t.bounds, palette.Plan9)
+	} else {
+		// Clear the frame, as img may be smaller than the previous image
+		for i := range t.frame.Pix {
+			t.frame.Pix[i] = 0
+		}
+	}
+	b := img.Bounds()
+	draw.FloydSteinberg.Draw(t.frame, b.Sub(b.Min), img, b.Min)
+
+	// Graphic control extension with the delay
+	t.write([]byte{0x21, 0xF9, 0x04, 0x00, byte(delay), byte(delay >> 8), 0x00, 0x00})
+	// Image descriptor without a local color table
+	width, height := t.bounds.Dx(), t.bounds.Dy()
+	t.write([]byte{
+		0x2C, 0x00, 0x00, 0x00, 0x00,
+		byte(width), byte(width >> 8), byte(height), byte(height >> 8),
+		0x00,
+	})
+	// Image data as LZW compressed sub-blocks, with a minimum code size of 8
+	t.write([]byte{0x08})
+	if t.err != nil {
+		return t.err
+	}
+	bw := &gifBlockWriter{w: t.w}
+	lw := lzw.NewWriter(bw, lzw.LSB, 8)
+	if _, err := lw.Write(t.frame.Pix); err != nil {
+		lw.Close()
+		t.err = err
+		return err
+	}
+	if err := lw.Close(); err != nil {
+		t.err = err
+		return err
+	}
+	t.err = bw.Close()
+	return t.err
+}
+
+// Close writes the GIF trailer and flushes the output, this does not close the
+// underlying io.Writer.
+func (t *timelineWriter) Close() error {
+	t.write([]byte{0x3B})
+	if t.err == nil {
+		t.err = t.w.Flush()
+	}
+	return t.err
+}
+
+// gifBlockWriter splits data into sub-blocks of at most 255 bytes, each
+// prefixed with its length, Close() writes the block terminator.
+type gifBlockWriter struct {
+	w   io.Writer
+	buf [256]byte
+	n   int
+}
+
+func (b *gifBlockWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		c := copy(b.buf[1+b.n:], p)
+		b.n += c
+		written += c
+		p = p[c:]
+		if b.n == 255 {
+			if err := b.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (b *gifBlockWriter) flush() error {
+	if b.n == 0 {
+		return nil
+	}
+	b.buf[0] = byte(b.n)
+	_, err := b.w.Write(b.buf[:1+b.n])
+	b.n = 0
+	return err
+}
+
+func (b *gifBlockWriter) Close() error {
+	if err := b.flush(); err != nil {
+		return err
+	}
+	_, err := b.w.Write([]byte{0x00})
+	return err
+}
@@ -0,0 +1,53 @@
+package qemuengine
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimelineWriter(t *testing.T) {
+	// Frames of random noise, such that the image data spans many sub-blocks
+	frames := []image.Image{}
+	for _, size := range []image.Point{{200, 100}, {120, 150}} {
+		img := image.NewRGBA(image.Rect(0, 0, size.X, size.Y))
+		for i := range img.Pix {
+			img.Pix[i] = byte(rand.Intn(256))
+		}
+		frames = append(frames, img)
+	}
+
+	var buf bytes.Buffer
+	w := newTimelineWriter(&buf, 200, 150)
+	for _, img := range frames {
+		require.NoError(t, w.WriteFrame(img, timelineFrameDelay))
+	}
+	require.NoError(t, w.Close())
+
+	anim, err := gif.DecodeAll(&buf)
+	require.NoError(t, err)
+	require.Len(t, anim.Image, 2)
+	require.Equal(t, []int{timelineFrameDelay, timelineFrameDelay}, anim.Delay)
+	require.Equal(t, 0, anim.LoopCount, "expected animation to loop forever")
+	require.Equal(t, 200, anim.Config.Width)
+	require.Equal(t, 150, anim.Config.Height)
+	for _, p := range anim.Image {
+		require.Equal(t, image.Rect(0, 0, 200, 150), p.Bounds())
+	}
+
+	// Image data matches the quantized frame
+	expected := image.NewPaletted(image.Rect(0, 0, 200, 150), palette.Plan9)
+	draw.FloydSteinberg.Draw(expected, frames[0].Bounds(), frames[0], image.ZP)
+	require.Equal(t, expected.Pix, anim.Image[0].Pix)
+
+	// Pixels outside the second frame are cleared
+	black := palette.Plan9[0]
+	require.Equal(t, color.RGBAModel.Convert(black), color.RGBAModel.Convert(anim.Image[1].At(150, 10)))
+}
@@ -0,0 +1,54 @@
+package vm
+
+import (
+	"fmt"
+	"os"
+)
+
+// Accelerators that can be given in MachineLimits.Accelerator
+const (
+	AcceleratorKVM  = "kvm"  // Hardware virtualization, requires /dev/kvm
+	AcceleratorTCG  = "tcg"  // Software emulation, slow but works everywhere
+	AcceleratorAuto = "auto" // KVM if available, otherwise TCG
+)
+
+// tcgDefaultCPU is the CPU model used instead of 'host' when using TCG, as
+// 'host' is only supported with KVM.
+const tcgDefaultCPU = "qemu64"
+
+// kvmDevice is the device that must be accessible for KVM to be used
+var kvmDevice = "/dev/kvm"
+
+// KVMAvailable returns true, if /dev/kvm exists and can be opened by the
+// current user.
+func KVMAvailable() bool {
+	f, err := os.OpenFile(kvmDevice, os.O_RDWR, 0)
+	if err != nil {
+		debug("KVM isn't available, error: %s", err)
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// ResolveAccelerator returns the accelerator to use, either AcceleratorKVM or
+// AcceleratorTCG. If accelerator is AcceleratorAuto or empty, KVM is used if
+// available. Returns an error if KVM is requested, but isn't available.
+func ResolveAccelerator(accelerator string) (string, error) {
+	switch accelerator {
+	case AcceleratorKVM:
+		if !KVMAvailable() {
+			return "", fmt.Errorf("accelerator 'kvm' is not available, '%s' can't be opened", kvmDevice)
+		}
+		return AcceleratorKVM, nil
+	case AcceleratorTCG:
+		return AcceleratorTCG, nil
+	case AcceleratorAuto, "":
+		if KVMAvailable() {
+			return AcceleratorKVM, nil
+		}
+		return AcceleratorTCG, nil
+	default:
+		return "", fmt.Errorf("unknown accelerator: '%s'", accelerator)
+	}
+}
@@ -0,0 +1,49 @@
+package vm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveAccelerator(t *testing.T) {
+	folder, err := ioutil.TempDir("", "accel-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	original := kvmDevice
+	defer func() { kvmDevice = original }()
+
+	// Pretend KVM isn't available
+	kvmDevice = filepath.Join(folder, "missing")
+	assert.False(t, KVMAvailable())
+	accel, err := ResolveAccelerator(AcceleratorAuto)
+	assert.NoError(t, err)
+	assert.Equal(t, AcceleratorTCG, accel)
+	accel, err = ResolveAccelerator("")
+	assert.NoError(t, err)
+	assert.Equal(t, AcceleratorTCG, accel)
+	_, err = ResolveAccelerator(AcceleratorKVM)
+	assert.Error(t, err)
+	accel, err = ResolveAccelerator(AcceleratorTCG)
+	assert.NoError(t, err)
+	assert.Equal(t, AcceleratorTCG, accel)
+
+	// Pretend KVM is available
+	kvmDevice = filepath.Join(folder, "kvm")
+	require.NoError(t, ioutil.WriteFile(kvmDevice, nil, 0666))
+	assert.True(t, KVMAvailable())
+	accel, err = ResolveAccelerator(AcceleratorAuto)
+	assert.NoError(t, err)
+	assert.Equal(t, AcceleratorKVM, accel)
+	accel, err = ResolveAccelerator(AcceleratorKVM)
+	assert.NoError(t, err)
+	assert.Equal(t, AcceleratorKVM, accel)
+
+	_, err = ResolveAccelerator("hvf")
+	assert.Error(t, err)
+}
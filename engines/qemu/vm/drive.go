@@ -0,0 +1,129 @@
+package vm
+
+import (
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// Types of additional drives
+const (
+	DriveScratch = "scratch" // Empty disk of a given size
+	DriveData    = "data"    // Disk backed by a data file from the image
+	DriveCDROM   = "cdrom"   // Read-only CD-ROM with an ISO file from a source
+)
+
+// MaxDisks is the maximum number of additional disks (scratch and data drives)
+// that can be attached to a virtual machine, these use PCI 0x9 to 0xf.
+const MaxDisks = 7
+
+// MaxCDROMs is the maximum number of CD-ROM drives that can be attached to a
+// virtual machine from the machine definition, these use the secondary IDE bus.
+const MaxCDROMs = 2
+
+// A Drive is an additional drive attached to the virtual machine, besides the
+// boot disk from the image.
+type Drive struct {
+	Type   string      `json:"type"`
+	Size   int         `json:"size,omitempty"`   // Size in MiB for scratch drives
+	File   string      `json:"file,omitempty"`   // Data file from the image for data drives
+	Source interface{} `json:"source,omitempty"` // Reference to ISO file for cdrom drives
+}
+
+var driveSchema = schematypes.Object{
+	Title: "Drive",
+	Description: util.Markdown(`
+		Additional drive attached to the virtual machine, 'type' determines
+		which other properties must be given:
+
+		 * 'scratch', an empty disk of 'size' MiB,
+		 * 'data', a disk with the contents of the data 'file' from the image, or,
+		 * 'cdrom', a read-only CD-ROM with the ISO file referenced by 'source'.
+
+		Writes to disks are discarded when the virtual machine is stopped.
+	`),
+	Properties: schematypes.Properties{
+		"type": schematypes.StringEnum{
+			Title:   "Drive Type",
+			Options: []string{DriveScratch, DriveData, DriveCDROM},
+		},
+		"size": schematypes.Integer{
+			Title:       "Size",
+			Description: `Size of scratch disk in MiB.`,
+			Minimum:     1,
+			Maximum:     1024 * 1024, // 1 TiB
+		},
+		"file": schematypes.String{
+			Title: "Data File",
+			Description: util.Markdown(`
+				Name of raw disk file in the image archive to use as data disk, the
+				name must have the form 'data-<name>.img'.
+			`),
+			Pattern: `^data-[a-z0-9_-]{1,64}\.img$`,
+		},
+		"source": schematypes.AnyOf{
+			schematypes.String{},
+			schematypes.Object{AdditionalProperties: true},
+		},
+	},
+	Required: []string{"type"},
+}
+
+// Drives returns the additional drives of the machine.
+func (m Machine) Drives() []Drive {
+	return append([]Drive(nil), m.options.Drives...)
+}
+
+// validateDrives returns a MalformedPayloadError, if drives are incomplete or
+// violates limits.
+func validateDrives(drives []Drive, limits MachineLimits) error {
+	if len(drives) > limits.MaxDrives {
+		return runtime.NewMalformedPayloadError(
+			"Machine has ", len(drives), " additional drives, but at most ",
+			limits.MaxDrives, " additional drives are allowed",
+		)
+	}
+	disks, cdroms := 0, 0
+	for i, d := range drives {
+		switch d.Type {
+		case DriveScratch:
+			disks++
+			if d.Size == 0 {
+				return runtime.NewMalformedPayloadError(
+					"Machine drive ", i, " of type 'scratch' must specify 'size'",
+				)
+			}
+			if d.Size > limits.MaxDriveSize {
+				return runtime.NewMalformedPayloadError(
+					"Machine drive ", i, " has size ", d.Size, " MiB which is larger ",
+					"than the allowed drive size ", limits.MaxDriveSize, " MiB",
+				)
+			}
+		case DriveData:
+			disks++
+			if d.File == "" {
+				return runtime.NewMalformedPayloadError(
+					"Machine drive ", i, " of type 'data' must specify 'file'",
+				)
+			}
+		case DriveCDROM:
+			cdroms++
+			if d.Source == nil {
+				return runtime.NewMalformedPayloadError(
+					"Machine drive ", i, " of type 'cdrom' must specify 'source'",
+				)
+			}
+		}
+	}
+	if disks > MaxDisks {
+		return runtime.NewMalformedPayloadError(
+			"A virtual machine can have at most ", MaxDisks, " scratch and data drives",
+		)
+	}
+	if cdroms > MaxCDROMs {
+		return runtime.NewMalformedPayloadError(
+			"A virtual machine can have at most ", MaxCDROMs, " cdrom drives",
+		)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package vm
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// Firmware options for the machine definition
+const (
+	FirmwareBIOS = "bios" // SeaBIOS, the QEMU default
+	FirmwareUEFI = "uefi" // OVMF
+)
+
+// Paths to the OVMF firmware, as installed by the debian package 'ovmf'.
+// The code file is shared between virtual machines, while the vars file is a
+// template for the writable NVRAM of each virtual machine.
+const (
+	OVMFCodeFile = "/usr/share/OVMF/OVMF_CODE.fd"
+	OVMFVarsFile = "/usr/share/OVMF/OVMF_VARS.fd"
+)
+
+const (
+	nvramFile     = "nvram.bin" // NVRAM in socket folder, if image has none
+	tpmStateDir   = "tpm"       // TPM state in socket folder
+	tpmSocketFile = "tpm.sock"  // swtpm control socket in socket folder
+)
+
+// Firmware returns the firmware of the machine, empty-string if not given.
+func (m Machine) Firmware() string {
+	return m.options.Firmware
+}
+
+// Time to wait for swtpm to create its control socket
+const tpmStartTimeout = 5 * time.Second
+
+// swtpm is an emulated TPM process attached to a virtual machine
+type swtpm struct {
+	cmd  *exec.Cmd
+	done chan struct{} // closed when swtpm has exited
+}
+
+// startTPM starts swtpm with state in folder, and waits for the control
+// socket to be created. The TPM state is not persisted, as it is removed with
+// the folder when the virtual machine is done.
+func startTPM(folder string) (*swtpm, error) {
+	stateDir := filepath.Join(folder, tpmStateDir)
+	socket := filepath.Join(folder, tpmSocketFile)
+	if err := os.Mkdir(stateDir, 0700); err != nil {
+		return nil, fmt.Errorf("Failed to create TPM state folder, error: %s", err)
+	}
+
+	// swtpm terminates when QEMU closes the connection
+	t := &swtpm{
+		cmd: exec.Command("swtpm", "socket", "--tpm2",
+			"--tpmstate", "dir="+stateDir,
+			"--ctrl", "type=unixio,path="+socket,
+			"--terminate",
+		),
+		done: make(chan struct{}),
+	}
+	if err := t.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Failed to start swtpm, error: %s", err)
+	}
+	go func() {
+		t.cmd.Wait()
+		close(t.done)
+	}()
+
+	deadline := time.Now().Add(tpmStartTimeout)
+	for {
+		if _, err := os.Stat(socket); err == nil {
+			return t, nil
+		}
+		select {
+		case <-t.done:
+			return nil, fmt.Errorf("swtpm exited before creating its socket")
+		case <-time.After(10 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Stop()
+			return nil, fmt.Errorf("swtpm didn't create its socket within %s", tpmStartTimeout)
+		}
+	}
+}
+
+// Stop kills swtpm, if it hasn't already exited, and waits for it to exit.
+// This is a noop, if t is nil.
+func (t *swtpm) Stop() {
+	if t == nil {
+		return
+	}
+	select {
+	case <-t.done:
+	default:
+		t.cmd.Process.Kill()
+		<-t.done
+	}
+}
@@ -1,12 +1,17 @@
 package vm
 
+import "reflect"
+
 // An Image provides an instance of a virtual machine image that a virtual
 // machine can be started from.
 type Image interface {
-	DiskFile() string // Primary disk file to be used as boot disk.
-	Format() string   // Image format 'qcow2', 'raw', etc.
-	Machine() Machine // Machine configuration.
-	Release()         // Free resources held by this image instance.
+	DiskFile() string  // Primary disk file to be used as boot disk.
+	Format() string    // Image format 'qcow2', 'raw', etc.
+	Machine() Machine  // Machine configuration.
+	StateFile() string // Saved virtual machine state, empty-string if none.
+	Drives() []string  // Files for Machine().Drives(), nil if none.
+	NVRAMFile() string // Writable UEFI variables, empty-string if none.
+	Release()          // Free resources held by this image instance.
 }
 
 // A MutableImage is an instance of a virtual machine image similar to
@@ -27,6 +32,15 @@ func (i *imageMachinePair) Machine() Machine {
 	return i.machine
 }
 
+// StateFile returns the saved state from the image, if the machine definition
+// wasn't changed, as saved state can only be restored on an identical machine.
+func (i *imageMachinePair) StateFile() string {
+	if !reflect.DeepEqual(i.machine.options, i.Image.Machine().options) {
+		return ""
+	}
+	return i.Image.StateFile()
+}
+
 // OverwriteMachine returns an image with a machine definition whose properties
 // is overwritten by machine given here.
 func OverwriteMachine(image Image, machine Machine) Image {
@@ -35,3 +49,46 @@ func OverwriteMachine(image Image, machine Machine) Image {
 		machine: machine.WithDefaults(image.Machine()),
 	}
 }
+
+// imageWithoutState holds an image whose saved state is ignored.
+type imageWithoutState struct {
+	Image
+}
+
+func (i *imageWithoutState) StateFile() string {
+	return ""
+}
+
+// WithoutState returns an image whose saved state is ignored, hence, virtual
+// machines started from the image will boot from disk.
+func WithoutState(image Image) Image {
+	return &imageWithoutState{Image: image}
+}
+
+// imageWithDrives holds an image and files for the additional drives of the
+// machine definition.
+type imageWithDrives struct {
+	Image
+	drives  []string
+	release func()
+}
+
+func (i *imageWithDrives) Drives() []string {
+	return i.drives
+}
+
+func (i *imageWithDrives) Release() {
+	i.release()
+	i.Image.Release()
+}
+
+// AttachDrives returns an image with files for the additional drives given
+// by image.Machine().Drives(), in the same order. The release function is
+// called when the image is released, and should delete the files.
+func AttachDrives(image Image, drives []string, release func()) Image {
+	return &imageWithDrives{
+		Image:   image,
+		drives:  drives,
+		release: release,
+	}
+}
@@ -0,0 +1,77 @@
+package vm
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+type testImage struct {
+	machine   Machine
+	stateFile string
+}
+
+func (i *testImage) DiskFile() string  { return "/dev/null" }
+func (i *testImage) Format() string    { return "raw" }
+func (i *testImage) Machine() Machine  { return i.machine }
+func (i *testImage) StateFile() string { return i.stateFile }
+func (i *testImage) Drives() []string  { return nil }
+func (i *testImage) NVRAMFile() string { return "" }
+func (i *testImage) Release()          {}
+
+type testNetwork struct{}
+
+func (testNetwork) NetDev(ID string) string         { return "user,id=" + ID }
+func (testNetwork) TapDevice() string               { return "" }
+func (testNetwork) SetHandler(handler http.Handler) {}
+func (testNetwork) Release()                        {}
+
+// incomingArgument returns the -incoming argument given to QEMU, if any
+func incomingArgument(t *testing.T, image Image) string {
+	folder, err := ioutil.TempDir("", "vm-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	limits := MachineLimits{MaxMemory: 256, MaxCPUs: 1, DefaultThreads: 1, Accelerator: AcceleratorTCG}
+	vm, err := NewVirtualMachine(
+		limits, image, testNetwork{}, nil, folder, "", "", LinuxBootOptions{},
+		mocks.NewMockMonitor(true),
+	)
+	require.NoError(t, err)
+	for i, arg := range vm.qemu.Args {
+		if arg == "-incoming" {
+			return vm.qemu.Args[i+1]
+		}
+	}
+	return ""
+}
+
+func TestImageStateFile(t *testing.T) {
+	limits := MachineLimits{MaxMemory: 256, MaxCPUs: 1, DefaultThreads: 1, Accelerator: AcceleratorTCG}
+	m, err := defaultMachine.ApplyLimits(limits)
+	require.NoError(t, err)
+	stateFile := filepath.Join(os.TempDir(), "state.bin")
+	img := &testImage{machine: m, stateFile: stateFile}
+
+	// Saved state is restored, if the machine is identical
+	assert.Equal(t, stateFile, OverwriteMachine(img, Machine{}).StateFile())
+	assert.Equal(t, "exec:cat '"+stateFile+"'", incomingArgument(t, img))
+
+	// Saved state is ignored, if the machine is changed
+	changed := NewMachine(map[string]interface{}{"version": float64(2), "memory": float64(128)})
+	assert.Equal(t, "", OverwriteMachine(img, changed).StateFile())
+	assert.Equal(t, "", incomingArgument(t, OverwriteMachine(img, changed)))
+
+	// Saved state is ignored, if discarded by WithoutState
+	assert.Equal(t, "", WithoutState(img).StateFile())
+	assert.Equal(t, "", incomingArgument(t, WithoutState(img)))
+
+	// Images without saved state boot from disk
+	assert.Equal(t, "", incomingArgument(t, &testImage{machine: m}))
+}
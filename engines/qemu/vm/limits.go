@@ -7,9 +7,12 @@ import (
 
 // MachineLimits imposes limits on a virtual machine definition.
 type MachineLimits struct {
-	MaxMemory      int `json:"maxMemory"`
-	MaxCPUs        int `json:"maxCPUs"`
-	DefaultThreads int `json:"defaultThreads"`
+	MaxMemory      int    `json:"maxMemory"`
+	MaxCPUs        int    `json:"maxCPUs"`
+	DefaultThreads int    `json:"defaultThreads"`
+	Accelerator    string `json:"accelerator"` // kvm, tcg or auto (default)
+	MaxDrives      int    `json:"maxDrives"`
+	MaxDriveSize   int    `json:"maxDriveSize"` // MiB
 }
 
 // MachineLimitsSchema is the schema for MachineOptions.
@@ -57,6 +60,39 @@ var MachineLimitsSchema = schematypes.Object{
 			Minimum: 1,
 			Maximum: 255,
 		},
+		"accelerator": schematypes.StringEnum{
+			Title: "Accelerator",
+			Description: util.Markdown(`
+				Accelerator to use for virtual machines, 'kvm' uses hardware
+				virtualization and requires access to '/dev/kvm', 'tcg' uses
+				software emulation which is much slower but works on any host.
+
+				If 'auto' or not given, 'kvm' will be used if available, otherwise
+				the engine falls back to 'tcg'. When using 'tcg' the CPU model
+				'host' is replaced with 'qemu64', as 'host' requires KVM.
+			`),
+			Options: []string{AcceleratorKVM, AcceleratorTCG, AcceleratorAuto},
+		},
+		"maxDrives": schematypes.Integer{
+			Title: "Max Drives",
+			Description: util.Markdown(`
+				Maximum number of additional drives a virtual machine can have
+				besides the boot disk, this includes scratch disks, data disks and
+				CD-ROMs. Defaults to zero, which doesn't allow additional drives.
+			`),
+			Minimum: 0,
+			Maximum: MaxDisks + MaxCDROMs,
+		},
+		"maxDriveSize": schematypes.Integer{
+			Title: "Max Drive Size",
+			Description: util.Markdown(`
+				Maximum size of each additional drive in MiB. This limits the size
+				of scratch disks, the virtual size of data disks and the size of
+				ISO files for CD-ROMs. Defaults to zero.
+			`),
+			Minimum: 0,
+			Maximum: 1024 * 1024, // 1 TiB
+		},
 	},
 	Required: []string{
 		"maxMemory",
@@ -12,7 +12,7 @@ import (
 )
 
 // version number of the machine.json format
-const machineFormatVersion = 1
+const machineFormatVersion = 2
 
 // Machine specifies arguments for various QEMU options.
 //
@@ -42,13 +42,16 @@ type Machine struct {
 		KeyboardLayout string   `json:"keyboardLayout"`
 		Mouse          string   `json:"mouse"`
 		Tablet         string   `json:"tablet"`
+		Drives         []Drive  `json:"drives"`
+		Firmware       string   `json:"firmware"`
+		TPM            string   `json:"tpm"`
 	}
 }
 
 var defaultMachine = (func() Machine {
 	var m Machine
 	err := json.Unmarshal([]byte(`{
-		"version":         1,
+		"version":         2,
 		"uuid":            "52bab607-10f1-4049-a0f8-ee4725cb715b",
 		"chipset":         "pc-i440fx-2.8",
 		"cpu":             "host",
@@ -62,7 +65,9 @@ var defaultMachine = (func() Machine {
 		"keyboard":        "usb-kbd",
 		"keyboardLayout":  "en-us",
 		"mouse":           "usb-mouse",
-		"tablet":          "usb-tablet"
+		"tablet":          "usb-tablet",
+		"firmware":        "bios",
+		"tpm":             "none"
 	}`), &m.options)
 	if err != nil {
 		panic("failed to parse static JSON config")
@@ -122,6 +127,11 @@ func (m Machine) WithDefaults(defaults Machine) Machine {
 	return Machine{options: options}
 }
 
+// Memory returns the memory in MiB, zero if not specified.
+func (m Machine) Memory() int {
+	return m.options.Memory
+}
+
 // ApplyLimits returns an Machine with defaults extracted from the limits, or
 // a MalformedPayloadError if limits were violated.
 func (m Machine) ApplyLimits(limits MachineLimits) (Machine, error) {
@@ -179,6 +189,11 @@ func (m Machine) ApplyLimits(limits MachineLimits) (Machine, error) {
 			limits.MaxCPUs,
 		))
 	}
+
+	// Validate limitations for additional drives
+	if err := validateDrives(o.Drives, limits); err != nil {
+		return Machine{o}, err
+	}
 	return Machine{o}, nil
 }
 
@@ -216,6 +231,9 @@ func (m Machine) DeriveLimits() MachineLimits {
 		MaxMemory:      memory,
 		MaxCPUs:        maxCPUs,
 		DefaultThreads: 1,
+		Accelerator:    AcceleratorAuto,
+		MaxDrives:      len(m.options.Drives), // permit drives of the machine
+		MaxDriveSize:   1024 * 1024,           // 1 TiB
 	}
 }
 
@@ -317,6 +335,32 @@ var MachineSchema schematypes.Schema = schematypes.Object{
 		"tablet": schematypes.StringEnum{
 			Options: []string{"usb-tablet", "none"},
 		},
+		"firmware": schematypes.StringEnum{
+			Title: "Firmware",
+			Description: util.Markdown(`
+				Firmware to boot the virtual machine with, 'bios' uses SeaBIOS and
+				'uefi' uses OVMF. With 'uefi' the UEFI variables are stored in a
+				writable NVRAM file, which is saved as 'nvram.bin' in the image.
+			`),
+			Options: []string{FirmwareBIOS, FirmwareUEFI},
+		},
+		"tpm": schematypes.StringEnum{
+			Title: "TPM",
+			Description: util.Markdown(`
+				Emulated TPM 2.0 device, using 'swtpm', the TPM state is not
+				persisted between virtual machines.
+			`),
+			Options: []string{"none", "tpm-tis", "tpm-crb"},
+		},
+		"drives": schematypes.Array{
+			Title: "Additional Drives",
+			Description: util.Markdown(`
+				Drives attached to the virtual machine in addition to the boot disk.
+				Scratch and data drives are attached with the 'storage' device in
+				the order given, cdrom drives are attached to the secondary IDE bus.
+			`),
+			Items: driveSchema,
+		},
 	},
 	Required: []string{"version"},
 }
@@ -8,7 +8,7 @@ import (
 
 func TestMachineWithDefaults(t *testing.T) {
 	m := NewMachine(map[string]interface{}{
-		"version":  float64(1),
+		"version":  float64(2),
 		"graphics": "VGA",
 	})
 	assert.Equal(t, "VGA", m.options.Graphics)
@@ -60,7 +60,7 @@ func TestValidateMACWithValidMACs(t *testing.T) {
 	}
 	for _, mac := range validMACs {
 		err := MachineSchema.Validate(map[string]interface{}{
-			"version": float64(1),
+			"version": float64(2),
 			"mac":     mac,
 		})
 		assert.NoError(t, err, "failed to validate: %s", mac)
@@ -92,7 +92,7 @@ func TestValidateMACWithGlobalMACs(t *testing.T) {
 	}
 	for _, mac := range invalidMACs {
 		err := MachineSchema.Validate(map[string]interface{}{
-			"version": float64(1),
+			"version": float64(2),
 			"mac":     mac,
 		})
 		if err == nil {
@@ -129,7 +129,7 @@ func TestValidateMACWithMulticastMACs(t *testing.T) {
 	}
 	for _, mac := range invalidMACs {
 		err := MachineSchema.Validate(map[string]interface{}{
-			"version": float64(1),
+			"version": float64(2),
 			"mac":     mac,
 		})
 		if err == nil {
@@ -171,7 +171,7 @@ func TestValidateMACWithInvalidMACs(t *testing.T) {
 	}
 	for _, mac := range invalidMACs {
 		err := MachineSchema.Validate(map[string]interface{}{
-			"version": float64(1),
+			"version": float64(2),
 			"mac":     mac,
 		})
 		if err == nil {
@@ -179,3 +179,56 @@ func TestValidateMACWithInvalidMACs(t *testing.T) {
 		}
 	}
 }
+
+func TestMachineApplyLimitsDrives(t *testing.T) {
+	m := NewMachine(map[string]interface{}{
+		"version": float64(2),
+		"drives": []interface{}{
+			map[string]interface{}{"type": "scratch", "size": float64(2048)},
+			map[string]interface{}{"type": "cdrom", "source": "https://example.com/drivers.iso"},
+		},
+	})
+	limits := MachineLimits{
+		MaxMemory:      1024,
+		MaxCPUs:        2,
+		DefaultThreads: 1,
+		MaxDrives:      2,
+		MaxDriveSize:   4096,
+	}
+	_, err := m.ApplyLimits(limits)
+	assert.NoError(t, err)
+
+	limits.MaxDriveSize = 1024
+	_, err = m.ApplyLimits(limits)
+	assert.Error(t, err, "expected scratch drive to exceed MaxDriveSize")
+
+	limits.MaxDriveSize = 4096
+	limits.MaxDrives = 1
+	_, err = m.ApplyLimits(limits)
+	assert.Error(t, err, "expected drives to exceed MaxDrives")
+
+	_, err = m.ApplyLimits(m.DeriveLimits())
+	assert.NoError(t, err)
+
+	m = NewMachine(map[string]interface{}{
+		"version": float64(2),
+		"drives": []interface{}{
+			map[string]interface{}{"type": "data"},
+		},
+	})
+	_, err = m.ApplyLimits(m.DeriveLimits())
+	assert.Error(t, err, "expected data drive without file to be invalid")
+}
+
+func TestMachineFirmwareDefaults(t *testing.T) {
+	m := NewMachine(map[string]interface{}{
+		"version":  float64(2),
+		"firmware": "uefi",
+		"tpm":      "tpm-crb",
+	})
+	assert.Equal(t, FirmwareUEFI, m.Firmware())
+	assert.Equal(t, FirmwareBIOS, NewMachine(map[string]interface{}{
+		"version": float64(2),
+	}).WithDefaults(defaultMachine).Firmware())
+	assert.Equal(t, "none", defaultMachine.options.TPM)
+}
@@ -11,6 +11,7 @@ var migrations = []func(map[string]interface{}) map[string]interface{}{
 	//       All migrations must migrate to the next version, this way we only
 	//       have to write one migration when we change the format.
 	migrate0to1,
+	migrate1to2,
 
 	// As a final step after migrations we validate against current schema and
 	// return nil, if it's not valid.
@@ -128,3 +129,11 @@ func migrate0to1(def map[string]interface{}) map[string]interface{} {
 
 	return result
 }
+
+// Migrate version 1 -> version 2
+func migrate1to2(def map[string]interface{}) map[string]interface{} {
+	// Note: version 2 added "drives", "firmware" and "tpm", which are optional,
+	// so version 1 machine definitions are valid version 2 definitions.
+	def["version"] = 2
+	return def
+}
@@ -58,3 +58,21 @@ func TestMigrateFromV1(t *testing.T) {
 	def = MigrateMachineDefinition(def)
 	assert.NotNil(t, def, "Expected some machine definition")
 }
+
+func TestMigrateFromV2(t *testing.T) {
+	var def interface{}
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"version":         2,
+		"uuid":            "52bab607-10f1-4049-a0f8-ee4725cb715b",
+		"mac":             "aa:54:1a:30:5c:de",
+		"storage":         "virtio-blk-pci",
+		"drives": [
+			{"type": "scratch", "size": 1024},
+			{"type": "data", "file": "data-tools.img"},
+			{"type": "cdrom", "source": "https://example.com/drivers.iso"}
+		]
+	}`), &def))
+	def = MigrateMachineDefinition(def)
+	assert.NotNil(t, def, "Expected some machine definition")
+	assert.Len(t, NewMachine(def).Drives(), 3)
+}
@@ -7,6 +7,7 @@ import "net/http"
 // orignates from the virtual machine wit hthe -netdev argument.
 type Network interface {
 	NetDev(ID string) string         // Argument for the QEMU -netdev option
+	TapDevice() string               // Host tap device, empty-string if none
 	SetHandler(handler http.Handler) // Set http.Handler for 169.254.169.254:80
 	Release()                        // Release the network after use
 }
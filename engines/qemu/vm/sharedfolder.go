@@ -0,0 +1,14 @@
+package vm
+
+// MaxSharedFolders is the maximum number of shared folders that can be
+// attached to a virtual machine.
+const MaxSharedFolders = 8
+
+// A SharedFolder is a folder on the host that is exposed to the guest as a
+// virtio-9p device. The guest can mount it with:
+//   mount -t 9p -o trans=virtio,version=9p2000.L <tag> <mountpoint>
+type SharedFolder struct {
+	Tag      string // mount_tag for the virtio-9p device, max 31 characters
+	Path     string // Folder on the host to be shared with the guest
+	ReadOnly bool   // True, if the guest should not be allowed to write
+}
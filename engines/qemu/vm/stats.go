@@ -0,0 +1,228 @@
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/digitalocean/go-qemu/qmp"
+	"github.com/pkg/errors"
+)
+
+// Path of the balloon device in the QEMU object model
+const balloonPath = "/machine/peripheral/balloon-0"
+
+// Interval in seconds for the balloon driver to update guest memory stats
+const balloonPollingInterval = 5
+
+// Clock ticks per second, as used in /proc/<pid>/task/<tid>/stat
+const clockTicks = 100
+
+// Stats holds resource usage for a virtual machine. Counters are cumulative
+// from when the virtual machine was started.
+type Stats struct {
+	CPUTime     time.Duration // CPU time used by virtual CPUs
+	MemoryTotal int64         // Memory available to the guest, 0 if unknown
+	MemoryFree  int64         // Free memory in the guest, 0 if unknown
+	DiskRead    int64         // Bytes read from disks
+	DiskWrite   int64         // Bytes written to disks
+	NetworkRx   int64         // Bytes received by the guest, 0 if unknown
+	NetworkTx   int64         // Bytes transmitted by the guest, 0 if unknown
+}
+
+// Stats returns resource usage for the virtual machine.
+//
+// Memory statistics are reported by the balloon driver in the guest, these
+// are only available if the guest has a balloon driver, and some time after
+// the first call to Stats().
+func (vm *VirtualMachine) Stats() (*Stats, error) {
+	vm.m.Lock()
+	domain := vm.domain
+	released := vm.network == nil
+	tap := ""
+	if !released {
+		// Network is released under lock, so we must read the tap device here
+		tap = vm.network.TapDevice()
+	}
+	pid := 0
+	if vm.qemu.Process != nil {
+		pid = vm.qemu.Process.Pid
+	}
+	enablePolling := !vm.statsPolling
+	vm.m.Unlock()
+	if domain == nil || released {
+		return nil, errors.New("virtual machine isn't running")
+	}
+
+	// Enable polling of guest memory stats, if not already enabled
+	if enablePolling {
+		_, err := domain.Run(qmp.Command{Execute: "qom-set", Args: map[string]interface{}{
+			"path":     balloonPath,
+			"property": "guest-stats-polling-interval",
+			"value":    balloonPollingInterval,
+		}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to enable guest memory stats polling, error: %s", err)
+		}
+		vm.m.Lock()
+		vm.statsPolling = true
+		vm.m.Unlock()
+	}
+
+	stats := &Stats{}
+
+	// Find CPU time from the threads running virtual CPUs
+	raw, err := domain.Run(qmp.Command{Execute: "query-cpus-fast"})
+	if err != nil {
+		return nil, fmt.Errorf("failed QMP command 'query-cpus-fast', error: %s", err)
+	}
+	threads, err := parseCPUThreads(raw)
+	if err != nil {
+		return nil, err
+	}
+	for _, tid := range threads {
+		data, rerr := ioutil.ReadFile(fmt.Sprintf("/proc/%d/task/%d/stat", pid, tid))
+		if rerr != nil {
+			return nil, errors.Wrap(rerr, "failed to read CPU time for virtual CPU thread")
+		}
+		cpuTime, perr := parseThreadCPUTime(string(data))
+		if perr != nil {
+			return nil, perr
+		}
+		stats.CPUTime += cpuTime
+	}
+
+	// Find memory usage from balloon driver
+	raw, err = domain.Run(qmp.Command{Execute: "qom-get", Args: map[string]interface{}{
+		"path":     balloonPath,
+		"property": "guest-stats",
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("failed QMP command 'qom-get', error: %s", err)
+	}
+	if stats.MemoryTotal, stats.MemoryFree, err = parseBalloonStats(raw); err != nil {
+		return nil, err
+	}
+
+	// Find disk IO
+	raw, err = domain.Run(qmp.Command{Execute: "query-blockstats"})
+	if err != nil {
+		return nil, fmt.Errorf("failed QMP command 'query-blockstats', error: %s", err)
+	}
+	if stats.DiskRead, stats.DiskWrite, err = parseBlockStats(raw); err != nil {
+		return nil, err
+	}
+
+	// Find network IO from the tap device, what the tap device receives is
+	// transmitted by the guest, and vice versa.
+	if tap != "" {
+		folder := filepath.Join("/sys/class/net", tap, "statistics")
+		if stats.NetworkTx, err = readCounter(filepath.Join(folder, "rx_bytes")); err != nil {
+			return nil, err
+		}
+		if stats.NetworkRx, err = readCounter(filepath.Join(folder, "tx_bytes")); err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
+
+// parseCPUThreads returns the thread ids from a 'query-cpus-fast' response
+func parseCPUThreads(raw []byte) ([]int, error) {
+	var result struct {
+		Return []struct {
+			ThreadID int `json:"thread-id"`
+		} `json:"return"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("invalid response from 'query-cpus-fast', error: %s", err)
+	}
+	threads := make([]int, len(result.Return))
+	for i, cpu := range result.Return {
+		threads[i] = cpu.ThreadID
+	}
+	return threads, nil
+}
+
+// parseThreadCPUTime returns user + system time from /proc/<pid>/task/<tid>/stat
+func parseThreadCPUTime(stat string) (time.Duration, error) {
+	// The command name is in parentheses and may contain spaces, so we only
+	// split fields after the last parenthesis, then utime and stime are field
+	// 14 and 15 in the file, these are field 11 and 12 after the command name.
+	i := strings.LastIndex(stat, ")")
+	if i == -1 {
+		return 0, fmt.Errorf("invalid thread stat: '%s'", stat)
+	}
+	fields := strings.Fields(stat[i+1:])
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("invalid thread stat: '%s'", stat)
+	}
+	var ticks int64
+	for _, f := range fields[11:13] {
+		n, err := strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid thread stat: '%s'", stat)
+		}
+		ticks += n
+	}
+	return time.Duration(ticks) * time.Second / clockTicks, nil
+}
+
+// parseBalloonStats returns total and free memory from 'guest-stats', values
+// are zero if the guest hasn't reported memory stats.
+func parseBalloonStats(raw []byte) (total, free int64, err error) {
+	var result struct {
+		Return struct {
+			Stats map[string]int64 `json:"stats"`
+		} `json:"return"`
+	}
+	if err = json.Unmarshal(raw, &result); err != nil {
+		return 0, 0, fmt.Errorf("invalid response from 'qom-get', error: %s", err)
+	}
+	// Stats not reported by the guest are -1
+	total = result.Return.Stats["stat-total-memory"]
+	free = result.Return.Stats["stat-free-memory"]
+	if total < 0 || free < 0 {
+		return 0, 0, nil
+	}
+	return total, free, nil
+}
+
+// parseBlockStats returns bytes read and written summed over all devices
+// from a 'query-blockstats' response.
+func parseBlockStats(raw []byte) (read, written int64, err error) {
+	var result struct {
+		Return []struct {
+			Stats struct {
+				ReadBytes  int64 `json:"rd_bytes"`
+				WriteBytes int64 `json:"wr_bytes"`
+			} `json:"stats"`
+		} `json:"return"`
+	}
+	if err = json.Unmarshal(raw, &result); err != nil {
+		return 0, 0, fmt.Errorf("invalid response from 'query-blockstats', error: %s", err)
+	}
+	for _, device := range result.Return {
+		read += device.Stats.ReadBytes
+		written += device.Stats.WriteBytes
+	}
+	return read, written, nil
+}
+
+// readCounter reads an integer from a file in sysfs
+func readCounter(file string) (int64, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to read network statistics")
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid counter in '%s', error: %s", file, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,49 @@
+package vm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseThreadCPUTime(t *testing.T) {
+	stat := "4242 (CPU 0/KVM) S 4200 4200 4200 0 -1 138412096 3167 0 0 0 " +
+		"250 120 0 0 20 0 5 0 1234 0 0 18446744073709551615"
+	d, err := parseThreadCPUTime(stat)
+	require.NoError(t, err)
+	require.Equal(t, 3700*time.Millisecond, d)
+
+	_, err = parseThreadCPUTime("4242 (qemu) S 1 2")
+	require.Error(t, err)
+}
+
+func TestParseQMPStats(t *testing.T) {
+	threads, err := parseCPUThreads([]byte(`{"return": [
+		{"cpu-index": 0, "thread-id": 4242}, {"cpu-index": 1, "thread-id": 4243}
+	]}`))
+	require.NoError(t, err)
+	require.Equal(t, []int{4242, 4243}, threads)
+
+	total, free, err := parseBalloonStats([]byte(`{"return": {"stats": {
+		"stat-total-memory": 1073741824, "stat-free-memory": 536870912
+	}, "last-update": 1500000000}}`))
+	require.NoError(t, err)
+	require.Equal(t, int64(1073741824), total)
+	require.Equal(t, int64(536870912), free)
+
+	total, free, err = parseBalloonStats([]byte(`{"return": {"stats": {
+		"stat-total-memory": -1, "stat-free-memory": -1
+	}, "last-update": 0}}`))
+	require.NoError(t, err)
+	require.Zero(t, total)
+	require.Zero(t, free)
+
+	read, written, err := parseBlockStats([]byte(`{"return": [
+		{"device": "", "stats": {"rd_bytes": 100, "wr_bytes": 10}},
+		{"device": "", "stats": {"rd_bytes": 50, "wr_bytes": 5}}
+	]}`))
+	require.NoError(t, err)
+	require.Equal(t, int64(150), read)
+	require.Equal(t, int64(15), written)
+}
@@ -2,6 +2,8 @@ package vm
 
 import (
 	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
 	"io"
@@ -9,6 +11,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -28,6 +31,9 @@ const (
 	qmpSocketFile = "qmp.sock"
 )
 
+// Time to wait for migration of virtual machine state to/from a file
+const migrationTimeout = 5 * time.Minute
+
 // LinuxBootOptions holds optionals boot options for Linux.
 // These are exclusively useful for building images and should not be used in
 // production when running per-task VMs. But they can greatly simplify image
@@ -46,6 +52,8 @@ type VirtualMachine struct {
 	started      bool
 	network      Network
 	image        Image
+	machine      Machine // Machine definition with defaults and limits applied
+	stateFile    string  // State to restore, empty-string if booting from disk
 	socketFolder string
 	qemu         *exec.Cmd
 	qemuDone     chan<- struct{}
@@ -53,10 +61,14 @@ type VirtualMachine struct {
 	Error        error           // Error, to be read after Done is closed
 	monitor      runtime.Monitor
 	domain       *qemu.Domain
+	statsPolling bool   // true, if polling of guest memory stats is enabled
+	nvramFile    string // NVRAM used with UEFI, empty-string if none
+	nvramCreate  bool   // true, if nvramFile is created from OVMFVarsFile
+	tpm          *swtpm // Emulated TPM, nil if none
 }
 
 // NewVirtualMachine constructs a new virtual machine using the given
-// machineOptions, image, network and cdroms.
+// machineOptions, image, network, shared folders and cdroms.
 //
 // Returns engines.MalformedPayloadError if machineOptions and image definition
 // are conflicting. If this returns an error, caller is responsible for
@@ -64,7 +76,8 @@ type VirtualMachine struct {
 // object.
 func NewVirtualMachine(
 	limits MachineLimits,
-	image Image, network Network, socketFolder, cdrom1, cdrom2 string,
+	image Image, network Network, sharedFolders []SharedFolder,
+	socketFolder, cdrom1, cdrom2 string,
 	bootOptions LinuxBootOptions,
 	monitor runtime.Monitor,
 ) (*VirtualMachine, error) {
@@ -75,6 +88,47 @@ func NewVirtualMachine(
 	}
 	o := m.options
 
+	// Find accelerator, and use a CPU model supported by TCG if necessary
+	accel, err := ResolveAccelerator(limits.Accelerator)
+	if err != nil {
+		return nil, err
+	}
+	if accel == AcceleratorTCG && o.CPU == "host" {
+		debug("using cpu: '%s' instead of 'host' as KVM isn't used", tcgDefaultCPU)
+		o.CPU = tcgDefaultCPU
+	}
+
+	// Validate shared folders
+	if len(sharedFolders) > MaxSharedFolders {
+		return nil, runtime.NewMalformedPayloadError(
+			"A virtual machine can have at most ", MaxSharedFolders, " shared folders",
+		)
+	}
+
+	// Validate that files are given for additional drives
+	drives := image.Drives()
+	if len(drives) != len(o.Drives) {
+		return nil, fmt.Errorf(
+			"machine has %d additional drives, but %d drive files are given",
+			len(o.Drives), len(drives),
+		)
+	}
+
+	// Restore saved state, if the image has one, and the virtual machine is
+	// identical to the one the state was saved from. Otherwise, we boot from disk.
+	stateFile := image.StateFile()
+	if stateFile != "" {
+		if len(sharedFolders) > 0 || cdrom1 != "" || cdrom2 != "" || bootOptions != (LinuxBootOptions{}) {
+			monitor.Info("Image has saved state, but shared folders or boot options are given, booting from disk")
+			stateFile = ""
+		} else if !reflect.DeepEqual(m.options, image.Machine().options) {
+			monitor.Info("Image has saved state, but machine definition is incomplete or limited, booting from disk")
+			stateFile = ""
+		} else if strings.Contains(stateFile, "'") {
+			return nil, fmt.Errorf("state file path: '%s' must not contain single quotes", stateFile)
+		}
+	}
+
 	// Create a sub-folder in the socketFolder
 	socketFolder = filepath.Join(socketFolder, slugid.Nice())
 
@@ -83,12 +137,24 @@ func NewVirtualMachine(
 		socketFolder: socketFolder,
 		network:      network,
 		image:        image,
+		machine:      m,
+		stateFile:    stateFile,
 		monitor:      monitor,
 	}
 
 	vncSocket := filepath.Join(vm.socketFolder, vncSocketFile)
 	qmpSocket := filepath.Join(vm.socketFolder, qmpSocketFile)
 
+	// Use the NVRAM from the image, or create one in the socket folder, if the
+	// image doesn't have one. In which case UEFI variables are discarded.
+	if o.Firmware == FirmwareUEFI {
+		vm.nvramFile = image.NVRAMFile()
+		if vm.nvramFile == "" {
+			vm.nvramFile = filepath.Join(vm.socketFolder, nvramFile)
+			vm.nvramCreate = true
+		}
+	}
+
 	// Construct options for QEMU
 	var options []string
 	// Auxiliary functions for defining options
@@ -144,9 +210,21 @@ func NewVirtualMachine(
 	option("realtime", "", args{
 		"mlock": "off", // TODO: Enable for things like talos
 	})
-	option("rtc", "", args{
-		"base": "utc", // TODO: Allow clock=vm for loadvm with windows
-	})
+	if stateFile == "" {
+		option("rtc", "", args{
+			"base": "utc",
+		})
+	} else {
+		// When restoring saved state the RTC follows virtual time, so it doesn't
+		// jump relative to the guest clock. Guests are expected to set the clock
+		// when resumed, as the guest clock is from when the state was saved.
+		option("rtc", "", args{
+			"base":  "utc",
+			"clock": "vm",
+		})
+		// Load state when started, "exec:" runs the command with /bin/sh
+		option("incoming", "exec:cat '"+stateFile+"'", nil)
+	}
 	option("smp", "", args{
 		"cpus":    strconv.Itoa(o.Threads * o.Cores * o.Sockets),
 		"threads": strconv.Itoa(o.Threads), // threads per core
@@ -155,9 +233,41 @@ func NewVirtualMachine(
 		// TODO: fit to system HT, see: https://www.kernel.org/doc/Documentation/ABI/testing/sysfs-devices-system-cpu
 	})
 	option("machine", o.Chipset, args{
-		"accel": "kvm",
+		"accel": accel,
 		// TODO: Configure additional options
 	})
+
+	// UEFI firmware, otherwise QEMU defaults to SeaBIOS
+	if o.Firmware == FirmwareUEFI {
+		drive("readonly", args{
+			"file":   OVMFCodeFile,
+			"if":     "pflash",
+			"format": "raw",
+			"unit":   "0",
+		})
+		drive("", args{
+			"file":   vm.nvramFile,
+			"if":     "pflash",
+			"format": "raw",
+			"unit":   "1",
+		})
+	}
+
+	// Emulated TPM, swtpm is started when the virtual machine is started
+	if o.TPM != "none" {
+		option("chardev", "socket", args{
+			"id":   "tpm-socket",
+			"path": filepath.Join(vm.socketFolder, tpmSocketFile),
+		})
+		option("tpmdev", "emulator", args{
+			"id":      "tpm-0",
+			"chardev": "tpm-socket",
+		})
+		device(o.TPM, args{
+			"id":     "tpm-device-0",
+			"tpmdev": "tpm-0",
+		})
+	}
 	option("vnc", "unix:"+vncSocket, args{
 		"share": "force-shared",
 	})
@@ -246,6 +356,72 @@ func NewVirtualMachine(
 		"bootindex": "1",
 	})
 
+	// Additional drives, disks are attached from PCI 0x9 and cdroms to the
+	// secondary IDE bus, as the primary IDE bus is used for cdroms by qemu-build
+	disks, cdroms := 0, 0
+	for i, d := range o.Drives {
+		id := fmt.Sprintf("drive-%d", i)
+		switch d.Type {
+		case DriveScratch, DriveData:
+			drive("", args{
+				"file":   drives[i],
+				"if":     "none",
+				"id":     id,
+				"cache":  "unsafe",
+				"aio":    "threads",
+				"format": "qcow2",
+				"werror": "report",
+				"rerror": "report",
+			})
+			device(o.Storage, args{
+				"scsi":  "off",
+				"bus":   "pci.0",
+				"addr":  fmt.Sprintf("0x%x", 0x9+disks),
+				"drive": id,
+				"id":    fmt.Sprintf("virtio-disk%d", 1+disks),
+			})
+			disks++
+		case DriveCDROM:
+			drive("readonly", args{
+				"file":   drives[i],
+				"if":     "none",
+				"id":     id,
+				"cache":  "unsafe",
+				"aio":    "threads",
+				"format": "raw",
+				"werror": "report",
+				"rerror": "report",
+			})
+			device("ide-cd", args{
+				"drive": id,
+				"id":    fmt.Sprintf("ide-cd%d", 3+cdroms),
+				"bus":   "ide.1",
+				"unit":  strconv.Itoa(cdroms),
+			})
+			cdroms++
+		}
+	}
+
+	// Shared folders
+	for i, f := range sharedFolders {
+		fsdev := args{
+			"id":             fmt.Sprintf("fsdev-%d", i),
+			"path":           f.Path,
+			"security_model": "none",
+		}
+		if f.ReadOnly {
+			fsdev["readonly"] = "on"
+		}
+		option("fsdev", "local", fsdev)
+		device("virtio-9p-pci", args{
+			"fsdev":     fmt.Sprintf("fsdev-%d", i),
+			"mount_tag": f.Tag,
+			"id":        fmt.Sprintf("virtio-9p-%d", i),
+			"bus":       "pci.0",
+			"addr":      fmt.Sprintf("0x%x", 0x10+i), // Shared folders from PCI 0x10
+		})
+	}
+
 	// Sound
 	if o.Sound != "none" {
 		if strings.Contains(o.Sound, "/") {
@@ -360,10 +536,32 @@ func (vm *VirtualMachine) Start() {
 		return
 	}
 
+	// Create NVRAM from the OVMF template, if the image doesn't have one
+	if vm.nvramCreate {
+		if err = copyFile(OVMFVarsFile, vm.nvramFile); err != nil {
+			vm.monitor.Errorf("Failed to create NVRAM from %s, error: %s", OVMFVarsFile, err)
+			vm.Error = err
+			close(vm.qemuDone)
+			return
+		}
+	}
+
+	// Start emulated TPM, QEMU connects to it when started
+	if vm.machine.options.TPM != "none" {
+		vm.tpm, err = startTPM(socketFolder)
+		if err != nil {
+			vm.monitor.Errorf("Failed to start emulated TPM, error: %s", err)
+			vm.Error = err
+			close(vm.qemuDone)
+			return
+		}
+	}
+
 	// Start monitor socketFolder for vnc and qmp sockets
 	socketsReady, err := vm.waitForSockets()
 	if err != nil {
 		vm.monitor.Errorf("Error configuring socketFolder monitoring, error: %s", err)
+		vm.tpm.Stop()
 		vm.Error = err
 		close(vm.qemuDone)
 		return
@@ -372,6 +570,7 @@ func (vm *VirtualMachine) Start() {
 	// Start QEMU
 	vm.Error = vm.qemu.Start()
 	if vm.Error != nil {
+		vm.tpm.Stop()
 		close(vm.qemuDone)
 		return
 	}
@@ -406,6 +605,9 @@ func (vm *VirtualMachine) Start() {
 			vm.domain.Close()
 		}
 
+		// Stop emulated TPM, if it didn't terminate with QEMU
+		vm.tpm.Stop()
+
 		// Release network and image
 		vm.network.Release()
 		vm.network = nil
@@ -474,6 +676,15 @@ func (vm *VirtualMachine) Start() {
 	}
 	vm.m.Unlock()
 
+	// Wait for saved state to be restored, if any
+	if vm.stateFile != "" {
+		if err = vm.waitForIncoming(); err != nil {
+			debug("Error restoring saved state, error: %s", err)
+			vm.abort(fmt.Errorf("Failed to restore saved state, error: %s", err))
+			return
+		}
+	}
+
 	// Run QMP command continue to start execution
 	_, err = vm.domain.Run(qmp.Command{
 		Execute: "cont",
@@ -481,9 +692,178 @@ func (vm *VirtualMachine) Start() {
 	if err != nil {
 		debug("Error executing QMP command 'cont', error: %s", err)
 		vm.abort(fmt.Errorf("Failed QMP command 'cont', error: %s", err))
+		return
+	}
+
+	// Bring network link back up after restoring saved state, the link-change
+	// prompts the guest to renew its DHCP lease on the new network.
+	if vm.stateFile != "" {
+		_, err = vm.domain.Run(qmp.Command{
+			Execute: "set_link",
+			Args:    map[string]interface{}{"name": "nic0", "up": true},
+		})
+		if err != nil {
+			debug("Error executing QMP command 'set_link', error: %s", err)
+			vm.abort(fmt.Errorf("Failed QMP command 'set_link', error: %s", err))
+		}
 	}
 }
 
+// waitForIncoming waits for QEMU to load the saved state, and takes the
+// network link down, so it can be brought up when execution is continued.
+func (vm *VirtualMachine) waitForIncoming() error {
+	deadline := time.Now().Add(migrationTimeout)
+	for {
+		status, err := vm.domain.Status()
+		if err != nil {
+			return err
+		}
+		if status == qemu.StatusPaused {
+			break
+		}
+		if status != qemu.StatusInMigrate && status != qemu.StatusPreLaunch {
+			return fmt.Errorf("unexpected status: '%s' while restoring state", status)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("restoring state didn't finish within %s", migrationTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	_, err := vm.domain.Run(qmp.Command{
+		Execute: "set_link",
+		Args:    map[string]interface{}{"name": "nic0", "up": false},
+	})
+	return err
+}
+
+// SaveState stops the virtual machine and writes its state to stateFile,
+// then QEMU is terminated. The state can be restored with a virtual machine
+// that is identical to this one, except for the network it is attached to.
+//
+// This is used by qemu-build to create images that don't need to boot.
+func (vm *VirtualMachine) SaveState(stateFile string) error {
+	domain, err := vm.saveState(stateFile)
+	if err != nil {
+		return err
+	}
+
+	// Terminate QEMU, this will flush disks
+	if _, err := domain.Run(qmp.Command{Execute: "quit"}); err != nil {
+		return fmt.Errorf("failed QMP command 'quit', error: %s", err)
+	}
+	<-vm.Done
+	return nil
+}
+
+// Checkpoint stops the virtual machine, writes its state to stateFile and
+// copies the disk image to diskFile, then QEMU is terminated. The disk image
+// is copied after the state has been saved, as QEMU flushes the disk image
+// when migration completes. If the virtual machine uses UEFI, the NVRAM is
+// copied to nvramFile.
+//
+// If an error is returned the virtual machine is left stopped, and must be
+// terminated with Kill().
+func (vm *VirtualMachine) Checkpoint(stateFile, diskFile, nvramFile string) error {
+	// Only the boot disk is copied, so additional drives would be lost
+	if len(vm.machine.options.Drives) > 0 {
+		return errors.New("virtual machines with additional drives can't be checkpointed")
+	}
+
+	domain, err := vm.saveState(stateFile)
+	if err != nil {
+		return err
+	}
+
+	// Copy the disk image, while QEMU is paused, holding the lock ensures that
+	// the image isn't released while copying
+	vm.m.Lock()
+	if vm.image == nil {
+		err = errors.New("virtual machine terminated before disk image was copied")
+	} else {
+		err = copyFile(vm.image.DiskFile(), diskFile)
+	}
+	if err == nil && vm.nvramFile != "" {
+		err = copyFile(vm.nvramFile, nvramFile)
+	}
+	vm.m.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to copy disk image, error: %s", err)
+	}
+
+	if _, err := domain.Run(qmp.Command{Execute: "quit"}); err != nil {
+		return fmt.Errorf("failed QMP command 'quit', error: %s", err)
+	}
+	<-vm.Done
+	return nil
+}
+
+// saveState stops the virtual machine and writes its state to stateFile,
+// returning the QMP domain once migration has completed.
+func (vm *VirtualMachine) saveState(stateFile string) (*qemu.Domain, error) {
+	if strings.Contains(stateFile, "'") {
+		return nil, fmt.Errorf("state file path: '%s' must not contain single quotes", stateFile)
+	}
+	vm.m.Lock()
+	domain := vm.domain
+	vm.m.Unlock()
+	if domain == nil {
+		return nil, errors.New("virtual machine isn't running")
+	}
+
+	// Stop execution and migrate state to file without bandwidth limit
+	commands := []qmp.Command{
+		{Execute: "stop"},
+		{Execute: "migrate-set-parameters", Args: map[string]interface{}{
+			"max-bandwidth": int64(1) << 40,
+		}},
+		{Execute: "migrate", Args: map[string]interface{}{
+			"uri": "exec:cat > '" + stateFile + "'",
+		}},
+	}
+	for _, c := range commands {
+		if _, err := domain.Run(c); err != nil {
+			return nil, fmt.Errorf("failed QMP command '%s', error: %s", c.Execute, err)
+		}
+	}
+
+	// Wait for migration to complete
+	deadline := time.Now().Add(migrationTimeout)
+	for {
+		raw, err := domain.Run(qmp.Command{Execute: "query-migrate"})
+		if err != nil {
+			return nil, fmt.Errorf("failed QMP command 'query-migrate', error: %s", err)
+		}
+		var result struct {
+			Return struct {
+				Status    string `json:"status"`
+				ErrorDesc string `json:"error-desc"`
+			} `json:"return"`
+		}
+		if err = json.Unmarshal(raw, &result); err != nil {
+			return nil, fmt.Errorf("invalid response from 'query-migrate', error: %s", err)
+		}
+		if result.Return.Status == "completed" {
+			break
+		}
+		if result.Return.Status == "failed" || result.Return.Status == "cancelled" {
+			return nil, fmt.Errorf("saving state failed, status: %s, error: %s",
+				result.Return.Status, result.Return.ErrorDesc)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("saving state didn't finish within %s", migrationTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return domain, nil
+}
+
+// Machine returns the machine definition used by the virtual machine, this
+// includes defaults and values derived from limits.
+func (vm *VirtualMachine) Machine() Machine {
+	return vm.machine
+}
+
 // abort kills the VM and sets the error, if it's not already dead with another
 // error. This ensure we don't accidentally overwrite vm.Error with an error
 // that was the result of the original error.
@@ -523,7 +903,14 @@ func (vm *VirtualMachine) VNCSocket() string {
 
 // Screenshot takes a screenshot of the virtual machine screen as is running.
 func (vm *VirtualMachine) Screenshot() (image.Image, error) {
-	r, err := vm.domain.ScreenDump()
+	vm.m.Lock()
+	domain := vm.domain
+	vm.m.Unlock()
+	if domain == nil {
+		return nil, errors.New("virtual machine isn't running")
+	}
+
+	r, err := domain.ScreenDump()
 	if err != nil {
 		return nil, fmt.Errorf("Error taking screendump, error: %s", err)
 	}
@@ -600,3 +987,22 @@ func scanLog(log io.Reader, infoLog, errorLog func(...interface{})) {
 		errorLog("Error reading QEMU log, error: ", err)
 	}
 }
+
+// copyFile copies source to target
+func copyFile(source, target string) error {
+	input, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	output, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(output, input); err != nil {
+		output.Close()
+		return err
+	}
+	return output.Close()
+}
@@ -1,6 +1,8 @@
 package engines
 
 import (
+	"time"
+
 	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
 )
 
@@ -83,6 +85,36 @@ type ResultSet interface {
 	// as a tar-stream. Ideally this also includes cache folders.
 	ArchiveSandbox() (ioext.ReadSeekCloser, error)
 
+	// ExitStatus returns the exit status of the task command. Plugins may use
+	// this to treat specific exit codes differently, as Success() only tells if
+	// the command was successful.
+	//
+	// If the exit status is unknown, for example because the sandbox was killed
+	// before the command exited, the engine should return ErrResourceNotFound.
+	//
+	// Non-fatal errors: ErrFeatureNotSupported, ErrResourceNotFound
+	ExitStatus() (ExitStatus, error)
+
+	// ResourceUsage returns the resources used by the task command, such as
+	// wall time, CPU time and peak memory usage. Fields that the engine can't
+	// measure should be left zero.
+	//
+	// If the resource usage is unknown, for example because the sandbox was
+	// killed before the command exited, the engine should return
+	// ErrResourceNotFound.
+	//
+	// Non-fatal errors: ErrFeatureNotSupported, ErrResourceNotFound
+	ResourceUsage() (ResourceUsage, error)
+
+	// Environment returns a JSON serializable description of the environment
+	// the task was executed in, such as the hash of the image used. This is
+	// included in chain-of-trust certificates, hence, implementors should only
+	// include properties that are useful for verifying the integrity of the
+	// task environment.
+	//
+	// Non-fatal errors: ErrFeatureNotSupported
+	Environment() (map[string]interface{}, error)
+
 	// Dispose shall release all resources.
 	//
 	// CacheFolders given to the sandbox shall not be disposed, instead they are
@@ -93,6 +125,25 @@ type ResultSet interface {
 	Dispose() error
 }
 
+// ExitStatus is the exit status of the task command, as returned from
+// ResultSet.ExitStatus().
+type ExitStatus struct {
+	// Exit code of the command, -1 if the command was terminated by a signal.
+	Code int
+	// Description of the signal that terminated the command, empty-string if
+	// the command exited normally.
+	Signal string
+}
+
+// ResourceUsage is the resources used by the task command, as returned from
+// ResultSet.ResourceUsage().
+type ResourceUsage struct {
+	WallTime   time.Duration // Time from the command was started until it exited
+	UserTime   time.Duration // CPU time spent in user-mode
+	SystemTime time.Duration // CPU time spent in kernel-mode
+	MaxMemory  uint64        // Peak resident memory in bytes, zero if unknown
+}
+
 // ResultSetBase is a base implemenation of ResultSet. It will implement all
 // optional methods such that they return ErrFeatureNotSupported.
 //
@@ -120,6 +171,24 @@ func (ResultSetBase) ArchiveSandbox() (ioext.ReadSeekCloser, error) {
 	return nil, ErrFeatureNotSupported
 }
 
+// ExitStatus returns ErrFeatureNotSupported indicating that the feature isn't
+// supported.
+func (ResultSetBase) ExitStatus() (ExitStatus, error) {
+	return ExitStatus{}, ErrFeatureNotSupported
+}
+
+// ResourceUsage returns ErrFeatureNotSupported indicating that the feature
+// isn't supported.
+func (ResultSetBase) ResourceUsage() (ResourceUsage, error) {
+	return ResourceUsage{}, ErrFeatureNotSupported
+}
+
+// Environment returns ErrFeatureNotSupported indicating that the feature
+// isn't supported.
+func (ResultSetBase) Environment() (map[string]interface{}, error) {
+	return nil, ErrFeatureNotSupported
+}
+
 // Dispose returns nil indicating that resources have been released.
 func (ResultSetBase) Dispose() error {
 	return nil
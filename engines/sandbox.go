@@ -99,6 +99,15 @@ type Sandbox interface {
 	// ErrSandboxTerminated, ErrSandboxAborted.
 	OpenDisplay(name string) (io.ReadWriteCloser, error)
 
+	// WatchDisplay returns a VNC connection to a display like OpenDisplay(),
+	// but the connection is passive, it doesn't keep the sandbox alive after
+	// the task has finished. Instead the connection is closed when the sandbox
+	// terminates. This is intended for recording the display.
+	//
+	// Non-fatal errors: ErrFeatureNotSupported, ErrNoSuchDisplay,
+	// ErrSandboxTerminated, ErrSandboxAborted.
+	WatchDisplay(name string) (io.ReadWriteCloser, error)
+
 	// Abort the sandbox. This means killing the task execution as well as all
 	// associated shells and releasing all resources held.
 	//
@@ -118,6 +127,21 @@ type Sandbox interface {
 	// Non-fatal errors: ErrSandboxTerminated, ErrSandboxAborted,
 	// ErrFeatureNotSupported
 	Kill() error
+
+	// Checkpoint the sandbox, saving the state of the running task as an
+	// artifact such that a rerun of the task can resume from the checkpoint,
+	// and then abort the sandbox. This is called when the worker is shutting
+	// down, before the TaskContext is canceled.
+	//
+	// Unless ErrFeatureNotSupported, ErrSandboxTerminated or ErrSandboxAborted
+	// is returned, the sandbox is aborted whether or not the checkpoint was
+	// created, WaitForResult() must return ErrSandboxAborted and all resources
+	// must be released, as if Abort() was called. Any other error indicates that
+	// the checkpoint couldn't be created.
+	//
+	// Non-fatal errors: ErrFeatureNotSupported, ErrSandboxTerminated,
+	// ErrSandboxAborted
+	Checkpoint() error
 }
 
 // SandboxBase is a base implemenation of Sandbox. It will implement all
@@ -147,11 +171,23 @@ func (SandboxBase) OpenDisplay(string) (io.ReadWriteCloser, error) {
 	return nil, ErrFeatureNotSupported
 }
 
+// WatchDisplay returns ErrFeatureNotSupported indicating that the feature
+// isn't supported.
+func (SandboxBase) WatchDisplay(string) (io.ReadWriteCloser, error) {
+	return nil, ErrFeatureNotSupported
+}
+
 // Abort returns nil indicating that resources have been released.
 func (SandboxBase) Abort() error {
 	return nil
 }
 
+// Checkpoint returns ErrFeatureNotSupported indicating that the feature isn't
+// supported.
+func (SandboxBase) Checkpoint() error {
+	return ErrFeatureNotSupported
+}
+
 // Kill returns ErrFeatureNotSupported
 func (SandboxBase) Kill() error {
 	// TODO: Make implementation required, and disallow ErrFeatureNotSupported
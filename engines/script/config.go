@@ -1,13 +1,18 @@
 package scriptengine
 
 import (
+	"time"
+
 	schematypes "github.com/taskcluster/go-schematypes"
 	"github.com/taskcluster/taskcluster-worker/runtime/util"
 )
 
 type configType struct {
-	Command []string `json:"command"`
-	Schema  struct {
+	Command         []string          `json:"command"`
+	KillGracePeriod time.Duration     `json:"killGracePeriod"`
+	Environment     map[string]string `json:"environment"`
+	ShellCommand    []string          `json:"shellCommand"`
+	Schema          struct {
 		Type       string                 `json:"type"`
 		Properties map[string]interface{} `json:"properties"`
 		Required   []string               `json:"required"`
@@ -26,11 +31,44 @@ var configSchema = schematypes.Object{
 			`),
 			Items: schematypes.String{},
 		},
+		"killGracePeriod": schematypes.Duration{
+			Title: "Kill Grace Period",
+			Description: util.Markdown(`
+				Time between sending 'SIGTERM' and 'SIGKILL' to the process tree of
+				the script, when the task is killed or aborted. The script is started
+				in its own process group, so all sub-processes are terminated.
+
+				Defaults to 5 seconds, if not specified.
+			`),
+		},
+		"environment": schematypes.Map{
+			Title: "Environment Variables",
+			Description: util.Markdown(`
+				Environment variables given to the script. Variables set by plugins,
+				such as the 'env' plugin, overwrite variables given here.
+			`),
+			Values: schematypes.String{},
+		},
+		"shellCommand": schematypes.Array{
+			Title: "Shell Command",
+			Description: util.Markdown(`
+				Command to execute when an interactive shell is requested without
+				specifying a command, for example '["bash", "-i"]'. Shells are
+				executed in the working folder of the script with the same
+				environment variables.
+
+				If not given, interactive shells are not supported.
+			`),
+			Items: schematypes.String{},
+		},
 		"schema": schematypes.Object{
 			Title: "Payload Schema",
 			Description: util.Markdown(`
 				JSON schema for 'task.payload'. A JSON string matching this
 				schema will be piped to the script command over stdin.
+
+				The 'volumes' property is reserved, it is used to give the script
+				the paths of attached volumes.
 			`),
 			Properties: schematypes.Properties{
 				"type":       schematypes.StringEnum{Options: []string{"object"}},
@@ -2,9 +2,11 @@ package scriptengine
 
 import (
 	"fmt"
+	"time"
 
 	schematypes "github.com/taskcluster/go-schematypes"
 	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/engines/hostvolume"
 	"github.com/taskcluster/taskcluster-worker/runtime"
 )
 
@@ -20,6 +22,13 @@ type engine struct {
 	environment *runtime.Environment
 }
 
+// Time between SIGTERM and SIGKILL, if not configured
+var defaultKillGracePeriod = 5 * time.Second
+
+// Interval at which we check if the process group is empty, while waiting to
+// send SIGKILL
+const processGroupPollInterval = 100 * time.Millisecond
+
 func init() {
 	engines.Register("script", engineProvider{})
 }
@@ -31,6 +40,17 @@ func (engineProvider) ConfigSchema() schematypes.Schema {
 func (engineProvider) NewEngine(options engines.EngineOptions) (engines.Engine, error) {
 	var config configType
 	schematypes.MustValidateAndMap(configSchema, options.Config, &config)
+	if config.KillGracePeriod == 0 {
+		config.KillGracePeriod = defaultKillGracePeriod
+	}
+
+	// The 'volumes' property is used to pass volume paths to the script
+	if _, ok := config.Schema.Properties[volumesProperty]; ok {
+		return nil, fmt.Errorf(
+			"schema.properties.%s is reserved for volumes attached to the sandbox",
+			volumesProperty,
+		)
+	}
 
 	// Construct payload schema as schematypes.Object using schema.properties
 	properties := schematypes.Properties{}
@@ -64,5 +84,19 @@ func (e *engine) NewSandboxBuilder(options engines.SandboxOptions) (engines.Sand
 		engine:  e,
 		context: options.TaskContext,
 		monitor: options.Monitor,
+		env:     make(map[string]string),
+		volumes: make(map[string]volumeMount),
 	}, nil
 }
+
+func (e *engine) VolumeSchema() schematypes.Schema {
+	return schematypes.Object{}
+}
+
+func (e *engine) NewVolumeBuilder(options interface{}) (engines.VolumeBuilder, error) {
+	return hostvolume.NewBuilder(e.environment.TemporaryStorage, false)
+}
+
+func (e *engine) NewVolume(options interface{}) (engines.Volume, error) {
+	return hostvolume.New(e.environment.TemporaryStorage, false)
+}
@@ -39,6 +39,21 @@ func TestLogTargetWhenFailing(t *t.T) { loggingTestCase.TestLogTargetWhenFailing
 func TestSilentTask(t *t.T)           { loggingTestCase.TestSilentTask() }
 func TestLoggingTestCase(t *t.T)      { loggingTestCase.Test() }
 
+var exitStatusTestCase = enginetest.ExitStatusTestCase{
+	EngineProvider: provider,
+	SuccessPayload: `{
+    "arg": "this is a successful task"
+  }`,
+	FailingPayload: `{
+    "arg": "this is a failing task"
+  }`,
+	ExitCode: 1,
+}
+
+func TestExitZero(t *t.T)           { exitStatusTestCase.TestExitZero() }
+func TestExitNonZero(t *t.T)        { exitStatusTestCase.TestExitNonZero() }
+func TestExitStatusTestCase(t *t.T) { exitStatusTestCase.Test() }
+
 func TestStderrPrefixing(t *t.T) {
 	(&enginetest.LoggingTestCase{
 		EngineProvider: &enginetest.EngineProvider{
@@ -0,0 +1,79 @@
+// +build !windows
+
+package scriptengine
+
+import (
+	"strconv"
+	t "testing"
+
+	"github.com/taskcluster/taskcluster-worker/engines/enginetest"
+)
+
+// Script that reads payload from stdin, extracts the path of the attached
+// volume (if any) and evaluates the 'arg' property as a bash snippet. Notice
+// that 'arg' can't contain quotes or characters escaped by json.Marshal.
+const evalScript = `v=$(cat);
+path=$(echo "$v" | sed -n 's/.*"path":"\([^"]*\)".*/\1/p');
+ro=$(echo "$v" | grep -o '"readOnly":true' || true);
+arg=$(echo "$v" | sed -n 's/.*"arg":"\([^"]*\)".*/\1/p');
+eval "$arg"`
+
+var evalProvider = &enginetest.EngineProvider{
+	Engine: "script",
+	Config: `{
+		"command": ["bash", "-ec", ` + strconv.Quote(evalScript) + `],
+		"environment": {
+			"CONFIG_VAR": "hello-config"
+		},
+		"shellCommand": ["bash"],
+		"schema": {
+			"type": "object",
+			"properties": {
+				"arg": {"type": "string"}
+			},
+			"required": ["arg"]
+		}
+	}`,
+}
+
+func TestConfigEnvironment(t *t.T) {
+	c := enginetest.LoggingTestCase{
+		EngineProvider: evalProvider,
+		Target:         "hello-config",
+		TargetPayload:  `{"arg": "echo $CONFIG_VAR"}`,
+	}
+	c.TestLogTarget()
+}
+
+func TestEnvVars(t *t.T) {
+	c := enginetest.EnvVarTestCase{
+		EngineProvider:       evalProvider,
+		VariableName:         "TEST_ENV_VAR",
+		InvalidVariableNames: []string{"bad d", "also bad", "3bad"},
+		Payload:              `{"arg": "echo $TEST_ENV_VAR"}`,
+	}
+	c.Test()
+}
+
+func TestShell(t *t.T) {
+	c := enginetest.ShellTestCase{
+		EngineProvider: evalProvider,
+		Command:        "echo '[hello-world]'; (>&2 echo '[hello-error]');",
+		Stdout:         "[hello-world]\n",
+		Stderr:         "[hello-error]\n",
+		BadCommand:     "exit 1;\n",
+		SleepCommand:   "sleep 30;\n",
+		Payload:        `{"arg": "sleep 1"}`, // sandbox doesn't terminate before shell is started
+	}
+	c.Test()
+}
+
+func TestVolumes(t *t.T) {
+	c := enginetest.VolumeTestCase{
+		EngineProvider:     evalProvider,
+		Mountpoint:         "/mnt/cache",
+		WriteVolumePayload: `{"arg": "test -z $ro; echo hello | tee $path/hello.txt"}`,
+		CheckVolumePayload: `{"arg": "cat $path/hello.txt | grep hello"}`,
+	}
+	c.Test()
+}
@@ -0,0 +1,94 @@
+// +build !windows
+
+package scriptengine
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/engines/enginetest"
+)
+
+// isAlive returns true, if pid is a running process (not a zombie)
+func isAlive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	return err != nil || !strings.Contains(string(data), ") Z ")
+}
+
+func TestKillProcessTree(t *testing.T) {
+	// Script that spawns grandchildren ignoring SIGTERM, these hold stdout and
+	// stderr, so the task can't resolve until they are killed.
+	testKillProcessTree(t, func(pidFile string) string {
+		return "cat > /dev/null; (trap '' TERM; " +
+			"sleep 300 & echo $! >> " + pidFile + "; " +
+			"sleep 300 & echo $! >> " + pidFile + "; " +
+			"echo hello-world; wait) & wait"
+	})
+}
+
+func TestKillDetachedProcessTree(t *testing.T) {
+	// Script that spawns grandchildren ignoring SIGTERM, these don't hold stdout
+	// or stderr, so the task resolves when the script exits, but grandchildren
+	// must still be killed when the grace period expires.
+	testKillProcessTree(t, func(pidFile string) string {
+		return "cat > /dev/null; (trap '' TERM; " +
+			"sleep 300 3>&- & echo $! >> " + pidFile + "; " +
+			"sleep 300 3>&- & echo $! >> " + pidFile + "; " +
+			"echo hello-world >&3; exec 3>&-; wait) 3>&1 > /dev/null 2>&1 & wait"
+	})
+}
+
+func testKillProcessTree(t *testing.T, makeScript func(pidFile string) string) {
+	folder, err := ioutil.TempDir("", "scriptengine-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+	pidFile := filepath.Join(folder, "pids")
+	script := makeScript(pidFile)
+
+	c := enginetest.KillTestCase{
+		EngineProvider: &enginetest.EngineProvider{
+			Engine: "script",
+			Config: `{
+				"command": ["bash", "-c", "` + script + `"],
+				"killGracePeriod": 1,
+				"schema": {
+					"type": "object",
+					"properties": {
+						"arg": {"type": "string"}
+					},
+					"required": ["arg"]
+				}
+			}`,
+		},
+		Target: "hello-world",
+		Payload: `{
+			"arg": "spawn grandchildren"
+		}`,
+	}
+	c.Test()
+
+	data, err := ioutil.ReadFile(pidFile)
+	require.NoError(t, err)
+	pids := strings.Fields(string(data))
+	require.Len(t, pids, 2, "expected two grandchildren")
+	for _, p := range pids {
+		pid, err := strconv.Atoi(p)
+		require.NoError(t, err)
+		// Allow time for the grace period to expire and the kernel to clean up
+		for i := 0; i < 150 && isAlive(pid); i++ {
+			time.Sleep(20 * time.Millisecond)
+		}
+		require.False(t, isAlive(pid), "grandchild with pid %d is still alive", pid)
+	}
+}
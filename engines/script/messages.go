@@ -0,0 +1,134 @@
+package scriptengine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+// Environment variable given to the script, if the script can write messages
+// to a file descriptor.
+const messageFdEnvVar = "TASK_MESSAGE_FD"
+
+// Maximum size of a single message line from the script
+const maxMessageSize = 1024 * 1024
+
+// Results the script can report with a 'result' message
+const (
+	resultSuccess            = "success"
+	resultFailed             = "failed"
+	resultMalformedPayload   = "malformed-payload"
+	resultInternalError      = "internal-error"
+	resultFatalInternalError = "fatal-internal-error"
+)
+
+// message is a single line of JSON written by the script to the message file
+// descriptor.
+type message struct {
+	Type        string    `json:"type"`
+	Message     string    `json:"message"`
+	Progress    float64   `json:"progress"`
+	Result      string    `json:"result"`
+	Name        string    `json:"name"`
+	Path        string    `json:"path"`
+	ContentType string    `json:"contentType"`
+	Expires     time.Time `json:"expires"`
+}
+
+// artifactDeclaration is an artifact declared by the script with an
+// 'artifact' message.
+type artifactDeclaration struct {
+	Name        string
+	Path        string // relative to the working folder
+	ContentType string
+	Expires     time.Time // zero, if task expiration should be used
+}
+
+// messageState holds the state reported by the script using messages, this
+// may only be accessed after readMessages() has returned.
+type messageState struct {
+	result    string
+	malformed []runtime.MalformedPayloadError
+	artifacts []artifactDeclaration
+	invalid   []string // descriptions of invalid messages
+}
+
+// readMessages reads messages from r until EOF, logging messages and
+// progress to the task log while recording everything else in s.messages.
+func (s *sandbox) readMessages(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var m message
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			s.messages.invalid = append(s.messages.invalid, fmt.Sprintf(
+				"unable to parse message: %s", err,
+			))
+			continue
+		}
+		if problem := s.handleMessage(m); problem != "" {
+			s.messages.invalid = append(s.messages.invalid, problem)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		s.messages.invalid = append(s.messages.invalid, fmt.Sprintf(
+			"failed to read messages: %s", err,
+		))
+		// Drain the reader, so the script doesn't block writing messages
+		_, _ = io.Copy(ioutil.Discard, r)
+	}
+}
+
+// handleMessage handles message m, returning a description of the problem if
+// the message is invalid.
+func (s *sandbox) handleMessage(m message) string {
+	switch m.Type {
+	case "log":
+		s.context.Log(m.Message)
+	case "progress":
+		if m.Progress < 0 || m.Progress > 1 {
+			return fmt.Sprintf("progress must be between 0 and 1, got %g", m.Progress)
+		}
+		s.context.Log(fmt.Sprintf("%s - %.0f %%", m.Message, m.Progress*100))
+	case "malformed-payload":
+		if m.Message == "" {
+			return "malformed-payload message must have a 'message' property"
+		}
+		s.messages.malformed = append(s.messages.malformed, runtime.NewMalformedPayloadError(m.Message))
+	case "artifact":
+		if m.Name == "" || m.Path == "" {
+			return "artifact message must have 'name' and 'path' properties"
+		}
+		p := filepath.Clean(filepath.FromSlash(m.Path))
+		if filepath.IsAbs(p) || p == ".." || strings.HasPrefix(p, ".."+string(filepath.Separator)) {
+			return fmt.Sprintf("artifact path '%s' is not relative to the working folder", m.Path)
+		}
+		s.messages.artifacts = append(s.messages.artifacts, artifactDeclaration{
+			Name:        m.Name,
+			Path:        p,
+			ContentType: m.ContentType,
+			Expires:     m.Expires,
+		})
+	case "result":
+		switch m.Result {
+		case resultSuccess, resultFailed, resultMalformedPayload, resultInternalError, resultFatalInternalError:
+		default:
+			return fmt.Sprintf("unknown result '%s'", m.Result)
+		}
+		s.messages.result = m.Result
+	default:
+		return fmt.Sprintf("unknown message type '%s'", m.Type)
+	}
+	return ""
+}
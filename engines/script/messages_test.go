@@ -0,0 +1,188 @@
+// +build !windows
+
+package scriptengine
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/slugid-go/slugid"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/client"
+	"github.com/taskcluster/taskcluster-worker/runtime/gc"
+	"github.com/taskcluster/taskcluster-worker/runtime/mocks"
+)
+
+type scriptRun struct {
+	ResultSet engines.ResultSet
+	Error     error
+	KillError error // Error from Kill() after the result
+	Log       string
+}
+
+// runScript runs a bash script with the script engine and returns the result
+// and task log, artifacts are uploaded to q if not nil.
+func runScript(t *testing.T, script string, q *client.MockQueue) scriptRun {
+	folder, err := ioutil.TempDir("", "scriptengine-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+	storage, err := runtime.NewTemporaryStorage(folder)
+	require.NoError(t, err)
+
+	monitor := mocks.NewMockMonitor(true)
+	e, err := engines.Engines()["script"].NewEngine(engines.EngineOptions{
+		Environment: &runtime.Environment{
+			GarbageCollector: &gc.GarbageCollector{},
+			TemporaryStorage: storage,
+			Monitor:          monitor,
+		},
+		Monitor: monitor,
+		Config: map[string]interface{}{
+			"command": []interface{}{"bash", "-c", "cat > /dev/null; " + script},
+			"schema": map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{},
+				"required":   []interface{}{},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer e.Dispose()
+
+	ctx, control, err := runtime.NewTaskContext(filepath.Join(folder, "log"), runtime.TaskInfo{
+		TaskID:  slugid.Nice(),
+		Expires: time.Now().Add(24 * time.Hour),
+	})
+	require.NoError(t, err)
+	defer control.Dispose()
+	if q != nil {
+		control.SetQueueClient(q)
+	}
+
+	b, err := e.NewSandboxBuilder(engines.SandboxOptions{
+		TaskContext: ctx,
+		Payload:     map[string]interface{}{},
+		Monitor:     monitor,
+	})
+	require.NoError(t, err)
+	s, err := b.StartSandbox()
+	require.NoError(t, err)
+
+	var r scriptRun
+	r.ResultSet, r.Error = s.WaitForResult()
+	r.KillError = s.Kill()
+	require.NoError(t, control.CloseLog())
+	reader, err := ctx.NewLogReader()
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	r.Log = string(data)
+	return r
+}
+
+func TestMessageLogAndProgress(t *testing.T) {
+	r := runScript(t, `
+		echo '{"type": "log", "message": "hello-log"}' >&$TASK_MESSAGE_FD
+		echo '{"type": "progress", "message": "downloading", "progress": 0.5}' >&$TASK_MESSAGE_FD
+	`, nil)
+	require.NoError(t, r.Error)
+	require.True(t, r.ResultSet.Success())
+	require.Contains(t, r.Log, "hello-log")
+	require.Contains(t, r.Log, "downloading - 50 %")
+	require.Equal(t, engines.ErrSandboxTerminated, r.KillError)
+}
+
+func TestMessageMalformedPayload(t *testing.T) {
+	r := runScript(t, `
+		echo '{"type": "malformed-payload", "message": "bad-input-1"}' >&$TASK_MESSAGE_FD
+		echo '{"type": "malformed-payload", "message": "bad-input-2"}' >&$TASK_MESSAGE_FD
+		exit 2
+	`, nil)
+	e, ok := runtime.IsMalformedPayloadError(r.Error)
+	require.True(t, ok, "expected MalformedPayloadError, got: %v", r.Error)
+	require.Equal(t, []string{"bad-input-1", "bad-input-2"}, e.Messages())
+	require.Equal(t, engines.ErrSandboxTerminated, r.KillError)
+
+	// Exit code is ignored when a result is reported
+	r = runScript(t, `
+		echo '{"type": "malformed-payload", "message": "bad-input"}' >&$TASK_MESSAGE_FD
+		echo '{"type": "result", "result": "malformed-payload"}' >&$TASK_MESSAGE_FD
+		exit 1
+	`, nil)
+	e, ok = runtime.IsMalformedPayloadError(r.Error)
+	require.True(t, ok, "expected MalformedPayloadError, got: %v", r.Error)
+	require.Equal(t, []string{"bad-input"}, e.Messages())
+}
+
+func TestMessageResult(t *testing.T) {
+	r := runScript(t, `echo '{"type": "result", "result": "failed"}' >&$TASK_MESSAGE_FD`, nil)
+	require.NoError(t, r.Error)
+	require.False(t, r.ResultSet.Success())
+
+	r = runScript(t, `echo '{"type": "result", "result": "internal-error"}' >&$TASK_MESSAGE_FD`, nil)
+	require.Equal(t, runtime.ErrNonFatalInternalError, r.Error)
+
+	// Success is only trusted, if the script exits zero
+	r = runScript(t, `
+		echo '{"type": "result", "result": "success"}' >&$TASK_MESSAGE_FD
+		exit 1
+	`, nil)
+	require.NoError(t, r.Error)
+	require.False(t, r.ResultSet.Success())
+}
+
+func TestMessageInvalid(t *testing.T) {
+	r := runScript(t, `echo 'not-json' >&$TASK_MESSAGE_FD`, nil)
+	require.Equal(t, runtime.ErrNonFatalInternalError, r.Error)
+	require.Contains(t, r.Log, "Invalid message from script")
+
+	r = runScript(t, `echo '{"type": "artifact", "name": "public/x", "path": "../x"}' >&$TASK_MESSAGE_FD`, nil)
+	require.Equal(t, runtime.ErrNonFatalInternalError, r.Error)
+	require.Contains(t, r.Log, "is not relative to the working folder")
+}
+
+func TestMessageArtifact(t *testing.T) {
+	var uploaded []byte
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploaded, _ = ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	resp, _ := json.Marshal(queue.S3ArtifactResponse{PutURL: s.URL, StorageType: "s3"})
+	q := &client.MockQueue{}
+	q.On("CreateArtifact", mock.Anything, "0", "public/report.html", mock.MatchedBy(
+		func(req *queue.PostArtifactRequest) bool {
+			var r queue.S3ArtifactRequest
+			if json.Unmarshal(*req, &r) != nil {
+				return false
+			}
+			return r.ContentType == "text/x-report" && time.Time(r.Expires).Equal(expires)
+		},
+	)).Return(func() *queue.PostArtifactResponse {
+		r := queue.PostArtifactResponse(resp)
+		return &r
+	}(), nil)
+
+	r := runScript(t, `
+		mkdir -p output
+		echo 'hello-report' > output/report.txt
+		echo '{"type": "artifact", "name": "public/report.html", "path": "output/report.txt", "contentType": "text/x-report", "expires": "`+expires.Format(time.RFC3339)+`"}' >&$TASK_MESSAGE_FD
+	`, q)
+	require.NoError(t, r.Error)
+	require.True(t, r.ResultSet.Success(), "log: %s", r.Log)
+	q.AssertExpectations(t)
+	require.Equal(t, "hello-report\n", string(uploaded))
+}
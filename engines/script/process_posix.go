@@ -0,0 +1,42 @@
+// +build !windows
+
+package scriptengine
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setupProcessGroup configures cmd to start in a new session and process
+// group, such that the entire process tree can be signaled.
+func setupProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// terminateProcessGroup sends SIGTERM to all processes in the process group
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+// killProcessGroup sends SIGKILL to all processes in the process group
+func killProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// processGroupExists returns true, if any process in the process group of cmd
+// is still running or hasn't been reaped, regardless of exited.
+func processGroupExists(cmd *exec.Cmd, exited bool) bool {
+	return syscall.Kill(-cmd.Process.Pid, 0) != syscall.ESRCH
+}
+
+// setupMessagePipe gives cmd a pipe as file descriptor 3 for messages, the
+// caller must close the returned writer after cmd has been started.
+func setupMessagePipe(cmd *exec.Cmd) (r, w *os.File, err error) {
+	r, w, err = os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	cmd.ExtraFiles = []*os.File{w}
+	return r, w, nil
+}
@@ -0,0 +1,39 @@
+package scriptengine
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// setupProcessGroup configures cmd to start in a new process group
+func setupProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP,
+	}
+}
+
+// terminateProcessGroup asks the process tree to terminate
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	pid := strconv.Itoa(cmd.Process.Pid)
+	return exec.Command("taskkill", "/T", "/PID", pid).Run()
+}
+
+// killProcessGroup forcefully terminates the process tree
+func killProcessGroup(cmd *exec.Cmd) error {
+	pid := strconv.Itoa(cmd.Process.Pid)
+	return exec.Command("taskkill", "/T", "/F", "/PID", pid).Run()
+}
+
+// processGroupExists returns true, if cmd hasn't exited, as the process tree
+// can't be found once the root process has exited.
+func processGroupExists(cmd *exec.Cmd, exited bool) bool {
+	return !exited
+}
+
+// setupMessagePipe returns nil, as passing extra file descriptors isn't
+// supported on windows.
+func setupMessagePipe(cmd *exec.Cmd) (r, w *os.File, err error) {
+	return nil, nil, nil
+}
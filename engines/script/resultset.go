@@ -4,9 +4,25 @@ import "github.com/taskcluster/taskcluster-worker/engines"
 
 type resultSet struct {
 	engines.ResultSetBase
-	success bool
+	success       bool
+	exitStatus    *engines.ExitStatus    // nil, if killed or aborted
+	resourceUsage *engines.ResourceUsage // nil, if killed or aborted
 }
 
 func (r *resultSet) Success() bool {
 	return r.success
 }
+
+func (r *resultSet) ExitStatus() (engines.ExitStatus, error) {
+	if r.exitStatus == nil {
+		return engines.ExitStatus{}, engines.ErrResourceNotFound
+	}
+	return *r.exitStatus, nil
+}
+
+func (r *resultSet) ResourceUsage() (engines.ResourceUsage, error) {
+	if r.resourceUsage == nil {
+		return engines.ResourceUsage{}, engines.ErrResourceNotFound
+	}
+	return *r.resourceUsage, nil
+}
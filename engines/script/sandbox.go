@@ -1,74 +1,102 @@
 package scriptengine
 
 import (
+	"fmt"
 	"io"
 	"mime"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/goware/prefixer"
 	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/engines/hostshell"
 	"github.com/taskcluster/taskcluster-worker/runtime"
 	"github.com/taskcluster/taskcluster-worker/runtime/atomics"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+	"github.com/taskcluster/taskcluster-worker/runtime/processstate"
 )
 
 const artifactFolder = "artifacts"
 
 type sandbox struct {
 	engines.SandboxBase
-	context     *runtime.TaskContext
-	engine      *engine
-	cmd         *exec.Cmd
-	stderr      io.Reader
-	folder      runtime.TemporaryFolder
-	resolve     atomics.Once
-	resultSet   engines.ResultSet
-	resultError error
-	resultAbort error
-	monitor     runtime.Monitor
-	aborted     atomics.Bool
-	done        chan struct{}
+	context       *runtime.TaskContext
+	engine        *engine
+	cmd           *exec.Cmd
+	started       time.Time
+	stderr        io.Reader
+	messageReader io.ReadCloser // nil, if messages aren't supported
+	messages      messageState
+	folder        runtime.TemporaryFolder
+	env           map[string]string
+	resolve       atomics.Once
+	resultSet     engines.ResultSet
+	resultError   error
+	resultAbort   error
+	monitor       runtime.Monitor
+	aborted       atomics.Bool
+	killed        atomics.Bool
+	exited        atomics.Bool  // True, when the script has exited
+	terminating   atomics.Once  // Guards sending of signals to the process group
+	done          chan struct{} // Closed when run() is done
+	sessions      atomics.WaitGroup
+	mShells       sync.Mutex
+	shells        []*hostshell.Shell
 }
 
 func (s *sandbox) run() {
+	// Read messages, if supported on this platform
+	messagesDone := make(chan struct{})
+	go func() {
+		defer close(messagesDone)
+		if s.messageReader != nil {
+			s.readMessages(s.messageReader)
+			s.messageReader.Close()
+		}
+	}()
+
 	// Read stderr to task log before we wait for exit code
 	io.Copy(s.context.LogDrain(), prefixer.New(s.stderr, "[worker:error] "))
+	<-messagesDone
 	err := s.cmd.Wait()
+	wallTime := time.Since(s.started)
+	s.exited.Set(true)
+
+	// Wait for all shells to finish and prevent new shells from being created
+	s.sessions.WaitAndDrain()
 
 	success := err == nil
 	var resultError error
-	if e, ok := err.(*exec.ExitError); ok {
-		if status, ok := e.Sys().(syscall.WaitStatus); ok {
-			switch status.ExitStatus() {
-			case 0:
-				// this shouldn't be possible...
-				s.monitor.ReportError(err, "got an exec.ExitError with exit code zero")
-				resultError = runtime.ErrFatalInternalError
-			case 1:
-				// default value for success is false
-			case 2:
-				resultError = runtime.NewMalformedPayloadError("task.payload parameters are not permitted")
-			case 3:
-				resultError = runtime.ErrNonFatalInternalError
-			case 4:
-				resultError = runtime.ErrFatalInternalError
-			default:
-				s.monitor.Errorf("script exited with unhandled exit-code: %d", status.ExitStatus())
-				resultError = runtime.ErrFatalInternalError
-			}
-		} else {
-			debug("platform doesn't seem to support exit codes")
+	if s.aborted.Get() {
+		// If aborted, the script exit-code doesn't matter
+		success = false
+	} else if s.killed.Get() {
+		// If killed, the script exit-code doesn't matter
+		s.context.LogError("Task was killed")
+		success = false
+	} else if len(s.messages.invalid) > 0 {
+		// If the script wrote invalid messages, the script is broken
+		for _, problem := range s.messages.invalid {
+			s.context.LogError("Invalid message from script: ", problem)
 		}
-	} else if err != nil {
-		// if error wasn't because script exited non-zero, then we have a problem
-		s.monitor.Error("Script execution failed, error: ", err)
+		s.monitor.Warnf("script wrote invalid messages, first problem: %s", s.messages.invalid[0])
+		resultError = runtime.ErrNonFatalInternalError
+	} else if s.messages.result != "" {
+		success, resultError = s.messageResult(err)
+	} else {
+		success, resultError = s.exitCodeResult(err)
 	}
 
 	// Upload artifacts if not aborted
 	if !s.aborted.Get() {
-		err2 := s.uploadArtifacts()
+		found, err2 := s.uploadArtifacts()
+		if !found {
+			success = false
+		}
 		if err2 != nil {
 			success = false
 			s.context.LogError("Failed to upload artifacts")
@@ -87,7 +115,15 @@ func (s *sandbox) run() {
 		}
 
 		if resultError == nil {
-			s.resultSet = &resultSet{success: success}
+			r := &resultSet{success: success}
+			// If killed or aborted, the script didn't exit by itself
+			if !s.killed.Get() && !s.aborted.Get() {
+				code, signal := processstate.ExitStatusOf(s.cmd.ProcessState)
+				usage := engines.ResourceUsage(processstate.ResourceUsageOf(s.cmd.ProcessState, wallTime))
+				r.exitStatus = &engines.ExitStatus{Code: code, Signal: signal}
+				r.resourceUsage = &usage
+			}
+			s.resultSet = r
 		} else {
 			s.resultError = resultError
 		}
@@ -95,9 +131,52 @@ func (s *sandbox) run() {
 	})
 }
 
+// terminate sends SIGTERM to the process group of the script, and SIGKILL
+// after the configured grace period. The SIGKILL is sent even if the script
+// has exited, as sub-processes may still be running in the process group, but
+// not once the process group is empty, as the id may then be reused.
+func (s *sandbox) terminate() {
+	s.terminating.Do(func() {
+		// Discard errors as we're racing with termination
+		debug("sending SIGTERM to process group")
+		_ = terminateProcessGroup(s.cmd)
+
+		kill := time.NewTimer(s.engine.config.KillGracePeriod)
+		go func() {
+			defer kill.Stop()
+			poll := time.NewTicker(processGroupPollInterval)
+			defer poll.Stop()
+			for {
+				select {
+				case <-poll.C:
+					if !processGroupExists(s.cmd, s.exited.Get()) {
+						debug("process group is empty")
+						return
+					}
+				case <-kill.C:
+					if processGroupExists(s.cmd, s.exited.Get()) {
+						debug("sending SIGKILL to process group")
+						_ = killProcessGroup(s.cmd)
+					}
+					return
+				}
+			}
+		}()
+	})
+}
+
 func (s *sandbox) Kill() error {
-	// TODO: Implement termination of all subprocesses
-	_ = s.cmd.Process.Kill()
+	// If already resolved, the sandbox was terminated or aborted
+	if s.resolve.IsDone() {
+		if s.aborted.Get() {
+			return engines.ErrSandboxAborted
+		}
+		return s.resultAbort
+	}
+	s.killed.Set(true)
+	s.terminate()
+	s.abortShells()
+	s.resolve.Wait()
 	return nil
 }
 
@@ -111,8 +190,9 @@ func (s *sandbox) Abort() error {
 		// Abort artifact upload
 		s.aborted.Set(true)
 
-		// Discard error from Kill() as we're racing with termination
-		_ = s.cmd.Process.Kill()
+		// Terminate the process tree
+		s.terminate()
+		s.abortShells()
 
 		// Wait for artifact upload to be aborted
 		<-s.done
@@ -128,9 +208,164 @@ func (s *sandbox) Abort() error {
 	return s.resultAbort
 }
 
-func (s *sandbox) uploadArtifacts() error {
+func (s *sandbox) NewShell(command []string, tty bool) (engines.Shell, error) {
+	// Default to configured shellCommand, if not configured we don't support
+	// interactive shells
+	if len(command) == 0 {
+		if len(s.engine.config.ShellCommand) == 0 {
+			return nil, engines.ErrFeatureNotSupported
+		}
+		command = s.engine.config.ShellCommand
+	}
+
+	s.mShells.Lock()
+	defer s.mShells.Unlock()
+
+	// Increment shell counter, if draining we don't allow new shells
+	if s.sessions.Add(1) != nil {
+		return nil, engines.ErrSandboxTerminated
+	}
+
+	debug("NewShell with: %v", command)
+	S, err := newShell(s, command, tty)
+	if err != nil {
+		debug("Failed to start shell, error: %s", err)
+		s.sessions.Done()
+		return nil, runtime.NewMalformedPayloadError(
+			"Unable to spawn command: ", command, " error: ", err,
+		)
+	}
+
+	// Add shells to list
+	s.shells = append(s.shells, S)
+
+	// Wait for the S to be done and decrement WaitGroup
+	go func() {
+		result, _ := S.Wait()
+		debug("Shell finished with: %v", result)
+
+		s.mShells.Lock()
+		defer s.mShells.Unlock()
+
+		// remove S from s.shells
+		shells := make([]*hostshell.Shell, 0, len(s.shells))
+		for _, s2 := range s.shells {
+			if s2 != S {
+				shells = append(shells, s2)
+			}
+		}
+		s.shells = shells
+
+		// Mark as done
+		s.sessions.Done()
+	}()
+
+	return S, nil
+}
+
+// abortShells prevents new shells and aborts all existing shells
+func (s *sandbox) abortShells() {
+	s.mShells.Lock()
+
+	// Prevent new shells
+	s.sessions.Drain()
+
+	// Abort all shells
+	for _, S := range s.shells {
+		go S.Abort()
+	}
+	s.shells = nil
+
+	// can't hold lock while waiting for session to finish
+	s.mShells.Unlock()
+
+	// Wait for all shells to be done
+	s.sessions.Wait()
+}
+
+// exitCodeResult returns the result of the task given the exit code of the
+// script, this is used if the script didn't report a result using messages.
+func (s *sandbox) exitCodeResult(err error) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+	if e, ok := err.(*exec.ExitError); ok {
+		if status, ok := e.Sys().(syscall.WaitStatus); ok {
+			switch status.ExitStatus() {
+			case 0:
+				// this shouldn't be possible...
+				s.monitor.ReportError(err, "got an exec.ExitError with exit code zero")
+				return false, runtime.ErrFatalInternalError
+			case 1:
+				return false, nil
+			case 2:
+				return false, s.malformedPayloadError()
+			case 3:
+				return false, runtime.ErrNonFatalInternalError
+			case 4:
+				return false, runtime.ErrFatalInternalError
+			default:
+				s.monitor.Errorf("script exited with unhandled exit-code: %d", status.ExitStatus())
+				return false, runtime.ErrFatalInternalError
+			}
+		}
+		debug("platform doesn't seem to support exit codes")
+		return false, nil
+	}
+	// if error wasn't because script exited non-zero, then we have a problem
+	s.monitor.Error("Script execution failed, error: ", err)
+	return false, nil
+}
+
+// messageResult returns the result of the task reported by the script using
+// a 'result' message.
+func (s *sandbox) messageResult(err error) (bool, error) {
+	switch s.messages.result {
+	case resultSuccess:
+		if err != nil {
+			// Don't trust the script to report success, if it exited non-zero
+			s.context.LogError("Script reported success, but exited with: ", err)
+			return false, nil
+		}
+		return true, nil
+	case resultFailed:
+		return false, nil
+	case resultMalformedPayload:
+		return false, s.malformedPayloadError()
+	case resultInternalError:
+		return false, runtime.ErrNonFatalInternalError
+	case resultFatalInternalError:
+		return false, runtime.ErrFatalInternalError
+	}
+	panic("unreachable, result messages are validated in handleMessage")
+}
+
+// malformedPayloadError returns a MalformedPayloadError with messages reported
+// by the script, or a generic message if the script didn't report any.
+func (s *sandbox) malformedPayloadError() error {
+	if len(s.messages.malformed) == 0 {
+		return runtime.NewMalformedPayloadError("task.payload parameters are not permitted")
+	}
+	return runtime.MergeMalformedPayload(s.messages.malformed...)
+}
+
+// uploadArtifacts uploads artifacts declared by the script and files in the
+// artifact folder, returns false if a declared artifact was missing.
+func (s *sandbox) uploadArtifacts() (bool, error) {
+	// Upload declared artifacts
+	declared := make(map[string]bool, len(s.messages.artifacts))
+	found := true
+	for _, a := range s.messages.artifacts {
+		declared[a.Name] = true
+		ok, err := s.uploadDeclaredArtifact(a)
+		if err != nil {
+			return false, err
+		}
+		found = found && ok
+	}
+
 	folder := filepath.Join(s.folder.Path(), artifactFolder)
-	return filepath.Walk(folder, func(p string, info os.FileInfo, err error) error {
+	err := filepath.Walk(folder, func(p string, info os.FileInfo, err error) error {
 		// Abort if there is an error
 		if err != nil {
 			return err
@@ -141,37 +376,83 @@ func (s *sandbox) uploadArtifacts() error {
 			return nil
 		}
 
-		// Guess mimetype
-		mimeType := mime.TypeByExtension(filepath.Ext(p))
-		if mimeType == "" {
-			// application/octet-stream is the mime type for "unknown"
-			mimeType = "application/octet-stream"
+		// Find filename, skip it if declared with a message
+		name, _ := filepath.Rel(folder, p)
+		name = filepath.ToSlash(name)
+		if declared[name] {
+			return nil
 		}
 
-		// Open file
-		f, err := os.Open(p)
-		if err != nil {
-			return err
-		}
+		return s.uploadFile(p, runtime.S3Artifact{
+			Name:     name,
+			Mimetype: guessMimeType(p),
+			Expires:  s.context.Expires, // use task expiration
+		})
+	})
+	return found, err
+}
 
-		// Find filename
-		name, _ := filepath.Rel(folder, p)
+// uploadDeclaredArtifact uploads an artifact declared by the script, returns
+// false if the file is missing.
+func (s *sandbox) uploadDeclaredArtifact(a artifactDeclaration) (bool, error) {
+	// Artifacts can't expire after the task
+	expires := s.context.Expires
+	if !a.Expires.IsZero() && a.Expires.Before(expires) {
+		expires = a.Expires
+	}
 
-		// Upload artifact
-		err = s.context.UploadS3Artifact(runtime.S3Artifact{
-			Name:     filepath.ToSlash(name),
-			Mimetype: mimeType,
-			Expires:  s.context.Expires, // use task expiration
-			Stream:   f,
+	p := filepath.Join(s.folder.Path(), a.Path)
+	info, err := os.Stat(p)
+	if err != nil || !info.Mode().IsRegular() {
+		s.context.LogError(fmt.Sprintf("Artifact '%s' was not found at path: '%s'", a.Name, a.Path))
+		return false, s.context.CreateErrorArtifact(runtime.ErrorArtifact{
+			Name:    a.Name,
+			Reason:  "file-missing-on-worker",
+			Message: fmt.Sprintf("No file was found at path: '%s' on worker", a.Path),
+			Expires: expires,
 		})
+	}
 
-		// Ensure that we close the file
-		cerr := f.Close()
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = guessMimeType(p)
+	}
+	return true, s.uploadFile(p, runtime.S3Artifact{
+		Name:     a.Name,
+		Mimetype: contentType,
+		Expires:  expires,
+	})
+}
 
-		// Return first error, if any
-		if err != nil {
-			err = cerr
-		}
+// uploadFile uploads the file at path p as artifact
+func (s *sandbox) uploadFile(p string, artifact runtime.S3Artifact) error {
+	// Open file
+	f, err := os.Open(p)
+	if err != nil {
 		return err
-	})
+	}
+
+	// Upload artifact, the http client closes the request body, so we wrap the
+	// file to ensure that we close it exactly once
+	artifact.Stream = ioext.NopCloser(f)
+	err = s.context.UploadS3Artifact(artifact)
+
+	// Ensure that we close the file
+	cerr := f.Close()
+
+	// Return first error, if any
+	if err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// guessMimeType returns the mimetype for path p based on file extension
+func guessMimeType(p string) string {
+	mimeType := mime.TypeByExtension(filepath.Ext(p))
+	if mimeType == "" {
+		// application/octet-stream is the mime type for "unknown"
+		mimeType = "application/octet-stream"
+	}
+	return mimeType
 }
@@ -7,21 +7,95 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/engines/hostvolume"
 	"github.com/taskcluster/taskcluster-worker/runtime"
 )
 
+// Property in the JSON given on stdin, which holds attached volumes
+const volumesProperty = "volumes"
+
 type sandboxBuilder struct {
 	engines.SandboxBuilderBase
+	m       sync.Mutex
 	payload map[string]interface{}
 	engine  *engine
 	context *runtime.TaskContext
 	monitor runtime.Monitor
+	env     map[string]string
+	volumes map[string]volumeMount
+}
+
+// volumeMount is a volume attached to the sandboxBuilder
+type volumeMount struct {
+	volume   *hostvolume.Volume
+	readOnly bool
+}
+
+// volumeInfo is given to the script for each attached volume
+type volumeInfo struct {
+	Path     string `json:"path"`
+	ReadOnly bool   `json:"readOnly"`
+}
+
+func (b *sandboxBuilder) AttachVolume(mountpoint string, v engines.Volume, readOnly bool) error {
+	// We can type cast Volume to our internal type as we know the volume was
+	// created by NewVolume() or NewVolumeBuilder()
+	vol, valid := v.(*hostvolume.Volume)
+	if !valid {
+		return fmt.Errorf("invalid volume type")
+	}
+
+	// The mountpoint is just a key for the script, so anything non-empty goes
+	if mountpoint == "" {
+		return runtime.NewMalformedPayloadError(
+			"Volume mountpoint cannot be empty for script engine",
+		)
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if _, ok := b.volumes[mountpoint]; ok {
+		return engines.ErrNamingConflict
+	}
+	b.volumes[mountpoint] = volumeMount{
+		volume:   vol,
+		readOnly: readOnly,
+	}
+	return nil
+}
+
+var envVarPattern = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+
+func (b *sandboxBuilder) SetEnvironmentVariable(name string, value string) error {
+	if !envVarPattern.MatchString(name) {
+		return runtime.NewMalformedPayloadError(
+			"Environment variables name: '", name, "' doesn't match: ",
+			envVarPattern.String(),
+		)
+	}
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if _, ok := b.env[name]; ok {
+		return engines.ErrNamingConflict
+	}
+	b.env[name] = value
+	return nil
 }
 
 func (b *sandboxBuilder) StartSandbox() (engines.Sandbox, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
 	script := b.engine.config.Command
 	cmd := exec.Command(script[0], script[1:]...)
 	folder, err := b.engine.environment.TemporaryStorage.NewFolder()
@@ -32,11 +106,39 @@ func (b *sandboxBuilder) StartSandbox() (engines.Sandbox, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to create artifact folder")
 	}
-	data, err := json.Marshal(b.payload)
+
+	// Add attached volumes to the JSON given on stdin
+	input := b.payload
+	if len(b.volumes) > 0 {
+		input = make(map[string]interface{}, len(b.payload)+1)
+		for k, v := range b.payload {
+			input[k] = v
+		}
+		volumes := make(map[string]volumeInfo, len(b.volumes))
+		for mountpoint, m := range b.volumes {
+			volumes[mountpoint] = volumeInfo{
+				Path:     m.volume.Path(),
+				ReadOnly: m.readOnly,
+			}
+		}
+		input[volumesProperty] = volumes
+	}
+	data, err := json.Marshal(input)
 	if err != nil {
 		panic(errors.Wrap(err, "Error serializing json payload"))
 	}
 
+	// Environment variables from config, built-in variables and plugins
+	env := map[string]string{}
+	for k, v := range b.engine.config.Environment {
+		env[k] = v
+	}
+	env["TASK_ID"] = b.context.TaskID
+	env["RUN_ID"] = strconv.Itoa(b.context.RunID)
+	for k, v := range b.env {
+		env[k] = v
+	}
+
 	cmd.Dir = folder.Path()
 	cmd.Stdin = bytes.NewBuffer(data)
 	cmd.Stdout = b.context.LogDrain()
@@ -44,23 +146,47 @@ func (b *sandboxBuilder) StartSandbox() (engines.Sandbox, error) {
 	if err != nil {
 		panic(errors.Wrap(err, "failed to created cmd.StderrPipe()")) // should never happen
 	}
-	cmd.Env = formatEnv(map[string]string{
-		"TASK_ID": b.context.TaskID,
-		"RUN_ID":  fmt.Sprintf("%d", b.context.RunID),
-	})
 
-	if err := cmd.Start(); err != nil {
+	// Give the script a pipe for messages, if supported on this platform
+	messageReader, messageWriter, err := setupMessagePipe(cmd)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to create pipe for messages")
+	}
+	cmd.Env = formatEnv(env)
+	if messageWriter != nil {
+		// First extra file is given file descriptor 3 (after stdin, stdout, stderr)
+		cmd.Env = append(cmd.Env, messageFdEnvVar+"=3")
+	}
+
+	// Start in a new process group, so we can kill the entire process tree
+	setupProcessGroup(cmd)
+
+	err = cmd.Start()
+	started := time.Now()
+	if messageWriter != nil {
+		// The child process has a copy, so we close our end of the pipe
+		messageWriter.Close()
+	}
+	if err != nil {
+		if messageReader != nil {
+			messageReader.Close()
+		}
 		return nil, errors.Wrap(err, "Internal error invalid script")
 	}
 	s := &sandbox{
 		cmd:     cmd,
+		started: started,
 		stderr:  stderr,
 		folder:  folder,
+		env:     env,
 		monitor: b.monitor,
 		context: b.context,
 		engine:  b.engine,
 		done:    make(chan struct{}),
 	}
+	if messageReader != nil {
+		s.messageReader = messageReader
+	}
 	go s.run()
 	return s, nil
 }
@@ -0,0 +1,16 @@
+package scriptengine
+
+import (
+	"github.com/taskcluster/taskcluster-worker/engines/hostshell"
+	"github.com/taskcluster/taskcluster-worker/engines/native/system"
+)
+
+// newShell starts command in the working folder of the sandbox
+func newShell(s *sandbox, command []string, tty bool) (*hostshell.Shell, error) {
+	return hostshell.New(system.ProcessOptions{
+		Arguments:     command,
+		Environment:   s.env,
+		WorkingFolder: s.folder.Path(),
+		TTY:           tty,
+	})
+}
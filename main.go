@@ -33,6 +33,7 @@ import (
 	_ "github.com/taskcluster/taskcluster-worker/commands/schema"
 	_ "github.com/taskcluster/taskcluster-worker/commands/shell"
 	_ "github.com/taskcluster/taskcluster-worker/commands/shell-server"
+	_ "github.com/taskcluster/taskcluster-worker/commands/verify-cot"
 	_ "github.com/taskcluster/taskcluster-worker/commands/version"
 	_ "github.com/taskcluster/taskcluster-worker/commands/work"
 	_ "github.com/taskcluster/taskcluster-worker/config/abs"
@@ -43,18 +44,22 @@ import (
 	_ "github.com/taskcluster/taskcluster-worker/config/secrets"
 	_ "github.com/taskcluster/taskcluster-worker/engines/enginetest"
 	_ "github.com/taskcluster/taskcluster-worker/engines/mock"
+	_ "github.com/taskcluster/taskcluster-worker/engines/namespace"
 	_ "github.com/taskcluster/taskcluster-worker/engines/native"
 	_ "github.com/taskcluster/taskcluster-worker/engines/qemu"
 	_ "github.com/taskcluster/taskcluster-worker/engines/script"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/artifacts"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/cache"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/env"
+	_ "github.com/taskcluster/taskcluster-worker/plugins/exitstatus"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/interactive"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/livelog"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/logprefix"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/maxruntime"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/plugintest"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/reboot"
+	_ "github.com/taskcluster/taskcluster-worker/plugins/resultcache"
+	_ "github.com/taskcluster/taskcluster-worker/plugins/screenrecording"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/success"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/tcproxy"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/watchdog"
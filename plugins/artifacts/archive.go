@@ -0,0 +1,79 @@
+package artifacts
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+// tarArchive writes files to a tar.gz archive in a temporary file, this is
+// used to upload a directory artifact as a single artifact.
+//
+// Add() is thread-safe, as ExtractFolder may call the handler concurrently.
+type tarArchive struct {
+	m       sync.Mutex
+	file    runtime.TemporaryFile
+	zipper  *gzip.Writer
+	tarball *tar.Writer
+	modTime time.Time
+}
+
+func newTarArchive(storage runtime.TemporaryStorage) (*tarArchive, error) {
+	file, err := storage.NewFile()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create temporary file for archive")
+	}
+	zipper := gzip.NewWriter(file)
+	return &tarArchive{
+		file:    file,
+		zipper:  zipper,
+		tarball: tar.NewWriter(zipper),
+		modTime: time.Now(),
+	}, nil
+}
+
+// Add writes a file with slash separated path p and given size to the archive
+func (a *tarArchive) Add(p string, size int64, r io.Reader) error {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	err := a.tarball.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     p,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  a.modTime,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to write header for '%s' to archive", p)
+	}
+	if _, err = io.CopyN(a.tarball, r, size); err != nil {
+		return errors.Wrapf(err, "failed to write '%s' to archive", p)
+	}
+	return nil
+}
+
+// Finish completes the archive and returns a stream from the start of the
+// archive. The stream is closed when the archive is closed.
+func (a *tarArchive) Finish() (runtime.TemporaryFile, error) {
+	if err := a.tarball.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to close tar archive")
+	}
+	if err := a.zipper.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to close compression of archive")
+	}
+	if _, err := a.file.Seek(0, io.SeekStart); err != nil {
+		return nil, errors.Wrap(err, "failed to seek to start of archive")
+	}
+	return a.file, nil
+}
+
+// Close releases the temporary file holding the archive
+func (a *tarArchive) Close() error {
+	return a.file.Close()
+}
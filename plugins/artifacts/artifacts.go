@@ -2,21 +2,16 @@ package artifacts
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
-	"mime"
 	"path"
-	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
+	"golang.org/x/crypto/ed25519"
 	"golang.org/x/crypto/openpgp"
-	"golang.org/x/crypto/openpgp/clearsign"
 
 	"github.com/pkg/errors"
 	schematypes "github.com/taskcluster/go-schematypes"
@@ -28,7 +23,10 @@ import (
 	"github.com/taskcluster/taskcluster-worker/runtime/util"
 )
 
-const unknownMimetype = "application/octet-stream"
+const (
+	unknownMimetype = "application/octet-stream"
+	tarGzMimetype   = "application/gzip"
+)
 
 // Maximum concurrent uploads, note that we might do concurrent uploads for
 // folder artifacts too, causing a total of:
@@ -41,8 +39,13 @@ type pluginProvider struct {
 
 type plugin struct {
 	plugins.PluginBase
-	environment *runtime.Environment
-	privateKey  *openpgp.Entity // nil, if COT is disabled
+	environment     *runtime.Environment
+	engineName      string
+	workerVersion   string
+	workerRevision  string
+	privateKey      *openpgp.Entity    // nil, if COT v1 is disabled
+	signingKey      ed25519.PrivateKey // nil, if COT v2 is disabled
+	contentEncoding string             // default content encoding policy
 }
 
 type taskPlugin struct {
@@ -52,7 +55,8 @@ type taskPlugin struct {
 	artifacts    []artifact
 	createCOT    bool
 	certifiedLog bool
-	uploaded     map[string][]byte // Map from artifact to sha256 hash
+	uploaded     map[string]cotArtifact // Map from artifact to hashes
+	environment  map[string]interface{} // From ResultSet.Environment(), may be nil
 	mUploaded    sync.Mutex
 	monitor      runtime.Monitor
 	failed       atomics.Bool                    // If true, Stopped() returns false
@@ -86,9 +90,27 @@ func (pluginProvider) NewPlugin(options plugins.PluginOptions) (plugins.Plugin,
 		key = keyring[0]
 	}
 
+	var signingKey ed25519.PrivateKey
+	if c.SigningKey != "" {
+		var err error
+		signingKey, err = parseSigningKey(c.SigningKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "Failed to load signing key")
+		}
+	}
+
+	if c.ContentEncoding == "" {
+		c.ContentEncoding = encodingIdentity
+	}
+
 	return &plugin{
-		environment: options.Environment,
-		privateKey:  key,
+		environment:     options.Environment,
+		engineName:      options.EngineName,
+		workerVersion:   options.Version,
+		workerRevision:  options.Revision,
+		privateKey:      key,
+		signingKey:      signingKey,
+		contentEncoding: c.ContentEncoding,
 	}, nil
 }
 
@@ -98,18 +120,22 @@ func (p *plugin) PayloadSchema() schematypes.Object {
 			"artifacts": artifactSchema,
 		},
 	}
-	if p.privateKey != nil {
+	if p.cotEnabled() {
 		schema.Properties["chainOfTrust"] = schematypes.Boolean{
 			Title: "Create chain-of-trust Certificate",
 			Description: util.Markdown(`
-				Generate a 'public/chainOfTrust.json.asc' artifact with signed hashes
-				of the artifacts generated from this task.
+				Generate a chain-of-trust certificate with signed hashes of the
+				artifacts generated from this task. Depending on worker
+				configuration this is either a 'public/chainOfTrust.json.asc'
+				artifact clear-signed with OpenPGP, or a 'public/chain-of-trust.json'
+				artifact with a detached ed25519 signature in
+				'public/chain-of-trust.json.sig', or both.
 			`),
 		}
 		schema.Properties["certifiedLog"] = schematypes.Boolean{
 			Title: "Create Certified Log",
 			Description: util.Markdown(`
-				Default log artifact is not covered by 'public/chainOfTrust.json.asc',
+				Default log artifact is not covered by chain-of-trust certificates,
 				if this is set to 'true' an artifact 'public/logs/certified.log' will
 				be created and covered by chain-of-trust certificate.
 			`),
@@ -118,16 +144,26 @@ func (p *plugin) PayloadSchema() schematypes.Object {
 	return schema
 }
 
+// cotEnabled returns true, if a key for signing chain-of-trust certificates
+// is configured.
+func (p *plugin) cotEnabled() bool {
+	return p.privateKey != nil || p.signingKey != nil
+}
+
 func (p *plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskPlugin, error) {
 	var P payload
 	schematypes.MustValidateAndMap(p.PayloadSchema(), options.Payload, &P)
 
+	if err := validateArtifacts(P.Artifacts); err != nil {
+		return nil, err
+	}
+
 	return &taskPlugin{
 		plugin:       p,
 		artifacts:    P.Artifacts,
-		createCOT:    p.privateKey != nil && P.CreateCOT,
-		certifiedLog: p.privateKey != nil && P.CertifiedLog,
-		uploaded:     make(map[string][]byte),
+		createCOT:    p.cotEnabled() && P.CreateCOT,
+		certifiedLog: p.cotEnabled() && P.CertifiedLog,
+		uploaded:     make(map[string]cotArtifact),
 		context:      options.TaskContext,
 		monitor:      options.Monitor,
 	}, nil
@@ -144,6 +180,9 @@ func (tp *taskPlugin) Stopped(result engines.ResultSet) (bool, error) {
 		if a.Expires.IsZero() {
 			a.Expires = tp.context.TaskInfo.Expires
 		}
+		if a.ContentEncoding == "" {
+			a.ContentEncoding = tp.plugin.contentEncoding
+		}
 		switch a.Type {
 		case typeFile:
 			tp.processFile(result, a)
@@ -153,6 +192,15 @@ func (tp *taskPlugin) Stopped(result engines.ResultSet) (bool, error) {
 	})
 	debug("Artifacts extracted and uploaded")
 
+	// Get environment description from engine for chain-of-trust
+	if tp.createCOT {
+		env, err := result.Environment()
+		if err != nil && err != engines.ErrFeatureNotSupported {
+			tp.monitor.ReportWarning(err, "ResultSet.Environment() failed")
+		}
+		tp.environment = env
+	}
+
 	// Find error condition
 	var err error
 	if len(tp.errors) > 0 {
@@ -167,26 +215,63 @@ func (tp *taskPlugin) Stopped(result engines.ResultSet) (bool, error) {
 	return !tp.failed.Get(), err
 }
 
-func (tp *taskPlugin) hashArtifact(name string, r io.ReadSeeker) error {
-	// Skip if no COT is to be generated
-	if !tp.createCOT {
-		return nil
+// uploadArtifact uploads r as the artifact name, compressing the content with
+// gzip if compress is true, and records hashes for chain-of-trust.
+func (tp *taskPlugin) uploadArtifact(
+	name, mimetype string, expires time.Time, r ioext.ReadSeekCloser, compress bool,
+) error {
+	// Compute artifact hash for chain-of-trust
+	var hashes cotArtifact
+	if tp.createCOT {
+		hash, err := hashStream(r)
+		if err != nil {
+			return err
+		}
+		hashes.Sha256 = hash
 	}
 
-	var err error
-	h := sha256.New()
-	if _, err = io.Copy(h, r); err != nil {
-		return errors.Wrap(err, "failed to hash artifact from reader")
-	}
-	if _, err = r.Seek(0, 0); err != nil {
-		return errors.Wrap(err, "failed to seek artifact reader to start")
+	var headers map[string]string
+	if compress {
+		compressed, err := tp.plugin.environment.TemporaryStorage.NewFile()
+		if err != nil {
+			return err
+		}
+		defer compressed.Close()
+
+		if err = gzipStream(compressed, r); err != nil {
+			return err
+		}
+		if tp.createCOT {
+			hash, herr := hashStream(compressed)
+			if herr != nil {
+				return herr
+			}
+			hashes.ContentEncoding = encodingGzip
+			hashes.CompressedSha256 = hash
+		}
+		r = compressed
+		headers = map[string]string{
+			"Content-Encoding": encodingGzip,
+		}
 	}
 
-	// Set artifact hash in uploaded for COT generation
-	tp.mUploaded.Lock()
-	defer tp.mUploaded.Unlock()
-	tp.uploaded[name] = h.Sum(nil)
+	err := tp.context.UploadS3Artifact(runtime.S3Artifact{
+		Name:              name,
+		Mimetype:          mimetype,
+		Stream:            r,
+		Expires:           expires,
+		AdditionalHeaders: headers,
+	})
+	if err != nil {
+		return err
+	}
 
+	// Set artifact hashes in uploaded for COT generation
+	if tp.createCOT {
+		tp.mUploaded.Lock()
+		defer tp.mUploaded.Unlock()
+		tp.uploaded[name] = hashes
+	}
 	return nil
 }
 
@@ -206,40 +291,10 @@ func (tp *taskPlugin) Finished(success bool) error {
 		}
 		defer r.Close()
 
-		// Compute artifact hash for chain-of-trust
-		if err = tp.hashArtifact(certifiedLogName, r); err != nil {
-			return err
-		}
-
-		compressed, err := tp.plugin.environment.TemporaryStorage.NewFile()
-		if err != nil {
-			return err
-		}
-		defer compressed.Close()
-
-		// Compress log
-		zipper := gzip.NewWriter(compressed)
-		if _, err = io.Copy(zipper, r); err != nil {
-			return errors.Wrap(err, "failed to compress log")
-		}
-		if err = zipper.Close(); err != nil {
-			return errors.Wrap(err, "failed to close compressing of log")
-		}
-		_, err = compressed.Seek(0, 0)
-		if err != nil {
-			return errors.Wrap(err, "Failed to seek to start of compressed log")
-		}
-
-		// Let's upload from compressed
-		err = tp.context.UploadS3Artifact(runtime.S3Artifact{
-			Name:     certifiedLogName,
-			Mimetype: "text/plain; charset=utf-8",
-			Stream:   compressed,
-			Expires:  tp.context.TaskInfo.Expires,
-			AdditionalHeaders: map[string]string{
-				"Content-Encoding": "gzip",
-			},
-		})
+		// Upload certified log, always compressed with gzip
+		err = tp.uploadArtifact(
+			certifiedLogName, "text/plain; charset=utf-8", tp.context.TaskInfo.Expires, r, true,
+		)
 		if err != nil {
 			err = errors.Wrap(err, "failed to upload certified.log")
 			tp.monitor.Error(err)
@@ -248,47 +303,66 @@ func (tp *taskPlugin) Finished(success bool) error {
 	}
 
 	COT := chainOfTrust{
-		Version:     1,
 		TaskID:      tp.context.TaskID,
 		RunID:       tp.context.RunID,
 		WorkerGroup: tp.plugin.environment.WorkerGroup,
 		WorkerID:    tp.plugin.environment.WorkerID,
-		Environment: map[string]interface{}{},
+		Environment: tp.plugin.cotEnvironment(tp.environment),
 		Task:        tp.context.Task,
 		Artifacts:   make(map[string]cotArtifact),
 	}
-	for name, hash := range tp.uploaded {
-		COT.Artifacts[name] = cotArtifact{
-			Sha256: hex.EncodeToString(hash),
-		}
-	}
-	data, err := json.MarshalIndent(COT, "", "  ")
-	if err != nil {
-		panic(errors.Wrap(err, "failed to serialize COT certificate"))
-	}
-	cot := bytes.NewBuffer(nil)
-	w, err := clearsign.Encode(cot, tp.plugin.privateKey.PrivateKey, nil)
-	if err != nil {
-		return errors.Wrap(err, "failed to setup signing of COT certificate")
+	for name, hashes := range tp.uploaded {
+		COT.Artifacts[name] = hashes
 	}
-	_, err = w.Write(data)
-	if err != nil {
-		return errors.Wrap(err, "failed to write COT certificate")
+
+	// Create clear-signed v1 certificate
+	if tp.plugin.privateKey != nil {
+		COT.Version = 1
+		data, err := json.MarshalIndent(COT, "", "  ")
+		if err != nil {
+			panic(errors.Wrap(err, "failed to serialize COT certificate"))
+		}
+		cot, err := tp.plugin.clearsignCertificate(data)
+		if err != nil {
+			return err
+		}
+		if err = tp.uploadCertificate(cotCertificateName, cot); err != nil {
+			return err
+		}
 	}
-	err = w.Close()
-	if err != nil {
-		return errors.Wrap(err, "failed to sign COT certificate")
+
+	// Create v2 certificate with detached ed25519 signature
+	if tp.plugin.signingKey != nil {
+		COT.Version = 2
+		data, err := json.MarshalIndent(COT, "", "  ")
+		if err != nil {
+			panic(errors.Wrap(err, "failed to serialize COT certificate"))
+		}
+		signature := ed25519.Sign(tp.plugin.signingKey, data)
+		if err = tp.uploadCertificate(cotV2CertificateName, data); err != nil {
+			return err
+		}
+		if err = tp.uploadCertificate(cotV2SignatureName, signature); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	const cotCertificateName = "public/chainOfTrust.json.asc"
-	err = tp.context.UploadS3Artifact(runtime.S3Artifact{
-		Name:     cotCertificateName,
-		Mimetype: "text/plain; charset=utf-8",
-		Stream:   ioext.NopCloser(bytes.NewReader(cot.Bytes())),
+// uploadCertificate uploads a chain-of-trust certificate or signature
+func (tp *taskPlugin) uploadCertificate(name string, data []byte) error {
+	mimetype := guessMimetype(name)
+	if name == cotCertificateName {
+		mimetype = "text/plain; charset=utf-8"
+	}
+	err := tp.context.UploadS3Artifact(runtime.S3Artifact{
+		Name:     name,
+		Mimetype: mimetype,
+		Stream:   ioext.NopCloser(bytes.NewReader(data)),
 		Expires:  tp.context.TaskInfo.Expires,
 	})
 	if err != nil {
-		err = errors.Wrap(err, "failed to upload COT certificate")
+		err = errors.Wrapf(err, "failed to upload COT certificate '%s'", name)
 		tp.monitor.Error(err)
 		return runtime.ErrNonFatalInternalError // We don't expect upload errors to be fatal
 	}
@@ -371,24 +445,12 @@ func (tp *taskPlugin) processFile(result engines.ResultSet, a artifact) {
 	}
 
 	// Guess the mimetype
-	mtype := mime.TypeByExtension(filepath.Ext(a.Path))
-	if mtype == "" {
-		mtype = mime.TypeByExtension(filepath.Ext(a.Name))
-	}
-	if mtype == "" {
-		mtype = unknownMimetype
-	}
+	mtype := guessMimetype(a.Path, a.Name)
 
-	// Compute artifact hash for chain-of-trust
-	if err = tp.hashArtifact(a.Name, r); err == nil {
-		// Let's upload from r
-		err = tp.context.UploadS3Artifact(runtime.S3Artifact{
-			Name:     a.Name,
-			Mimetype: mtype,
-			Stream:   r,
-			Expires:  a.Expires,
-		})
-	}
+	// Let's upload from r
+	err = tp.uploadArtifact(
+		a.Name, mtype, a.Expires, r, shouldCompress(a.ContentEncoding, mtype),
+	)
 
 	if err != nil && err != context.Canceled {
 		tp.nonFatalErr.Set(true)
@@ -399,12 +461,57 @@ func (tp *taskPlugin) processFile(result engines.ResultSet, a artifact) {
 
 func (tp *taskPlugin) processDirectory(result engines.ResultSet, a artifact) {
 	debug("extracting directory from path: %s", a.Path)
+
+	// Create archive, if directory is to be uploaded as a single artifact
+	var archive *tarArchive
+	if a.Format == formatTarGz {
+		var err error
+		archive, err = newTarArchive(tp.plugin.environment.TemporaryStorage)
+		if err != nil {
+			tp.nonFatalErr.Set(true)
+			i := tp.monitor.ReportError(err, "Failed to create archive for directory artifact")
+			tp.context.LogError("Failed to create archive unhandled error, incidentId:", i)
+			return
+		}
+		defer archive.Close()
+	}
+
+	filter := newFileFilter(a)
 	semaphore := make(chan struct{}, maxUploadConcurrency)
 	err := result.ExtractFolder(a.Path, func(p string, r ioext.ReadSeekCloser) error {
 		debug(" - Found artifact: %s in %s", p, a.Path)
 		// Always close the reader
 		defer r.Close()
 
+		// Skip files not matching include/exclude patterns
+		if !filter.Match(p) {
+			debug(" - Skipping %s in %s", p, a.Path)
+			return nil
+		}
+
+		// Enforce limits on number of files and total size
+		size, serr := streamSize(r)
+		if serr != nil {
+			tp.nonFatalErr.Set(true)
+			i := tp.monitor.ReportError(serr, "Failed to determine size of artifact")
+			tp.context.LogError("Failed to read artifact unhandled error, incidentId:", i)
+			return serr
+		}
+		if lerr := filter.Reserve(size); lerr != nil {
+			return lerr
+		}
+
+		// Add to archive, if we're uploading the directory as a single archive
+		if archive != nil {
+			if aerr := archive.Add(p, size, r); aerr != nil {
+				tp.nonFatalErr.Set(true)
+				i := tp.monitor.ReportError(aerr, "Failed to add file to archive")
+				tp.context.LogError("Failed to archive artifact unhandled error, incidentId:", i)
+				return aerr
+			}
+			return tp.context.Err()
+		}
+
 		// Block until we can write to semaphore, then read when we're done uploading
 		// This way the capacity o the semaphore channel limits concurrency.
 		select {
@@ -417,26 +524,16 @@ func (tp *taskPlugin) processDirectory(result engines.ResultSet, a artifact) {
 		}()
 
 		// Guess the mimetype
-		mtype := mime.TypeByExtension(filepath.Ext(p))
-		if mtype == "" {
-			mtype = unknownMimetype
-		}
+		mtype := guessMimetype(p)
 
 		// Construct artifact name
 		name := path.Join(a.Name, p)
 
-		var uerr error
-		// Compute artifact hash for chain-of-trust
-		if uerr = tp.hashArtifact(name, r); uerr == nil {
-			// Upload artifact
-			debug(" - Uploading %s from %s -> %s", p, a.Path, name)
-			uerr = tp.context.UploadS3Artifact(runtime.S3Artifact{
-				Name:     name,
-				Expires:  a.Expires,
-				Stream:   r,
-				Mimetype: mtype,
-			})
-		}
+		// Upload artifact
+		debug(" - Uploading %s from %s -> %s", p, a.Path, name)
+		uerr := tp.uploadArtifact(
+			name, mtype, a.Expires, r, shouldCompress(a.ContentEncoding, mtype),
+		)
 
 		// If we have an upload error, that's just a internal non-fatal error.
 		// We ignore the error, if TaskContext was canceled, as requests should be
@@ -478,6 +575,21 @@ func (tp *taskPlugin) processDirectory(result engines.ResultSet, a artifact) {
 		return
 	}
 
+	// If a limit was exceeded the task is failed, as the files wasn't uploaded
+	if lerr := filter.Exceeded(); lerr != nil {
+		tp.failed.Set(true)
+		tp.context.LogError(fmt.Sprintf(
+			"Directory artifact '%s' from '%s' exceeds limits: %s", a.Name, a.Path, lerr,
+		))
+		tp.context.CreateErrorArtifact(runtime.ErrorArtifact{
+			Name:    a.Name,
+			Reason:  reasonTooLarge,
+			Message: fmt.Sprintf("Folder at path: '%s' on worker exceeds limits: %s", a.Path, lerr),
+			Expires: a.Expires,
+		})
+		return
+	}
+
 	// If handler was interupted, then task was canceled or aborted...
 	if err == engines.ErrHandlerInterrupt {
 		tp.monitor.Debug("TaskContext cancellation interrupted artifact upload from folder")
@@ -515,4 +627,18 @@ func (tp *taskPlugin) processDirectory(result engines.ResultSet, a artifact) {
 		tp.context.LogError("Failed to extract artifact unhandled error, incidentId:", i)
 		return
 	}
+
+	// Upload archive, if directory is to be uploaded as a single archive
+	if archive != nil {
+		r, aerr := archive.Finish()
+		if aerr == nil {
+			debug(" - Uploading archive of %s -> %s", a.Path, a.Name)
+			aerr = tp.uploadArtifact(a.Name, tarGzMimetype, a.Expires, r, false)
+		}
+		if aerr != nil && aerr != context.Canceled {
+			tp.nonFatalErr.Set(true)
+			i := tp.monitor.ReportError(aerr, "Failed to upload archive artifact")
+			tp.context.LogError("Failed to upload artifact unhandled error, incidentId:", i)
+		}
+	}
 }
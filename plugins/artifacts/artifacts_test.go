@@ -1,12 +1,25 @@
 package artifacts
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ed25519"
+
 	"github.com/taskcluster/slugid-go/slugid"
 	"github.com/taskcluster/taskcluster-client-go/queue"
 	"github.com/taskcluster/taskcluster-worker/plugins/plugintest"
@@ -16,21 +29,82 @@ import (
 type artifactTestCase struct {
 	plugintest.Case
 	Artifacts []string
+	// Mapping from artifact to expected Content-Encoding, if given
+	Encodings map[string]string
+	// Mapping from tar.gz artifact to files expected in the archive
+	Archives map[string][]string
+	// Error artifacts expected to be created
+	ErrorArtifacts []string
+	// Artifacts for which the raw upload is given to AssertRaw
+	Raw       []string
+	AssertRaw func(uploads map[string][]byte)
 }
 
 func (a artifactTestCase) Test() {
 	taskID := slugid.Nice()
+	var m sync.Mutex
+	encodings := make(map[string]string)
+	archives := make(map[string][]string)
+	raws := make(map[string][]byte)
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+
+		// Capture raw artifacts
+		for _, raw := range a.Raw {
+			if raw == name {
+				data, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				m.Lock()
+				raws[name] = data
+				m.Unlock()
+				return
+			}
+		}
+
+		// Read the list of files from archive artifacts
+		if _, ok := a.Archives[name]; ok {
+			files, err := readArchive(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			m.Lock()
+			archives[name] = files
+			m.Unlock()
+			return
+		}
+
+		// Read the uploaded artifact, decompressing if needed
+		body := r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			body = zr
+		}
+		data, err := ioutil.ReadAll(body)
+		if err != nil || string(data) != "Hello World" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m.Lock()
+		encodings[name] = r.Header.Get("Content-Encoding")
+		m.Unlock()
 		fmt.Fprintln(w, "Hello, client.")
 	}))
 	defer ts.Close()
 
-	s3resp, _ := json.Marshal(queue.S3ArtifactResponse{
-		PutURL: ts.URL,
-	})
-	resp := queue.PostArtifactResponse(s3resp)
 	mockedQueue := &client.MockQueue{}
 	for _, path := range a.Artifacts {
+		s3resp, _ := json.Marshal(queue.S3ArtifactResponse{
+			PutURL: ts.URL + "/" + path,
+		})
+		resp := queue.PostArtifactResponse(s3resp)
 		mockedQueue.On(
 			"CreateArtifact",
 			taskID,
@@ -40,10 +114,78 @@ func (a artifactTestCase) Test() {
 		).Return(&resp, nil)
 	}
 
+	for _, path := range a.Raw {
+		s3resp, _ := json.Marshal(queue.S3ArtifactResponse{
+			PutURL: ts.URL + "/" + path,
+		})
+		resp := queue.PostArtifactResponse(s3resp)
+		mockedQueue.On(
+			"CreateArtifact",
+			taskID,
+			"0",
+			path,
+			client.PostS3ArtifactRequest,
+		).Return(&resp, nil)
+	}
+	for path := range a.Archives {
+		s3resp, _ := json.Marshal(queue.S3ArtifactResponse{
+			PutURL: ts.URL + "/" + path,
+		})
+		resp := queue.PostArtifactResponse(s3resp)
+		mockedQueue.On(
+			"CreateArtifact",
+			taskID,
+			"0",
+			path,
+			client.PostS3ArtifactRequest,
+		).Return(&resp, nil)
+	}
+	errorResp := queue.PostArtifactResponse(`{"storageType": "error"}`)
+	for _, path := range a.ErrorArtifacts {
+		mockedQueue.On(
+			"CreateArtifact",
+			taskID,
+			"0",
+			path,
+			client.PostAnyArtifactRequest,
+		).Return(&errorResp, nil)
+	}
+
 	a.Case.QueueMock = mockedQueue
 	a.Case.TaskID = taskID
 	a.Case.Test()
 	mockedQueue.AssertExpectations(a.Case.TestStruct)
+	if a.Encodings != nil {
+		require.Equal(a.Case.TestStruct, a.Encodings, encodings)
+	}
+	for name, files := range a.Archives {
+		require.Equal(a.Case.TestStruct, files, archives[name])
+	}
+	if a.AssertRaw != nil {
+		a.AssertRaw(raws)
+	}
+}
+
+// readArchive returns the sorted list of files in a tar.gz archive
+func readArchive(r io.Reader) ([]string, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(zr)
+	var files []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, hdr.Name)
+	}
+	sort.Strings(files)
+	return files, nil
 }
 
 func TestArtifactsNone(t *testing.T) {
@@ -130,3 +272,177 @@ func TestArtifactsDirectory(t *testing.T) {
 		},
 	}.Test()
 }
+
+func TestArtifactsContentEncoding(t *testing.T) {
+	artifactTestCase{
+		Artifacts: []string{
+			"public/blah.txt", "public/build.log", "public/data.json",
+			"public/data.bin", "public/image.png", "public/bar.json",
+			"public/forced.bin",
+		},
+		Encodings: map[string]string{
+			"public/blah.txt":   "gzip",
+			"public/build.log":  "gzip",
+			"public/data.json":  "gzip",
+			"public/data.bin":   "",
+			"public/image.png":  "",
+			"public/bar.json":   "",
+			"public/forced.bin": "gzip",
+		},
+		Case: plugintest.Case{
+			Payload: `{
+				"delay": 0,
+				"function": "write-files",
+				"argument": "/artifacts/blah.txt /artifacts/build.log /artifacts/data.json /artifacts/data.bin /artifacts/image.png /bar.json /forced.bin",
+				"artifacts": [
+					{
+						"type": "directory",
+						"path": "/artifacts",
+						"name": "public"
+					}, {
+						"type": "file",
+						"path": "/bar.json",
+						"name": "public/bar.json",
+						"contentEncoding": "identity"
+					}, {
+						"type": "file",
+						"path": "/forced.bin",
+						"name": "public/forced.bin",
+						"contentEncoding": "gzip"
+					}
+				]
+			}`,
+			Plugin:        "artifacts",
+			PluginConfig:  `{"contentEncoding": "auto"}`,
+			TestStruct:    t,
+			PluginSuccess: true,
+			EngineSuccess: true,
+		},
+	}.Test()
+}
+
+func TestArtifactsDirectoryPatterns(t *testing.T) {
+	artifactTestCase{
+		Artifacts: []string{"public/build/a.log", "public/build/x/y/b.log", "public/build/dist/app.zip"},
+		Case: plugintest.Case{
+			Payload: `{
+				"delay": 0,
+				"function": "write-files",
+				"argument": "/build/a.log /build/x/y/b.log /build/x/skip.log /build/x/c.txt /build/dist/app.zip /build/dist/sub/other.zip",
+				"artifacts": [
+					{
+						"type": "directory",
+						"path": "/build",
+						"name": "public/build",
+						"include": ["**/*.log", "dist/*.zip"],
+						"exclude": ["x/skip.log"]
+					}
+				]
+			}`,
+			Plugin:        "artifacts",
+			PluginConfig:  `{}`,
+			TestStruct:    t,
+			PluginSuccess: true,
+			EngineSuccess: true,
+		},
+	}.Test()
+}
+
+func TestArtifactsDirectoryTarGz(t *testing.T) {
+	artifactTestCase{
+		Archives: map[string][]string{
+			"public/build.tar.gz": {"a.txt", "x/b.txt"},
+		},
+		Case: plugintest.Case{
+			Payload: `{
+				"delay": 0,
+				"function": "write-files",
+				"argument": "/build/a.txt /build/x/b.txt /build/x/c.o",
+				"artifacts": [
+					{
+						"type": "directory",
+						"path": "/build",
+						"name": "public/build.tar.gz",
+						"exclude": ["**/*.o"],
+						"format": "tar.gz"
+					}
+				]
+			}`,
+			Plugin:        "artifacts",
+			PluginConfig:  `{}`,
+			TestStruct:    t,
+			PluginSuccess: true,
+			EngineSuccess: true,
+		},
+	}.Test()
+}
+
+func TestArtifactsDirectoryMaxFiles(t *testing.T) {
+	artifactTestCase{
+		ErrorArtifacts: []string{"public/build.tar.gz"},
+		Case: plugintest.Case{
+			Payload: `{
+				"delay": 0,
+				"function": "write-files",
+				"argument": "/build/a.txt /build/b.txt /build/c.txt",
+				"artifacts": [
+					{
+						"type": "directory",
+						"path": "/build",
+						"name": "public/build.tar.gz",
+						"maxFiles": 2,
+						"format": "tar.gz"
+					}
+				]
+			}`,
+			Plugin:        "artifacts",
+			PluginConfig:  `{}`,
+			TestStruct:    t,
+			PluginSuccess: false,
+			EngineSuccess: true,
+			MatchLog:      "exceeds limits",
+		},
+	}.Test()
+}
+
+func TestArtifactsChainOfTrustV2(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	artifactTestCase{
+		Artifacts: []string{"public/blah.txt"},
+		Raw:       []string{"public/chain-of-trust.json", "public/chain-of-trust.json.sig"},
+		AssertRaw: func(uploads map[string][]byte) {
+			data := uploads["public/chain-of-trust.json"]
+			signature := uploads["public/chain-of-trust.json.sig"]
+			require.True(t, ed25519.Verify(public, data, signature), "invalid signature")
+
+			var cot chainOfTrust
+			require.NoError(t, json.Unmarshal(data, &cot))
+			require.Equal(t, 2, cot.Version)
+			require.Equal(t, "mock", cot.Environment["engine"])
+			h := sha256.Sum256([]byte("Hello World"))
+			require.Equal(t, hex.EncodeToString(h[:]), cot.Artifacts["public/blah.txt"].Sha256)
+		},
+		Case: plugintest.Case{
+			Payload: `{
+				"delay": 0,
+				"function": "write-files",
+				"argument": "/artifacts/blah.txt",
+				"chainOfTrust": true,
+				"artifacts": [
+					{
+						"type": "file",
+						"path": "/artifacts/blah.txt",
+						"name": "public/blah.txt"
+					}
+				]
+			}`,
+			Plugin:        "artifacts",
+			PluginConfig:  `{"signingKey": "` + base64.StdEncoding.EncodeToString(private) + `"}`,
+			TestStruct:    t,
+			PluginSuccess: true,
+			EngineSuccess: true,
+		},
+	}.Test()
+}
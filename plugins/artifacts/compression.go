@@ -0,0 +1,135 @@
+package artifacts
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Content encoding policies for artifacts
+const (
+	encodingIdentity = "identity" // never compress
+	encodingGzip     = "gzip"     // compress unless the content is already compressed
+	encodingAuto     = "auto"     // compress content types known to be compressible
+)
+
+// compressibleMimetypes are compressed when contentEncoding is 'auto', in
+// addition to 'text/*' and mimetypes with a '+json' or '+xml' suffix.
+var compressibleMimetypes = map[string]bool{
+	"application/json":         true,
+	"application/xml":          true,
+	"application/javascript":   true,
+	"application/x-javascript": true,
+	"application/ecmascript":   true,
+	"application/x-sh":         true,
+	"application/x-tar":        true,
+	"application/x-ndjson":     true,
+	"application/yaml":         true,
+	"application/x-yaml":       true,
+	"image/svg+xml":            true,
+	"image/bmp":                true,
+}
+
+// compressedMimetypes are never compressed, as it would just waste CPU cycles.
+var compressedMimetypes = map[string]bool{
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/x-bzip2":          true,
+	"application/x-xz":             true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+	"application/zip":              true,
+	"application/zstd":             true,
+	"application/java-archive":     true,
+	"application/pdf":              true,
+}
+
+// extraMimetypes maps extensions that the mime package doesn't know about
+var extraMimetypes = map[string]string{
+	".log":  "text/plain; charset=utf-8",
+	".yml":  "application/yaml",
+	".yaml": "application/yaml",
+}
+
+// guessMimetype returns the mimetype from the extension of the first of the
+// given paths for which it is known.
+func guessMimetype(paths ...string) string {
+	for _, p := range paths {
+		ext := strings.ToLower(filepath.Ext(p))
+		if mtype := mime.TypeByExtension(ext); mtype != "" {
+			return mtype
+		}
+		if mtype, ok := extraMimetypes[ext]; ok {
+			return mtype
+		}
+	}
+	return unknownMimetype
+}
+
+// shouldCompress returns true, if content with given mimetype should be
+// gzip'ed under the given content encoding policy.
+func shouldCompress(encoding, mimetype string) bool {
+	mtype, _, err := mime.ParseMediaType(mimetype)
+	if err != nil {
+		mtype = strings.ToLower(mimetype)
+	}
+	switch encoding {
+	case encodingGzip:
+		return !isCompressed(mtype)
+	case encodingAuto:
+		return isCompressible(mtype)
+	default:
+		return false
+	}
+}
+
+func isCompressible(mtype string) bool {
+	return strings.HasPrefix(mtype, "text/") ||
+		strings.HasSuffix(mtype, "+json") ||
+		strings.HasSuffix(mtype, "+xml") ||
+		compressibleMimetypes[mtype]
+}
+
+func isCompressed(mtype string) bool {
+	return strings.HasPrefix(mtype, "image/") && !compressibleMimetypes[mtype] ||
+		strings.HasPrefix(mtype, "video/") ||
+		strings.HasPrefix(mtype, "audio/") ||
+		strings.HasSuffix(mtype, "+zip") ||
+		compressedMimetypes[mtype]
+}
+
+// hashStream returns the hex encoded sha256 of r and seeks r back to start
+func hashStream(r io.ReadSeeker) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", errors.Wrap(err, "failed to hash artifact from reader")
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", errors.Wrap(err, "failed to seek artifact reader to start")
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// gzipStream writes r to w compressed with gzip, then seeks both to start
+func gzipStream(w io.WriteSeeker, r io.ReadSeeker) error {
+	zipper := gzip.NewWriter(w)
+	if _, err := io.Copy(zipper, r); err != nil {
+		return errors.Wrap(err, "failed to compress artifact")
+	}
+	if err := zipper.Close(); err != nil {
+		return errors.Wrap(err, "failed to close compressing of artifact")
+	}
+	if _, err := w.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to seek to start of compressed artifact")
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to seek artifact reader to start")
+	}
+	return nil
+}
@@ -6,14 +6,17 @@ import (
 )
 
 type config struct {
-	PrivateKey string `json:"privateKey"`
+	PrivateKey      string `json:"privateKey"`
+	SigningKey      string `json:"signingKey"`
+	ContentEncoding string `json:"contentEncoding"`
 }
 
 var configSchema = schematypes.Object{
 	Title: "Artifact Configuration",
 	Description: util.Markdown(`
 		Configuration for artifact plugin. This is mostly COT (chain-of-trust)
-		configuration, such as private key.
+		configuration, such as private key, and the default content encoding
+		policy for artifacts.
 	`),
 	Properties: schematypes.Properties{
 		"privateKey": schematypes.String{
@@ -22,8 +25,46 @@ var configSchema = schematypes.Object{
 				GPG armoured private key (unencrypted) for signing chain-of-trust
 				certificates.
 
-				If not given, chain-of-trust signing will be disabled.
+				If given, chain-of-trust certificates will be clear-signed and
+				uploaded as 'public/chainOfTrust.json.asc' with
+				'chainOfTrustVersion: 1'.
 			`),
 		},
+		"signingKey": schematypes.String{
+			Title: "COT Signing Key",
+			Description: util.Markdown(`
+				Base64 encoded ed25519 private key for signing chain-of-trust
+				certificates, this can be either the 32 byte seed or the 64 byte
+				private key.
+
+				If given, chain-of-trust certificates will be uploaded as
+				'public/chain-of-trust.json' with 'chainOfTrustVersion: 2' and a
+				detached ed25519 signature uploaded as
+				'public/chain-of-trust.json.sig'.
+
+				If neither 'privateKey' nor 'signingKey' is given, chain-of-trust
+				certificates will be disabled.
+			`),
+		},
+		"contentEncoding": contentEncodingSchema,
 	},
 }
+
+var contentEncodingSchema = schematypes.StringEnum{
+	Title: "Content Encoding",
+	Description: util.Markdown(`
+		Policy for compressing artifacts before upload, compressed artifacts
+		are uploaded with 'Content-Encoding: gzip', which is transparently
+		decompressed by most HTTP clients.
+
+		 * 'identity', artifacts are uploaded as-is,
+		 * 'gzip', artifacts are compressed unless the mimetype indicates
+		   that they are already compressed (archives, images, video, etc.),
+		 * 'auto', artifacts are compressed if the mimetype indicates that
+		   they are compressible (text, json, xml, logs, etc.).
+
+		The policy given for an artifact in the task payload overrides the
+		policy from the plugin configuration, which defaults to 'identity'.
+	`),
+	Options: []string{encodingIdentity, encodingGzip, encodingAuto},
+}
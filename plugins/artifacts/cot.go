@@ -1,7 +1,33 @@
 package artifacts
 
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	goruntime "runtime"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/openpgp/clearsign"
+
+	"github.com/pkg/errors"
+)
+
+// Artifact names for chain-of-trust certificates
+const (
+	cotCertificateName   = "public/chainOfTrust.json.asc"   // v1, clear-signed with OpenPGP
+	cotV2CertificateName = "public/chain-of-trust.json"     // v2, signed with ed25519
+	cotV2SignatureName   = "public/chain-of-trust.json.sig" // v2, detached signature
+)
+
+// cotArtifact holds the hashes of an artifact, sha256 is always the hash of
+// the uncompressed content. If the artifact was uploaded with a
+// Content-Encoding the hash of the bytes stored is given as compressedSha256.
 type cotArtifact struct {
-	Sha256 string `json:"sha256"`
+	Sha256           string `json:"sha256"`
+	ContentEncoding  string `json:"contentEncoding,omitempty"`
+	CompressedSha256 string `json:"compressedSha256,omitempty"`
 }
 
 type chainOfTrust struct {
@@ -14,3 +40,75 @@ type chainOfTrust struct {
 	Task        interface{}            `json:"task"`
 	Artifacts   map[string]cotArtifact `json:"artifacts"`
 }
+
+// parseSigningKey parses a base64 encoded ed25519 private key, this may either
+// be the 32 byte seed or the 64 byte private key.
+func parseSigningKey(key string) (ed25519.PrivateKey, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, errors.Wrap(err, "signingKey must be base64 encoded")
+	}
+	switch len(data) {
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(data), nil
+	case 32: // seed
+		_, privateKey, err := ed25519.GenerateKey(bytes.NewReader(data))
+		return privateKey, err
+	default:
+		return nil, fmt.Errorf(
+			"signingKey must be a 32 byte seed or %d byte ed25519 private key, found %d bytes",
+			ed25519.PrivateKeySize, len(data),
+		)
+	}
+}
+
+// clearsignCertificate returns data clear-signed with an OpenPGP key
+func (p *plugin) clearsignCertificate(data []byte) ([]byte, error) {
+	cot := bytes.NewBuffer(nil)
+	w, err := clearsign.Encode(cot, p.privateKey.PrivateKey, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to setup signing of COT certificate")
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, errors.Wrap(err, "failed to write COT certificate")
+	}
+	if err = w.Close(); err != nil {
+		return nil, errors.Wrap(err, "failed to sign COT certificate")
+	}
+	return cot.Bytes(), nil
+}
+
+// cotEnvironment returns the environment section for chain-of-trust
+// certificates, engineEnvironment is the result of ResultSet.Environment(),
+// which may be nil.
+func (p *plugin) cotEnvironment(engineEnvironment map[string]interface{}) map[string]interface{} {
+	env := map[string]interface{}{
+		"engine":         p.engineName,
+		"workerVersion":  p.workerVersion,
+		"workerRevision": p.workerRevision,
+		"provisionerId":  p.environment.ProvisionerID,
+		"workerType":     p.environment.WorkerType,
+		"os":             goruntime.GOOS,
+		"arch":           goruntime.GOARCH,
+	}
+	if kernel := hostKernel(); kernel != "" {
+		env["hostKernel"] = kernel
+	}
+	// Engines may add properties, but not overwrite the ones set by the worker
+	for k, v := range engineEnvironment {
+		if _, ok := env[k]; !ok {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// hostKernel returns the kernel release of the host, or empty string if this
+// isn't available on the current platform.
+func hostKernel() string {
+	data, err := ioutil.ReadFile("/proc/sys/kernel/osrelease")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,141 @@
+package artifacts
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// fileFilter decides which files from a directory artifact should be uploaded
+// and enforces limits on the number of files and their total size.
+//
+// All methods are thread-safe, as ExtractFolder may call the handler
+// concurrently.
+type fileFilter struct {
+	include  []string
+	exclude  []string
+	maxFiles int   // zero, if unlimited
+	maxSize  int64 // zero, if unlimited
+	m        sync.Mutex
+	files    int
+	size     int64
+	exceeded error // limit error, if a limit was exceeded
+}
+
+func newFileFilter(a artifact) *fileFilter {
+	return &fileFilter{
+		include:  a.Include,
+		exclude:  a.Exclude,
+		maxFiles: a.MaxFiles,
+		maxSize:  a.MaxSize,
+	}
+}
+
+// Match returns true, if the file at the slash separated path p relative to
+// the directory should be included.
+func (f *fileFilter) Match(p string) bool {
+	included := len(f.include) == 0
+	for _, pattern := range f.include {
+		if matchGlob(pattern, p) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, pattern := range f.exclude {
+		if matchGlob(pattern, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// Reserve accounts for a file with given size, returning an error if this
+// exceeds maxFiles or maxSize. Once a limit has been exceeded all future calls
+// will return the same error.
+func (f *fileFilter) Reserve(size int64) error {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if f.exceeded != nil {
+		return f.exceeded
+	}
+	f.files++
+	f.size += size
+	if f.maxFiles != 0 && f.files > f.maxFiles {
+		f.exceeded = fmt.Errorf("directory contains more than %d files matching the filters", f.maxFiles)
+	}
+	if f.maxSize != 0 && f.size > f.maxSize {
+		f.exceeded = fmt.Errorf("files matching the filters are larger than %d bytes in total", f.maxSize)
+	}
+	return f.exceeded
+}
+
+// Exceeded returns the error from Reserve, if a limit was exceeded.
+func (f *fileFilter) Exceeded() error {
+	f.m.Lock()
+	defer f.m.Unlock()
+	return f.exceeded
+}
+
+// validateGlob returns an error if pattern is malformed
+func validateGlob(pattern string) error {
+	if pattern == "" || strings.HasPrefix(pattern, "/") {
+		return fmt.Errorf("glob pattern '%s' must be a non-empty relative path", pattern)
+	}
+	for _, segment := range strings.Split(pattern, "/") {
+		if segment == "**" {
+			continue
+		}
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("glob pattern '%s' is malformed", pattern)
+		}
+	}
+	return nil
+}
+
+// matchGlob returns true if the slash separated path p matches pattern.
+// Segments in the pattern are matched using path.Match, except for '**' which
+// matches zero or more directories.
+func matchGlob(pattern, p string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// streamSize returns the size of r and seeks r back to start
+func streamSize(r io.Seeker) (int64, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to seek to end of file")
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return 0, errors.Wrap(err, "failed to seek to start of file")
+	}
+	return size, nil
+}
@@ -0,0 +1,51 @@
+package artifacts
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"*.log", "a.log", true},
+		{"*.log", "x/a.log", false},
+		{"**/*.log", "a.log", true},
+		{"**/*.log", "x/y/a.log", true},
+		{"**/*.log", "x/y/a.txt", false},
+		{"dist/*.zip", "dist/app.zip", true},
+		{"dist/*.zip", "dist/sub/app.zip", false},
+		{"dist/**", "dist/sub/app.zip", true},
+		{"x/**/b.txt", "x/b.txt", true},
+		{"x/**/b.txt", "x/y/z/b.txt", true},
+		{"x/**/b.txt", "y/b.txt", false},
+		{"a?c/[0-9].txt", "abc/7.txt", true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.match, matchGlob(c.pattern, c.path), "matchGlob(%q, %q)", c.pattern, c.path)
+	}
+}
+
+func TestValidateGlob(t *testing.T) {
+	assert.NoError(t, validateGlob("**/*.log"))
+	assert.NoError(t, validateGlob("dist/[a-z]*.zip"))
+	assert.Error(t, validateGlob(""))
+	assert.Error(t, validateGlob("/abs/*.log"))
+	assert.Error(t, validateGlob("dist/[a-z.zip"))
+}
+
+func TestFileFilterLimits(t *testing.T) {
+	f := newFileFilter(artifact{MaxFiles: 2, MaxSize: 100})
+	assert.NoError(t, f.Reserve(40))
+	assert.NoError(t, f.Reserve(60))
+	assert.Error(t, f.Reserve(0))
+	assert.Error(t, f.Exceeded())
+
+	f = newFileFilter(artifact{MaxSize: 100})
+	assert.NoError(t, f.Reserve(100))
+	assert.Error(t, f.Reserve(1))
+}
@@ -1,9 +1,11 @@
 package artifacts
 
 import (
+	"math"
 	"time"
 
 	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime"
 	"github.com/taskcluster/taskcluster-worker/runtime/util"
 )
 
@@ -14,10 +16,16 @@ type payload struct {
 }
 
 type artifact struct {
-	Type    string    `json:"type"`
-	Path    string    `json:"path"`
-	Name    string    `json:"name"`
-	Expires time.Time `json:"expires"`
+	Type            string    `json:"type"`
+	Path            string    `json:"path"`
+	Name            string    `json:"name"`
+	Expires         time.Time `json:"expires"`
+	ContentEncoding string    `json:"contentEncoding"`
+	Include         []string  `json:"include"`
+	Exclude         []string  `json:"exclude"`
+	MaxFiles        int       `json:"maxFiles"`
+	MaxSize         int64     `json:"maxSize"`
+	Format          string    `json:"format"`
 }
 
 const (
@@ -25,6 +33,11 @@ const (
 	typeDirectory = "directory"
 )
 
+const (
+	formatFiles = "files"
+	formatTarGz = "tar.gz"
+)
+
 var artifactSchema = schematypes.Array{
 	Title:       "Artifacts",
 	Description: "Artifacts to be published",
@@ -58,7 +71,87 @@ var artifactSchema = schematypes.Array{
 				Title:       "Expiration Date",
 				Description: "",
 			},
+			"contentEncoding": contentEncodingSchema,
+			"include": schematypes.Array{
+				Title: "Include Patterns",
+				Description: util.Markdown(`
+					Glob patterns for files to include from a 'directory' artifact,
+					patterns are relative to 'path' and use '/' as separator. In
+					addition to the syntax supported by 'path.Match', the pattern '**'
+					matches zero or more directories, e.g. '**/*.log'.
+
+					If not given, all files in the directory are included.
+				`),
+				Items: schematypes.String{},
+			},
+			"exclude": schematypes.Array{
+				Title: "Exclude Patterns",
+				Description: util.Markdown(`
+					Glob patterns for files to exclude from a 'directory' artifact,
+					using the same syntax as 'include'. A file is excluded if it
+					matches any of these patterns, even if it matches an 'include'
+					pattern.
+				`),
+				Items: schematypes.String{},
+			},
+			"maxFiles": schematypes.Integer{
+				Title: "Maximum Number of Files",
+				Description: util.Markdown(`
+					Maximum number of files to upload from a 'directory' artifact,
+					the task is failed if more files match the patterns.
+				`),
+				Minimum: 1,
+				Maximum: math.MaxInt32,
+			},
+			"maxSize": schematypes.Integer{
+				Title: "Maximum Total Size",
+				Description: util.Markdown(`
+					Maximum total size in bytes of files to upload from a 'directory'
+					artifact, the task is failed if the files matching the patterns
+					are larger.
+				`),
+				Minimum: 1,
+				Maximum: math.MaxInt64,
+			},
+			"format": schematypes.StringEnum{
+				Title: "Directory Format",
+				Description: util.Markdown(`
+					Format for uploading a 'directory' artifact, by default each file
+					is uploaded as an artifact prefixed with 'name'. If 'tar.gz' is
+					given, the files are uploaded as a single tar.gz archive with the
+					artifact 'name'.
+				`),
+				Options: []string{formatFiles, formatTarGz},
+			},
 		},
 		Required: []string{"type", "path", "name"},
 	},
 }
+
+// validateArtifacts returns a MalformedPayloadError if glob patterns are
+// malformed, or directory options are given for a file artifact.
+func validateArtifacts(artifacts []artifact) error {
+	var errs []runtime.MalformedPayloadError
+	for _, a := range artifacts {
+		if a.Type == typeFile && (len(a.Include) > 0 || len(a.Exclude) > 0 ||
+			a.MaxFiles != 0 || a.MaxSize != 0 || a.Format != "") {
+			errs = append(errs, runtime.NewMalformedPayloadError(
+				"artifact '", a.Name, "' has type 'file', but 'include', 'exclude', ",
+				"'maxFiles', 'maxSize' and 'format' only apply to type 'directory'",
+			))
+		}
+		for _, patterns := range [][]string{a.Include, a.Exclude} {
+			for _, pattern := range patterns {
+				if err := validateGlob(pattern); err != nil {
+					errs = append(errs, runtime.NewMalformedPayloadError(
+						"artifact '", a.Name, "' has invalid pattern: ", err.Error(),
+					))
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return runtime.MergeMalformedPayload(errs...)
+	}
+	return nil
+}
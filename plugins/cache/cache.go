@@ -45,6 +45,7 @@ type taskPlugin struct {
 	monitor        runtime.Monitor
 	context        *runtime.TaskContext
 	payloadEntries []payloadEntry
+	onExitStatus   runtime.OnExitStatus
 	cacheHandles   []*caching.Handle // pointing to *cacheVolume
 	cachesError    error
 	cachesReady    atomics.Once
@@ -87,8 +88,17 @@ func (p *provider) NewPlugin(options plugins.PluginOptions) (plugins.Plugin, err
 }
 
 func (p *plugin) PayloadSchema() schematypes.Object {
+	// We implement 'onExitStatus.purgeCaches' as this plugin owns the caches,
+	// other properties of 'onExitStatus' are declared by other plugins.
 	return schematypes.Object{
 		Properties: schematypes.Properties{
+			"onExitStatus": runtime.OnExitStatusSchema(schematypes.Properties{
+				"purgeCaches": runtime.ExitCodesSchema("Purge Caches on Exit Codes", util.Markdown(`
+					List of exit codes for which the writable caches used by the
+					task should be purged, ensuring that subsequent tasks don't reuse
+					caches that may have been corrupted.
+				`)),
+			}),
 			"caches": schematypes.Array{
 				Items: schematypes.Object{
 					Properties: schematypes.Properties{
@@ -240,7 +250,8 @@ func (p *plugin) PurgeCacheAsNeeded(ctx *runtime.TaskContext) {
 
 func (p *plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskPlugin, error) {
 	var P struct {
-		Caches []payloadEntry `json:"caches"`
+		Caches       []payloadEntry       `json:"caches"`
+		OnExitStatus runtime.OnExitStatus `json:"onExitStatus"`
 	}
 	schematypes.MustValidateAndMap(p.PayloadSchema(), options.Payload, &P)
 
@@ -249,6 +260,7 @@ func (p *plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskP
 		monitor:        options.Monitor,
 		context:        options.TaskContext,
 		payloadEntries: P.Caches,
+		onExitStatus:   P.OnExitStatus,
 	}
 	go tp.cachesReady.Do(tp.getCaches)
 
@@ -377,6 +389,54 @@ func (tp *taskPlugin) BuildSandbox(sandboxBuilder engines.SandboxBuilder) error
 	return nil
 }
 
+func (tp *taskPlugin) Stopped(result engines.ResultSet) (bool, error) {
+	if result.Success() || len(tp.onExitStatus.PurgeCaches) == 0 {
+		return true, nil
+	}
+
+	// The exitstatus plugin reports if ExitStatus() isn't supported
+	status, err := result.ExitStatus()
+	if err != nil {
+		debug("not purging caches, failed to get exit status, error: %s", err)
+		return true, nil
+	}
+	if !tp.onExitStatus.ShouldPurgeCaches(status.Code) {
+		return true, nil
+	}
+
+	// Find writable caches used by the task, read-only caches can't have been
+	// modified by the task, so we don't purge those.
+	var resources []caching.Resource
+	for i, entry := range tp.payloadEntries {
+		if entry.Name != "" && tp.cacheHandles[i] != nil {
+			resources = append(resources, tp.cacheHandles[i].Resource())
+		}
+	}
+	if len(resources) == 0 {
+		return true, nil
+	}
+
+	tp.context.Log(fmt.Sprintf(
+		"Task exited with exit code %d which is listed in task.payload.onExitStatus.purgeCaches, caches used by the task will be purged",
+		status.Code,
+	))
+	err = tp.plugin.exclusiveCache.Purge(func(r caching.Resource) bool {
+		for _, resource := range resources {
+			if r == resource {
+				tp.monitor.Infof("purging cache: '%s'", r.(*cacheVolume).Name)
+				return true
+			}
+		}
+		return false
+	})
+	if err != nil {
+		incidentID := tp.monitor.ReportError(err, "failed to purge caches")
+		tp.context.LogError("Failed to purge caches, incidentId:", incidentID)
+		return true, runtime.ErrNonFatalInternalError
+	}
+	return true, nil
+}
+
 func (tp *taskPlugin) Dispose() error {
 	tp.cachesReady.Wait()
 	tp.cachesDisposed.Do(func() {
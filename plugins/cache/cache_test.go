@@ -18,6 +18,7 @@ import (
 	"github.com/taskcluster/taskcluster-worker/worker/workertest"
 
 	_ "github.com/taskcluster/taskcluster-worker/engines/mock"
+	_ "github.com/taskcluster/taskcluster-worker/plugins/exitstatus"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/livelog"
 	_ "github.com/taskcluster/taskcluster-worker/plugins/success"
 )
@@ -456,3 +457,129 @@ func TestPurgeCache(t *testing.T) {
 		},
 	}.TestWithFakeQueue(t) // TODO: Resolve scope issues and test against real queue
 }
+
+func TestPurgeCachesOnExitStatus(t *testing.T) {
+	workertest.Case{
+		Concurrency:  0, // runs tasks sequentially
+		Engine:       "mock",
+		EngineConfig: `{}`,
+		PluginConfig: `{
+			"disabled": [],
+			"success": {},
+			"livelog": {},
+			"exitstatus": {},
+			"cache": {}
+		}`,
+		Tasks: []workertest.Task{
+			{
+				Title:  "Write hello-world to empty cache volume",
+				Scopes: []string{"worker:cache:dummy-garbage-my-cache-name"},
+				Payload: `{
+					"delay": 5,
+					"function": "write-volume",
+					"argument": "my-mount-point/my-folder/my-file.txt:hello-world",
+					"caches": [
+						{
+							"name": "dummy-garbage-my-cache-name",
+							"mountPoint": "my-mount-point",
+							"options": {}
+						}
+					]
+				}`,
+				AllowAdditional: true,
+				Success:         true,
+			},
+			{
+				Title:  "Exit with exit code not listed in purgeCaches",
+				Scopes: []string{"worker:cache:dummy-garbage-my-cache-name"},
+				Payload: `{
+					"delay": 5,
+					"function": "exit",
+					"argument": "2",
+					"caches": [
+						{
+							"name": "dummy-garbage-my-cache-name",
+							"mountPoint": "my-mount-point",
+							"options": {}
+						}
+					],
+					"onExitStatus": {
+						"purgeCaches": [3]
+					}
+				}`,
+				Artifacts: workertest.ArtifactAssertions{
+					"public/logs/live_backing.log": workertest.NotGrepArtifact("caches used by the task will be purged"),
+				},
+				AllowAdditional: true,
+				Success:         false,
+			},
+			{
+				Title:  "Read from cache volume",
+				Scopes: []string{"worker:cache:dummy-garbage-my-cache-name"},
+				Payload: `{
+					"delay": 5,
+					"function": "read-volume",
+					"argument": "some-mount-point/my-folder/my-file.txt",
+					"caches": [
+						{
+							"name": "dummy-garbage-my-cache-name",
+							"mountPoint": "some-mount-point",
+							"options": {}
+						}
+					]
+				}`,
+				Artifacts: workertest.ArtifactAssertions{
+					"public/logs/live_backing.log": workertest.GrepArtifact("hello-world"),
+				},
+				AllowAdditional: true,
+				Success:         true,
+			},
+			{
+				Title:  "Exit with exit code listed in purgeCaches",
+				Scopes: []string{"worker:cache:dummy-garbage-my-cache-name"},
+				Payload: `{
+					"delay": 5,
+					"function": "exit",
+					"argument": "3",
+					"caches": [
+						{
+							"name": "dummy-garbage-my-cache-name",
+							"mountPoint": "my-mount-point",
+							"options": {}
+						}
+					],
+					"onExitStatus": {
+						"retry": [4],
+						"purgeCaches": [3]
+					}
+				}`,
+				Artifacts: workertest.ArtifactAssertions{
+					"public/logs/live_backing.log": workertest.GrepArtifact("caches used by the task will be purged"),
+				},
+				AllowAdditional: true,
+				Success:         false,
+			},
+			{
+				Title:  "Read from cache volume after purge",
+				Scopes: []string{"worker:cache:dummy-garbage-my-cache-name"},
+				Payload: `{
+					"delay": 5,
+					"function": "read-volume",
+					"argument": "some-mount-point/my-folder/my-file.txt",
+					"caches": [
+						{
+							"name": "dummy-garbage-my-cache-name",
+							"mountPoint": "some-mount-point",
+							"options": {}
+						}
+					]
+				}`,
+				Artifacts: workertest.ArtifactAssertions{
+					"public/logs/live_backing.log": workertest.NotGrepArtifact("hello-world"),
+				},
+				AllowAdditional: true,
+				Success:         false,
+			},
+		},
+	}.TestWithFakeQueue(t) // TODO: Resolve scope issues and test against real queue
+}
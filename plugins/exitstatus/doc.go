@@ -0,0 +1,12 @@
+// Package exitstatus provides a plugin for taskcluster-worker which resolves
+// tasks as exception with reason 'intermittent-task', if the task command
+// exits with an exit code listed in 'task.payload.onExitStatus.retry'. This
+// causes the queue to rerun the task, if the task has retries left.
+//
+// The 'onExitStatus.purgeCaches' property is declared and implemented by the
+// cache plugin, as the cache plugin owns the caches the task used.
+package exitstatus
+
+import "github.com/taskcluster/taskcluster-worker/runtime/util"
+
+var debug = util.Debug("exitstatus")
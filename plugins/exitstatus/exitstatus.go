@@ -0,0 +1,84 @@
+package exitstatus
+
+import (
+	"fmt"
+
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/plugins"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+type provider struct {
+	plugins.PluginProviderBase
+}
+
+type plugin struct {
+	plugins.PluginBase
+}
+
+type taskPlugin struct {
+	plugins.TaskPluginBase
+	onExitStatus runtime.OnExitStatus
+	context      *runtime.TaskContext
+	monitor      runtime.Monitor
+}
+
+func init() {
+	plugins.Register("exitstatus", provider{})
+}
+
+func (provider) NewPlugin(plugins.PluginOptions) (plugins.Plugin, error) {
+	return plugin{}, nil
+}
+
+func (plugin) PayloadSchema() schematypes.Object {
+	return payloadSchema
+}
+
+func (plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskPlugin, error) {
+	var P payload
+	schematypes.MustValidateAndMap(payloadSchema, options.Payload, &P)
+
+	if len(P.OnExitStatus.Retry) == 0 {
+		return plugins.TaskPluginBase{}, nil
+	}
+
+	return &taskPlugin{
+		onExitStatus: P.OnExitStatus,
+		context:      options.TaskContext,
+		monitor:      options.Monitor,
+	}, nil
+}
+
+func (tp *taskPlugin) Stopped(result engines.ResultSet) (bool, error) {
+	// Exit codes are ignored, if the task was successful
+	if result.Success() {
+		return true, nil
+	}
+
+	status, err := result.ExitStatus()
+	switch err {
+	case nil:
+	case engines.ErrFeatureNotSupported:
+		return false, runtime.NewMalformedPayloadError(
+			"task.payload.onExitStatus.retry is not supported in current configuration of this workerType",
+		)
+	case engines.ErrResourceNotFound:
+		debug("exit status is unknown, the task command didn't exit by itself")
+		return true, nil
+	default:
+		incidentID := tp.monitor.ReportError(err, "ResultSet.ExitStatus() failed")
+		tp.context.LogError("Failed to read exit status of task, incidentId:", incidentID)
+		return false, runtime.ErrNonFatalInternalError
+	}
+
+	if !tp.onExitStatus.ShouldRetry(status.Code) {
+		return true, nil
+	}
+	tp.context.Log(fmt.Sprintf(
+		"Task exited with exit code %d which is listed in task.payload.onExitStatus.retry, the task will be retried",
+		status.Code,
+	))
+	return false, runtime.ErrIntermittentTask
+}
@@ -0,0 +1,71 @@
+package exitstatus
+
+import (
+	"testing"
+
+	"github.com/taskcluster/taskcluster-worker/plugins/plugintest"
+)
+
+func TestExitStatusRetry(t *testing.T) {
+	plugintest.Case{
+		Payload: `{
+			"delay": 0,
+			"function": "exit",
+			"argument": "3",
+			"onExitStatus": {
+				"retry": [2, 3]
+			}
+		}`,
+		Plugin:           "exitstatus",
+		EngineSuccess:    false,
+		IntermittentTask: true,
+		MatchLog:         "exit code 3 .* will be retried",
+	}.Test()
+}
+
+func TestExitStatusNotListed(t *testing.T) {
+	plugintest.Case{
+		Payload: `{
+			"delay": 0,
+			"function": "exit",
+			"argument": "4",
+			"onExitStatus": {
+				"retry": [2, 3]
+			}
+		}`,
+		Plugin:        "exitstatus",
+		PluginSuccess: true,
+		EngineSuccess: false,
+		NotMatchLog:   "will be retried",
+	}.Test()
+}
+
+func TestExitStatusSuccess(t *testing.T) {
+	plugintest.Case{
+		Payload: `{
+			"delay": 0,
+			"function": "exit",
+			"argument": "0",
+			"onExitStatus": {
+				"retry": [0]
+			}
+		}`,
+		Plugin:        "exitstatus",
+		PluginSuccess: true,
+		EngineSuccess: true,
+		NotMatchLog:   "will be retried",
+	}.Test()
+}
+
+func TestExitStatusNoPayload(t *testing.T) {
+	plugintest.Case{
+		Payload: `{
+			"delay": 0,
+			"function": "false",
+			"argument": ""
+		}`,
+		Plugin:        "exitstatus",
+		PluginSuccess: true,
+		EngineSuccess: false,
+	}.Test()
+}
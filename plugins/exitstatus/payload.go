@@ -0,0 +1,25 @@
+package exitstatus
+
+import (
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+type payload struct {
+	OnExitStatus runtime.OnExitStatus `json:"onExitStatus"`
+}
+
+// payloadSchema declares 'onExitStatus.retry', other properties of
+// 'onExitStatus' are declared by the plugins implementing them.
+var payloadSchema = schematypes.Object{
+	Properties: schematypes.Properties{
+		"onExitStatus": runtime.OnExitStatusSchema(schematypes.Properties{
+			"retry": runtime.ExitCodesSchema("Retry on Exit Codes", util.Markdown(`
+				List of exit codes for which the task should be resolved as
+				exception with reason 'intermittent-task', causing the task to
+				be retried, if it has retries left.
+			`)),
+		}),
+	},
+}
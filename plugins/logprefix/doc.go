@@ -1,6 +1,8 @@
 // Package logprefix provides a taskcluster-worker plugin that prefixes all
 // task logs with useful debug information such as taskId, workerType, as well
-// as configurable constants.
+// as configurable constants. When the task command has stopped, the exit code
+// and resource usage of the command is appended to the task log, if the engine
+// supports it.
 package logprefix
 
 import "github.com/taskcluster/taskcluster-worker/runtime/util"
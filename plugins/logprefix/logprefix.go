@@ -11,7 +11,9 @@ import (
 	"github.com/shirou/gopsutil/host"
 	schematypes "github.com/taskcluster/go-schematypes"
 	"github.com/taskcluster/taskcluster-worker/commands/version"
+	"github.com/taskcluster/taskcluster-worker/engines"
 	"github.com/taskcluster/taskcluster-worker/plugins"
+	"github.com/taskcluster/taskcluster-worker/runtime"
 )
 
 type provider struct {
@@ -25,6 +27,11 @@ type plugin struct {
 	taskCount int64 // Count number of tasks processed
 }
 
+type taskPlugin struct {
+	plugins.TaskPluginBase
+	context *runtime.TaskContext
+}
+
 func init() {
 	plugins.Register("logprefix", provider{})
 }
@@ -102,8 +109,36 @@ func (p *plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskP
 		options.TaskContext.Log(fmt.Sprintf("%s: %s", k, v))
 	}
 
-	// Return a plugin that does nothing
-	return plugins.TaskPluginBase{}, nil
+	return &taskPlugin{context: options.TaskContext}, nil
+}
+
+func (tp *taskPlugin) Stopped(result engines.ResultSet) (bool, error) {
+	// Print exit status and resource usage of the task command as log footer
+	status, err := result.ExitStatus()
+	if err == nil {
+		if status.Signal != "" {
+			tp.context.Log(fmt.Sprintf("signal: %s", status.Signal))
+		} else {
+			tp.context.Log(fmt.Sprintf("exitCode: %d", status.Code))
+		}
+	} else {
+		debug("exit status not available, error: %s", err)
+	}
+
+	usage, err := result.ResourceUsage()
+	if err != nil {
+		debug("resource usage not available, error: %s", err)
+		return true, nil
+	}
+	tp.context.Log(fmt.Sprintf("wallTime: %s", usage.WallTime.Round(time.Millisecond)))
+	if usage.UserTime != 0 || usage.SystemTime != 0 {
+		tp.context.Log(fmt.Sprintf("userTime: %s", usage.UserTime.Round(time.Millisecond)))
+		tp.context.Log(fmt.Sprintf("systemTime: %s", usage.SystemTime.Round(time.Millisecond)))
+	}
+	if usage.MaxMemory != 0 {
+		tp.context.Log(fmt.Sprintf("maxMemory: %.1f MiB", float64(usage.MaxMemory)/(1024*1024)))
+	}
+	return true, nil
 }
 
 func stringContains(list []string, element string) bool {
@@ -92,3 +92,33 @@ func TestLogPrefixOverwriteBuiltin(*testing.T) {
 		NotMatchLog:   "Ghv98GSxQL2dR7eD8hXbMw",
 	}.Test()
 }
+
+func TestLogPrefixExitStatus(*testing.T) {
+	plugintest.Case{
+		Payload: `{
+			"delay": 0,
+			"function": "exit",
+			"argument": "3"
+		}`,
+		PluginConfig:  `{}`,
+		Plugin:        "logprefix",
+		PluginSuccess: true,
+		EngineSuccess: false,
+		MatchLog:      "exitCode: 3",
+	}.Test()
+}
+
+func TestLogPrefixResourceUsage(*testing.T) {
+	plugintest.Case{
+		Payload: `{
+			"delay": 0,
+			"function": "true",
+			"argument": ""
+		}`,
+		PluginConfig:  `{}`,
+		Plugin:        "logprefix",
+		PluginSuccess: true,
+		EngineSuccess: true,
+		MatchLog:      "wallTime: ",
+	}.Test()
+}
@@ -0,0 +1,68 @@
+package plugins
+
+import (
+	"fmt"
+	"reflect"
+
+	schematypes "github.com/taskcluster/go-schematypes"
+)
+
+// mergePayloadSchemas merges payload schemas from plugins like
+// schematypes.Merge, except that a property declared as an object by multiple
+// plugins is merged too. This allows plugins to implement different properties
+// of the same object, such as 'onExitStatus'. The metadata of merged objects
+// is taken from the first declaration.
+func mergePayloadSchemas(schemas ...schematypes.Object) (schematypes.Object, error) {
+	result := schematypes.Object{
+		Properties: schematypes.Properties{},
+		Required:   []string{},
+	}
+	for _, s := range schemas {
+		if s.AdditionalProperties {
+			return schematypes.Object{}, fmt.Errorf("AdditionalProperties is true for %#v", s)
+		}
+		for k, schema := range s.Properties {
+			existing, ok := result.Properties[k]
+			if !ok || reflect.DeepEqual(schema, existing) {
+				result.Properties[k] = schema
+				continue
+			}
+			a, aok := existing.(schematypes.Object)
+			b, bok := schema.(schematypes.Object)
+			if !aok || !bok {
+				return schematypes.Object{}, fmt.Errorf(
+					"The key '%s' is defined with different schemas %#v and %#v",
+					k, schema, existing,
+				)
+			}
+			merged, err := mergePayloadSchemas(a, b)
+			if err != nil {
+				return schematypes.Object{}, fmt.Errorf("In key '%s': %s", k, err)
+			}
+			merged.Title = a.Title
+			merged.Description = a.Description
+			result.Properties[k] = merged
+		}
+
+		for _, k := range s.Required {
+			if !stringContains(result.Required, k) {
+				result.Required = append(result.Required, k)
+			}
+		}
+	}
+	return result, nil
+}
+
+// filterPayload returns the properties of payload declared in schema, like
+// schema.Filter(payload), but also filters properties of nested objects, see
+// mergePayloadSchemas().
+func filterPayload(schema schematypes.Object, payload map[string]interface{}) map[string]interface{} {
+	value := schema.Filter(payload)
+	for k, v := range value {
+		s, ok := schema.Properties[k].(schematypes.Object)
+		if m, isMap := v.(map[string]interface{}); ok && isMap {
+			value[k] = filterPayload(s, m)
+		}
+	}
+	return value
+}
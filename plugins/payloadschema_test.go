@@ -0,0 +1,61 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	schematypes "github.com/taskcluster/go-schematypes"
+)
+
+func TestMergePayloadSchemas(t *testing.T) {
+	a := schematypes.Object{
+		Properties: schematypes.Properties{
+			"count": schematypes.Integer{Maximum: 255},
+			"onExitStatus": schematypes.Object{
+				Properties: schematypes.Properties{
+					"retry": schematypes.Array{Items: schematypes.Integer{Maximum: 255}},
+				},
+			},
+		},
+		Required: []string{"count"},
+	}
+	b := schematypes.Object{
+		Properties: schematypes.Properties{
+			"count": schematypes.Integer{Maximum: 255},
+			"onExitStatus": schematypes.Object{
+				Properties: schematypes.Properties{
+					"purgeCaches": schematypes.Array{Items: schematypes.Integer{Maximum: 255}},
+				},
+			},
+		},
+	}
+	schema, err := mergePayloadSchemas(a, b)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"count"}, schema.Required)
+
+	payload := map[string]interface{}{
+		"count": 1,
+		"onExitStatus": map[string]interface{}{
+			"retry":       []interface{}{1},
+			"purgeCaches": []interface{}{2},
+		},
+	}
+	require.NoError(t, schema.Validate(payload))
+
+	// Each plugin gets the properties it declared
+	filtered := filterPayload(b, payload)
+	require.NoError(t, b.Validate(filtered))
+	assert.Equal(t, map[string]interface{}{
+		"purgeCaches": []interface{}{2},
+	}, filtered["onExitStatus"])
+	require.NoError(t, a.Validate(filterPayload(a, payload)))
+
+	// Conflicting declarations can't be merged
+	_, err = mergePayloadSchemas(a, schematypes.Object{
+		Properties: schematypes.Properties{
+			"count": schematypes.String{},
+		},
+	})
+	assert.Error(t, err)
+}
@@ -40,8 +40,10 @@ type Plugin interface {
 	// for the TaskPluginOptions.Payload property.
 	//
 	// Note: this will be merged with payload schemas from engine and other
-	// plugins, thus, it cannot contain conflicting properties. Furthermore the
-	// metadata will be discarded and additionalProperties will not be allowed.
+	// plugins, thus, it cannot contain conflicting properties, except objects
+	// which are merged with objects other plugins declare for the same property.
+	// Furthermore the metadata will be discarded and additionalProperties will
+	// not be allowed.
 	PayloadSchema() schematypes.Object
 
 	// NewTaskPlugin method will be called once for each task. The TaskPlugin
@@ -119,7 +121,11 @@ type TaskPlugin interface {
 	// This is the place to wait for downloads and other expensive operations to
 	// finished, before mounting caches, proxies, etc. and returning.
 	//
-	// Non-fatal errors: MalformedPayloadError
+	// Plugins that have published the result of a previous run for the task may
+	// return ErrTaskResultReused, in which case the sandbox is not started and
+	// the Started() and Stopped() stages are skipped.
+	//
+	// Non-fatal errors: MalformedPayloadError, ErrTaskResultReused
 	BuildSandbox(sandboxBuilder engines.SandboxBuilder) error
 
 	// Started is called once the sandbox has started execution. This is a good
@@ -180,6 +180,9 @@ func NewPluginManager(options PluginOptions) (*PluginManager, error) {
 			plugins[i], errors[i] = pluginProviders[name].NewPlugin(PluginOptions{
 				Environment: options.Environment,
 				Engine:      options.Engine,
+				EngineName:  options.EngineName,
+				Version:     options.Version,
+				Revision:    options.Revision,
 				Monitor:     monitors[i],
 				Config:      config[name],
 			})
@@ -211,7 +214,7 @@ func NewPluginManager(options PluginOptions) (*PluginManager, error) {
 	for _, plugin := range plugins {
 		schemas = append(schemas, plugin.PayloadSchema())
 	}
-	schema, err := schematypes.Merge(schemas...)
+	schema, err := mergePayloadSchemas(schemas...)
 	if err != nil {
 		return nil, fmt.Errorf("Conflicting payload schema types, error: %s", err)
 	}
@@ -336,7 +339,7 @@ func (pm *PluginManager) NewTaskPlugin(options TaskPluginOptions) (TaskPlugin, e
 
 	// Create taskPlugins
 	err := m.spawnEachPlugin("NewTaskPlugin", func(i int) error {
-		payload := pm.plugins[i].PayloadSchema().Filter(options.Payload)
+		payload := filterPayload(pm.plugins[i].PayloadSchema(), options.Payload)
 		nerr := pm.plugins[i].PayloadSchema().Validate(payload)
 		if nerr != nil {
 			// Ensure that we always have a taskPlugin, even if we get an error.
@@ -381,8 +384,9 @@ func (m *taskPluginManager) spawnEachPlugin(hook string, fn func(i int) error) e
 			errors[i] = fn(i)
 		})
 		if _, ok := runtime.IsMalformedPayloadError(errors[i]); !ok && errors[i] != nil {
-			// Both of these errors assumes that the error has been logged and recorded
-			if errors[i] != runtime.ErrFatalInternalError && errors[i] != runtime.ErrNonFatalInternalError {
+			// These errors assumes that the error has been logged and recorded
+			if errors[i] != runtime.ErrFatalInternalError && errors[i] != runtime.ErrNonFatalInternalError &&
+				errors[i] != runtime.ErrIntermittentTask && errors[i] != runtime.ErrTaskResultReused {
 				incidentID = monitor.ReportError(errors[i], "Unhandled error during ", hook, " hook")
 			}
 		}
@@ -396,6 +400,8 @@ func (m *taskPluginManager) spawnEachPlugin(hook string, fn func(i int) error) e
 	// payload errors
 	fatalErr := false
 	nonFatalErr := false
+	intermittentErr := false
+	reusedErr := false
 	malformedErrs := []runtime.MalformedPayloadError{}
 	for _, err := range errors {
 		if err == runtime.ErrFatalInternalError {
@@ -404,12 +410,24 @@ func (m *taskPluginManager) spawnEachPlugin(hook string, fn func(i int) error) e
 		if err == runtime.ErrNonFatalInternalError {
 			nonFatalErr = true
 		}
+		if err == runtime.ErrIntermittentTask {
+			intermittentErr = true
+		}
+		if err == runtime.ErrTaskResultReused {
+			reusedErr = true
+		}
 		if e, ok := runtime.IsMalformedPayloadError(err); ok {
 			malformedErrs = append(malformedErrs, e)
 		}
 	}
 
 	var err error
+	if reusedErr {
+		err = runtime.ErrTaskResultReused
+	}
+	if intermittentErr {
+		err = runtime.ErrIntermittentTask
+	}
 	if nonFatalErr {
 		err = runtime.ErrNonFatalInternalError
 	}
@@ -417,7 +435,8 @@ func (m *taskPluginManager) spawnEachPlugin(hook string, fn func(i int) error) e
 		err = runtime.ErrFatalInternalError
 	}
 	if len(malformedErrs) > 0 {
-		if err == nil {
+		// Retrying won't fix a malformed payload, so it takes precedence
+		if err == nil || err == runtime.ErrIntermittentTask || err == runtime.ErrTaskResultReused {
 			err = runtime.MergeMalformedPayload(malformedErrs...)
 		} else {
 			m.context.LogError("Encountered an unhandled worker error, along with malformed payload errors")
@@ -22,6 +22,9 @@ var (
 type PluginOptions struct {
 	Environment *runtime.Environment
 	Engine      engines.Engine
+	EngineName  string // Name of the engine, as given in worker config
+	Version     string // Version of the worker, empty if not a release build
+	Revision    string // Revision of the worker, empty if not known
 	Monitor     runtime.Monitor
 	Config      interface{}
 }
@@ -70,6 +70,8 @@ type Case struct {
 	TestStruct *testing.T // TODO: Remove this and make it an argument for .Test(t)
 	// If true, the sandbox is expected to be aborted
 	SandboxAbort bool
+	// If true, plugin.Stopped() is expected to return ErrIntermittentTask
+	IntermittentTask bool
 	// If true, requires that the plugin called StopNow
 	StoppedNow bool
 	// If true, requires that the plugin called StopGracefully
@@ -155,6 +157,7 @@ func (c Case) Test() {
 	p, err := provider.NewPlugin(plugins.PluginOptions{
 		Environment: &pluginEnv,
 		Engine:      engine,
+		EngineName:  "mock",
 		Monitor:     runtimeEnvironment.Monitor.WithTag("plugin", c.Plugin),
 		Config:      parsePluginConfig(provider, c.PluginConfig),
 	})
@@ -236,10 +239,18 @@ func (c Case) Test() {
 			nilOrPanic(err, "sandbox.WaitForResult failed")
 			assert(resultSet.Success() == c.EngineSuccess, "expected resultSet.Success(): ", c.EngineSuccess)
 			success, err = tp.Stopped(resultSet)
-			nilOrPanic(err, "taskPlugin.Stopped failed")
-			assert(success == c.PluginSuccess)
+			if c.IntermittentTask {
+				assert(err == runtime.ErrIntermittentTask, "Expected taskPlugin.Stopped to return ErrIntermittentTask")
+				reason = runtime.ReasonIntermittentTask
+			} else {
+				nilOrPanic(err, "taskPlugin.Stopped failed")
+				assert(success == c.PluginSuccess)
+			}
 			c.maybeRun(c.AfterStopped, options)
 		}
+	}
+
+	if reason == runtime.ReasonNoException {
 		if c.PropagateSuccess {
 			success = success && resultSet.Success()
 		}
@@ -254,6 +265,9 @@ func (c Case) Test() {
 
 	if reason != runtime.ReasonNoException {
 		controller.CloseLog()
+		if reason == runtime.ReasonIntermittentTask {
+			c.grepLog(context)
+		}
 		err = tp.Exception(reason)
 		nilOrPanic(err, "taskPlugin.Exception failed")
 	}
@@ -0,0 +1,73 @@
+package resultcache
+
+import (
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+type config struct {
+	IndexNamespace   string   `json:"indexNamespace"`
+	IndexBaseURL     string   `json:"indexBaseUrl"`
+	QueueBaseURL     string   `json:"queueBaseUrl"`
+	ExcludeArtifacts []string `json:"excludeArtifacts"`
+}
+
+// Artifacts excluded from reuse, if 'excludeArtifacts' isn't configured.
+var defaultExcludeArtifacts = []string{"public/logs/"}
+
+var configSchema = schematypes.Object{
+	Title: "Result Cache Plugin",
+	Description: util.Markdown(`
+		Configuration for the result cache plugin, which reuses the result of a
+		previous successful run for tasks with an identical task definition.
+	`),
+	Properties: schematypes.Properties{
+		"indexNamespace": schematypes.String{
+			Title: "Shared Index Namespace",
+			Description: util.Markdown(`
+				Index namespace under which successful runs are indexed, allowing
+				results to be shared between workers. Runs are indexed as
+				'<indexNamespace>.<hash>', where '<hash>' is the task definition hash.
+
+				Tasks must have the scope 'index:insert-task:<indexNamespace>.<hash>'
+				for their result to be indexed, hence, only tasks that are trusted to
+				produce correct results should be granted this scope.
+
+				If not given, results are only reused on this worker.
+			`),
+			Pattern:       `^[a-zA-Z0-9_!~*'()%-]+(\.[a-zA-Z0-9_!~*'()%-]+)*$`,
+			MaximumLength: 255,
+		},
+		"indexBaseUrl": schematypes.URI{
+			Title: "BaseUrl for the index service",
+			Description: util.Markdown(`
+				This is the baseUrl for the taskcluster-index service, used when
+				'indexNamespace' is given.
+
+				This defaults to the production value from taskcluster-client libraries.
+				You do not need to set this in production.
+			`),
+		},
+		"queueBaseUrl": schematypes.URI{
+			Title: "BaseUrl for the queue service",
+			Description: util.Markdown(`
+				This is the baseUrl for the taskcluster-queue service, used when
+				constructing the URLs that redirect artifacts point to.
+
+				This defaults to the production value from taskcluster-client libraries.
+				You do not need to set this in production.
+			`),
+		},
+		"excludeArtifacts": schematypes.Array{
+			Title: "Excluded Artifacts",
+			Description: util.Markdown(`
+				List of artifact name prefixes for artifacts that should not be
+				re-published when a result is reused. This is necessary for artifacts
+				that the current run creates itself, such as the task log.
+
+				This defaults to '["public/logs/"]'.
+			`),
+			Items: schematypes.String{},
+		},
+	},
+}
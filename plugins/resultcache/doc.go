@@ -0,0 +1,14 @@
+// Package resultcache provides a taskcluster-worker plugin that reuses the
+// result of a previous successful run, instead of executing the task again.
+//
+// Tasks opt-in by setting 'task.payload.reuseResult'. The plugin then hashes
+// the normalized task definition together with the hash-keys of all input
+// references found in 'task.payload'. If a previous successful run with the
+// same hash is known on this worker, or is indexed under the configured
+// 'indexNamespace', the artifacts from that run are re-published as redirect
+// artifacts, and the sandbox is never started.
+package resultcache
+
+import "github.com/taskcluster/taskcluster-worker/runtime/util"
+
+var debug = util.Debug("resultcache")
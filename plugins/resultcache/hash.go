@@ -0,0 +1,118 @@
+package resultcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/fetcher"
+)
+
+// A fetcher matching references to inputs in task.payload, plain URLs are not
+// included as their HashKey() is the URL, which is already part of the payload.
+var inputFetcher = fetcher.Combine(
+	// Match references to queue artifacts
+	fetcher.Artifact,
+	// Match references to queue artifacts by index namespace
+	fetcher.Index,
+	// Match references to URL + hash
+	fetcher.URLHash,
+)
+
+type fetchContext struct {
+	*runtime.TaskContext
+}
+
+func (fetchContext) Progress(description string, percent float64) {
+	// References are only resolved, nothing is fetched
+}
+
+// taskHash returns a hash of the normalized task definition and the HashKey()
+// of all input references found in task.payload.
+func taskHash(ctx *runtime.TaskContext) (string, error) {
+	task, ok := ctx.Task.(map[string]interface{})
+	if !ok {
+		return "", errors.New("task definition is not available")
+	}
+	return hashTaskDefinition(ctx, task, ctx.Scopes)
+}
+
+// referencedTaskHash fetches the definition of taskID and returns its hash as
+// computed by taskHash, input references are resolved using ctx.
+func referencedTaskHash(ctx *runtime.TaskContext, taskID string) (string, error) {
+	def, err := ctx.Queue().Task(taskID)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to fetch task definition")
+	}
+	// Use the same representation as the task definition in TaskContext
+	data, err := json.Marshal(def)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to serialize task definition")
+	}
+	var task map[string]interface{}
+	if err = json.Unmarshal(data, &task); err != nil {
+		return "", errors.Wrap(err, "failed to parse task definition")
+	}
+	return hashTaskDefinition(ctx, task, def.Scopes)
+}
+
+func hashTaskDefinition(ctx *runtime.TaskContext, task map[string]interface{}, scopes []string) (string, error) {
+	// Resolve input references, so that a change of index namespace or latest
+	// runId results in a different hash
+	var inputs []string
+	err := findReferences(task["payload"], func(options interface{}) error {
+		ref, err := inputFetcher.NewReference(fetchContext{ctx}, options)
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, ref.HashKey())
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to resolve input reference")
+	}
+	sort.Strings(inputs)
+
+	// Only include properties that affects the result of the task, the order of
+	// scopes doesn't matter. Notice, that encoding/json sorts keys in maps.
+	scopes = append([]string{}, scopes...)
+	sort.Strings(scopes)
+	data, err := json.Marshal(map[string]interface{}{
+		"provisionerId": task["provisionerId"],
+		"workerType":    task["workerType"],
+		"scopes":        scopes,
+		"payload":       task["payload"],
+		"inputs":        inputs,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to serialize task definition")
+	}
+
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// findReferences calls fn for each object in value that matches inputFetcher
+func findReferences(value interface{}, fn func(options interface{}) error) error {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if inputFetcher.Schema().Validate(v) == nil {
+			return fn(v)
+		}
+		for _, val := range v {
+			if err := findReferences(val, fn); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, val := range v {
+			if err := findReferences(val, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
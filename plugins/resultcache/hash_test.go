@@ -0,0 +1,56 @@
+package resultcache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/slugid-go/slugid"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/client"
+)
+
+func TestReferencedTaskHash(t *testing.T) {
+	def := &queue.TaskDefinitionResponse{
+		ProvisionerID: "dummy-provisioner",
+		WorkerType:    "dummy-worker-type",
+		Scopes:        []string{"scope-b", "scope-a"},
+		Payload:       json.RawMessage(`{"command": ["true"], "reuseResult": true}`),
+	}
+	other := *def
+	other.Payload = json.RawMessage(`{"command": ["false"], "reuseResult": true}`)
+
+	q := &client.MockQueue{}
+	q.On("Task", "same-task").Return(def, nil)
+	q.On("Task", "other-task").Return(&other, nil)
+
+	// Represent the task definition as the worker does
+	data, err := json.Marshal(def)
+	require.NoError(t, err)
+	var task interface{}
+	require.NoError(t, json.Unmarshal(data, &task))
+
+	ctx, control, err := runtime.NewTaskContext(filepath.Join(os.TempDir(), slugid.Nice()), runtime.TaskInfo{
+		TaskID: slugid.Nice(),
+		Task:   task,
+		Scopes: []string{"scope-a", "scope-b"},
+	})
+	require.NoError(t, err)
+	defer control.Dispose()
+	defer control.CloseLog()
+	control.SetQueueClient(q)
+
+	hash, err := taskHash(ctx)
+	require.NoError(t, err)
+
+	refHash, err := referencedTaskHash(ctx, "same-task")
+	require.NoError(t, err)
+	require.Equal(t, hash, refHash, "expected same hash for same task definition")
+
+	refHash, err = referencedTaskHash(ctx, "other-task")
+	require.NoError(t, err)
+	require.NotEqual(t, hash, refHash, "expected different hash for different payload")
+}
@@ -0,0 +1,171 @@
+package resultcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	got "github.com/taskcluster/go-got"
+	"github.com/taskcluster/httpbackoff"
+	tcclient "github.com/taskcluster/taskcluster-client-go"
+	tcindex "github.com/taskcluster/taskcluster-client-go/index"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+// A resultEntry references a successful run, whose result can be reused.
+type resultEntry struct {
+	TaskID  string
+	RunID   int
+	Expires time.Time
+}
+
+// indexData is the data stored with runs indexed in the shared index namespace
+type indexData struct {
+	RunID *int `json:"runId,omitempty"`
+}
+
+// lookup finds a previous successful run with the given task hash
+func (p *plugin) lookup(ctx *runtime.TaskContext, hash string) (resultEntry, bool) {
+	// Find result from runs on this worker
+	p.m.Lock()
+	entry, ok := p.results[hash]
+	if ok && !time.Now().Before(entry.Expires) {
+		delete(p.results, hash)
+		ok = false
+	}
+	p.m.Unlock()
+	if ok && isCompleted(ctx, &entry) {
+		return entry, true
+	}
+
+	// Find result in shared index namespace
+	if p.config.IndexNamespace == "" {
+		return resultEntry{}, false
+	}
+	entry, err := p.findIndexedResult(ctx, hash)
+	if err != nil {
+		debug("no result for hash: %s in index, error: %s", hash, err)
+		return resultEntry{}, false
+	}
+	// Anyone with scopes to insert into the index namespace could reference any
+	// task, so verify that the referenced task has the same task hash
+	refHash, err := referencedTaskHash(ctx, entry.TaskID)
+	if err != nil {
+		debug("unable to hash task: %s referenced by index, error: %s", entry.TaskID, err)
+		return resultEntry{}, false
+	}
+	if refHash != hash {
+		debug("task: %s indexed for hash: %s has hash: %s", entry.TaskID, hash, refHash)
+		return resultEntry{}, false
+	}
+	if !isCompleted(ctx, &entry) {
+		return resultEntry{}, false
+	}
+	return entry, true
+}
+
+// record stores the result of a successful run with the given task hash
+func (p *plugin) record(ctx *runtime.TaskContext, hash string, monitor runtime.Monitor) {
+	p.m.Lock()
+	// Remove expired entries, so results doesn't grow forever
+	now := time.Now()
+	for h, e := range p.results {
+		if !now.Before(e.Expires) {
+			delete(p.results, h)
+		}
+	}
+	p.results[hash] = resultEntry{
+		TaskID:  ctx.TaskID,
+		RunID:   ctx.RunID,
+		Expires: ctx.Expires,
+	}
+	p.m.Unlock()
+
+	// Index the result in the shared index namespace, if the task is allowed to
+	if p.config.IndexNamespace == "" {
+		return
+	}
+	namespace := p.config.IndexNamespace + "." + hash
+	if !ctx.HasScopes([]string{"index:insert-task:" + namespace}) {
+		debug("task %s doesn't have scopes to index result under %s", ctx.TaskID, namespace)
+		return
+	}
+	if err := p.insertIndexedResult(ctx, namespace); err != nil {
+		monitor.ReportWarning(err, "failed to index result under: ", namespace)
+	}
+}
+
+func (p *plugin) findIndexedResult(ctx *runtime.TaskContext, hash string) (resultEntry, error) {
+	index := tcindex.New(nil)
+	index.Context = ctx
+	index.Authenticate = false
+	index.BaseURL = p.indexBaseURL
+	result, err := index.FindTask(p.config.IndexNamespace + "." + hash)
+	if err != nil {
+		if e, ok := err.(httpbackoff.BadHttpResponseCode); ok && e.HttpResponseCode == http.StatusNotFound {
+			return resultEntry{}, errors.New("no such namespace")
+		}
+		return resultEntry{}, errors.Wrap(err, "failed to find task in index")
+	}
+
+	// Use latest runId, if the runId wasn't indexed with the task
+	var data indexData
+	_ = json.Unmarshal(result.Data, &data)
+	runID := -1
+	if data.RunID != nil {
+		runID = *data.RunID
+	}
+	return resultEntry{
+		TaskID:  result.TaskID,
+		RunID:   runID,
+		Expires: time.Time(result.Expires),
+	}, nil
+}
+
+func (p *plugin) insertIndexedResult(ctx *runtime.TaskContext, namespace string) error {
+	data, _ := json.Marshal(indexData{RunID: &ctx.RunID})
+	body, err := json.Marshal(tcindex.InsertTaskRequest{
+		TaskID:  ctx.TaskID,
+		Data:    json.RawMessage(data),
+		Expires: tcclient.Time(ctx.Expires),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to serialize request")
+	}
+
+	u, err := url.Parse(fmt.Sprintf("%s/task/%s", p.indexBaseURL, url.QueryEscape(namespace)))
+	if err != nil {
+		return errors.Wrap(err, "failed to construct index URL")
+	}
+	signature, err := ctx.Authorizer().SignHeader(http.MethodPut, u, body)
+	if err != nil {
+		return errors.Wrap(err, "failed to sign request")
+	}
+
+	req := got.New().Put(u.String(), body).WithContext(ctx)
+	req.Header.Set("Authorization", signature)
+	req.Header.Set("Content-Type", "application/json")
+	_, err = req.Send()
+	return err
+}
+
+// isCompleted returns true, if entry references a completed run, if the runId
+// is -1 it is resolved to the latest run.
+func isCompleted(ctx *runtime.TaskContext, entry *resultEntry) bool {
+	result, err := ctx.Queue().Status(entry.TaskID)
+	if err != nil {
+		debug("failed to fetch status for task %s, error: %s", entry.TaskID, err)
+		return false
+	}
+	runs := result.Status.Runs
+	if entry.RunID == -1 {
+		entry.RunID = len(runs) - 1
+	}
+	if entry.RunID < 0 || entry.RunID >= len(runs) {
+		return false
+	}
+	return runs[entry.RunID].State == "completed"
+}
@@ -0,0 +1,31 @@
+package resultcache
+
+import (
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+type payload struct {
+	ReuseResult bool `json:"reuseResult"`
+}
+
+var payloadSchema = schematypes.Object{
+	Properties: schematypes.Properties{
+		"reuseResult": schematypes.Boolean{
+			Title: "Reuse Result",
+			Description: util.Markdown(`
+				Reuse the result of a previous successful run with the same task
+				definition, instead of executing the task.
+
+				The task definition is hashed along with the resolved references to
+				input artifacts, such that tasks using an index namespace that has
+				been updated will not reuse stale results. When a result is reused,
+				the artifacts from the previous run are published as redirect
+				artifacts and the task is resolved successfully.
+
+				Only enable this for tasks that are deterministic and free of
+				side-effects.
+			`),
+		},
+	},
+}
@@ -0,0 +1,182 @@
+package resultcache
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	schematypes "github.com/taskcluster/go-schematypes"
+	tcindex "github.com/taskcluster/taskcluster-client-go/index"
+	tcqueue "github.com/taskcluster/taskcluster-client-go/queue"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/plugins"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+type provider struct {
+	plugins.PluginProviderBase
+}
+
+type plugin struct {
+	plugins.PluginBase
+	config       config
+	indexBaseURL string
+	queueBaseURL string
+	m            sync.Mutex
+	results      map[string]resultEntry // task hash -> previous successful run
+}
+
+type taskPlugin struct {
+	plugins.TaskPluginBase
+	plugin  *plugin
+	context *runtime.TaskContext
+	monitor runtime.Monitor
+	hash    string
+	reused  bool
+}
+
+func init() {
+	plugins.Register("resultcache", provider{})
+}
+
+func (provider) ConfigSchema() schematypes.Schema {
+	return configSchema
+}
+
+func (provider) NewPlugin(options plugins.PluginOptions) (plugins.Plugin, error) {
+	var c config
+	schematypes.MustValidateAndMap(configSchema, options.Config, &c)
+	if c.ExcludeArtifacts == nil {
+		c.ExcludeArtifacts = defaultExcludeArtifacts
+	}
+
+	p := &plugin{
+		config:       c,
+		indexBaseURL: tcindex.New(nil).BaseURL,
+		queueBaseURL: tcqueue.New(nil).BaseURL,
+		results:      make(map[string]resultEntry),
+	}
+	if c.IndexBaseURL != "" {
+		p.indexBaseURL = strings.TrimSuffix(c.IndexBaseURL, "/")
+	}
+	if c.QueueBaseURL != "" {
+		p.queueBaseURL = strings.TrimSuffix(c.QueueBaseURL, "/")
+	}
+	return p, nil
+}
+
+func (p *plugin) PayloadSchema() schematypes.Object {
+	return payloadSchema
+}
+
+func (p *plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskPlugin, error) {
+	var P payload
+	schematypes.MustValidateAndMap(payloadSchema, options.Payload, &P)
+
+	if !P.ReuseResult {
+		return plugins.TaskPluginBase{}, nil
+	}
+
+	return &taskPlugin{
+		plugin:  p,
+		context: options.TaskContext,
+		monitor: options.Monitor,
+	}, nil
+}
+
+func (tp *taskPlugin) BuildSandbox(engines.SandboxBuilder) error {
+	hash, err := taskHash(tp.context)
+	if err != nil {
+		// Broken references are reported by the engine or plugin consuming them
+		debug("unable to hash task: %s, error: %s", tp.context.TaskID, err)
+		tp.context.Log("Unable to compute task definition hash, previous results cannot be reused")
+		return nil
+	}
+	tp.hash = hash
+
+	entry, ok := tp.plugin.lookup(tp.context, hash)
+	if !ok {
+		tp.context.Log(fmt.Sprintf("No previous result found for task definition hash: %s", hash))
+		return nil
+	}
+
+	tp.context.Log(fmt.Sprintf(
+		"Reusing result from taskId: %s, runId: %d, with task definition hash: %s",
+		entry.TaskID, entry.RunID, hash,
+	))
+	if err = tp.republishArtifacts(entry); err != nil {
+		incidentID := tp.monitor.ReportError(err, "failed to reuse result of previous run")
+		tp.context.LogError("Failed to reuse result of previous run, incidentId: ", incidentID)
+		return runtime.ErrNonFatalInternalError
+	}
+	tp.reused = true
+	return runtime.ErrTaskResultReused
+}
+
+// republishArtifacts creates redirect artifacts for all artifacts from entry,
+// except those excluded by configuration.
+func (tp *taskPlugin) republishArtifacts(entry resultEntry) error {
+	runID := strconv.Itoa(entry.RunID)
+	var continuationToken string
+	for {
+		result, err := tp.context.Queue().ListArtifacts(entry.TaskID, runID, continuationToken, "")
+		if err != nil {
+			return errors.Wrap(err, "failed to list artifacts")
+		}
+
+		for _, a := range result.Artifacts {
+			if tp.plugin.isExcluded(a.Name) {
+				continue
+			}
+			// Redirect artifacts shouldn't outlive the artifact or the task
+			expires := time.Time(a.Expires)
+			if expires.After(tp.context.Expires) {
+				expires = tp.context.Expires
+			}
+			err = tp.context.CreateRedirectArtifact(runtime.RedirectArtifact{
+				Name:     a.Name,
+				Mimetype: a.ContentType,
+				URL:      tp.plugin.artifactURL(entry.TaskID, runID, a.Name),
+				Expires:  expires,
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to create redirect artifact: %s", a.Name)
+			}
+			tp.context.Log(fmt.Sprintf("Created redirect artifact: %s", a.Name))
+		}
+
+		// Break, if there is no continuationToken
+		continuationToken = result.ContinuationToken
+		if continuationToken == "" {
+			return nil
+		}
+	}
+}
+
+func (tp *taskPlugin) Finished(success bool) error {
+	// Record successful runs, unless the result itself was reused
+	if success && !tp.reused && tp.hash != "" {
+		tp.plugin.record(tp.context, tp.hash, tp.monitor)
+	}
+	return nil
+}
+
+func (p *plugin) isExcluded(name string) bool {
+	for _, prefix := range p.config.ExcludeArtifacts {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *plugin) artifactURL(taskID, runID, name string) string {
+	return fmt.Sprintf(
+		"%s/task/%s/runs/%s/artifacts/%s",
+		p.queueBaseURL, url.QueryEscape(taskID), runID, url.QueryEscape(name),
+	)
+}
@@ -0,0 +1,151 @@
+package resultcache
+
+import (
+	"testing"
+
+	"github.com/taskcluster/taskcluster-worker/worker/workertest"
+
+	_ "github.com/taskcluster/taskcluster-worker/engines/mock"
+	_ "github.com/taskcluster/taskcluster-worker/plugins/artifacts"
+	_ "github.com/taskcluster/taskcluster-worker/plugins/livelog"
+	_ "github.com/taskcluster/taskcluster-worker/plugins/success"
+)
+
+const testPluginConfig = `{
+	"disabled": [],
+	"artifacts": {},
+	"livelog": {},
+	"resultcache": {},
+	"success": {}
+}`
+
+const testPayload = `{
+	"delay": 0,
+	"function": "write-files",
+	"argument": "/artifacts/hello.txt",
+	"artifacts": [
+		{
+			"type": "file",
+			"path": "/artifacts/hello.txt",
+			"name": "public/hello.txt"
+		}
+	],
+	"reuseResult": true
+}`
+
+func TestReuseResult(t *testing.T) {
+	workertest.Case{
+		Concurrency:  0, // runs tasks sequentially
+		Engine:       "mock",
+		EngineConfig: `{}`,
+		PluginConfig: testPluginConfig,
+		Tasks: []workertest.Task{
+			{
+				Title:   "Run task and record result",
+				Payload: testPayload,
+				Artifacts: workertest.ArtifactAssertions{
+					"public/logs/live_backing.log": workertest.GrepArtifact("No previous result found"),
+					"public/logs/live.log":         workertest.AnyArtifact(),
+					"public/hello.txt":             workertest.S3Artifact(),
+				},
+				Success: true,
+			},
+			{
+				Title:   "Reuse result of previous task",
+				Payload: testPayload,
+				Artifacts: workertest.ArtifactAssertions{
+					"public/logs/live_backing.log": workertest.GrepArtifact("Reusing result from taskId"),
+					"public/logs/live.log":         workertest.AnyArtifact(),
+					"public/hello.txt":             workertest.ReferenceArtifact(),
+				},
+				Success: true,
+			},
+		},
+	}.TestWithFakeQueue(t)
+}
+
+func TestReuseResultDifferentPayload(t *testing.T) {
+	workertest.Case{
+		Concurrency:  0, // runs tasks sequentially
+		Engine:       "mock",
+		EngineConfig: `{}`,
+		PluginConfig: testPluginConfig,
+		Tasks: []workertest.Task{
+			{
+				Title:   "Run task and record result",
+				Payload: testPayload,
+				Artifacts: workertest.ArtifactAssertions{
+					"public/logs/live_backing.log": workertest.AnyArtifact(),
+					"public/logs/live.log":         workertest.AnyArtifact(),
+					"public/hello.txt":             workertest.S3Artifact(),
+				},
+				Success: true,
+			},
+			{
+				Title: "Run task with a different payload",
+				Payload: `{
+					"delay": 0,
+					"function": "write-files",
+					"argument": "/artifacts/hello.txt /artifacts/world.txt",
+					"artifacts": [
+						{
+							"type": "file",
+							"path": "/artifacts/hello.txt",
+							"name": "public/hello.txt"
+						}
+					],
+					"reuseResult": true
+				}`,
+				Artifacts: workertest.ArtifactAssertions{
+					"public/logs/live_backing.log": workertest.NotGrepArtifact("Reusing result"),
+					"public/logs/live.log":         workertest.AnyArtifact(),
+					"public/hello.txt":             workertest.S3Artifact(),
+				},
+				Success: true,
+			},
+		},
+	}.TestWithFakeQueue(t)
+}
+
+func TestReuseResultNotRequested(t *testing.T) {
+	payload := `{
+		"delay": 0,
+		"function": "write-files",
+		"argument": "/artifacts/hello.txt",
+		"artifacts": [
+			{
+				"type": "file",
+				"path": "/artifacts/hello.txt",
+				"name": "public/hello.txt"
+			}
+		]
+	}`
+	workertest.Case{
+		Concurrency:  0, // runs tasks sequentially
+		Engine:       "mock",
+		EngineConfig: `{}`,
+		PluginConfig: testPluginConfig,
+		Tasks: []workertest.Task{
+			{
+				Title:   "Run task without reuseResult",
+				Payload: payload,
+				Artifacts: workertest.ArtifactAssertions{
+					"public/logs/live_backing.log": workertest.AnyArtifact(),
+					"public/logs/live.log":         workertest.AnyArtifact(),
+					"public/hello.txt":             workertest.S3Artifact(),
+				},
+				Success: true,
+			},
+			{
+				Title:   "Run task without reuseResult again",
+				Payload: payload,
+				Artifacts: workertest.ArtifactAssertions{
+					"public/logs/live_backing.log": workertest.NotGrepArtifact("Reusing result"),
+					"public/logs/live.log":         workertest.AnyArtifact(),
+					"public/hello.txt":             workertest.S3Artifact(),
+				},
+				Success: true,
+			},
+		},
+	}.TestWithFakeQueue(t)
+}
@@ -0,0 +1,236 @@
+package screenrecording
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// AVI files without the OpenDML extensions use 32 bit offsets, and many
+// players can't read files larger than 1 GiB.
+const maxAVISize = 1024 * 1024 * 1024
+
+// errAVIFull is returned from WriteFrame, if the frame would make the file
+// exceed maxAVISize. Close() may still be called to finish the file.
+var errAVIFull = errors.New("AVI file has reached the maximum size")
+
+// Flags used in the AVI headers
+const (
+	aviHasIndex = 0x10 // AVIF_HASINDEX
+	aviKeyFrame = 0x10 // AVIIF_KEYFRAME
+)
+
+// Offset of the 'movi' list type, which offsets in the index are relative to,
+// this follows from the size of the headers written by writeHeader.
+const aviMoviOffset = 220
+
+type fourCC [4]byte
+
+type chunkHeader struct {
+	ID   fourCC
+	Size uint32
+}
+
+type listHeader struct {
+	ID   fourCC // 'RIFF' or 'LIST'
+	Size uint32
+	Type fourCC
+}
+
+type aviMainHeader struct {
+	MicroSecPerFrame    uint32
+	MaxBytesPerSec      uint32
+	PaddingGranularity  uint32
+	Flags               uint32
+	TotalFrames         uint32
+	InitialFrames       uint32
+	Streams             uint32
+	SuggestedBufferSize uint32
+	Width               uint32
+	Height              uint32
+	Reserved            [4]uint32
+}
+
+type aviStreamHeader struct {
+	Type                fourCC
+	Handler             fourCC
+	Flags               uint32
+	Priority            uint16
+	Language            uint16
+	InitialFrames       uint32
+	Scale               uint32
+	Rate                uint32
+	Start               uint32
+	Length              uint32
+	SuggestedBufferSize uint32
+	Quality             uint32
+	SampleSize          uint32
+	Frame               [4]uint16
+}
+
+type bitmapInfoHeader struct {
+	Size          uint32
+	Width         int32
+	Height        int32
+	Planes        uint16
+	BitCount      uint16
+	Compression   fourCC
+	SizeImage     uint32
+	XPelsPerMeter int32
+	YPelsPerMeter int32
+	ClrUsed       uint32
+	ClrImportant  uint32
+}
+
+type aviIndexEntry struct {
+	ID     fourCC
+	Flags  uint32
+	Offset uint32
+	Size   uint32
+}
+
+// aviWriter writes Motion JPEG frames to an AVI file with a single video
+// stream. Close() must be called to write the index and update the headers.
+type aviWriter struct {
+	file      io.WriteSeeker
+	w         *bufio.Writer
+	width     int
+	height    int
+	frameRate int
+	size      int64 // bytes written to file
+	maxFrame  int   // size of largest frame
+	index     []aviIndexEntry
+}
+
+// newAVIWriter creates an aviWriter writing to file, which must be empty
+func newAVIWriter(file io.WriteSeeker, width, height, frameRate int) (*aviWriter, error) {
+	a := &aviWriter{
+		file:      file,
+		w:         bufio.NewWriter(file),
+		width:     width,
+		height:    height,
+		frameRate: frameRate,
+	}
+	a.size = aviMoviOffset + 4
+	if err := a.writeHeader(); err != nil {
+		return nil, errors.Wrap(err, "failed to write AVI header")
+	}
+	return a, nil
+}
+
+// writeHeader writes the RIFF header, the 'hdrl' list and the start of the
+// 'movi' list, reflecting the frames written so far.
+func (a *aviWriter) writeHeader() error {
+	frames := uint32(len(a.index))
+	indexSize := uint32(len(a.index) * 16)
+	moviSize := uint32(a.size - aviMoviOffset)
+	// RIFF size excludes the 8 byte RIFF header, but includes the 'idx1' chunk
+	riffSize := uint32(a.size) + indexSize
+	return writeLE(a.w,
+		listHeader{fourCC{'R', 'I', 'F', 'F'}, riffSize, fourCC{'A', 'V', 'I', ' '}},
+		listHeader{fourCC{'L', 'I', 'S', 'T'}, 192, fourCC{'h', 'd', 'r', 'l'}},
+		chunkHeader{fourCC{'a', 'v', 'i', 'h'}, 56},
+		aviMainHeader{
+			MicroSecPerFrame:    uint32(1000000 / a.frameRate),
+			MaxBytesPerSec:      uint32(a.maxFrame * a.frameRate),
+			Flags:               aviHasIndex,
+			TotalFrames:         frames,
+			Streams:             1,
+			SuggestedBufferSize: uint32(a.maxFrame),
+			Width:               uint32(a.width),
+			Height:              uint32(a.height),
+		},
+		listHeader{fourCC{'L', 'I', 'S', 'T'}, 116, fourCC{'s', 't', 'r', 'l'}},
+		chunkHeader{fourCC{'s', 't', 'r', 'h'}, 56},
+		aviStreamHeader{
+			Type:                fourCC{'v', 'i', 'd', 's'},
+			Handler:             fourCC{'M', 'J', 'P', 'G'},
+			Scale:               1,
+			Rate:                uint32(a.frameRate),
+			Length:              frames,
+			SuggestedBufferSize: uint32(a.maxFrame),
+			Quality:             0xFFFFFFFF, // default quality
+			Frame:               [4]uint16{0, 0, uint16(a.width), uint16(a.height)},
+		},
+		chunkHeader{fourCC{'s', 't', 'r', 'f'}, 40},
+		bitmapInfoHeader{
+			Size:        40,
+			Width:       int32(a.width),
+			Height:      int32(a.height),
+			Planes:      1,
+			BitCount:    24,
+			Compression: fourCC{'M', 'J', 'P', 'G'},
+			SizeImage:   uint32(a.width * a.height * 3),
+		},
+		listHeader{fourCC{'L', 'I', 'S', 'T'}, moviSize, fourCC{'m', 'o', 'v', 'i'}},
+	)
+}
+
+// WriteFrame writes a JPEG encoded frame
+func (a *aviWriter) WriteFrame(frame []byte) error {
+	// Size of file with frame chunk, padding, 'idx1' chunk and index entries
+	indexSize := int64(len(a.index)+1) * 16
+	if a.size+8+int64(len(frame))+1+8+indexSize > maxAVISize {
+		return errAVIFull
+	}
+	a.index = append(a.index, aviIndexEntry{
+		ID:     fourCC{'0', '0', 'd', 'c'},
+		Flags:  aviKeyFrame,
+		Offset: uint32(a.size - aviMoviOffset),
+		Size:   uint32(len(frame)),
+	})
+	if len(frame) > a.maxFrame {
+		a.maxFrame = len(frame)
+	}
+
+	err := writeLE(a.w, chunkHeader{fourCC{'0', '0', 'd', 'c'}, uint32(len(frame))})
+	if err == nil {
+		_, err = a.w.Write(frame)
+	}
+	a.size += 8 + int64(len(frame))
+	// Chunks are padded to an even number of bytes
+	if err == nil && len(frame)%2 == 1 {
+		err = a.w.WriteByte(0)
+		a.size++
+	}
+	return errors.Wrap(err, "failed to write frame")
+}
+
+// Frames returns the number of frames written
+func (a *aviWriter) Frames() int {
+	return len(a.index)
+}
+
+// Close writes the index and updates the headers, this does not close the
+// underlying file.
+func (a *aviWriter) Close() error {
+	err := writeLE(a.w, chunkHeader{fourCC{'i', 'd', 'x', '1'}, uint32(len(a.index) * 16)})
+	if err == nil {
+		err = writeLE(a.w, a.index)
+	}
+	if err == nil {
+		err = a.w.Flush()
+	}
+	if err == nil {
+		_, err = a.file.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		err = a.writeHeader()
+	}
+	if err == nil {
+		err = a.w.Flush()
+	}
+	return errors.Wrap(err, "failed to finish AVI file")
+}
+
+// writeLE writes values in little endian
+func writeLE(w io.Writer, values ...interface{}) error {
+	for _, v := range values {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
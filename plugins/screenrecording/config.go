@@ -0,0 +1,64 @@
+package screenrecording
+
+import (
+	"fmt"
+
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+type config struct {
+	FrameRate    int `json:"frameRate"`
+	MaxFrameRate int `json:"maxFrameRate"`
+	Quality      int `json:"quality"`
+}
+
+const (
+	defaultFrameRate    = 5
+	defaultMaxFrameRate = 15
+	defaultQuality      = 75
+	maxFrameRate        = 30
+)
+
+var configSchema = schematypes.Object{
+	Title: "`screenrecording` Plugin",
+	Description: util.Markdown(`
+		The screen recording plugin allows tasks to record the display of the
+		sandbox as a video. The display is recorded as Motion JPEG in an AVI
+		file, which is uploaded as '` + artifactName + `' when the task has
+		stopped.
+
+		Recording is only possible with engines that expose a VNC display, the
+		same display the 'interactive' plugin offers to users.
+	`),
+	Properties: schematypes.Properties{
+		"frameRate": schematypes.Integer{
+			Title: "Default Frame Rate",
+			Description: util.Markdown(`
+				Number of frames per second recorded, if not specified by the task.
+				Defaults to ` + fmt.Sprint(defaultFrameRate) + `.
+			`),
+			Minimum: 1,
+			Maximum: maxFrameRate,
+		},
+		"maxFrameRate": schematypes.Integer{
+			Title: "Maximum Frame Rate",
+			Description: util.Markdown(`
+				Maximum number of frames per second tasks may request, each frame
+				is encoded as JPEG so high frame rates consumes CPU on the worker.
+				Defaults to ` + fmt.Sprint(defaultMaxFrameRate) + `.
+			`),
+			Minimum: 1,
+			Maximum: maxFrameRate,
+		},
+		"quality": schematypes.Integer{
+			Title: "JPEG Quality",
+			Description: util.Markdown(`
+				Quality of the JPEG encoded frames from 1 to 100, higher is better.
+				Defaults to ` + fmt.Sprint(defaultQuality) + `.
+			`),
+			Minimum: 1,
+			Maximum: 100,
+		},
+	},
+}
@@ -0,0 +1,10 @@
+// Package screenrecording provides a plugin for taskcluster-worker which can
+// record the display of a sandbox as a video. The plugin connects to the VNC
+// display exposed by the engine, decodes framebuffer updates and writes the
+// screen as Motion JPEG frames in an AVI file, which is uploaded as an
+// artifact when the task has stopped.
+package screenrecording
+
+import "github.com/taskcluster/taskcluster-worker/runtime/util"
+
+var debug = util.Debug("screenrecording")
@@ -0,0 +1,257 @@
+package screenrecording
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"sync"
+	"time"
+
+	vnc "github.com/mitchellh/go-vnc"
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+)
+
+// copyRectEncoding implements the CopyRect encoding, which go-vnc doesn't
+// support. Servers use it to move regions of the screen, see RFC 6143 Section
+// 7.7.2.
+type copyRectEncoding struct {
+	SrcX uint16
+	SrcY uint16
+}
+
+func (*copyRectEncoding) Type() int32 {
+	return 1
+}
+
+func (*copyRectEncoding) Read(c *vnc.ClientConn, rect *vnc.Rectangle, r io.Reader) (vnc.Encoding, error) {
+	e := &copyRectEncoding{}
+	if err := binary.Read(r, binary.BigEndian, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// closeNotifier signals closed when Close() is called
+type closeNotifier struct {
+	io.ReadWriteCloser
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (c *closeNotifier) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return c.ReadWriteCloser.Close()
+}
+
+// recorder records a VNC display as Motion JPEG frames in an AVI file
+type recorder struct {
+	display   io.ReadWriteCloser
+	conn      *closeNotifier
+	client    *vnc.ClientConn
+	messages  chan vnc.ServerMessage
+	framebuf  *image.RGBA
+	dirty     bool   // true, if framebuf has changed since last frame
+	frame     []byte // last encoded frame
+	avi       *aviWriter
+	frameRate int
+	quality   int
+	truncated bool  // true, if recording stopped at maximum size
+	err       error // error that stopped the recording
+	stop      chan struct{}
+	stopOnce  sync.Once
+	done      chan struct{}
+}
+
+// newRecorder connects to display and starts recording to file, which must be
+// empty. The display is closed when the recording stops.
+func newRecorder(display io.ReadWriteCloser, file io.WriteSeeker, frameRate, quality int) (*recorder, error) {
+	r := &recorder{
+		display:   display,
+		conn:      &closeNotifier{ReadWriteCloser: display, closed: make(chan struct{})},
+		messages:  make(chan vnc.ServerMessage),
+		frameRate: frameRate,
+		quality:   quality,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	var err error
+	r.client, err = vnc.Client(ioext.NopConn(r.conn), &vnc.ClientConfig{
+		Exclusive:       false,
+		ServerMessageCh: r.messages,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "VNC handshake failed")
+	}
+
+	// We use the pixel format of the server, as servers aren't required to
+	// support other formats, and go-vnc decodes pixels for us.
+	err = r.client.SetEncodings([]vnc.Encoding{&vnc.RawEncoding{}, &copyRectEncoding{}})
+	width, height := r.client.FrameBufferWidth, r.client.FrameBufferHeight
+	if err == nil {
+		r.avi, err = newAVIWriter(file, int(width), int(height), frameRate)
+	}
+	if err == nil {
+		err = r.client.FramebufferUpdateRequest(false, 0, 0, width, height)
+	}
+	if err != nil {
+		r.client.Close()
+		return nil, errors.Wrap(err, "failed to start recording")
+	}
+	r.framebuf = image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
+	r.dirty = true
+
+	go r.run()
+	return r, nil
+}
+
+func (r *recorder) run() {
+	defer close(r.done)
+	// Close the display and drain messages until go-vnc closes the connection,
+	// otherwise go-vnc may block forever sending a message.
+	defer func() {
+		r.display.Close()
+		for {
+			select {
+			case <-r.messages:
+			case <-r.conn.closed:
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(time.Second / time.Duration(r.frameRate))
+	defer ticker.Stop()
+
+	pending := true // true, if we have an outstanding update request
+	for {
+		select {
+		case msg := <-r.messages:
+			if update, ok := msg.(*vnc.FramebufferUpdateMessage); ok {
+				r.applyUpdate(update)
+				pending = false
+			}
+		case <-ticker.C:
+			if err := r.writeFrame(); err != nil {
+				if err == errAVIFull {
+					r.truncated = true
+				} else {
+					r.err = err
+				}
+				return
+			}
+			// Request at most one update per frame, to avoid spinning if the
+			// server replies immediately to incremental update requests.
+			if !pending {
+				w, h := uint16(r.framebuf.Rect.Dx()), uint16(r.framebuf.Rect.Dy())
+				if err := r.client.FramebufferUpdateRequest(true, 0, 0, w, h); err != nil {
+					debug("FramebufferUpdateRequest failed, error: %s", err)
+					return
+				}
+				pending = true
+			}
+		case <-r.conn.closed:
+			debug("VNC connection closed")
+			return
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// applyUpdate draws rectangles from a framebuffer update to r.framebuf
+func (r *recorder) applyUpdate(update *vnc.FramebufferUpdateMessage) {
+	for _, rect := range update.Rectangles {
+		x, y := int(rect.X), int(rect.Y)
+		w, h := int(rect.Width), int(rect.Height)
+		switch enc := rect.Enc.(type) {
+		case *vnc.RawEncoding:
+			for i, c := range enc.Colors {
+				r.framebuf.SetRGBA(x+i%w, y+i/w, r.toRGBA(c))
+			}
+		case *copyRectEncoding:
+			src := image.Rect(0, 0, w, h).Add(image.Pt(int(enc.SrcX), int(enc.SrcY)))
+			if src.Min == image.Pt(x, y) {
+				continue // nothing moves
+			}
+			// Copy through a temporary image, as regions may overlap
+			tmp := image.NewRGBA(image.Rect(0, 0, w, h))
+			for dy := 0; dy < h; dy++ {
+				for dx := 0; dx < w; dx++ {
+					tmp.SetRGBA(dx, dy, r.framebuf.RGBAAt(src.Min.X+dx, src.Min.Y+dy))
+				}
+			}
+			for dy := 0; dy < h; dy++ {
+				for dx := 0; dx < w; dx++ {
+					r.framebuf.SetRGBA(x+dx, y+dy, tmp.RGBAAt(dx, dy))
+				}
+			}
+		}
+		r.dirty = true
+	}
+}
+
+// toRGBA converts a color decoded by go-vnc, true colors are given in the
+// range of the pixel format, while colors from the color map are 16 bit.
+func (r *recorder) toRGBA(c vnc.Color) color.RGBA {
+	pf := r.client.PixelFormat
+	if !pf.TrueColor {
+		return color.RGBA{R: uint8(c.R >> 8), G: uint8(c.G >> 8), B: uint8(c.B >> 8), A: 255}
+	}
+	return color.RGBA{
+		R: scaleColor(c.R, pf.RedMax),
+		G: scaleColor(c.G, pf.GreenMax),
+		B: scaleColor(c.B, pf.BlueMax),
+		A: 255,
+	}
+}
+
+// scaleColor scales v from the range [0; max] to [0; 255]
+func scaleColor(v, max uint16) uint8 {
+	if max == 0 {
+		return 0
+	}
+	return uint8(uint32(v) * 255 / uint32(max))
+}
+
+// writeFrame writes the current framebuffer as a frame, encoding it only if
+// it has changed since the last frame.
+func (r *recorder) writeFrame() error {
+	if r.dirty {
+		var b bytes.Buffer
+		if err := jpeg.Encode(&b, r.framebuf, &jpeg.Options{Quality: r.quality}); err != nil {
+			return errors.Wrap(err, "failed to encode frame")
+		}
+		r.frame = b.Bytes()
+		r.dirty = false
+	}
+	return r.avi.WriteFrame(r.frame)
+}
+
+// Stop recording and finish the AVI file, returns the error that stopped the
+// recording, if any.
+func (r *recorder) Stop() error {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+		<-r.done
+		if r.err == nil {
+			r.err = r.avi.Close()
+		}
+	})
+	return r.err
+}
+
+// Frames returns the number of frames recorded, Stop() must have been called.
+func (r *recorder) Frames() int {
+	return r.avi.Frames()
+}
+
+// Truncated returns true, if the recording was stopped because the file
+// reached the maximum size, Stop() must have been called.
+func (r *recorder) Truncated() bool {
+	return r.truncated
+}
@@ -0,0 +1,235 @@
+package screenrecording
+
+import (
+	"fmt"
+
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/engines"
+	"github.com/taskcluster/taskcluster-worker/plugins"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// Name of the artifact the recording is uploaded as
+const artifactName = "public/screen-recording.avi"
+
+type provider struct {
+	plugins.PluginProviderBase
+}
+
+type plugin struct {
+	plugins.PluginBase
+	config
+	environment *runtime.Environment
+}
+
+type taskPlugin struct {
+	plugins.TaskPluginBase
+	plugin   *plugin
+	options  *recordingOptions
+	context  *runtime.TaskContext
+	monitor  runtime.Monitor
+	file     runtime.TemporaryFile
+	recorder *recorder
+}
+
+type recordingOptions struct {
+	Display   string `json:"display"`
+	FrameRate int    `json:"frameRate"`
+}
+
+type payload struct {
+	ScreenRecording *recordingOptions `json:"screenRecording"`
+}
+
+func init() {
+	plugins.Register("screenrecording", provider{})
+}
+
+func (provider) ConfigSchema() schematypes.Schema {
+	return configSchema
+}
+
+func (provider) NewPlugin(options plugins.PluginOptions) (plugins.Plugin, error) {
+	var c config
+	schematypes.MustValidateAndMap(configSchema, options.Config, &c)
+
+	if c.FrameRate == 0 {
+		c.FrameRate = defaultFrameRate
+	}
+	if c.MaxFrameRate == 0 {
+		c.MaxFrameRate = defaultMaxFrameRate
+	}
+	if c.FrameRate > c.MaxFrameRate {
+		c.FrameRate = c.MaxFrameRate
+	}
+	if c.Quality == 0 {
+		c.Quality = defaultQuality
+	}
+
+	return &plugin{
+		config:      c,
+		environment: options.Environment,
+	}, nil
+}
+
+func (p *plugin) PayloadSchema() schematypes.Object {
+	return schematypes.Object{
+		Properties: schematypes.Properties{
+			"screenRecording": schematypes.Object{
+				Title: "Screen Recording",
+				Description: util.Markdown(`
+					Record the display of the task as a video, the recording is
+					uploaded as '` + artifactName + `' when the task has stopped.
+					The video is Motion JPEG in an AVI file, which most video players
+					can play.
+				`),
+				Properties: schematypes.Properties{
+					"display": schematypes.String{
+						Title: "Display",
+						Description: util.Markdown(`
+							Name of the display to record, defaults to the first display
+							of the sandbox.
+						`),
+						MaximumLength: 255,
+					},
+					"frameRate": schematypes.Integer{
+						Title: "Frame Rate",
+						Description: util.Markdown(`
+							Number of frames per second to record, defaults to
+							` + fmt.Sprint(p.FrameRate) + `.
+						`),
+						Minimum: 1,
+						Maximum: int64(p.MaxFrameRate),
+					},
+				},
+			},
+		},
+	}
+}
+
+func (p *plugin) NewTaskPlugin(options plugins.TaskPluginOptions) (plugins.TaskPlugin, error) {
+	var P payload
+	schematypes.MustValidateAndMap(p.PayloadSchema(), options.Payload, &P)
+
+	if P.ScreenRecording == nil {
+		return plugins.TaskPluginBase{}, nil
+	}
+	if P.ScreenRecording.FrameRate == 0 {
+		P.ScreenRecording.FrameRate = p.FrameRate
+	}
+
+	return &taskPlugin{
+		plugin:  p,
+		options: P.ScreenRecording,
+		context: options.TaskContext,
+		monitor: options.Monitor,
+	}, nil
+}
+
+func (tp *taskPlugin) Started(sandbox engines.Sandbox) error {
+	// Find the display to record
+	displays, err := sandbox.ListDisplays()
+	if err == engines.ErrFeatureNotSupported {
+		return runtime.NewMalformedPayloadError(
+			"Screen recording is not supported in current configuration of this workerType",
+		)
+	}
+	if err == engines.ErrSandboxTerminated {
+		debug("sandbox terminated before the recording was started")
+		return nil
+	}
+	if err != nil {
+		incidentID := tp.monitor.ReportError(err, "ListDisplays() failed")
+		tp.context.LogError("Failed to start screen recording, incidentId:", incidentID)
+		return runtime.ErrNonFatalInternalError
+	}
+	name := tp.options.Display
+	if name == "" && len(displays) > 0 {
+		name = displays[0].Name
+	}
+	found := false
+	for _, d := range displays {
+		found = found || d.Name == name
+	}
+	if !found {
+		return runtime.NewMalformedPayloadError(
+			"task.payload.screenRecording.display: '", name, "' doesn't exist",
+		)
+	}
+
+	display, err := sandbox.WatchDisplay(name)
+	if err == engines.ErrFeatureNotSupported {
+		return runtime.NewMalformedPayloadError(
+			"Screen recording is not supported in current configuration of this workerType",
+		)
+	}
+	if err == engines.ErrSandboxTerminated || err == engines.ErrSandboxAborted {
+		debug("sandbox terminated before the recording was started")
+		return nil
+	}
+	if err != nil {
+		incidentID := tp.monitor.ReportError(err, "WatchDisplay() failed")
+		tp.context.LogError("Failed to start screen recording, incidentId:", incidentID)
+		return runtime.ErrNonFatalInternalError
+	}
+
+	tp.file, err = tp.plugin.environment.TemporaryStorage.NewFile()
+	if err != nil {
+		display.Close()
+		return fmt.Errorf("Failed to create temporary file for screen recording, error: %s", err)
+	}
+
+	tp.recorder, err = newRecorder(display, tp.file, tp.options.FrameRate, tp.plugin.Quality)
+	if err != nil {
+		display.Close()
+		// The display may be closed if the sandbox stopped, hence, we only warn
+		incidentID := tp.monitor.ReportWarning(err, "failed to start screen recording")
+		tp.context.LogError("Failed to start screen recording, incidentId:", incidentID)
+	}
+	return nil
+}
+
+func (tp *taskPlugin) Stopped(engines.ResultSet) (bool, error) {
+	if tp.recorder == nil {
+		return true, nil
+	}
+
+	err := tp.recorder.Stop()
+	if err != nil {
+		incidentID := tp.monitor.ReportError(err, "screen recording failed")
+		tp.context.LogError("Screen recording failed, incidentId:", incidentID)
+		return true, runtime.ErrNonFatalInternalError
+	}
+	if tp.recorder.Truncated() {
+		tp.context.Log("Screen recording was stopped as it reached the maximum size")
+	}
+	if tp.recorder.Frames() == 0 {
+		return true, nil
+	}
+
+	err = tp.context.UploadS3Artifact(runtime.S3Artifact{
+		Name:     artifactName,
+		Mimetype: "video/x-msvideo",
+		Expires:  tp.context.TaskInfo.Expires,
+		Stream:   ioext.NopCloser(tp.file),
+	})
+	if err != nil {
+		incidentID := tp.monitor.ReportError(err, "failed to upload screen recording")
+		tp.context.LogError("Failed to upload screen recording, incidentId:", incidentID)
+		return true, runtime.ErrNonFatalInternalError
+	}
+	return true, nil
+}
+
+func (tp *taskPlugin) Dispose() error {
+	// NOTE: Stopped() is not called, if the task is resolved exception
+	if tp.recorder != nil {
+		tp.recorder.Stop()
+	}
+	if tp.file != nil {
+		return tp.file.Close()
+	}
+	return nil
+}
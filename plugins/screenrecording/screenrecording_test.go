@@ -0,0 +1,120 @@
+package screenrecording
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image/jpeg"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/slugid-go/slugid"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+	"github.com/taskcluster/taskcluster-worker/plugins/plugintest"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/client"
+)
+
+// readAVI returns the frames and main header from an AVI file written by
+// aviWriter, using the index to locate the frames.
+func readAVI(t *testing.T, data []byte) (aviMainHeader, [][]byte) {
+	require.Equal(t, "RIFF", string(data[0:4]))
+	require.Equal(t, len(data)-8, int(binary.LittleEndian.Uint32(data[4:8])))
+	require.Equal(t, "AVI ", string(data[8:12]))
+	require.Equal(t, "movi", string(data[aviMoviOffset:aviMoviOffset+4]))
+
+	var header aviMainHeader
+	err := binary.Read(bytes.NewReader(data[32:88]), binary.LittleEndian, &header)
+	require.NoError(t, err)
+
+	moviSize := int(binary.LittleEndian.Uint32(data[aviMoviOffset-4 : aviMoviOffset]))
+	index := data[aviMoviOffset+moviSize:]
+	require.Equal(t, "idx1", string(index[0:4]))
+	entries := make([]aviIndexEntry, binary.LittleEndian.Uint32(index[4:8])/16)
+	err = binary.Read(bytes.NewReader(index[8:]), binary.LittleEndian, entries)
+	require.NoError(t, err)
+
+	var frames [][]byte
+	for _, e := range entries {
+		offset := aviMoviOffset + int(e.Offset)
+		require.Equal(t, "00dc", string(data[offset:offset+4]))
+		frames = append(frames, data[offset+8:offset+8+int(e.Size)])
+	}
+	return header, frames
+}
+
+func TestAVIWriter(t *testing.T) {
+	storage := runtime.NewTemporaryTestFolderOrPanic()
+	defer storage.Remove()
+	f, err := storage.NewFile()
+	require.NoError(t, err)
+	defer f.Close()
+
+	a, err := newAVIWriter(f, 640, 480, 10)
+	require.NoError(t, err)
+	require.NoError(t, a.WriteFrame([]byte("odd")))
+	require.NoError(t, a.WriteFrame([]byte("even")))
+	require.NoError(t, a.Close())
+
+	data, err := ioutil.ReadFile(f.Path())
+	require.NoError(t, err)
+	header, frames := readAVI(t, data)
+	require.Equal(t, uint32(2), header.TotalFrames)
+	require.Equal(t, uint32(640), header.Width)
+	require.Equal(t, uint32(100000), header.MicroSecPerFrame)
+	require.Equal(t, [][]byte{[]byte("odd"), []byte("even")}, frames)
+}
+
+func TestScreenRecording(t *testing.T) {
+	taskID := slugid.Nice()
+	var m sync.Mutex
+	var upload []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m.Lock()
+		upload = data
+		m.Unlock()
+	}))
+	defer ts.Close()
+
+	s3resp, _ := json.Marshal(queue.S3ArtifactResponse{PutURL: ts.URL})
+	resp := queue.PostArtifactResponse(s3resp)
+	mockedQueue := &client.MockQueue{}
+	mockedQueue.On(
+		"CreateArtifact", taskID, "0", artifactName, client.PostS3ArtifactRequest,
+	).Return(&resp, nil)
+
+	plugintest.Case{
+		Payload: `{
+			"delay": 500,
+			"function": "true",
+			"argument": "whatever",
+			"screenRecording": {"frameRate": 10}
+		}`,
+		Plugin:        "screenrecording",
+		PluginConfig:  `{"quality": 50}`,
+		PluginSuccess: true,
+		EngineSuccess: true,
+		QueueMock:     mockedQueue,
+		TaskID:        taskID,
+	}.Test()
+	mockedQueue.AssertExpectations(t)
+
+	m.Lock()
+	defer m.Unlock()
+	header, frames := readAVI(t, upload)
+	require.NotEmpty(t, frames)
+	require.Equal(t, len(frames), int(header.TotalFrames))
+	img, err := jpeg.Decode(bytes.NewReader(frames[len(frames)-1]))
+	require.NoError(t, err)
+	require.Equal(t, int(header.Width), img.Bounds().Dx())
+	require.Equal(t, int(header.Height), img.Bounds().Dy())
+}
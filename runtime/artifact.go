@@ -42,28 +42,13 @@ type RedirectArtifact struct {
 	Expires  time.Time
 }
 
-// UploadS3Artifact is responsible for creating new artifacts
-// in the queue and then performing the upload to s3.
+// UploadS3Artifact is responsible for creating new artifacts in the queue and
+// uploading the content, using the ArtifactBackend of the TaskContext.
+//
+// By default the S3ArtifactBackend is used, which creates an 's3' artifact
+// and uploads the content with a single PUT request.
 func (context *TaskContext) UploadS3Artifact(artifact S3Artifact) error {
-	req, err := json.Marshal(queue.S3ArtifactRequest{
-		ContentType: artifact.Mimetype,
-		Expires:     tcclient.Time(artifact.Expires),
-		StorageType: "s3",
-	})
-	if err != nil {
-		panic(errors.Wrap(err, "failed to Marshal json that should have worked"))
-	}
-
-	parsed, err := context.createArtifact(artifact.Name, req)
-	if err != nil {
-		return err
-	}
-	var resp queue.S3ArtifactResponse
-	if err = json.Unmarshal(parsed, &resp); err != nil {
-		panic(errors.Wrap(err, "failed to parse JSON that have been parsed before"))
-	}
-
-	return putArtifact(resp.PutURL, artifact.Mimetype, artifact.Stream, artifact.AdditionalHeaders)
+	return context.ArtifactBackend().UploadArtifact(context, artifact)
 }
 
 // CreateErrorArtifact is responsible for inserting error
@@ -0,0 +1,317 @@
+package runtime
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	got "github.com/taskcluster/go-got"
+	tcclient "github.com/taskcluster/taskcluster-client-go"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+	"github.com/taskcluster/taskcluster-worker/runtime/client"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// An ArtifactBackend uploads the content of artifacts for a TaskContext.
+//
+// Implementations decide which storageType is used when creating the artifact
+// with the queue, and how the content is transferred.
+type ArtifactBackend interface {
+	UploadArtifact(context *TaskContext, artifact S3Artifact) error
+}
+
+// S3ArtifactBackend uploads artifacts using the 's3' storageType, with a
+// single PUT request to the signed URL returned by the queue. This is the
+// default ArtifactBackend.
+type S3ArtifactBackend struct{}
+
+// UploadArtifact creates an 's3' artifact and uploads the content.
+func (S3ArtifactBackend) UploadArtifact(context *TaskContext, artifact S3Artifact) error {
+	req, err := json.Marshal(queue.S3ArtifactRequest{
+		ContentType: artifact.Mimetype,
+		Expires:     tcclient.Time(artifact.Expires),
+		StorageType: "s3",
+	})
+	if err != nil {
+		panic(errors.Wrap(err, "failed to Marshal json that should have worked"))
+	}
+
+	parsed, err := context.createArtifact(artifact.Name, req)
+	if err != nil {
+		return err
+	}
+	var resp queue.S3ArtifactResponse
+	if err = json.Unmarshal(parsed, &resp); err != nil {
+		panic(errors.Wrap(err, "failed to parse JSON that have been parsed before"))
+	}
+
+	return putArtifact(resp.PutURL, artifact.Mimetype, artifact.Stream, artifact.AdditionalHeaders)
+}
+
+// Defaults and limits for BlobArtifactBackend
+const (
+	defaultBlobPartSize    = 64 * 1024 * 1024
+	defaultBlobConcurrency = 4
+	maxBlobParts           = 10000
+	maxBlobPartAttempts    = 10
+)
+
+// BlobArtifactBackend uploads artifacts using the 'blob' storageType. The
+// artifact is split into parts, which are uploaded in parallel and retried
+// individually, so large artifacts can be uploaded over flaky connections.
+//
+// The sha256 of each part and the entire artifact is given to the queue, and
+// each part is uploaded with a Content-MD5 header, such that the content is
+// verified by the storage service.
+type BlobArtifactBackend struct {
+	PartSize    int64 // Size of each part in bytes, defaults to 64 MiB
+	Concurrency int   // Number of parts to upload in parallel, defaults to 4
+}
+
+type blobPart struct {
+	Sha256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+type blobArtifactRequest struct {
+	StorageType     string        `json:"storageType"`
+	Expires         tcclient.Time `json:"expires"`
+	ContentType     string        `json:"contentType"`
+	ContentEncoding string        `json:"contentEncoding,omitempty"`
+	ContentSha256   string        `json:"contentSha256"`
+	ContentLength   int64         `json:"contentLength"`
+	Parts           []blobPart    `json:"parts"`
+}
+
+type blobArtifactResponse struct {
+	StorageType string `json:"storageType"`
+	Requests    []struct {
+		URL     string            `json:"url"`
+		Method  string            `json:"method"`
+		Headers map[string]string `json:"headers"`
+	} `json:"requests"`
+}
+
+// UploadArtifact creates a 'blob' artifact, uploads the parts and completes
+// the artifact.
+func (b BlobArtifactBackend) UploadArtifact(context *TaskContext, artifact S3Artifact) error {
+	size, err := artifact.Stream.Seek(0, io.SeekEnd)
+	if err != nil {
+		return errors.Wrap(err, "failed to seek end of stream for content-length detection")
+	}
+	partSize := b.PartSize
+	if partSize <= 0 {
+		partSize = defaultBlobPartSize
+	}
+	if size > partSize*maxBlobParts {
+		partSize = (size + maxBlobParts - 1) / maxBlobParts
+	}
+
+	// Hash the content and each part
+	if _, err = artifact.Stream.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to seek start of stream for hashing")
+	}
+	var parts []blobPart
+	var md5s []string
+	contentHash := sha256.New()
+	for offset := int64(0); offset < size || len(parts) == 0; offset += partSize {
+		n := partSize
+		if size-offset < n {
+			n = size - offset
+		}
+		partHash := sha256.New()
+		partMD5 := md5.New()
+		_, err = io.CopyN(io.MultiWriter(contentHash, partHash, partMD5), artifact.Stream, n)
+		if err != nil {
+			return errors.Wrap(err, "failed to read stream for hashing")
+		}
+		parts = append(parts, blobPart{
+			Sha256: hex.EncodeToString(partHash.Sum(nil)),
+			Size:   n,
+		})
+		md5s = append(md5s, base64.StdEncoding.EncodeToString(partMD5.Sum(nil)))
+	}
+
+	// Create the artifact
+	req, err := json.Marshal(blobArtifactRequest{
+		StorageType:     "blob",
+		Expires:         tcclient.Time(artifact.Expires),
+		ContentType:     artifact.Mimetype,
+		ContentEncoding: artifact.AdditionalHeaders["Content-Encoding"],
+		ContentSha256:   hex.EncodeToString(contentHash.Sum(nil)),
+		ContentLength:   size,
+		Parts:           parts,
+	})
+	if err != nil {
+		panic(errors.Wrap(err, "failed to Marshal json that should have worked"))
+	}
+	parsed, err := context.createArtifact(artifact.Name, req)
+	if err != nil {
+		return err
+	}
+	var resp blobArtifactResponse
+	if err = json.Unmarshal(parsed, &resp); err != nil {
+		return errors.Wrap(err, "failed to parse response from createArtifact")
+	}
+	if len(resp.Requests) != len(parts) {
+		return errors.Errorf(
+			"createArtifact returned %d requests for %d parts", len(resp.Requests), len(parts),
+		)
+	}
+
+	// Upload parts in parallel, reading from the stream with ReadAt
+	concurrency := b.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBlobConcurrency
+	}
+	ra, ok := artifact.Stream.(io.ReaderAt)
+	if !ok {
+		ra = &seekingReaderAt{r: artifact.Stream}
+	}
+	etags := make([]string, len(parts))
+	errs := make([]error, len(parts))
+	indexes := make(chan int)
+	go func() {
+		for i := range parts {
+			indexes <- i
+		}
+		close(indexes)
+	}()
+	util.Spawn(concurrency, func(int) {
+		for i := range indexes {
+			r := resp.Requests[i]
+			body := io.NewSectionReader(ra, int64(i)*partSize, parts[i].Size)
+			etags[i], errs[i] = putBlobPart(r.Method, r.URL, r.Headers, md5s[i], body)
+		}
+	})
+	for i, err := range errs {
+		if err != nil {
+			return errors.Wrapf(err, "failed to upload part %d of %d", i+1, len(parts))
+		}
+	}
+
+	// Complete the artifact
+	return client.CompleteArtifact(
+		context.Queue(), context.TaskID, strconv.Itoa(context.RunID), artifact.Name,
+		&client.CompleteArtifactRequest{ETags: etags},
+	)
+}
+
+// putBlobPart uploads body using method, URL and headers from the queue,
+// retrying on 5xx errors, and returns the ETag from the response.
+func putBlobPart(method, url string, headers map[string]string, contentMD5 string, body *io.SectionReader) (string, error) {
+	backoff := got.DefaultBackOff
+	httpClient := &http.Client{
+		Timeout: 10 * time.Minute, // There should be _some_ timeout, this seems like a good starting value.
+	}
+	var err error
+	for attempts := 1; attempts <= maxBlobPartAttempts; attempts++ {
+		if attempts > 1 {
+			time.Sleep(backoff.Delay(attempts - 1))
+		}
+		var reqBody io.Reader = http.NoBody
+		if body.Size() > 0 {
+			reqBody = io.NewSectionReader(body, 0, body.Size())
+		}
+		var req *http.Request
+		req, err = http.NewRequest(method, url, reqBody)
+		if err != nil {
+			return "", errors.Wrap(err, "invalid request returned from createArtifact")
+		}
+		req.ContentLength = body.Size()
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		req.Header.Set("Content-MD5", contentMD5)
+
+		var res *http.Response
+		res, err = httpClient.Do(req)
+		if err != nil {
+			continue
+		}
+		dump, _ := httputil.DumpResponse(res, true)
+		res.Body.Close()
+		if res.StatusCode/100 == 5 {
+			err = errors.Errorf("HTTP status: %d, response: %s", res.StatusCode, string(dump))
+			continue
+		}
+		if res.StatusCode/100 != 2 {
+			return "", errors.Errorf("HTTP status: %d, response: %s", res.StatusCode, string(dump))
+		}
+		etag := res.Header.Get("ETag")
+		if etag == "" {
+			return "", errors.New("response for uploaded part is missing an ETag header")
+		}
+		return etag, nil
+	}
+	return "", err
+}
+
+// seekingReaderAt implements io.ReaderAt for an io.ReadSeeker, by seeking
+// before each read.
+type seekingReaderAt struct {
+	m sync.Mutex
+	r io.ReadSeeker
+}
+
+func (s *seekingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if _, err := s.r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(s.r, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// FileSystemArtifactBackend stores artifacts in a local folder instead of
+// uploading them, this is mostly useful for tests.
+//
+// Artifacts are written to '<Folder>/<taskId>/<runId>/<name>', and the queue
+// isn't contacted.
+type FileSystemArtifactBackend struct {
+	Folder string
+}
+
+// UploadArtifact writes the artifact to the folder.
+func (b FileSystemArtifactBackend) UploadArtifact(context *TaskContext, artifact S3Artifact) error {
+	folder := filepath.Join(b.Folder, context.TaskID, strconv.Itoa(context.RunID))
+	target := filepath.Join(folder, filepath.FromSlash(artifact.Name))
+	if !strings.HasPrefix(target, folder+string(filepath.Separator)) {
+		return fmt.Errorf("invalid artifact name: '%s'", artifact.Name)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+		return errors.Wrap(err, "failed to create folder for artifact")
+	}
+	if _, err := artifact.Stream.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "failed to seek start of stream")
+	}
+
+	f, err := os.Create(target)
+	if err != nil {
+		return errors.Wrap(err, "failed to create file for artifact")
+	}
+	_, err = io.Copy(f, artifact.Stream)
+	cerr := f.Close()
+	if err == nil {
+		err = cerr
+	}
+	return err
+}
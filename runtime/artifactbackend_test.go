@@ -0,0 +1,149 @@
+package runtime
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/slugid-go/slugid"
+	tcclient "github.com/taskcluster/taskcluster-client-go"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+	"github.com/taskcluster/taskcluster-worker/runtime/ioext"
+	"github.com/taskcluster/taskcluster-worker/worker/workertest/fakequeue"
+)
+
+// flakyParts wraps a handler such that the first upload of each part fails
+type flakyParts struct {
+	m       sync.Mutex
+	handler http.Handler
+	failed  map[string]bool
+}
+
+func (f *flakyParts) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.Contains(r.URL.Path, "/put-part/") && r.Method == http.MethodPut {
+		f.m.Lock()
+		failed := f.failed[r.URL.Path]
+		f.failed[r.URL.Path] = true
+		f.m.Unlock()
+		if !failed {
+			ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+	f.handler.ServeHTTP(w, r)
+}
+
+func TestBlobArtifactBackend(t *testing.T) {
+	s := httptest.NewServer(&flakyParts{
+		handler: fakequeue.New(),
+		failed:  make(map[string]bool),
+	})
+	defer s.Close()
+
+	q := queue.New(&tcclient.Credentials{})
+	q.BaseURL = s.URL
+
+	// Create and claim a task, so we can create artifacts
+	taskID := slugid.Nice()
+	task := queue.TaskDefinitionRequest{
+		ProvisionerID: "dummy-provisioner",
+		WorkerType:    "dummy-worker-type",
+		Created:       tcclient.Time(time.Now()),
+		Deadline:      tcclient.Time(time.Now().Add(60 * time.Minute)),
+		Payload:       json.RawMessage(`{}`),
+	}
+	task.Metadata.Name = "test task"
+	task.Metadata.Description = "Task for testing BlobArtifactBackend"
+	task.Metadata.Source = "https://github.com/taskcluster/taskcluster-worker/tree/master/runtime/artifactbackend_test.go"
+	task.Metadata.Owner = "test@example.com"
+	_, err := q.CreateTask(taskID, &task)
+	require.NoError(t, err)
+	_, err = q.ClaimTask(taskID, "0", &queue.TaskClaimRequest{
+		WorkerGroup: "test-worker-group",
+		WorkerID:    "test-worker",
+	})
+	require.NoError(t, err)
+
+	ctx, control, err := NewTaskContext(filepath.Join(os.TempDir(), slugid.Nice()), TaskInfo{
+		TaskID: taskID,
+		RunID:  0,
+	})
+	require.NoError(t, err)
+	defer control.Dispose()
+	defer control.CloseLog()
+	control.SetQueueClient(q)
+	control.SetArtifactBackend(BlobArtifactBackend{
+		PartSize:    1024,
+		Concurrency: 3,
+	})
+
+	// Upload 10 parts and a bit, with NopCloser so we're not using io.ReaderAt
+	data := make([]byte, 10*1024+17)
+	rand.Read(data)
+	err = ctx.UploadS3Artifact(S3Artifact{
+		Name:     "public/blob.bin",
+		Mimetype: "application/octet-stream",
+		Expires:  time.Now().Add(time.Hour),
+		Stream:   ioext.NopCloser(bytes.NewReader(data)),
+	})
+	require.NoError(t, err)
+
+	res, err := http.Get(s.URL + "/task/" + taskID + "/runs/0/artifacts/public/blob.bin")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	result, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, data, result)
+
+	// Upload an empty artifact
+	err = ctx.UploadS3Artifact(S3Artifact{
+		Name:     "public/empty.txt",
+		Mimetype: "text/plain",
+		Expires:  time.Now().Add(time.Hour),
+		Stream:   ioext.NopCloser(bytes.NewReader(nil)),
+	})
+	require.NoError(t, err)
+}
+
+func TestFileSystemArtifactBackend(t *testing.T) {
+	folder, err := ioutil.TempDir("", "artifactbackend-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+
+	ctx, control, err := NewTaskContext(filepath.Join(folder, "log"), TaskInfo{
+		TaskID: "my-task-id",
+		RunID:  1,
+	})
+	require.NoError(t, err)
+	defer control.Dispose()
+	defer control.CloseLog()
+	control.SetArtifactBackend(FileSystemArtifactBackend{Folder: folder})
+
+	err = ctx.UploadS3Artifact(S3Artifact{
+		Name:     "public/hello.txt",
+		Mimetype: "text/plain",
+		Stream:   ioext.NopCloser(strings.NewReader("hello-world")),
+	})
+	require.NoError(t, err)
+	result, err := ioutil.ReadFile(filepath.Join(folder, "my-task-id", "1", "public", "hello.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "hello-world", string(result))
+
+	err = ctx.UploadS3Artifact(S3Artifact{
+		Name:   "../escape.txt",
+		Stream: ioext.NopCloser(strings.NewReader("bad")),
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"errors"
+	"net/url"
+
+	tcclient "github.com/taskcluster/taskcluster-client-go"
+	"github.com/taskcluster/taskcluster-client-go/queue"
+)
+
+// CompleteArtifactRequest is the payload for the queue.completeArtifact
+// end-point, which completes a blob artifact after all parts are uploaded.
+type CompleteArtifactRequest struct {
+	// ETags returned from uploading each part, in order of the parts
+	ETags []string `json:"etags"`
+}
+
+// An ArtifactCompleter is a queue client that can complete blob artifacts.
+//
+// The queue client from taskcluster-client-go doesn't expose the
+// completeArtifact end-point, so CompleteArtifact() will call the end-point
+// directly, other queue clients must implement this interface.
+type ArtifactCompleter interface {
+	CompleteArtifact(taskID, runID, name string, payload *CompleteArtifactRequest) error
+}
+
+// ErrCompleteArtifactNotSupported is returned from CompleteArtifact() if the
+// queue client doesn't support completing artifacts.
+var ErrCompleteArtifactNotSupported = errors.New("queue client doesn't support completeArtifact")
+
+// CompleteArtifact calls queue.completeArtifact for the artifact with name
+// in taskID and runID using q.
+func CompleteArtifact(q Queue, taskID, runID, name string, payload *CompleteArtifactRequest) error {
+	if c, ok := q.(ArtifactCompleter); ok {
+		return c.CompleteArtifact(taskID, runID, name, payload)
+	}
+	if tq, ok := q.(*queue.Queue); ok {
+		c := tcclient.Client(*tq)
+		_, _, err := (&c).APICall(
+			payload, "PUT",
+			"/task/"+url.QueryEscape(taskID)+"/runs/"+url.QueryEscape(runID)+"/artifacts/"+url.QueryEscape(name),
+			nil, nil,
+		)
+		return err
+	}
+	return ErrCompleteArtifactNotSupported
+}
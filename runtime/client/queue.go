@@ -22,6 +22,7 @@ import (
 // taskcluster-client-go package.  Passing around an interface allows the
 // queue client to be mocked
 type Queue interface {
+	Task(string) (*queue.TaskDefinitionResponse, error)
 	Status(string) (*queue.TaskStatusResponse, error)
 	ReportCompleted(string, string) (*queue.TaskStatusResponse, error)
 	ReportException(string, string, *queue.TaskExceptionRequest) (*queue.TaskStatusResponse, error)
@@ -32,6 +33,7 @@ type Queue interface {
 	PollTaskUrls(string, string) (*queue.PollTaskUrlsResponse, error)
 	CancelTask(string) (*queue.TaskStatusResponse, error)
 	CreateArtifact(string, string, string, *queue.PostArtifactRequest) (*queue.PostArtifactResponse, error)
+	ListArtifacts(taskID, runID, continuationToken, limit string) (*queue.ListArtifactsResponse, error)
 	GetArtifact_SignedURL(string, string, string, time.Duration) (*url.URL, error) // nolint
 }
 
@@ -45,6 +47,12 @@ type MockQueue struct {
 	mock.Mock
 }
 
+// Task is a mock implementation of github.com/taskcluster/taskcluster-client-go/queue.Task
+func (m *MockQueue) Task(taskID string) (*queue.TaskDefinitionResponse, error) {
+	args := m.Called(taskID)
+	return args.Get(0).(*queue.TaskDefinitionResponse), args.Error(1)
+}
+
 // Status is a mock implementation of github.com/taskcluster/taskcluster-client-go/queue.Status
 func (m *MockQueue) Status(taskID string) (*queue.TaskStatusResponse, error) {
 	args := m.Called(taskID)
@@ -105,6 +113,18 @@ func (m *MockQueue) CreateArtifact(taskID, runID, name string, payload *queue.Po
 	return args.Get(0).(*queue.PostArtifactResponse), args.Error(1)
 }
 
+// ListArtifacts is a mock implementation of github.com/taskcluster/taskcluster-client-go/queue.ListArtifacts
+func (m *MockQueue) ListArtifacts(taskID, runID, continuationToken, limit string) (*queue.ListArtifactsResponse, error) {
+	args := m.Called(taskID, runID, continuationToken, limit)
+	return args.Get(0).(*queue.ListArtifactsResponse), args.Error(1)
+}
+
+// CompleteArtifact is a mock implementation of the queue.completeArtifact end-point
+func (m *MockQueue) CompleteArtifact(taskID, runID, name string, payload *CompleteArtifactRequest) error {
+	args := m.Called(taskID, runID, name, payload)
+	return args.Error(0)
+}
+
 // GetArtifact_SignedURL is a mock implementation of github.com/taskcluster/taskcluster-client-go/queue.GetArtifact_SignedURL
 func (m *MockQueue) GetArtifact_SignedURL(taskID, runID, name string, duration time.Duration) (*url.URL, error) { // nolint
 	args := m.Called(taskID, runID, name, duration)
@@ -14,9 +14,10 @@ type Environment struct {
 	TemporaryStorage
 	webhookserver.WebHookServer // Optional, may be nil if not available
 	Monitor
-	Worker        Stoppable
-	ProvisionerID string
-	WorkerType    string
-	WorkerGroup   string
-	WorkerID      string
+	Worker          Stoppable
+	ArtifactBackend ArtifactBackend // Optional, S3ArtifactBackend is used if nil
+	ProvisionerID   string
+	WorkerType      string
+	WorkerGroup     string
+	WorkerID        string
 }
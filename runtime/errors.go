@@ -32,6 +32,24 @@ var ErrNonFatalInternalError = errors.New("Encountered a non-fatal internal erro
 // error reporting.
 var ErrFatalInternalError = errors.New("Encountered a fatal internal error")
 
+// ErrIntermittentTask is used to indicate that the task failed in a manner
+// known to be intermittent, and that the task should be retried.
+//
+// Worker should resolve the task as exception with reason 'intermittent-task',
+// which causes the queue to rerun the task, if it has retries left. The
+// engine/plugin which returned this error should explain in the task log why
+// the task is considered intermittent.
+var ErrIntermittentTask = errors.New("Task failed intermittently")
+
+// ErrTaskResultReused is used to indicate that the result of a previous run has
+// been published for the current task, and that the sandbox should not be run.
+//
+// This may only be returned from TaskPlugin.BuildSandbox(), worker should then
+// skip the execution of the sandbox and resolve the task successfully. The
+// plugin which returned this error must already have created the artifacts
+// and explained in the task log which result was reused.
+var ErrTaskResultReused = errors.New("Result of a previous run was reused")
+
 // The MalformedPayloadError error type is used to indicate that some operation
 // failed because of malformed-payload.
 //
@@ -151,6 +151,13 @@ func (gc *GarbageCollector) Collect() error {
 	return nil
 }
 
+// ResourceCount returns the number of resources currently tracked.
+func (gc *GarbageCollector) ResourceCount() int {
+	gc.m.Lock()
+	defer gc.m.Unlock()
+	return len(gc.resources)
+}
+
 // CollectAll disposes all resources that can be disposed.
 //
 // All resources not returning: ErrDisposableInUse.
@@ -173,19 +180,61 @@ func (gc *GarbageCollector) CollectAll() error {
 	return nil
 }
 
+// FreeDiskSpace returns the number of bytes of disk space available in the
+// storage folder beyond minimumDiskSpace. This is negative, if garbage
+// collection is needed to satisfy minimumDiskSpace.
+func (gc *GarbageCollector) FreeDiskSpace() (int64, error) {
+	stat, err := disk.Usage(gc.storageFolder)
+	if err != nil {
+		return 0, err
+	}
+	return int64(stat.Free) - gc.minimumDiskSpace, nil
+}
+
+// FreeMemory returns the number of bytes of memory available beyond
+// minimumMemory. This is negative, if garbage collection is needed to satisfy
+// minimumMemory.
+func (gc *GarbageCollector) FreeMemory() (int64, error) {
+	stat, err := mem.VirtualMemory()
+	if err != nil {
+		return 0, err
+	}
+	return int64(stat.Available) - gc.minimumMemory, nil
+}
+
+// TotalDiskSpace returns the size in bytes of the file system holding the
+// storage folder beyond minimumDiskSpace.
+func (gc *GarbageCollector) TotalDiskSpace() (int64, error) {
+	stat, err := disk.Usage(gc.storageFolder)
+	if err != nil {
+		return 0, err
+	}
+	return int64(stat.Total) - gc.minimumDiskSpace, nil
+}
+
+// TotalMemory returns the number of bytes of physical memory beyond
+// minimumMemory.
+func (gc *GarbageCollector) TotalMemory() (int64, error) {
+	stat, err := mem.VirtualMemory()
+	if err != nil {
+		return 0, err
+	}
+	return int64(stat.Total) - gc.minimumMemory, nil
+}
+
 // needDiskSpace returns true if we need to free diskspace
 func (gc *GarbageCollector) needDiskSpace() bool {
 	// If we have no metrics or minimum diskspace we remove everything
 	if gc.minimumDiskSpace == 0 || gc.storageFolder == "" {
 		return true
 	}
-	stat, err := disk.Usage(gc.storageFolder)
+	free, err := gc.FreeDiskSpace()
 	if err != nil {
 		// TODO: Write a warning to the log
 		return true
 	}
 
-	return int64(stat.Free) < gc.minimumDiskSpace
+	return free < 0
 }
 
 // needMemory returns true if we need to free memory
@@ -194,11 +243,11 @@ func (gc *GarbageCollector) needMemory() bool {
 	if gc.minimumMemory == 0 {
 		return true
 	}
-	stat, err := mem.VirtualMemory()
+	free, err := gc.FreeMemory()
 	if err != nil {
 		// TODO: Write a warning to the log
 		return true
 	}
 
-	return int64(stat.Available) < gc.minimumMemory
+	return free < 0
 }
@@ -0,0 +1,36 @@
+package monitoring
+
+import (
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+)
+
+// SetLogLevel changes the log-level of a monitor created by this package at
+// runtime. As monitors derived using WithPrefix() and WithTags() share the
+// same logger, this affects all monitors derived from the same root monitor.
+//
+// Returns an error if the log-level is invalid or the monitor doesn't support
+// changing log-level, such as mock monitors.
+func SetLogLevel(m runtime.Monitor, logLevel string) error {
+	level, err := logrus.ParseLevel(logLevel)
+	if err != nil {
+		return fmt.Errorf("unsupported log-level: '%s'", logLevel)
+	}
+
+	var logger *logrus.Logger
+	switch m := m.(type) {
+	case *monitor:
+		logger = m.Entry.Logger
+	case *loggingMonitor:
+		logger = m.Entry.Logger
+	default:
+		return fmt.Errorf("monitor of type %T doesn't support changing log-level", m)
+	}
+
+	// logrus reads Level without synchronization, so log statements running
+	// concurrently may briefly use the previous log-level, which is harmless.
+	logger.Level = level
+	return nil
+}
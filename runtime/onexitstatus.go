@@ -0,0 +1,66 @@
+package runtime
+
+import (
+	schematypes "github.com/taskcluster/go-schematypes"
+	"github.com/taskcluster/taskcluster-worker/runtime/util"
+)
+
+// OnExitStatus is the 'onExitStatus' property in task.payload, declaring
+// actions to take when the task command exits with specific exit codes.
+//
+// The properties are implemented by different plugins, each plugin declares
+// the properties it implements using OnExitStatusSchema(), and the plugin
+// manager merges these declarations.
+type OnExitStatus struct {
+	Retry       []int `json:"retry"`
+	PurgeCaches []int `json:"purgeCaches"`
+}
+
+var exitCodeSchema = schematypes.Integer{
+	Title:   "Exit Code",
+	Minimum: 0,
+	Maximum: 255,
+}
+
+// OnExitStatusSchema returns a schema for the 'onExitStatus' property in
+// task.payload declaring the given properties, see ExitCodesSchema().
+func OnExitStatusSchema(properties schematypes.Properties) schematypes.Object {
+	return schematypes.Object{
+		Title: "Behavior on Exit Status",
+		Description: util.Markdown(`
+			Actions to take when the task command exits with specific exit codes.
+			Exit codes are ignored, if the task command exited successfully.
+		`),
+		Properties: properties,
+	}
+}
+
+// ExitCodesSchema returns a schema for a list of unique exit codes.
+func ExitCodesSchema(title, description string) schematypes.Array {
+	return schematypes.Array{
+		Title:       title,
+		Description: description,
+		Items:       exitCodeSchema,
+		Unique:      true,
+	}
+}
+
+// ShouldRetry returns true, if the task should be retried when exiting code
+func (o OnExitStatus) ShouldRetry(code int) bool {
+	return containsExitCode(o.Retry, code)
+}
+
+// ShouldPurgeCaches returns true, if caches should be purged when the task
+// exits code
+func (o OnExitStatus) ShouldPurgeCaches(code int) bool {
+	return containsExitCode(o.PurgeCaches, code)
+}
+
+func containsExitCode(codes []int, code int) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,14 @@
+// Package processstate provides helpers for reading the exit status and
+// resource usage from the os.ProcessState of a terminated process, for engines
+// that run task commands as processes on the host.
+package processstate
+
+import "time"
+
+// ResourceUsage is the resources used by a process that has terminated.
+type ResourceUsage struct {
+	WallTime   time.Duration // Time from the process was started until it exited
+	UserTime   time.Duration // CPU time spent in user-mode
+	SystemTime time.Duration // CPU time spent in kernel-mode
+	MaxMemory  uint64        // Peak resident memory in bytes, zero if unknown
+}
@@ -0,0 +1,47 @@
+// +build !windows
+
+package processstate
+
+import (
+	"os"
+	goruntime "runtime"
+	"syscall"
+	"time"
+)
+
+// ExitStatusOf returns the exit code from state, or -1 and a description of
+// the signal, if the process was terminated by a signal.
+//
+// If state is nil, this returns -1 and an empty signal.
+func ExitStatusOf(state *os.ProcessState) (code int, signal string) {
+	if state == nil {
+		return -1, ""
+	}
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok {
+		return -1, ""
+	}
+	if status.Signaled() {
+		return -1, status.Signal().String()
+	}
+	return status.ExitStatus(), ""
+}
+
+// ResourceUsageOf returns the resources used by the process from state, given
+// the wallTime from the process was started until it exited.
+func ResourceUsageOf(state *os.ProcessState, wallTime time.Duration) ResourceUsage {
+	usage := ResourceUsage{WallTime: wallTime}
+	if state == nil {
+		return usage
+	}
+	usage.UserTime = state.UserTime()
+	usage.SystemTime = state.SystemTime()
+	if rusage, ok := state.SysUsage().(*syscall.Rusage); ok && rusage.Maxrss > 0 {
+		// maxrss is in bytes on darwin and in kilobytes elsewhere
+		usage.MaxMemory = uint64(rusage.Maxrss)
+		if goruntime.GOOS != "darwin" {
+			usage.MaxMemory *= 1024
+		}
+	}
+	return usage
+}
@@ -0,0 +1,39 @@
+// +build !windows
+
+package processstate
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExitStatusOf(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "exit 3")
+	assert.Error(t, cmd.Run())
+	code, signal := ExitStatusOf(cmd.ProcessState)
+	assert.Equal(t, 3, code)
+	assert.Equal(t, "", signal)
+
+	cmd = exec.Command("sh", "-c", "kill -9 $$")
+	assert.Error(t, cmd.Run())
+	code, signal = ExitStatusOf(cmd.ProcessState)
+	assert.Equal(t, -1, code)
+	assert.Equal(t, "killed", signal)
+
+	code, signal = ExitStatusOf(nil)
+	assert.Equal(t, -1, code)
+	assert.Equal(t, "", signal)
+}
+
+func TestResourceUsageOf(t *testing.T) {
+	cmd := exec.Command("true")
+	assert.NoError(t, cmd.Run())
+	usage := ResourceUsageOf(cmd.ProcessState, time.Second)
+	assert.Equal(t, time.Second, usage.WallTime)
+	assert.NotZero(t, usage.MaxMemory, "expected peak memory usage")
+
+	assert.Equal(t, ResourceUsage{WallTime: time.Second}, ResourceUsageOf(nil, time.Second))
+}
@@ -0,0 +1,31 @@
+package processstate
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// ExitStatusOf returns the exit code from state, processes are not terminated
+// by signals on windows.
+//
+// If state is nil, this returns -1 and an empty signal.
+func ExitStatusOf(state *os.ProcessState) (code int, signal string) {
+	if state == nil {
+		return -1, ""
+	}
+	return state.Sys().(syscall.WaitStatus).ExitStatus(), ""
+}
+
+// ResourceUsageOf returns the resources used by the process from state, given
+// the wallTime from the process was started until it exited. Peak memory usage
+// is not available on windows.
+func ResourceUsageOf(state *os.ProcessState, wallTime time.Duration) ResourceUsage {
+	usage := ResourceUsage{WallTime: wallTime}
+	if state == nil {
+		return usage
+	}
+	usage.UserTime = state.UserTime()
+	usage.SystemTime = state.SystemTime()
+	return usage
+}
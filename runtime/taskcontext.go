@@ -66,6 +66,7 @@ type TaskContext struct {
 	logClosed   bool
 	mu          sync.RWMutex
 	queue       client.Queue
+	backend     ArtifactBackend
 	status      TaskStatus
 	done        chan struct{}
 	authorizer  client.Authorizer
@@ -135,6 +136,26 @@ func (c *TaskContextController) SetQueueClient(client client.Queue) {
 	c.queue = client
 }
 
+// SetArtifactBackend will set the ArtifactBackend used for uploading artifacts,
+// if nil the S3ArtifactBackend is used.
+func (c *TaskContextController) SetArtifactBackend(backend ArtifactBackend) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.backend = backend
+}
+
+// ArtifactBackend returns the ArtifactBackend used for uploading artifacts.
+func (c *TaskContext) ArtifactBackend() ArtifactBackend {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.backend == nil {
+		return S3ArtifactBackend{}
+	}
+	return c.backend
+}
+
 // Queue will return a client for the TaskCluster Queue.  This client
 // is useful for plugins that require interactions with the queue, such as creating
 // artifacts.
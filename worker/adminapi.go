@@ -0,0 +1,262 @@
+package worker
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/taskcluster/taskcluster-worker/runtime/monitoring"
+	"github.com/taskcluster/taskcluster-worker/worker/taskrun"
+)
+
+// adminAPI is an HTTP server for operators of the machine, all requests must
+// carry the header 'Authorization: Bearer <token>'. Endpoints are:
+//
+//	GET  /status              status of the worker, see adminStatus
+//	POST /drain               stop claiming tasks, exit when tasks are done
+//	POST /stop                abort tasks with worker-shutdown and exit now
+//	POST /tasks/<taskId>/cancel
+//	                          abort task as canceled, without resolving it
+//	POST /gc                  dispose all resources not in use
+//	PUT  /log-level           set log-level, body: {"level": "debug"}
+//
+// Actions respond 204, errors respond with a plain text message.
+type adminAPI struct {
+	worker   *Worker
+	token    string
+	listener net.Listener
+	server   http.Server
+}
+
+// adminStatus is the response from GET /status
+type adminStatus struct {
+	State            string            `json:"state"`  // running, draining or stopping
+	Uptime           int64             `json:"uptime"` // seconds since the worker was created
+	ActiveTasks      int               `json:"activeTasks"`
+	Tasks            []adminTaskStatus `json:"tasks"`
+	GarbageCollector adminGCStatus     `json:"garbageCollector"`
+}
+
+type adminTaskStatus struct {
+	TaskID string `json:"taskId"`
+	RunID  int    `json:"runId"`
+	Stage  string `json:"stage"`
+}
+
+type adminGCStatus struct {
+	Resources     int    `json:"resources"`               // resources tracked
+	FreeMemory    *int64 `json:"freeMemory,omitempty"`    // bytes beyond minimumMemory
+	FreeDiskSpace *int64 `json:"freeDiskSpace,omitempty"` // bytes beyond minimumDiskSpace
+}
+
+// listenAdminAPI listens on a unix-domain socket, if address is an absolute
+// path, otherwise address must be a loopback address and port.
+func listenAdminAPI(address string) (net.Listener, error) {
+	if filepath.IsAbs(address) {
+		// Replace socket left behind by a previous worker, but nothing else
+		if info, err := os.Lstat(address); err == nil {
+			if info.Mode()&os.ModeSocket == 0 {
+				return nil, fmt.Errorf("cannot replace '%s' with a unix-domain socket, as it isn't a socket", address)
+			}
+			if err = os.Remove(address); err != nil {
+				return nil, errors.Wrap(err, "failed to remove existing unix-domain socket")
+			}
+		}
+		l, err := net.Listen("unix", address)
+		if err != nil {
+			return nil, err
+		}
+		if err = os.Chmod(address, 0600); err != nil {
+			l.Close()
+			return nil, errors.Wrap(err, "failed to restrict access to unix-domain socket")
+		}
+		return l, nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("admin API must listen on a loopback address, not '%s'", host)
+	}
+	return net.Listen("tcp", address)
+}
+
+func newAdminAPI(w *Worker, options *adminAPIOptions) (*adminAPI, error) {
+	l, err := listenAdminAPI(options.Listen)
+	if err != nil {
+		return nil, err
+	}
+	a := &adminAPI{
+		worker:   w,
+		token:    options.Token,
+		listener: l,
+	}
+	a.server.Handler = a
+	return a, nil
+}
+
+// Serve requests until Stop() is called
+func (a *adminAPI) Serve() {
+	go func() {
+		err := a.server.Serve(a.listener)
+		if err != http.ErrServerClosed {
+			a.worker.monitor.ReportError(err, "admin API stopped serving requests")
+		}
+	}()
+}
+
+// Stop serving requests and close the listener
+func (a *adminAPI) Stop() {
+	a.server.Close()
+}
+
+func (a *adminAPI) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	auth := []byte(req.Header.Get("Authorization"))
+	if subtle.ConstantTimeCompare(auth, []byte("Bearer "+a.token)) != 1 {
+		http.Error(res, "missing or invalid 'Authorization' header", http.StatusUnauthorized)
+		return
+	}
+
+	path := req.URL.Path
+	switch {
+	case path == "/status":
+		if checkMethod(res, req, http.MethodGet) {
+			a.status(res)
+		}
+	case path == "/drain":
+		if checkMethod(res, req, http.MethodPost) {
+			a.worker.monitor.Info("admin API: stopping gracefully")
+			a.worker.StopGracefully()
+			res.WriteHeader(http.StatusNoContent)
+		}
+	case path == "/stop":
+		if checkMethod(res, req, http.MethodPost) {
+			a.worker.monitor.Info("admin API: stopping now")
+			a.worker.StopNow()
+			res.WriteHeader(http.StatusNoContent)
+		}
+	case strings.HasPrefix(path, "/tasks/") && strings.HasSuffix(path, "/cancel"):
+		if checkMethod(res, req, http.MethodPost) {
+			a.cancelTask(res, strings.TrimSuffix(strings.TrimPrefix(path, "/tasks/"), "/cancel"))
+		}
+	case path == "/gc":
+		if checkMethod(res, req, http.MethodPost) {
+			a.collectGarbage(res)
+		}
+	case path == "/log-level":
+		if checkMethod(res, req, http.MethodPut) {
+			a.setLogLevel(res, req)
+		}
+	default:
+		http.NotFound(res, req)
+	}
+}
+
+// checkMethod responds 405, and returns false if req doesn't have method
+func checkMethod(res http.ResponseWriter, req *http.Request, method string) bool {
+	if req.Method != method {
+		res.Header().Set("Allow", method)
+		http.Error(res, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func (a *adminAPI) status(res http.ResponseWriter) {
+	w := a.worker
+	s := adminStatus{
+		State:       "running",
+		Uptime:      int64(time.Since(w.created) / time.Second),
+		ActiveTasks: w.activeTasks.Value(),
+		Tasks:       []adminTaskStatus{},
+	}
+	if w.lifeCycleTracker.StoppingNow.IsDone() {
+		s.State = "stopping"
+	} else if w.lifeCycleTracker.StoppingGracefully.IsDone() {
+		s.State = "draining"
+	}
+
+	// Copy runs, so runsMutex isn't held while waiting for TaskRun locks
+	w.runsMutex.Lock()
+	runs := make(map[string]activeRun, len(w.runs))
+	for taskID, r := range w.runs {
+		runs[taskID] = r
+	}
+	w.runsMutex.Unlock()
+	for taskID, r := range runs {
+		s.Tasks = append(s.Tasks, adminTaskStatus{
+			TaskID: taskID,
+			RunID:  r.RunID,
+			Stage:  r.Run.Stage().String(),
+		})
+	}
+	sort.Slice(s.Tasks, func(i, j int) bool { return s.Tasks[i].TaskID < s.Tasks[j].TaskID })
+
+	s.GarbageCollector.Resources = w.garbageCollector.ResourceCount()
+	if free, err := w.garbageCollector.FreeMemory(); err == nil {
+		s.GarbageCollector.FreeMemory = &free
+	} else {
+		debug("failed to read free memory, error: %s", err)
+	}
+	if free, err := w.garbageCollector.FreeDiskSpace(); err == nil {
+		s.GarbageCollector.FreeDiskSpace = &free
+	} else {
+		debug("failed to read free disk space, error: %s", err)
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(res).Encode(s)
+}
+
+func (a *adminAPI) cancelTask(res http.ResponseWriter, taskID string) {
+	w := a.worker
+	w.runsMutex.Lock()
+	r, ok := w.runs[taskID]
+	w.runsMutex.Unlock()
+	if !ok {
+		http.Error(res, fmt.Sprintf("task '%s' isn't running on this worker", taskID), http.StatusNotFound)
+		return
+	}
+
+	// Abort as canceled, the run isn't resolved with the queue, so unless the
+	// task is also canceled with queue.cancelTask the claim will expire.
+	w.monitor.WithTag("taskId", taskID).Info("admin API: aborting task as canceled")
+	r.Run.Abort(taskrun.TaskCanceled)
+	res.WriteHeader(http.StatusNoContent)
+}
+
+func (a *adminAPI) collectGarbage(res http.ResponseWriter) {
+	a.worker.monitor.Info("admin API: collecting all garbage")
+	if err := a.worker.garbageCollector.CollectAll(); err != nil {
+		a.worker.monitor.ReportWarning(err, "admin API: garbage collection failed")
+		http.Error(res, fmt.Sprintf("garbage collection failed, error: %s", err), http.StatusInternalServerError)
+		return
+	}
+	res.WriteHeader(http.StatusNoContent)
+}
+
+func (a *adminAPI) setLogLevel(res http.ResponseWriter, req *http.Request) {
+	var body struct {
+		Level string `json:"level"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(res, fmt.Sprintf("invalid JSON body, error: %s", err), http.StatusBadRequest)
+		return
+	}
+	if err := monitoring.SetLogLevel(a.worker.monitor, body.Level); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a.worker.monitor.Infof("admin API: changed log-level to '%s'", body.Level)
+	res.WriteHeader(http.StatusNoContent)
+}
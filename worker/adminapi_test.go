@@ -0,0 +1,160 @@
+package worker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taskcluster/taskcluster-worker/runtime"
+	"github.com/taskcluster/taskcluster-worker/runtime/client"
+	"github.com/taskcluster/taskcluster-worker/runtime/monitoring"
+	"github.com/taskcluster/taskcluster-worker/worker/taskrun"
+)
+
+const testAdminToken = "my-secret-admin-token"
+
+func adminRequest(a *adminAPI, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	res := httptest.NewRecorder()
+	a.ServeHTTP(res, req)
+	return res
+}
+
+func TestAdminAPIAuthentication(t *testing.T) {
+	w := setupTestWorker(t, "", 1)
+	a := &adminAPI{worker: w, token: testAdminToken}
+
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	res := httptest.NewRecorder()
+	a.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+	req.Header.Set("Authorization", "Bearer wrong-token")
+	res = httptest.NewRecorder()
+	a.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+	assert.Equal(t, http.StatusOK, adminRequest(a, http.MethodGet, "/status", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, adminRequest(a, http.MethodGet, "/drain", "").Code)
+	assert.Equal(t, http.StatusNotFound, adminRequest(a, http.MethodGet, "/unknown", "").Code)
+
+	w.StopGracefully()
+	require.NoError(t, w.Start())
+}
+
+func TestAdminAPIStatusAndDrain(t *testing.T) {
+	w := setupTestWorker(t, "", 1)
+	a := &adminAPI{worker: w, token: testAdminToken}
+
+	var s adminStatus
+	res := adminRequest(a, http.MethodGet, "/status", "")
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &s))
+	assert.Equal(t, "running", s.State)
+	assert.Equal(t, 0, s.ActiveTasks)
+	assert.Empty(t, s.Tasks)
+
+	assert.Equal(t, http.StatusNotFound, adminRequest(a, http.MethodPost, "/tasks/unknown-task/cancel", "").Code)
+	assert.Equal(t, http.StatusNoContent, adminRequest(a, http.MethodPost, "/gc", "").Code)
+	assert.Equal(t, http.StatusNoContent, adminRequest(a, http.MethodPost, "/drain", "").Code)
+
+	res = adminRequest(a, http.MethodGet, "/status", "")
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &s))
+	assert.Equal(t, "draining", s.State)
+
+	// Worker stops gracefully as it has been drained
+	require.NoError(t, w.Start())
+}
+
+func TestAdminAPICancelTask(t *testing.T) {
+	w := setupTestWorker(t, "", 1)
+	a := &adminAPI{worker: w, token: testAdminToken}
+
+	run := taskrun.New(taskrun.Options{
+		Environment:   w.environment,
+		Engine:        w.engine,
+		PluginManager: w.plugin,
+		Monitor:       w.monitor,
+		Queue:         &client.MockQueue{},
+		Payload: map[string]interface{}{
+			"delay":    0,
+			"function": "true",
+			"argument": "",
+		},
+		TaskInfo: runtime.TaskInfo{TaskID: "my-task-id"},
+	})
+	w.runsMutex.Lock()
+	w.runs["my-task-id"] = activeRun{RunID: 0, Run: run}
+	w.runsMutex.Unlock()
+
+	var s adminStatus
+	res := adminRequest(a, http.MethodGet, "/status", "")
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &s))
+	require.Len(t, s.Tasks, 1)
+	assert.Equal(t, "my-task-id", s.Tasks[0].TaskID)
+
+	assert.Equal(t, http.StatusNoContent, adminRequest(a, http.MethodPost, "/tasks/my-task-id/cancel", "").Code)
+	_, exception, reason := run.WaitForResult()
+	assert.True(t, exception, "expected task to be aborted")
+	assert.Equal(t, runtime.ReasonCanceled, reason)
+	require.NoError(t, run.Dispose())
+
+	w.StopGracefully()
+	require.NoError(t, w.Start())
+}
+
+func TestAdminAPILogLevel(t *testing.T) {
+	w := setupTestWorker(t, "", 1)
+	a := &adminAPI{worker: w, token: testAdminToken}
+
+	// mock monitor doesn't support changing log-level
+	assert.Equal(t, http.StatusBadRequest, adminRequest(a, http.MethodPut, "/log-level", `{"level": "debug"}`).Code)
+
+	w.monitor = monitoring.NewLoggingMonitor("info", nil, "")
+	assert.Equal(t, http.StatusNoContent, adminRequest(a, http.MethodPut, "/log-level", `{"level": "debug"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, adminRequest(a, http.MethodPut, "/log-level", `{"level": "verbose"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, adminRequest(a, http.MethodPut, "/log-level", `not json`).Code)
+
+	w.StopGracefully()
+	require.NoError(t, w.Start())
+}
+
+func TestAdminAPIListen(t *testing.T) {
+	_, err := listenAdminAPI("0.0.0.0:0")
+	assert.Error(t, err, "expected non-loopback address to be rejected")
+
+	l, err := listenAdminAPI("127.0.0.1:0")
+	require.NoError(t, err)
+	l.Close()
+
+	folder, err := ioutil.TempDir("", "adminapi")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+	socket := filepath.Join(folder, "admin.sock")
+
+	l, err = listenAdminAPI(socket)
+	require.NoError(t, err)
+	info, err := os.Stat(socket)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Sockets left behind are replaced, other files are not
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	l, err = listenAdminAPI(socket)
+	require.NoError(t, err)
+	l.Close()
+
+	file := filepath.Join(folder, "not-a-socket")
+	require.NoError(t, ioutil.WriteFile(file, []byte("data"), 0600))
+	_, err = listenAdminAPI(file)
+	assert.Error(t, err)
+}
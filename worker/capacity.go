@@ -0,0 +1,151 @@
+package worker
+
+import (
+	"sync"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/taskcluster/taskcluster-worker/engines"
+)
+
+const mebibyte = 1024 * 1024
+
+// capacityModel determines how many tasks the worker can claim, given the
+// total memory and disk space not reserved by active tasks, the free memory,
+// free disk space and CPU utilization.
+//
+// Reservations are only subtracted from the total resources, as resources used
+// by active tasks are already missing from the free resources.
+type capacityModel struct {
+	options        *capacityOptions // nil, if capacity is fixed
+	maxConcurrency int
+	freeMemory     func() (int64, error)
+	freeDiskSpace  func() (int64, error)
+	totalMemory    func() (int64, error)
+	totalDiskSpace func() (int64, error)
+	cpuTimes       func() (busy, total float64, err error)
+
+	m        sync.Mutex
+	reserved engines.Resources // resources reserved by active tasks
+	busy     float64           // CPU time busy at previous call to Capacity
+	total    float64           // CPU time total at previous call to Capacity
+}
+
+// systemCPUTimes returns the CPU time busy and in total across all cores
+func systemCPUTimes() (busy, total float64, err error) {
+	times, err := cpu.Times(false)
+	if err != nil || len(times) == 0 {
+		return 0, 0, err
+	}
+	total = times[0].Total()
+	busy = total - times[0].Idle - times[0].Iowait
+	return busy, total, nil
+}
+
+// Reserve resources for a claimed task, using the configured defaults for
+// resources that are unknown. The release function returned must be called
+// when the task is resolved.
+func (c *capacityModel) Reserve(r engines.Resources) (release func()) {
+	if c.options == nil {
+		return func() {}
+	}
+	if r.Memory == 0 {
+		r.Memory = c.options.TaskMemory * mebibyte
+	}
+	if r.DiskSpace == 0 {
+		r.DiskSpace = c.options.TaskDiskSpace * mebibyte
+	}
+
+	c.m.Lock()
+	c.reserved.Memory += r.Memory
+	c.reserved.DiskSpace += r.DiskSpace
+	c.m.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.m.Lock()
+			c.reserved.Memory -= r.Memory
+			c.reserved.DiskSpace -= r.DiskSpace
+			c.m.Unlock()
+		})
+	}
+}
+
+// Capacity returns the number of tasks that can be claimed, given the number
+// of active tasks.
+func (c *capacityModel) Capacity(active int) int {
+	N := c.maxConcurrency - active
+	if N <= 0 || c.options == nil {
+		return max(N, 0)
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	// Don't claim tasks if CPU utilization since last call is too high
+	if c.options.MaxCPUUtilization > 0 {
+		busy, total, err := c.cpuTimes()
+		if err != nil {
+			debug("failed to read CPU times, error: %s", err)
+		} else {
+			if total > c.total && (busy-c.busy)/(total-c.total) > c.options.MaxCPUUtilization {
+				debug("CPU utilization exceeds: %f", c.options.MaxCPUUtilization)
+				N = 0
+			}
+			c.busy, c.total = busy, total
+		}
+	}
+
+	// Limit by memory not reserved by active tasks and free memory
+	if c.options.TaskMemory > 0 {
+		if available, ok := c.available("memory", c.totalMemory, c.freeMemory, c.reserved.Memory); ok {
+			N = min(N, int(available/(c.options.TaskMemory*mebibyte)))
+		}
+	}
+
+	// Limit by disk space not reserved by active tasks and free disk space
+	if c.options.TaskDiskSpace > 0 {
+		if available, ok := c.available("disk space", c.totalDiskSpace, c.freeDiskSpace, c.reserved.DiskSpace); ok {
+			N = min(N, int(available/(c.options.TaskDiskSpace*mebibyte)))
+		}
+	}
+
+	// Always run at least one task, so the worker can't stall
+	if active == 0 && N < 1 {
+		return 1
+	}
+	return max(N, 0)
+}
+
+// available returns the lesser of total minus reserved and free, returns false
+// if either can't be read.
+func (c *capacityModel) available(resource string, total, free func() (int64, error), reserved int64) (int64, bool) {
+	t, err := total()
+	if err != nil {
+		debug("failed to read total %s, error: %s", resource, err)
+		return 0, false
+	}
+	f, err := free()
+	if err != nil {
+		debug("failed to read free %s, error: %s", resource, err)
+		return 0, false
+	}
+	if t-reserved < f {
+		return t - reserved, true
+	}
+	return f, true
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,92 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/taskcluster/taskcluster-worker/engines"
+)
+
+func newTestCapacityModel(options *capacityOptions, freeMemory, freeDiskSpace int64) *capacityModel {
+	return &capacityModel{
+		options:        options,
+		maxConcurrency: 8,
+		freeMemory:     func() (int64, error) { return freeMemory, nil },
+		freeDiskSpace:  func() (int64, error) { return freeDiskSpace, nil },
+		totalMemory:    func() (int64, error) { return freeMemory, nil },
+		totalDiskSpace: func() (int64, error) { return freeDiskSpace, nil },
+		cpuTimes:       func() (float64, float64, error) { return 0, 0, nil },
+	}
+}
+
+func TestCapacityFixed(t *testing.T) {
+	c := newTestCapacityModel(nil, 0, 0)
+	assert.Equal(t, 8, c.Capacity(0))
+	assert.Equal(t, 3, c.Capacity(5))
+	assert.Equal(t, 0, c.Capacity(8))
+}
+
+func TestCapacityMemory(t *testing.T) {
+	c := newTestCapacityModel(&capacityOptions{TaskMemory: 1024}, 4*1024*mebibyte, 0)
+	assert.Equal(t, 4, c.Capacity(0))
+
+	// Reservations declared by the engine are subtracted
+	release := c.Reserve(engines.Resources{Memory: 3 * 1024 * mebibyte})
+	assert.Equal(t, 1, c.Capacity(1))
+
+	// Reservations not declared use the default
+	release2 := c.Reserve(engines.Resources{})
+	assert.Equal(t, 0, c.Capacity(2))
+
+	release()
+	release()
+	release2()
+	assert.Equal(t, 4, c.Capacity(0))
+}
+
+func TestCapacityMemoryInUse(t *testing.T) {
+	free := int64(4 * 1024 * mebibyte)
+	c := newTestCapacityModel(&capacityOptions{TaskMemory: 1024}, 0, 0)
+	c.freeMemory = func() (int64, error) { return free, nil }
+	c.totalMemory = func() (int64, error) { return 4 * 1024 * mebibyte, nil }
+
+	// Reservation of a claimed task is subtracted from total memory
+	release := c.Reserve(engines.Resources{Memory: 2 * 1024 * mebibyte})
+	assert.Equal(t, 2, c.Capacity(1))
+
+	// Memory used by the task isn't subtracted twice, once it's in use
+	free = 2 * 1024 * mebibyte
+	assert.Equal(t, 2, c.Capacity(1))
+
+	// Free memory limits capacity, if other processes use memory
+	free = 1024 * mebibyte
+	assert.Equal(t, 1, c.Capacity(1))
+
+	release()
+}
+
+func TestCapacityDiskSpace(t *testing.T) {
+	c := newTestCapacityModel(&capacityOptions{TaskDiskSpace: 10 * 1024}, 0, 25*1024*mebibyte)
+	assert.Equal(t, 2, c.Capacity(0))
+	assert.Equal(t, 1, c.Capacity(7))
+	assert.Equal(t, 0, c.Capacity(8))
+}
+
+func TestCapacityCPUUtilization(t *testing.T) {
+	var busy, total float64
+	c := newTestCapacityModel(&capacityOptions{MaxCPUUtilization: 0.8}, 0, 0)
+	c.cpuTimes = func() (float64, float64, error) { return busy, total, nil }
+
+	busy, total = 50, 100
+	assert.Equal(t, 8, c.Capacity(0))
+	busy, total = 140, 200 // 90% since previous call
+	assert.Equal(t, 0, c.Capacity(2))
+	busy, total = 150, 300 // 10% since previous call
+	assert.Equal(t, 6, c.Capacity(2))
+}
+
+func TestCapacityAlwaysOneTask(t *testing.T) {
+	c := newTestCapacityModel(&capacityOptions{TaskMemory: 1024}, 512*mebibyte, 0)
+	assert.Equal(t, 1, c.Capacity(0))
+	assert.Equal(t, 0, c.Capacity(1))
+}
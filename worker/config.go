@@ -13,15 +13,83 @@ import (
 )
 
 type options struct {
-	ProvisionerID       string `json:"provisionerId"`
-	WorkerType          string `json:"workerType"`
-	WorkerGroup         string `json:"workerGroup"`
-	WorkerID            string `json:"workerId"`
-	PollingInterval     int    `json:"pollingInterval"`
-	ReclaimOffset       int    `json:"reclaimOffset"`
-	MinimumReclaimDelay int    `json:"minimumReclaimDelay"`
-	Concurrency         int    `json:"concurrency"`
-	EnableSuperseding   bool   `json:"enableSuperseding"`
+	ProvisionerID       string           `json:"provisionerId"`
+	WorkerType          string           `json:"workerType"`
+	WorkerGroup         string           `json:"workerGroup"`
+	WorkerID            string           `json:"workerId"`
+	PollingInterval     int              `json:"pollingInterval"`
+	ReclaimOffset       int              `json:"reclaimOffset"`
+	MinimumReclaimDelay int              `json:"minimumReclaimDelay"`
+	Concurrency         int              `json:"concurrency"`
+	EnableSuperseding   bool             `json:"enableSuperseding"`
+	Capacity            *capacityOptions `json:"capacity"`
+}
+
+type capacityOptions struct {
+	TaskMemory        int64   `json:"taskMemory"`
+	TaskDiskSpace     int64   `json:"taskDiskSpace"`
+	MaxCPUUtilization float64 `json:"maxCpuUtilization"`
+}
+
+var capacitySchema schematypes.Schema = schematypes.Object{
+	Title: "Dynamic Capacity",
+	Description: util.Markdown(`
+		Options for claiming tasks based on available resources, if not given
+		the worker always claims tasks until it is running 'concurrency' tasks.
+
+		When given, 'concurrency' is the maximum number of tasks, and the worker
+		only claims as many tasks as available memory, disk space and CPU
+		permits. Resources reserved by active tasks are subtracted from the
+		total resources beyond 'minimumMemory' and 'minimumDiskSpace', using the
+		reservation declared by the engine for the task payload (such as the
+		memory of a virtual machine), or the configured defaults when the engine
+		doesn't declare a reservation. The worker also doesn't claim more tasks
+		than the free resources beyond 'minimumMemory' and 'minimumDiskSpace'
+		permits.
+
+		If no tasks are running the worker will always claim at least one task,
+		ensuring that a conservative configuration doesn't stall the worker.
+	`),
+	Properties: schematypes.Properties{
+		"taskMemory": schematypes.Integer{
+			Title: "Task Memory",
+			Description: util.Markdown(`
+				Memory in MiB to reserve for tasks that doesn't declare how much memory
+				they need. Total memory beyond 'minimumMemory' not reserved by active
+				tasks, and free memory beyond 'minimumMemory', is divided by this to
+				determine how many tasks can be claimed.
+
+				If zero, memory doesn't limit the number of tasks claimed.
+			`),
+			Minimum: 0,
+			Maximum: math.MaxInt32,
+		},
+		"taskDiskSpace": schematypes.Integer{
+			Title: "Task Disk Space",
+			Description: util.Markdown(`
+				Disk space in MiB to reserve for tasks that doesn't declare how much
+				disk space they need. Total disk space beyond 'minimumDiskSpace' not
+				reserved by active tasks, and free disk space beyond 'minimumDiskSpace',
+				is divided by this to determine how many tasks can be claimed.
+
+				If zero, disk space doesn't limit the number of tasks claimed.
+			`),
+			Minimum: 0,
+			Maximum: math.MaxInt32,
+		},
+		"maxCpuUtilization": schematypes.Number{
+			Title: "Maximum CPU Utilization",
+			Description: util.Markdown(`
+				Maximum CPU utilization between 0 and 1, measured over all cores
+				since the previous attempt to claim tasks. No tasks are claimed while
+				the CPU utilization exceeds this value.
+
+				If zero, CPU utilization doesn't limit the number of tasks claimed.
+			`),
+			Minimum: 0,
+			Maximum: 1,
+		},
+	},
 }
 
 type configType struct {
@@ -37,6 +105,89 @@ type configType struct {
 	QueueBaseURL     string                 `json:"queueBaseUrl"`
 	AuthBaseURL      string                 `json:"authBaseUrl"`
 	WorkerOptions    options                `json:"worker"`
+	ArtifactUpload   *artifactUploadOptions `json:"artifactUpload"`
+	AdminAPI         *adminAPIOptions       `json:"adminApi"`
+}
+
+type artifactUploadOptions struct {
+	StorageType string `json:"storageType"`
+	PartSize    int64  `json:"partSize"`
+	Concurrency int    `json:"concurrency"`
+}
+
+var artifactUploadSchema schematypes.Schema = schematypes.Object{
+	Title: "Artifact Upload",
+	Description: util.Markdown(`
+		Options for how artifacts are uploaded, if not given artifacts will be
+		uploaded with storageType 's3' using a single PUT request.
+	`),
+	Properties: schematypes.Properties{
+		"storageType": schematypes.StringEnum{
+			Title: "Storage Type",
+			Description: util.Markdown(`
+				Storage type to use when creating artifacts. The 'blob' storage type
+				uploads artifacts in parts, retrying each part individually, which is
+				recommended for large artifacts.
+			`),
+			Options: []string{"s3", "blob"},
+		},
+		"partSize": schematypes.Integer{
+			Title: "Part Size",
+			Description: util.Markdown(`
+				Size of each part in MiB when uploading 'blob' artifacts,
+				defaults to 64 MiB.
+			`),
+			Minimum: 5,
+			Maximum: 5 * 1024,
+		},
+		"concurrency": schematypes.Integer{
+			Title: "Concurrency",
+			Description: util.Markdown(`
+				Number of parts to upload in parallel when uploading 'blob'
+				artifacts, defaults to 4.
+			`),
+			Minimum: 1,
+			Maximum: 64,
+		},
+	},
+	Required: []string{"storageType"},
+}
+
+type adminAPIOptions struct {
+	Listen string `json:"listen"`
+	Token  string `json:"token"`
+}
+
+var adminAPISchema schematypes.Schema = schematypes.Object{
+	Title: "Admin API",
+	Description: util.Markdown(`
+		Options for the admin API, if not given the admin API is disabled.
+
+		The admin API is an HTTP API for operators of the machine, exposing the
+		status of the worker and actions for draining the worker, stopping it
+		immediately, canceling a task, running garbage collection and changing
+		the log-level at runtime. See 'worker/adminapi.go' for endpoints.
+	`),
+	Properties: schematypes.Properties{
+		"listen": schematypes.String{
+			Title: "Listen Address",
+			Description: util.Markdown(`
+				Absolute path to a unix-domain socket, or loopback address and port
+				to listen on, such as 'localhost:60023'. The unix-domain socket is
+				created with mode '0600', any existing file is replaced.
+			`),
+			MinimumLength: 1,
+		},
+		"token": schematypes.String{
+			Title: "Access Token",
+			Description: util.Markdown(`
+				Secret token that requests must be authenticated with, given in the
+				header 'Authorization: Bearer <token>'.
+			`),
+			MinimumLength: 16,
+		},
+	},
+	Required: []string{"listen", "token"},
 }
 
 // optionsSchema must be satisfied by Options used to construct a Worker
@@ -110,6 +261,7 @@ var optionsSchema schematypes.Schema = schematypes.Object{
 			Minimum:     1,
 			Maximum:     1000,
 		},
+		"capacity": capacitySchema,
 		"enableSuperseding": schematypes.Boolean{
 			Title: "Enable Superseding",
 			Description: util.Markdown(`
@@ -224,11 +376,13 @@ func ConfigSchema() schematypes.Object {
 				Minimum: 0,
 				Maximum: math.MaxInt64,
 			},
-			"monitor":      monitoring.ConfigSchema,
-			"credentials":  credentialsSchema,
-			"queueBaseUrl": schematypes.String{},
-			"authBaseUrl":  schematypes.String{},
-			"worker":       optionsSchema,
+			"monitor":        monitoring.ConfigSchema,
+			"credentials":    credentialsSchema,
+			"queueBaseUrl":   schematypes.String{},
+			"authBaseUrl":    schematypes.String{},
+			"worker":         optionsSchema,
+			"artifactUpload": artifactUploadSchema,
+			"adminApi":       adminAPISchema,
 		},
 		Required: []string{
 			"engine",
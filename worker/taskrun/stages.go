@@ -42,6 +42,8 @@ func (s Stage) String() string {
 		return "stopped"
 	case StageFinished:
 		return "finished"
+	case stageResolved:
+		return "resolved"
 	}
 	panic(fmt.Sprintf("Unknown stage '%d' in stage.String()", s))
 }
@@ -130,9 +132,13 @@ func build(t *TaskRun) error {
 }
 
 func start(t *TaskRun) error {
-	var err error
-	t.sandbox, err = t.sandboxBuilder.StartSandbox()
+	sandbox, err := t.sandboxBuilder.StartSandbox()
 	t.sandboxBuilder = nil
+
+	// Set sandbox under lock, as Abort() may checkpoint the sandbox
+	t.m.Lock()
+	t.sandbox = sandbox
+	t.m.Unlock()
 	return err
 }
 
@@ -143,7 +149,9 @@ func started(t *TaskRun) error {
 func waiting(t *TaskRun) error {
 	var err error
 	t.resultSet, err = t.sandbox.WaitForResult()
+	t.m.Lock()
 	t.sandbox = nil
+	t.m.Unlock()
 	return err
 }
 
@@ -30,13 +30,14 @@ type TaskRun struct {
 	controller  *runtime.TaskContextController
 
 	// State
-	m         sync.Mutex // lock protecting state variables
-	c         sync.Cond  // Broadcast when state changes
-	running   bool       // true, when a thread is advancing the stage
-	stage     Stage      // next stage to be run
-	success   bool       // true, if task is completed successfully
-	exception bool       // true, if reason has a value
-	reason    runtime.ExceptionReason
+	m             sync.Mutex // lock protecting state variables
+	c             sync.Cond  // Broadcast when state changes
+	running       bool       // true, when a thread is advancing the stage
+	checkpointing bool       // true, while Abort() is checkpointing the sandbox
+	stage         Stage      // next stage to be run
+	success       bool       // true, if task is completed successfully
+	exception     bool       // true, if reason has a value
+	reason        runtime.ExceptionReason
 
 	// Final error to return from Dispose()
 	fatalErr    atomics.Bool // If we've seen ErrFatalInternalError
@@ -80,6 +81,7 @@ func New(options Options) *TaskRun {
 		t.fatalErr.Set(true)
 	} else {
 		t.controller.SetQueueClient(options.Queue)
+		t.controller.SetArtifactBackend(t.environment.ArtifactBackend)
 	}
 	return t
 }
@@ -101,13 +103,22 @@ func (t *TaskRun) SetCredentials(clientID, accessToken, certificate string) {
 	}
 }
 
+// Stage returns the stage currently being run, or the next stage to be run if
+// no stage is running. Once the TaskRun is resolved, this stage prints as
+// "resolved".
+func (t *TaskRun) Stage() Stage {
+	t.m.Lock()
+	defer t.m.Unlock()
+	return t.stage
+}
+
 // Abort will interrupt task execution.
 func (t *TaskRun) Abort(reason AbortReason) {
 	t.m.Lock()
-	defer t.m.Unlock()
 
 	// If we are already resolved, we won't change the resolution
 	if t.stage == stageResolved {
+		t.m.Unlock()
 		debug("ignoring TaskRun.Abort() as TaskRun is resolved")
 		return
 	}
@@ -124,13 +135,52 @@ func (t *TaskRun) Abort(reason AbortReason) {
 	case TaskCanceled:
 		t.reason = runtime.ReasonCanceled
 	default:
+		t.m.Unlock()
 		panic(fmt.Sprintf("Unknown AbortReason: %d", reason))
 	}
+
+	// Checkpoint the sandbox, if the worker is shutting down. This must happen
+	// before the TaskContext is canceled, as the checkpoint is uploaded. As
+	// checkpointing may take a while we do it without holding the lock, setting
+	// checkpointing ensures the TaskContext isn't canceled in the meantime.
+	sandbox := t.sandbox
+	if reason == WorkerShutdown && sandbox != nil {
+		t.checkpointing = true
+		t.m.Unlock()
+		t.checkpoint(sandbox)
+		t.m.Lock()
+		t.checkpointing = false
+	}
+
 	// Abort anything that's currently running
 	t.controller.Cancel()
 
 	// Inform anyone waiting for resolution
 	t.c.Broadcast()
+	t.m.Unlock()
+}
+
+// checkpoint will checkpoint the sandbox, caller must not hold the lock
+func (t *TaskRun) checkpoint(sandbox engines.Sandbox) {
+	monitor := t.monitor.WithTag("stage", "checkpoint")
+	var err error
+	incidentID := monitor.CapturePanic(func() {
+		err = sandbox.Checkpoint()
+	})
+	if incidentID != "" {
+		t.fatalErr.Set(true)
+		return
+	}
+	switch err {
+	case nil:
+		monitor.Info("created checkpoint of sandbox")
+	case engines.ErrFeatureNotSupported, engines.ErrSandboxTerminated, engines.ErrSandboxAborted:
+		debug("sandbox not checkpointed: %s", err)
+	default:
+		// Failure to checkpoint isn't fatal, the sandbox will be aborted as usual
+		monitor.ReportWarning(err, "failed to checkpoint sandbox")
+		t.controller.LogError("Failed to checkpoint the task, error: ", err)
+	}
 }
 
 // RunToStage will run all stages up-to and including the given stage.
@@ -171,6 +221,14 @@ func (t *TaskRun) RunToStage(targetStage Stage) {
 		})
 		t.m.Lock()
 
+		// Skip execution of the sandbox, if a plugin has reused a previous result
+		if err == runtime.ErrTaskResultReused && stage == StageBuild && t.stage != stageResolved {
+			debug("skipping sandbox execution, as the result of a previous run was reused")
+			err = nil
+			t.success = true
+			t.stage = StageStopped // advanced to StageFinished below
+		}
+
 		// Handle errors
 		if err != nil || incidentID != "" {
 			reason := runtime.ReasonInternalError
@@ -179,10 +237,15 @@ func (t *TaskRun) RunToStage(targetStage Stage) {
 					t.controller.LogError(m)
 				}
 				reason = runtime.ReasonMalformedPayload
+			} else if err == runtime.ErrIntermittentTask {
+				reason = runtime.ReasonIntermittentTask
 			} else if err == runtime.ErrNonFatalInternalError {
 				t.nonFatalErr.Set(true)
 			} else if err == runtime.ErrFatalInternalError {
 				t.fatalErr.Set(true)
+			} else if err == engines.ErrSandboxAborted && t.stage == stageResolved {
+				// Sandbox was aborted because the TaskRun was aborted
+				debug("sandbox aborted after TaskRun was resolved")
 			} else if err != nil {
 				incidentID = monitor.ReportError(err)
 			}
@@ -206,8 +269,12 @@ func (t *TaskRun) RunToStage(targetStage Stage) {
 		t.c.Broadcast()
 	}
 
-	// if resolved we always cancel the TaskContext
+	// if resolved we always cancel the TaskContext, but not while Abort() is
+	// checkpointing the sandbox, as the checkpoint is uploaded
 	if t.stage == stageResolved {
+		for t.checkpointing {
+			t.c.Wait()
+		}
 		t.controller.Cancel()
 	}
 
@@ -260,6 +327,13 @@ func (t *TaskRun) capturePanicAndError(stage string, fn func() error) {
 func (t *TaskRun) Dispose() error {
 	t.monitor.WithTag("stage", "dispose").Debug("running stage: dispose")
 
+	// Wait for Abort() to finish checkpointing the sandbox
+	t.m.Lock()
+	for t.checkpointing {
+		t.c.Wait()
+	}
+	t.m.Unlock()
+
 	if t.controller != nil {
 		debug("canceling TaskContext and closing log")
 		t.controller.Cancel()
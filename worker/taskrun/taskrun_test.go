@@ -303,6 +303,30 @@ func TestTaskRun(t *testing.T) {
 		require.Equal(t, runtime.ErrNonFatalInternalError, err, "expected non-fatal error")
 	})
 
+	t.Run("reused result", func(t *testing.T) {
+		plugin := &mockPlugin{}
+		plugin.On("PayloadSchema").Return(schematypes.Object{})
+		plugin.On("NewTaskPlugin", taskPluginOptions).Return(plugin, nil)
+		plugin.On("BuildSandbox", mockSandboxBuilder).Return(runtime.ErrTaskResultReused)
+		plugin.On("Finished", true).Return(nil)
+		plugin.On("Dispose").Return(nil)
+		defer plugin.AssertExpectations(t)
+
+		require.NoError(t, json.Unmarshal([]byte(`{
+			"delay":    0,
+			"function": "false",
+			"argument": ""
+		}`), &options.Payload), "unable to parse payload")
+
+		run := New(options)
+		run.pluginManager = plugin // hack to inject mock for PluginManager
+		success, exception, _ := run.WaitForResult()
+		assert.True(t, success, "expected success to be true")
+		assert.False(t, exception, "expected exception to be false")
+
+		require.NoError(t, run.Dispose(), "run.Dispose() returned an error")
+	})
+
 	t.Run("Abort worker-shutdown", func(t *testing.T) {
 		var run *TaskRun
 		var ctx *runtime.TaskContext
@@ -341,6 +365,55 @@ func TestTaskRun(t *testing.T) {
 		require.NoError(t, run.Dispose(), "run.Dispose() returned an error")
 	})
 
+	t.Run("Abort worker-shutdown with checkpoint", func(t *testing.T) {
+		var run *TaskRun
+		var ctx *runtime.TaskContext
+		checkpointed := false
+		opts := options
+		opts.Engine = &checkpointEngine{
+			Engine: options.Engine,
+			checkpoint: func() error {
+				// Must not hold the lock or cancel the TaskContext while checkpointing
+				assert.Equal(t, stageResolved, run.Stage())
+				assert.NoError(t, ctx.Err(), "TaskContext was canceled before checkpoint")
+				checkpointed = true
+				return nil
+			},
+		}
+		plugin := &mockPlugin{}
+		plugin.On("PayloadSchema").Return(schematypes.Object{})
+		plugin.On("NewTaskPlugin", taskPluginOptions).Return(plugin, func(options plugins.TaskPluginOptions) error {
+			ctx = options.TaskContext
+			return nil
+		})
+		plugin.On("BuildSandbox", mock.AnythingOfType("*taskrun.checkpointSandboxBuilder")).Return(nil)
+		plugin.On("Started", mock.AnythingOfType("*taskrun.checkpointSandbox")).Return(func(engines.Sandbox) error {
+			go run.Abort(WorkerShutdown)
+			<-ctx.Done() // Wait for TaskContext to be resolved
+			assert.True(t, checkpointed, "expected sandbox to be checkpointed before TaskContext is canceled")
+			return nil
+		})
+		plugin.On("Exception", runtime.ReasonWorkerShutdown).Return(nil)
+		plugin.On("Dispose").Return(nil)
+		defer plugin.AssertExpectations(t)
+
+		require.NoError(t, json.Unmarshal([]byte(`{
+			"delay":    50,
+			"function": "true",
+			"argument": ""
+		}`), &opts.Payload), "unable to parse payload")
+
+		run = New(opts)
+		run.pluginManager = plugin // hack to inject mock for PluginManager
+		success, exception, reason := run.WaitForResult()
+		assert.False(t, success, "expected success to be false")
+		assert.True(t, exception, "expected exception to be true")
+		assert.Equal(t, runtime.ReasonWorkerShutdown, reason, "expected worker-shutdown")
+		assert.True(t, checkpointed, "expected sandbox to be checkpointed")
+
+		require.NoError(t, run.Dispose(), "run.Dispose() returned an error")
+	})
+
 	t.Run("Abort canceled", func(t *testing.T) {
 		var run *TaskRun
 		var ctx *runtime.TaskContext
@@ -379,3 +452,42 @@ func TestTaskRun(t *testing.T) {
 		require.NoError(t, run.Dispose(), "run.Dispose() returned an error")
 	})
 }
+
+// checkpointEngine wraps an engine, such that sandboxes support Checkpoint()
+type checkpointEngine struct {
+	engines.Engine
+	checkpoint func() error
+}
+
+type checkpointSandboxBuilder struct {
+	engines.SandboxBuilder
+	checkpoint func() error
+}
+
+type checkpointSandbox struct {
+	engines.Sandbox
+	checkpoint func() error
+}
+
+func (e *checkpointEngine) NewSandboxBuilder(options engines.SandboxOptions) (engines.SandboxBuilder, error) {
+	b, err := e.Engine.NewSandboxBuilder(options)
+	if err != nil {
+		return nil, err
+	}
+	return &checkpointSandboxBuilder{SandboxBuilder: b, checkpoint: e.checkpoint}, nil
+}
+
+func (b *checkpointSandboxBuilder) StartSandbox() (engines.Sandbox, error) {
+	s, err := b.SandboxBuilder.StartSandbox()
+	if err != nil {
+		return nil, err
+	}
+	return &checkpointSandbox{Sandbox: s, checkpoint: b.checkpoint}, nil
+}
+
+func (s *checkpointSandbox) Checkpoint() error {
+	if err := s.checkpoint(); err != nil {
+		return err
+	}
+	return s.Sandbox.Abort()
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -15,6 +16,7 @@ import (
 	tcclient "github.com/taskcluster/taskcluster-client-go"
 	"github.com/taskcluster/taskcluster-client-go/auth"
 	"github.com/taskcluster/taskcluster-client-go/queue"
+	"github.com/taskcluster/taskcluster-worker/commands/version"
 	"github.com/taskcluster/taskcluster-worker/engines"
 	"github.com/taskcluster/taskcluster-worker/plugins"
 	"github.com/taskcluster/taskcluster-worker/runtime"
@@ -41,9 +43,20 @@ type Worker struct {
 	queueBaseURL     string
 	options          options
 	monitor          runtime.Monitor
+	capacity         capacityModel
+	adminAPI         *adminAPI
+	created          time.Time
 	// State
 	started     atomics.Once
 	activeTasks taskCounter
+	runsMutex   sync.Mutex
+	runs        map[string]activeRun // active runs by taskId
+}
+
+// activeRun is a TaskRun being processed, tracked for the admin API
+type activeRun struct {
+	RunID int
+	Run   *taskrun.TaskRun
 }
 
 // New creates a new Worker
@@ -64,6 +77,8 @@ func New(config interface{}) (w *Worker, err error) {
 		garbageCollector: gc.New(c.TemporaryFolder, c.MinimumDiskSpace, c.MinimumMemory),
 		queueBaseURL:     c.QueueBaseURL,
 		options:          c.WorkerOptions,
+		created:          time.Now(),
+		runs:             make(map[string]activeRun),
 	}
 
 	w.monitor.Info("starting up")
@@ -103,6 +118,12 @@ func New(config interface{}) (w *Worker, err error) {
 		ProvisionerID:    c.WorkerOptions.ProvisionerID,
 		WorkerType:       c.WorkerOptions.WorkerType,
 	}
+	if c.ArtifactUpload != nil && c.ArtifactUpload.StorageType == "blob" {
+		w.environment.ArtifactBackend = runtime.BlobArtifactBackend{
+			PartSize:    c.ArtifactUpload.PartSize * 1024 * 1024,
+			Concurrency: c.ArtifactUpload.Concurrency,
+		}
+	}
 
 	// Create engine
 	provider := engines.Engines()[c.Engine]
@@ -124,6 +145,9 @@ func New(config interface{}) (w *Worker, err error) {
 	w.plugin, err = plugins.NewPluginManager(plugins.PluginOptions{
 		Environment: &w.environment,
 		Engine:      w.engine,
+		EngineName:  c.Engine,
+		Version:     version.Version(),
+		Revision:    version.Revision(),
 		Monitor:     monitor.WithPrefix("plugin"),
 		Config:      c.Plugins,
 	})
@@ -133,6 +157,21 @@ func New(config interface{}) (w *Worker, err error) {
 		return
 	}
 
+	// Create capacity model, concurrency can't exceed what the engine supports
+	w.capacity = capacityModel{
+		options:        c.WorkerOptions.Capacity,
+		maxConcurrency: c.WorkerOptions.Concurrency,
+		freeMemory:     w.garbageCollector.FreeMemory,
+		freeDiskSpace:  w.garbageCollector.FreeDiskSpace,
+		totalMemory:    w.garbageCollector.TotalMemory,
+		totalDiskSpace: w.garbageCollector.TotalDiskSpace,
+		cpuTimes:       systemCPUTimes,
+	}
+	if limit := w.engine.Capabilities().MaxConcurrency; limit > 0 && limit < w.capacity.maxConcurrency {
+		w.monitor.Warnf("concurrency: %d exceeds MaxConcurrency: %d supported by engine", w.capacity.maxConcurrency, limit)
+		w.capacity.maxConcurrency = limit
+	}
+
 	// Check payload schema conflicts
 	_, err = schematypes.Merge(
 		w.engine.PayloadSchema(),
@@ -144,6 +183,16 @@ func New(config interface{}) (w *Worker, err error) {
 		return
 	}
 
+	// Create admin API, last as we don't want to leak the listener
+	if c.AdminAPI != nil {
+		w.adminAPI, err = newAdminAPI(w, c.AdminAPI)
+		if err != nil {
+			w.monitor.ReportError(err, "worker.New() failed to setup admin API")
+			err = runtime.ErrFatalInternalError
+			return
+		}
+	}
+
 	return
 }
 
@@ -203,30 +252,43 @@ func (w *Worker) Start() error {
 		}
 	}()
 
+	// Serve admin API, until disposed
+	if w.adminAPI != nil {
+		w.adminAPI.Serve()
+	}
+
 	for !w.lifeCycleTracker.StoppingGracefully.IsDone() {
-		// Claim tasks
-		N := w.options.Concurrency - w.activeTasks.Value()
-		debug("queue.claimWork(%s, %s) with capacity: %d", w.options.ProvisionerID, w.options.WorkerType, N)
-		claims, err := w.queue.ClaimWork(w.options.ProvisionerID, w.options.WorkerType, &queue.ClaimWorkRequest{
-			WorkerGroup: w.options.WorkerGroup,
-			WorkerID:    w.options.WorkerID,
-			Tasks:       N,
-		})
-		if err == context.Canceled {
-			break // if canceled we stop gracefully
-		}
-		if err != nil {
-			w.monitor.ReportError(err, "failed to ClaimWork")
-			w.plugin.ReportNonFatalError()
+		// Claim tasks, if we have capacity
+		var claims *queue.ClaimWorkResponse
+		N := w.capacity.Capacity(w.activeTasks.Value())
+		if N > 0 {
+			debug("queue.claimWork(%s, %s) with capacity: %d", w.options.ProvisionerID, w.options.WorkerType, N)
+			var err error
+			claims, err = w.queue.ClaimWork(w.options.ProvisionerID, w.options.WorkerType, &queue.ClaimWorkRequest{
+				WorkerGroup: w.options.WorkerGroup,
+				WorkerID:    w.options.WorkerID,
+				Tasks:       N,
+			})
+			if err == context.Canceled {
+				break // if canceled we stop gracefully
+			}
+			if err != nil {
+				w.monitor.ReportError(err, "failed to ClaimWork")
+				w.plugin.ReportNonFatalError()
+			}
+		} else {
+			debug("no capacity to claim tasks, with activeTasks: %d", w.activeTasks.Value())
 		}
 
 		// If we have claims we MUST always handle, even if we have stopNow!
 		if claims != nil {
 			for _, claim := range claims.Tasks {
+				// Reserve resources before the next call to Capacity()
+				release := w.capacity.Reserve(w.resourceReservation(claim))
 				// Start processing tasks
 				debug("starting to process task: %s/%d", claim.Status.TaskID, claim.RunID)
 				w.activeTasks.Increment()
-				go w.processClaim(claim)
+				go w.processClaim(claim, release)
 			}
 		}
 
@@ -244,8 +306,8 @@ func (w *Worker) Start() error {
 		}
 
 		// Wait for capacity to be available (delay is ticking while this happens)
-		debug("waiting for activeTasks: %d < concurrency: %d", w.activeTasks.Value(), w.options.Concurrency)
-		w.activeTasks.WaitForLessThan(w.options.Concurrency)
+		debug("waiting for activeTasks: %d < concurrency: %d", w.activeTasks.Value(), w.capacity.maxConcurrency)
+		w.activeTasks.WaitForLessThan(w.capacity.maxConcurrency)
 
 		// Wait for delay or stopGracefully
 		debug("sleep before reclaiming, unless stopping gracefully")
@@ -312,12 +374,34 @@ func (w *Worker) reclaimDelay(takenUntil time.Time) time.Duration {
 	return delay
 }
 
+// resourceReservation returns the resources the engine expects the task to use
+func (w *Worker) resourceReservation(claim taskClaim) engines.Resources {
+	if w.options.Capacity == nil {
+		return engines.Resources{}
+	}
+	var payload map[string]interface{}
+	if json.Unmarshal(claim.Task.Payload, &payload) != nil {
+		return engines.Resources{}
+	}
+	schema := w.engine.PayloadSchema()
+	payload = schema.Filter(payload)
+	if schema.Validate(payload) != nil {
+		return engines.Resources{} // task will be resolved malformed-payload
+	}
+	r, err := w.engine.ResourceReservation(payload)
+	if err != nil && err != engines.ErrFeatureNotSupported {
+		w.monitor.ReportWarning(err, "failed to determine resource reservation for task")
+	}
+	return r
+}
+
 // processClaim is responsible for processing a task, reclaiming the task and
 // aborting it with worker-shutdown with w.stopNow is unblocked, and decrements
-// activeTasks when done
-func (w *Worker) processClaim(claim taskClaim) {
+// activeTasks and releases the resources reserved for the task when done
+func (w *Worker) processClaim(claim taskClaim, release func()) {
 	// Decrement number of active tasks when we're done processing the task
 	defer w.activeTasks.Decrement()
+	defer release()
 
 	// If superseding is enabled, find superseding if one is available
 	// NOTE: This can be removed when superseding is implemented in the queue
@@ -345,7 +429,7 @@ func (w *Worker) processClaim(claim taskClaim) {
 	// Convert task definition to interface{} form
 	var jsontask interface{}
 	rawTask, _ := json.Marshal(claim.Task)
-	_ = json.Unmarshal(rawTask, jsontask)
+	_ = json.Unmarshal(rawTask, &jsontask)
 
 	// Create a taskrun
 	var payload map[string]interface{}
@@ -375,6 +459,16 @@ func (w *Worker) processClaim(claim taskClaim) {
 		claim.Credentials.Certificate,
 	)
 
+	// Track the run, so it can be inspected and aborted from the admin API
+	w.runsMutex.Lock()
+	w.runs[claim.Status.TaskID] = activeRun{RunID: claim.RunID, Run: run}
+	w.runsMutex.Unlock()
+	defer func() {
+		w.runsMutex.Lock()
+		delete(w.runs, claim.Status.TaskID)
+		w.runsMutex.Unlock()
+	}()
+
 	// runId as string for use in requests
 	runID := strconv.Itoa(claim.RunID)
 
@@ -692,6 +786,11 @@ func (w *Worker) dispose() {
 		w.webhookserver.Stop()
 	}
 
+	// Stop admin API
+	if w.adminAPI != nil {
+		w.adminAPI.Stop()
+	}
+
 	// Remove temporary storage
 	switch err := w.temporaryStorage.Remove(); err {
 	case runtime.ErrFatalInternalError, runtime.ErrNonFatalInternalError:
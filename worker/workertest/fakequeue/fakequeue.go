@@ -1,6 +1,10 @@
 package fakequeue
 
 import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -30,6 +34,7 @@ import (
 //  * reportFailed
 //  * reportException
 //  * createArtifact
+//  * completeArtifact
 //  * getArtifact
 //  * getLatestArtifact
 //  * listLatestArtifact
@@ -66,20 +71,31 @@ type run struct { // as defined in queue.TaskStatusStructure.Runs
 
 const (
 	storageTypeS3        = "s3"
+	storageTypeBlob      = "blob"
 	storageTypeAzure     = "azure"
 	storageTypeReference = "reference"
 	storageTypeError     = "error"
 )
 
 type artifact struct {
-	StorageType     string    `json:"storageType"`
-	Expires         time.Time `json:"expires"`
-	ContentType     string    `json:"contentType,omitempty"`
-	URL             string    `json:"url,omitempty"`
-	Reason          string    `json:"reason,omitempty"`
-	Message         string    `json:"message,omitempty"`
-	Data            []byte    `json:"-"`
-	ContentEncoding string    `json:"-"`
+	StorageType     string     `json:"storageType"`
+	Expires         time.Time  `json:"expires"`
+	ContentType     string     `json:"contentType,omitempty"`
+	URL             string     `json:"url,omitempty"`
+	Reason          string     `json:"reason,omitempty"`
+	Message         string     `json:"message,omitempty"`
+	ContentSha256   string     `json:"contentSha256,omitempty"`
+	ContentLength   int64      `json:"contentLength,omitempty"`
+	Parts           []blobPart `json:"parts,omitempty"`
+	Data            []byte     `json:"-"`
+	ContentEncoding string     `json:"-"`
+	PartData        [][]byte   `json:"-"` // data for each part of a blob artifact
+	Present         bool       `json:"-"` // true, when a blob artifact is completed
+}
+
+type blobPart struct {
+	Sha256 string `json:"sha256"`
+	Size   int64  `json:"size"`
 }
 
 func (q *FakeQueue) initAndLock() {
@@ -101,6 +117,7 @@ var (
 	patternReportFailed        = regexp.MustCompile("^/task/([a-zA-Z0-9_-]{22})/runs/([0-9]+)/failed$")
 	patternReportException     = regexp.MustCompile("^/task/([a-zA-Z0-9_-]{22})/runs/([0-9]+)/exception$")
 	patternCreateArtifact      = regexp.MustCompile("^/task/([a-zA-Z0-9_-]{22})/runs/([0-9]+)/artifacts/(.*)$")
+	patternCompleteArtifact    = regexp.MustCompile("^/task/([a-zA-Z0-9_-]{22})/runs/([0-9]+)/artifacts/(.*)$")
 	patternGetArtifact         = regexp.MustCompile("^/task/([a-zA-Z0-9_-]{22})/runs/([0-9]+)/artifacts/(.*)$")
 	patternListArtifacts       = regexp.MustCompile("^/task/([a-zA-Z0-9_-]{22})/runs/([0-9]+)/artifacts$")
 	patternGetLatestArtifact   = regexp.MustCompile("^/task/([a-zA-Z0-9_-]{22})/artifacts/(.*)$")
@@ -109,6 +126,7 @@ var (
 	patternPendingTasks        = regexp.MustCompile("^/pending/([a-zA-Z0-9_-]{1,22})/([a-zA-Z0-9_-]{1,22})$")
 	patternPing                = regexp.MustCompile("^/ping$")
 	patternArtifactPutURL      = regexp.MustCompile("^/internal/task/([a-zA-Z0-9_-]{22})/runs/([0-9]+)/put-artifact/(.*)$")
+	patternArtifactPartURL     = regexp.MustCompile("^/internal/task/([a-zA-Z0-9_-]{22})/runs/([0-9]+)/put-part/([0-9]+)/(.*)$")
 )
 
 func (q *FakeQueue) task(taskID string) interface{} {
@@ -495,10 +513,62 @@ func (q *FakeQueue) createArtifact(taskID string, runID int, name string, payloa
 		}
 	}
 
+	// Validate blob artifacts
+	if a.StorageType == storageTypeBlob {
+		if e := validateBlobArtifact(a); e != nil {
+			return *e
+		}
+		var blob struct {
+			ContentEncoding string `json:"contentEncoding"`
+		}
+		_ = json.Unmarshal(payload, &blob) // payload was parsed above
+		a.ContentEncoding = blob.ContentEncoding
+	}
+
 	// Recover data in case there was some stored
-	a.Data = t.artifacts[runID][name].Data
+	a2 := t.artifacts[runID][name]
+	a.Data = a2.Data
+	if a.StorageType == storageTypeBlob {
+		a.PartData = a2.PartData
+		a.Present = a2.Present
+		if a.PartData == nil {
+			a.PartData = make([][]byte, len(a.Parts))
+		}
+	}
 	t.artifacts[runID][name] = a
 
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+
+	// Return a request for each part, if blob
+	if a.StorageType == storageTypeBlob {
+		type request struct {
+			URL     string            `json:"url"`
+			Method  string            `json:"method"`
+			Headers map[string]string `json:"headers"`
+		}
+		var result struct {
+			StorageType string    `json:"storageType"`
+			Expires     time.Time `json:"expires"`
+			Requests    []request `json:"requests"`
+		}
+		result.StorageType = a.StorageType
+		result.Expires = time.Now().Add(5 * time.Minute)
+		for i := range a.Parts {
+			result.Requests = append(result.Requests, request{
+				URL: fmt.Sprintf(
+					"%s://%s/internal/task/%s/runs/%d/put-part/%d/%s",
+					proto, r.Host, taskID, runID, i, name,
+				),
+				Method:  http.MethodPut,
+				Headers: map[string]string{},
+			})
+		}
+		return result
+	}
+
 	var result struct {
 		StorageType string    `json:"storageType"`
 		Expires     time.Time `json:"expires,omitempty"`
@@ -509,10 +579,6 @@ func (q *FakeQueue) createArtifact(taskID string, runID int, name string, payloa
 
 	// Set PutURL if s3 or azure
 	if a.StorageType == storageTypeS3 || a.StorageType == storageTypeAzure {
-		proto := "http"
-		if r.TLS != nil {
-			proto = "https"
-		}
 		result.PutURL = fmt.Sprintf(
 			"%s://%s/internal/task/%s/runs/%d/put-artifact/%s",
 			proto, r.Host, taskID, runID, name,
@@ -550,6 +616,139 @@ func (q *FakeQueue) internalPutArtifact(taskID string, runID int, name string, p
 	}
 }
 
+// validateBlobArtifact returns an error if the parts of a blob artifact don't
+// add up to the contentLength.
+func validateBlobArtifact(a artifact) *restError {
+	if len(a.Parts) == 0 {
+		return &restError{
+			StatusCode: http.StatusBadRequest,
+			Code:       "InputError",
+			Message:    "Blob artifacts must have at-least one part",
+		}
+	}
+	var size int64
+	for _, p := range a.Parts {
+		if len(p.Sha256) != 64 || p.Size < 0 {
+			return &restError{
+				StatusCode: http.StatusBadRequest,
+				Code:       "InputError",
+				Message:    "Each part must have a sha256 and a non-negative size",
+			}
+		}
+		size += p.Size
+	}
+	if size != a.ContentLength || len(a.ContentSha256) != 64 {
+		return &restError{
+			StatusCode: http.StatusBadRequest,
+			Code:       "InputError",
+			Message:    "Size of parts must sum to contentLength, and contentSha256 must be given",
+		}
+	}
+	return nil
+}
+
+func (q *FakeQueue) internalPutPart(taskID string, runID int, part int, name string, payload []byte, r *http.Request) interface{} {
+	// Find task
+	t, ok := q.tasks[taskID]
+	if !ok || len(t.status.Runs) <= runID {
+		return resourceNotFoundError
+	}
+
+	// check that the artifact was created first
+	a, ok := t.artifacts[runID][name]
+	if !ok || a.StorageType != storageTypeBlob || part >= len(a.Parts) {
+		return restError{
+			StatusCode: http.StatusForbidden,
+			Code:       "InvalidPutURL",
+			Message:    "This URL was not returned from createArtifact",
+		}
+	}
+
+	// Verify the part, like S3 would with Content-MD5 and sha256 from signature
+	md5sum := md5.Sum(payload)
+	if h := r.Header.Get("Content-MD5"); h != "" && h != base64.StdEncoding.EncodeToString(md5sum[:]) {
+		return restError{
+			StatusCode: http.StatusBadRequest,
+			Code:       "BadDigest",
+			Message:    "The Content-MD5 you specified did not match what we received",
+		}
+	}
+	sha256sum := sha256.Sum256(payload)
+	if int64(len(payload)) != a.Parts[part].Size || hex.EncodeToString(sha256sum[:]) != a.Parts[part].Sha256 {
+		return restError{
+			StatusCode: http.StatusBadRequest,
+			Code:       "BadDigest",
+			Message:    "The size or sha256 of the part did not match the part declared",
+		}
+	}
+
+	// Store payload
+	a.PartData[part] = payload
+	t.artifacts[runID][name] = a
+
+	return etagResponse{ETag: fmt.Sprintf("\"%s\"", hex.EncodeToString(md5sum[:]))}
+}
+
+func (q *FakeQueue) completeArtifact(taskID string, runID int, name string, payload []byte) interface{} {
+	var p struct {
+		ETags []string `json:"etags"`
+	}
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return invalidJSONPayloadError
+	}
+
+	// Find task
+	t, ok := q.tasks[taskID]
+	if !ok || len(t.status.Runs) <= runID {
+		return resourceNotFoundError
+	}
+
+	// Find artifact
+	a, ok := t.artifacts[runID][name]
+	if !ok || a.StorageType != storageTypeBlob {
+		return restError{
+			StatusCode: http.StatusNotFound,
+			Code:       "ResourceNotFound",
+			Message:    "No such blob artifact found",
+		}
+	}
+
+	// Check that all parts are uploaded and etags match
+	if len(p.ETags) != len(a.Parts) {
+		return restError{
+			StatusCode: http.StatusBadRequest,
+			Code:       "InputError",
+			Message:    "Number of etags must match the number of parts",
+		}
+	}
+	var data []byte
+	for i, d := range a.PartData {
+		md5sum := md5.Sum(d)
+		if d == nil || p.ETags[i] != fmt.Sprintf("\"%s\"", hex.EncodeToString(md5sum[:])) {
+			return restError{
+				StatusCode: http.StatusBadRequest,
+				Code:       "InputError",
+				Message:    fmt.Sprintf("Part %d is missing or etag doesn't match", i),
+			}
+		}
+		data = append(data, d...)
+	}
+	sha256sum := sha256.Sum256(data)
+	if hex.EncodeToString(sha256sum[:]) != a.ContentSha256 {
+		return restError{
+			StatusCode: http.StatusBadRequest,
+			Code:       "InputError",
+			Message:    "The sha256 of the uploaded parts doesn't match contentSha256",
+		}
+	}
+
+	a.Data = data
+	a.Present = true
+	t.artifacts[runID][name] = a
+
+	return map[string]interface{}{}
+}
+
 func (q *FakeQueue) getArtifact(taskID string, runID int, name string) interface{} {
 	// Find task
 	t, ok := q.tasks[taskID]
@@ -566,6 +765,15 @@ func (q *FakeQueue) getArtifact(taskID string, runID int, name string) interface
 				ContentEncoding: a.ContentEncoding,
 				Payload:         a.Data,
 			}
+		case storageTypeBlob:
+			if a.Present {
+				return rawResponse{
+					StatusCode:      http.StatusOK,
+					ContentType:     a.ContentType,
+					ContentEncoding: a.ContentEncoding,
+					Payload:         a.Data,
+				}
+			}
 		case storageTypeReference:
 			return redirectResponse{
 				StatusCode: http.StatusSeeOther,
@@ -774,6 +982,23 @@ func (q *FakeQueue) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// PUT  /task/<taskId>/runs/<runId>/artifacts/<name>
+	if m := patternCompleteArtifact.FindStringSubmatch(p); len(m) > 0 && r.Method == http.MethodPut {
+		runID, _ := strconv.Atoi(m[2])
+		debug(" -> queue.completeArtifact(%s, %d, %s, ...)", m[1], runID, m[3])
+		reply(w, r, q.completeArtifact(m[1], runID, m[3], data))
+		return
+	}
+
+	// PUT  /internal/task/<taskId>/runs/<runId>/put-part/<part>/<name>
+	if m := patternArtifactPartURL.FindStringSubmatch(p); len(m) > 0 && r.Method == http.MethodPut {
+		debug(" -> blob part")
+		runID, _ := strconv.Atoi(m[2])
+		part, _ := strconv.Atoi(m[3])
+		reply(w, r, q.internalPutPart(m[1], runID, part, m[4], data, r))
+		return
+	}
+
 	// PUT  /internal/task/<taskId>/runs/<runId>/artifacts/<name>
 	if m := patternArtifactPutURL.FindStringSubmatch(p); len(m) > 0 && r.Method == http.MethodPut {
 		debug(" -> s3/azure")
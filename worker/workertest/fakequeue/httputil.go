@@ -36,12 +36,19 @@ type rawResponse struct {
 	Payload         []byte
 }
 
+type etagResponse struct {
+	ETag string
+}
+
 func reply(w http.ResponseWriter, r *http.Request, result interface{}) {
 	if rr, ok := result.(rawResponse); ok {
 		w.Header().Set("Content-Type", rr.ContentType)
 		w.Header().Set("Content-Encoding", rr.ContentEncoding)
 		w.WriteHeader(rr.StatusCode)
 		w.Write(rr.Payload)
+	} else if er, ok := result.(etagResponse); ok {
+		w.Header().Set("ETag", er.ETag)
+		w.WriteHeader(http.StatusOK)
 	} else if rd, ok := result.(redirectResponse); ok {
 		http.Redirect(w, r, rd.Location, rd.StatusCode)
 	} else if e, ok := result.(restError); ok {